@@ -0,0 +1,71 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/open-source-firmware/go-tcg-storage/cmd/internal/sedcli"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/locking"
+)
+
+// applyCmd is the struct for the apply cmd required by kong command line parser
+type applyCmd struct {
+	deviceSelection `embed:""`
+	Profile         string `arg:"" required:"" type:"existingfile" help:"Device profile (YAML or JSON) describing the desired state"`
+	Check           bool   `flag:"" help:"Only report where the device differs from the profile, fail if it does"`
+}
+
+func (a *applyCmd) Run(ctx *context) error {
+	f, err := os.Open(a.Profile)
+	if err != nil {
+		return err
+	}
+	p, err := sedcli.LoadProfile(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	return a.run(func(device string, w io.Writer) error {
+		return a.apply(device, w, p)
+	})
+}
+
+func (a *applyCmd) apply(device string, w io.Writer, p *sedcli.Profile) error {
+	coreObj, err := sedcli.NewCore(device)
+	if err != nil {
+		return fmt.Errorf("NewCore(%s) failed: %v", device, err)
+	}
+	defer coreObj.Close()
+	pp, err := p.ProvisionProfile(coreObj)
+	if err != nil {
+		return err
+	}
+
+	var opts []locking.InitializeOpt
+	if a.Check {
+		opts = append(opts, locking.WithReadOnly())
+	}
+	changes, err := locking.Provision(coreObj, pp, opts...)
+	for _, c := range changes {
+		if a.Check {
+			fmt.Fprintf(w, "drift: %s\n", c)
+		} else {
+			fmt.Fprintf(w, "changed: %s\n", c)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("Provision() failed: %v", err)
+	}
+	if a.Check && len(changes) > 0 {
+		return fmt.Errorf("%s does not match the profile", device)
+	}
+	if len(changes) == 0 {
+		fmt.Fprintf(w, "%s matches the profile\n", device)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/open-source-firmware/go-tcg-storage/cmd/internal/sedcli"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive"
+)
+
+// attestCmd is the struct for the attest cmd required by kong command line parser
+type attestCmd struct {
+	Device string   `flag:"" required:"" short:"d" help:"Path to SED device (e.g. /dev/nvme0)"`
+	CA     []string `flag:"" optional:"" name:"ca" type:"existingfile" help:"PEM file with trusted TCG or vendor CA certificates, can be repeated"`
+}
+
+func (a *attestCmd) Run(ctx *context) error {
+	coreObj, err := sedcli.NewCore(a.Device)
+	if err != nil {
+		return fmt.Errorf("NewCore(%s) failed: %v", a.Device, err)
+	}
+	defer coreObj.Close()
+
+	chain, err := drive.Certificate(coreObj.DriveIntf)
+	if err != nil {
+		return fmt.Errorf("reading the drive certificate failed: %v", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	for i, c := range chain {
+		printCertificate(w, i, c)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	var roots *x509.CertPool
+	if len(a.CA) > 0 {
+		if roots, err = drive.LoadCertPool(a.CA...); err != nil {
+			return fmt.Errorf("loading CA certificates failed: %v", err)
+		}
+	}
+	if err := drive.VerifyCertificate(chain, roots, time.Now()); err != nil {
+		return err
+	}
+	if roots == nil {
+		fmt.Println("Certificates are valid, the chain was not verified as no --ca was given")
+	} else {
+		fmt.Println("Certificate chain verified")
+	}
+	return nil
+}
+
+func printCertificate(w *tabwriter.Writer, i int, c *x509.Certificate) {
+	fp := sha256.Sum256(c.Raw)
+	fmt.Fprintf(w, "Certificate %d:\n", i)
+	fmt.Fprintf(w, "  Subject:\t%s\n", c.Subject)
+	fmt.Fprintf(w, "  Issuer:\t%s\n", c.Issuer)
+	fmt.Fprintf(w, "  Serial:\t%s\n", c.SerialNumber)
+	fmt.Fprintf(w, "  Valid:\t%s to %s\n", c.NotBefore.Format(time.RFC3339), c.NotAfter.Format(time.RFC3339))
+	fmt.Fprintf(w, "  SHA-256:\t%x\n", fp)
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/open-source-firmware/go-tcg-storage/cmd/internal/sedcli"
+)
+
+// deviceSelection are the flags of commands that can operate on several
+// devices at once.
+type deviceSelection struct {
+	Device   []string `flag:"" optional:"" short:"d" help:"Path to SED device (e.g. /dev/nvme0), repeatable"`
+	All      bool     `flag:"" optional:"" help:"Operate on all devices supporting TCG Storage"`
+	Include  []string `flag:"" optional:"" help:"With --all, only use devices whose path or name matches the glob (repeatable)"`
+	Exclude  []string `flag:"" optional:"" help:"With --all, skip devices whose path or name matches the glob (repeatable)"`
+	Parallel int      `flag:"" default:"4" help:"Number of devices to operate on concurrently"`
+}
+
+func (d *deviceSelection) devices() ([]string, error) {
+	if d.All && len(d.Device) > 0 {
+		return nil, fmt.Errorf("--device and --all cannot be combined")
+	}
+	if !d.All {
+		if len(d.Device) == 0 {
+			return nil, fmt.Errorf("either --device or --all is required")
+		}
+		if len(d.Include) > 0 || len(d.Exclude) > 0 {
+			return nil, fmt.Errorf("--include and --exclude require --all")
+		}
+		return d.Device, nil
+	}
+	devs, err := sedcli.FindDevices(d.Include, d.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	if len(devs) == 0 {
+		return nil, fmt.Errorf("no device supporting TCG Storage found")
+	}
+	return devs, nil
+}
+
+// run calls fn for every selected device. A single device given with
+// --device writes to stdout directly; otherwise the devices are processed
+// concurrently and their output is printed per device, followed by the
+// devices that failed.
+func (d *deviceSelection) run(fn func(device string, w io.Writer) error) error {
+	devs, err := d.devices()
+	if err != nil {
+		return err
+	}
+	if !d.All && len(devs) == 1 {
+		return fn(devs[0], os.Stdout)
+	}
+	return sedcli.ReportBatch(os.Stdout, sedcli.RunBatch(devs, d.Parallel, fn))
+}
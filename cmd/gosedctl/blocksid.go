@@ -0,0 +1,66 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/open-source-firmware/go-tcg-storage/cmd/internal/sedcli"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+)
+
+// blockSIDCmd is the struct for the block-sid cmd required by kong command line parser
+type blockSIDCmd struct {
+	Device  string `flag:"" required:"" short:"d" help:"Path to SED device (e.g. /dev/nvme0)"`
+	HWReset bool   `flag:"" optional:"" name:"hw-reset" help:"Clear the Block SID state on hardware reset as well, not only on power cycle"`
+}
+
+// freezeLockCmd is the struct for the freeze-lock cmd required by kong command line parser
+type freezeLockCmd struct {
+	Device  string `flag:"" required:"" short:"d" help:"Path to SED device (e.g. /dev/nvme0)"`
+	HWReset bool   `flag:"" optional:"" name:"hw-reset" help:"Clear the Block SID state on hardware reset as well, not only on power cycle"`
+}
+
+func (b *blockSIDCmd) Run(ctx *context) error {
+	return issueBlockSID(b.Device, b.HWReset, false)
+}
+
+func (f *freezeLockCmd) Run(ctx *context) error {
+	return issueBlockSID(f.Device, f.HWReset, true)
+}
+
+// issueBlockSID sends the Block SID Authentication command and prints the
+// resulting state of the Block SID feature.
+func issueBlockSID(device string, hwReset bool, freeze bool) error {
+	coreObj, err := sedcli.NewCore(device)
+	if err != nil {
+		return fmt.Errorf("NewCore(%s) failed: %v", device, err)
+	}
+	defer coreObj.Close()
+
+	b := coreObj.DiskInfo.Level0Discovery.BlockSID
+	if b == nil {
+		return fmt.Errorf("device does not support the Block SID Authentication feature")
+	}
+	if freeze && !b.LockingSPFreezeLockSupported {
+		return fmt.Errorf("device does not support freezing the Locking SP")
+	}
+	if err := core.BlockSID(coreObj.DriveIntf, hwReset, freeze); err != nil {
+		return fmt.Errorf("BlockSID() failed: %v", err)
+	}
+	if err := coreObj.Discovery0(); err != nil {
+		return fmt.Errorf("Discovery0() failed: %v", err)
+	}
+	b = coreObj.DiskInfo.Level0Discovery.BlockSID
+	if b == nil {
+		return fmt.Errorf("device no longer reports the Block SID Authentication feature")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	printBlockSIDStatus(w, newBlockSIDStatus(b))
+	fmt.Fprintf(w, "Clear on hardware reset:\t%s\n", yesNo(b.HardwareReset))
+	return w.Flush()
+}
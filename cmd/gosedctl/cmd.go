@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/open-source-firmware/go-tcg-storage/cmd/internal/clidoc"
+	"github.com/open-source-firmware/go-tcg-storage/cmd/internal/sedcli"
 	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
 	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
 	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
@@ -17,37 +19,44 @@ type context struct{}
 
 // initialSetupCmd is the struct for the initial-setup cmd required by kong command line parser
 type initialSetupCmd struct {
-	Device   string `flag:"" required:"" short:"d"  help:"Path to SED device (e.g. /dev/nvme0)"`
-	Password string `flag:"" optional:"" short:"p"`
+	sedcli.DryRunFlag `embed:""`
+	Device            string `flag:"" required:"" short:"d"  help:"Path to SED device (e.g. /dev/nvme0)"`
+	Password          string `flag:"" optional:"" short:"p"`
 }
 
 type loadPBAImageCmd struct {
-	Device   string `flag:"" required:"" short:"d"  help:"Path to SED device (e.g. /dev/nvme0)"`
-	Password string `flag:"" required:"" short:"p"`
-	Path     string `flag:"" required:"" short:"i" help:"Path to PBA image"`
+	sedcli.DryRunFlag `embed:""`
+	Device            string `flag:"" required:"" short:"d"  help:"Path to SED device (e.g. /dev/nvme0)"`
+	Password          string `flag:"" required:"" short:"p"`
+	Path              string `flag:"" required:"" short:"i" help:"Path to PBA image"`
 }
 
 type revertTPerCmd struct {
-	Device   string `flag:"" required:"" short:"d"  help:"Path to SED device (e.g. /dev/nvme0)"`
-	Password string `flag:"" required:"" short:"p"`
+	sedcli.DryRunFlag `embed:""`
+	Device            string `flag:"" required:"" short:"d"  help:"Path to SED device (e.g. /dev/nvme0)"`
+	Password          string `flag:"" required:"" short:"p"`
 }
 
 type revertNoeraseCmd struct {
-	Device   string `flag:"" required:"" short:"d"  help:"Path to SED device (e.g. /dev/nvme0)"`
-	Password string `flag:"" required:"" short:"p"`
+	sedcli.DryRunFlag `embed:""`
+	Device            string `flag:"" required:"" short:"d"  help:"Path to SED device (e.g. /dev/nvme0)"`
+	Password          string `flag:"" required:"" short:"p"`
+	User              string `flag:"" optional:"" short:"u" default:"Admin1" help:"Admin authority of the Locking SP to authenticate as"`
 }
 
 type initialSetupEnterpriseCmd struct {
-	Device        string `flag:"" required:"" short:"d" help:"Path to SED device (e.g. /dev/nvme0)"`
-	SIDPassword   string `flag:"" required:"" short:"p" help:"New password for SID authority"`
-	BandMaster0PW string `flag:"" required:"" short:"b" help:"Password for BandMaster0 authority for configuration, lock and unlock operations."`
-	EraseMasterPW string `flag:"" required:"" short:"e" help:"Password for EraseMaster authority for erase operations of ranges."`
+	sedcli.DryRunFlag `embed:""`
+	Device            string `flag:"" required:"" short:"d" help:"Path to SED device (e.g. /dev/nvme0)"`
+	SIDPassword       string `flag:"" required:"" short:"p" help:"New password for SID authority"`
+	BandMaster0PW     string `flag:"" required:"" short:"b" help:"Password for BandMaster0 authority for configuration, lock and unlock operations."`
+	EraseMasterPW     string `flag:"" required:"" short:"e" help:"Password for EraseMaster authority for erase operations of ranges."`
 }
 
 type resetDeviceEnterprise struct {
-	Device        string `flag:"" required:"" short:"d" help:"Path to SED device (e.g. /dev/nvme0)"`
-	SIDPassword   string `flag:"" required:"" short:"p" help:"Password to SID authority"`
-	ErasePassword string `flag:"" required:"" short:"e" help:"Password to authenticate as EaseMaster"`
+	sedcli.DryRunFlag `embed:""`
+	Device            string `flag:"" required:"" short:"d" help:"Path to SED device (e.g. /dev/nvme0)"`
+	SIDPassword       string `flag:"" required:"" short:"p" help:"Password to SID authority"`
+	ErasePassword     string `flag:"" required:"" short:"e" help:"Password to authenticate as EaseMaster"`
 }
 
 type unlockEnterprise struct {
@@ -62,20 +71,59 @@ type resetSIDcmd struct {
 
 // cli is the main command line interface struct required by kong command line parser
 var cli struct {
-	InitialSetup           initialSetupCmd           `cmd:"" help:"Take ownership of a given OPAL SSC device"`
-	LoadPBA                loadPBAImageCmd           `cmd:"" help:"Load PBA image to shadow MBR"`
-	RevertNoerase          revertNoeraseCmd          `cmd:"" help:""`
-	RevertTper             revertTPerCmd             `cmd:"" help:""`
-	InitialSetupEnterprise initialSetupEnterpriseCmd `cmd:"" help:"Take ownership of a given Enterprise SSC device"`
-	RevertEnterprise       resetDeviceEnterprise     `cmd:"" help:"delete after use"`
-	UnlockEnterprise       unlockEnterprise          `cmd:"" help:"Unlocks global range with BandMaster0"`
-	ResetSID               resetSIDcmd               `cmd:"" help:"Resets the SID PIN to MSID"`
+	HelpMan clidoc.ManFlag `flag:"" name:"help-man" help:"Print the man page and exit"`
+
+	sedcli.TraceFlags `embed:""`
+
+	InitialSetup           initialSetupCmd           `cmd:"" group:"Setup" help:"Take ownership of a given OPAL SSC device"`
+	InitialSetupSum        initialSetupSUMCmd        `cmd:"" group:"Setup" help:"Take ownership of a given OPAL SSC device in Single User Mode"`
+	InitialSetupEnterprise initialSetupEnterpriseCmd `cmd:"" group:"Setup" help:"Take ownership of a given Enterprise SSC device"`
+	Apply                  applyCmd                  `cmd:"" group:"Setup" help:"Provisions or converges an OPAL SSC device to the state declared in a profile"`
+	GenerateSystemd        generateSystemdCmd        `cmd:"" group:"Setup" help:"Generates systemd units unlocking devices with sedunlock at boot"`
+
+	List             listCmd          `cmd:"" group:"Locking" help:"List all ranges"`
+	Lock             lockCmd          `cmd:"" group:"Locking" help:"Locks the global range or a given range"`
+	Unlock           unlockCmd        `cmd:"" group:"Locking" help:"Unlocks the global range or a given range"`
+	LockAll          lockAllCmd       `cmd:"" group:"Locking" help:"Locks all ranges completely"`
+	UnlockAll        unlockAllCmd     `cmd:"" group:"Locking" help:"Unlocks all ranges completely"`
+	CreateRange      createRangeCmd   `cmd:"" group:"Locking" help:"Configures an unused range to cover the given area"`
+	DeleteRange      deleteRangeCmd   `cmd:"" group:"Locking" help:"Resets a range to its unconfigured defaults"`
+	Erase            eraseCmd         `cmd:"" group:"Locking" help:"Cryptographically erases a range (DESTROYS DATA)"`
+	UnlockEnterprise unlockEnterprise `cmd:"" group:"Locking" help:"Unlocks global range with BandMaster0"`
+
+	LoadPBA   loadPBAImageCmd `cmd:"" group:"MBR" help:"Load PBA image to shadow MBR"`
+	WriteMbr  writeMBRCmd     `cmd:"" group:"MBR" help:"Writes a PBA image to the MBR area with progress and verification"`
+	ReadMbr   readMBRCmd      `cmd:"" group:"MBR" help:"Prints the binary data in the MBR area"`
+	VerifyPba verifyPBACmd    `cmd:"" group:"MBR" help:"Validates a PBA image and compares it to the MBR area"`
+	MbrDone   mbrDoneCmd      `cmd:"" group:"MBR" help:"Sets the MBRDone property (hide/show Shadow MBR)"`
+	MbrStatus mbrStatusCmd    `cmd:"" group:"MBR" help:"Shows the MBRControl settings (Enable, Done, DoneOnReset)"`
+
+	AddUser        addUserCmd        `cmd:"" group:"Users" help:"Enables a user, sets its password and grants it access to ranges"`
+	EnableUser     enableUserCmd     `cmd:"" group:"Users" help:"Enables or disables a user of the Locking SP"`
+	ChangePassword changePasswordCmd `cmd:"" group:"Users" help:"Changes the password of SID, Admin, User, BandMaster or EraseMaster authorities"`
+	ResetSID       resetSIDcmd       `cmd:"" group:"Users" help:"Resets the SID PIN to MSID"`
+
+	RevertNoerase    revertNoeraseCmd      `cmd:"" group:"Revert" help:"Reverts the Locking SP, keeping the data"`
+	RevertTper       revertTPerCmd         `cmd:"" group:"Revert" help:"Reverts the TPer to factory state (DESTROYS DATA)"`
+	RevertEnterprise resetDeviceEnterprise `cmd:"" group:"Revert" help:"Reverts an Enterprise SSC device to factory state (DESTROYS DATA)"`
+	DataRemoval      dataRemovalCmd        `cmd:"" group:"Revert" help:"Lists, starts and monitors data removal on Pyrite and Opalite drives"`
+
+	Status     statusCmd     `cmd:"" group:"Diagnostics" help:"Shows identity, SSC and locking state of a device"`
+	Comid      comIDCmd      `cmd:"" group:"Diagnostics" help:"Shows the ComID state and optionally resets the protocol stack of a wedged drive"`
+	BlockSid   blockSIDCmd   `cmd:"" group:"Diagnostics" help:"Blocks SID authentication until the next power cycle"`
+	FreezeLock freezeLockCmd `cmd:"" group:"Diagnostics" help:"Blocks SID authentication and freezes the Locking SP until the next power cycle"`
+	Attest     attestCmd     `cmd:"" group:"Diagnostics" help:"Prints and verifies the certificate chain of the TPer"`
+	Msid       msidCmd       `cmd:"" group:"Diagnostics" help:"Prints the MSID PIN byte-exact as hex or base64"`
+
+	Vendor vendorCmd `cmd:"" group:"Vendor" help:"Vendor specific commands"`
+
+	Completion clidoc.CompletionCmd `cmd:"" help:"Prints shell completion scripts"`
 }
 
 // Run executes when the initial-setup command is invoked
 func (t *initialSetupCmd) Run(ctx *context) error {
-	fmt.Printf("Open device: %s", t.Device)
-	coreObj, err := core.NewCore(t.Device)
+	fmt.Printf("Open device: %s\n", t.Device)
+	coreObj, err := sedcli.NewCore(t.Device)
 	if err != nil {
 		return fmt.Errorf("NewCore(%s) failed: %v", t.Device, err)
 	}
@@ -109,6 +157,26 @@ func (t *initialSetupCmd) Run(ctx *context) error {
 	if err := table.ThisSP_Authenticate(adminSession, uid.AuthoritySID, msid); err != nil {
 		return fmt.Errorf("ThisSp_Authenticate failed: %v", err)
 	}
+	// Check the LockingSP before changing anything, so that an unsuitable
+	// device is not left half configured.
+	lcs, err := table.Admin_SP_GetLifeCycleState(adminSession, uid.LockingSP)
+	if err != nil {
+		return fmt.Errorf("Admin_SP_GetLifeCycleState() failed: %v", err)
+	}
+	if lcs != table.ManufacturedInactive {
+		return fmt.Errorf("LockingSP Lifecycle state of %s, but require %s", lcs.String(), table.ManufacturedInactive)
+	}
+	if t.DryRun {
+		adminSession.Close()
+		sedcli.PrintDryRun(os.Stdout,
+			"AdminSP: C_PIN_SID.Set PIN",
+			"AdminSP: LockingSP.Activate",
+			"LockingSP: ThisSP.Authenticate as Admin1",
+			"LockingSP: Locking_GlobalRange.Set ReadLockEnabled=false WriteLockEnabled=false",
+			"LockingSP: MBRControl.Set Done=true",
+			"LockingSP: MBRControl.Set Enable=true")
+		return nil
+	}
 	fmt.Println("Set new password")
 	// Set the new SID password. Password needs to be hashed.
 	// The used algorithm is the same as used in DriveTrustAlliance implementation of sedutil-cli
@@ -125,13 +193,6 @@ func (t *initialSetupCmd) Run(ctx *context) error {
 
 	fmt.Println("Activate LockingSP")
 	// Activate LockingSP
-	lcs, err := table.Admin_SP_GetLifeCycleState(adminSession, uid.LockingSP)
-	if err != nil {
-		return fmt.Errorf("Admin_SP_GetLifeCycleState() failed: %v", err)
-	}
-	if lcs != table.ManufacturedInactive {
-		return fmt.Errorf("LockingSP Lifecycle state of %s, but require %s", lcs.String(), table.ManufacturedInactive)
-	}
 	if err := table.LockingSPActivate(adminSession); err != nil {
 		return fmt.Errorf("LockingSPActivate() failed: %v", err)
 	}
@@ -182,7 +243,7 @@ func (l *loadPBAImageCmd) Run(ctx *context) error {
 		return fmt.Errorf("empty password not allowed")
 	}
 
-	coreObj, err := core.NewCore(l.Device)
+	coreObj, err := sedcli.NewCore(l.Device)
 	if err != nil {
 		return fmt.Errorf("NewCore() failed: %v", err)
 	}
@@ -212,6 +273,21 @@ func (l *loadPBAImageCmd) Run(ctx *context) error {
 	if err := table.ThisSP_Authenticate(lockingSession, uid.LockingAuthorityAdmin1, pwhash); err != nil {
 		return fmt.Errorf("authenticating as Admin1 failed: %v", err)
 	}
+	mbi, err := table.MBR_TableInfo(lockingSession)
+	if err != nil {
+		return fmt.Errorf("MBR_TableInfo() failed: %v", err)
+	}
+	info, err := table.ValidatePBAImage(img, mbi)
+	if err != nil {
+		return err
+	}
+	for _, warn := range info.Warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warn)
+	}
+	if l.DryRun {
+		sedcli.PrintDryRun(os.Stdout, fmt.Sprintf("LockingSP: MBR.Set %d bytes at offset 0", len(img)))
+		return nil
+	}
 	if err := table.LoadPBAImage(lockingSession, img); err != nil {
 		return fmt.Errorf("LoadPBAImage() failed: %v", err)
 	}
@@ -224,11 +300,20 @@ func (r *revertNoeraseCmd) Run(ctx *context) error {
 		return fmt.Errorf("empty password not allowed")
 	}
 
-	coreObj, err := core.NewCore(r.Device)
+	coreObj, err := sedcli.NewCore(r.Device)
 	if err != nil {
 		return fmt.Errorf("NewCore() failed: %v", err)
 	}
 
+	policy, err := newRevertPolicy(coreObj.DiskInfo.Level0Discovery)
+	if err != nil {
+		return err
+	}
+	admin, err := policy.adminAuthority(r.User)
+	if err != nil {
+		return err
+	}
+
 	comID, _, err := core.FindComID(coreObj.DriveIntf, coreObj.DiskInfo.Level0Discovery)
 	if err != nil {
 		return fmt.Errorf("FindComID() failed: %v", err)
@@ -250,22 +335,33 @@ func (r *revertNoeraseCmd) Run(ctx *context) error {
 		return fmt.Errorf("NewSession() to LockingSP failed: %v", err)
 	}
 	defer lockingSession.Close()
-	// Elevate the session to Admin1 with required credentials
-	if err := table.ThisSP_Authenticate(lockingSession, uid.LockingAuthorityAdmin1, pwhash); err != nil {
-		return fmt.Errorf("authenticating as Admin1 failed: %v", err)
+	// Elevate the session to the admin with required credentials
+	if err := table.ThisSP_Authenticate(lockingSession, admin, pwhash); err != nil {
+		return fmt.Errorf("authenticating as %s failed: %v", r.User, err)
 	}
 
-	if err := table.RevertLockingSP(lockingSession, true, pwhash); err != nil {
+	if w := policy.revertSPWarning(); w != "" {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+	if r.DryRun {
+		sedcli.PrintDryRun(os.Stdout, fmt.Sprintf("LockingSP: ThisSP.RevertSP KeepGlobalRangeKey=%v", policy.KeepGlobalRangeKey))
+		return nil
+	}
+	if err := table.RevertLockingSP(lockingSession, policy.KeepGlobalRangeKey, pwhash); err != nil {
 		return fmt.Errorf("RevertLockingSP() failed: %v", err)
 	}
 	return nil
 }
 
 func (r *revertTPerCmd) Run(ctx *context) error {
-	coreObj, err := core.NewCore(r.Device)
+	coreObj, err := sedcli.NewCore(r.Device)
 	if err != nil {
 		return fmt.Errorf("NewCore(%s) failed: %v", r.Device, err)
 	}
+	policy, err := newRevertPolicy(coreObj.DiskInfo.Level0Discovery)
+	if err != nil {
+		return err
+	}
 	comID, _, err := core.FindComID(coreObj.DriveIntf, coreObj.DiskInfo.Level0Discovery)
 	if err != nil {
 		return fmt.Errorf("FindComID() failed: %v", err)
@@ -289,6 +385,16 @@ func (r *revertTPerCmd) Run(ctx *context) error {
 		return fmt.Errorf("authenticating as AdminSP failed: %v", err)
 	}
 
+	if w := policy.revertTPerWarning(); w != "" {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+		if m, err := table.Admin_DataRemovalMechanism_Get(adminSession); err == nil {
+			fmt.Fprintf(os.Stderr, "Active data removal mechanism: %s\n", m)
+		}
+	}
+	if r.DryRun {
+		sedcli.PrintDryRun(os.Stdout, "AdminSP: AdminSP.Revert (ALL DATA WILL BE LOST)")
+		return nil
+	}
 	if err := table.RevertTPer(adminSession); err != nil {
 		return fmt.Errorf("RevertTPer() failed: %v", err)
 	}
@@ -296,7 +402,7 @@ func (r *revertTPerCmd) Run(ctx *context) error {
 }
 
 func (i *initialSetupEnterpriseCmd) Run(ctx *context) error {
-	coreObj, err := core.NewCore(i.Device)
+	coreObj, err := sedcli.NewCore(i.Device)
 	if err != nil {
 		return fmt.Errorf("NewCore(%s) failed: %v", i.Device, err)
 	}
@@ -338,7 +444,12 @@ func (i *initialSetupEnterpriseCmd) Run(ctx *context) error {
 		}
 	}
 
-	if err := table.Admin_C_Pin_SID_SetPIN(adminSession, pwhash); err != nil {
+	// In a dry run all authentications are still done, but the calls that
+	// change the drive are only collected.
+	var planned []string
+	if i.DryRun {
+		planned = append(planned, "AdminSP: C_PIN_SID.Set PIN")
+	} else if err := table.Admin_C_Pin_SID_SetPIN(adminSession, pwhash); err != nil {
 		return fmt.Errorf("Admin_C_PIN_SID_SetPIN() failed: %v", err)
 	}
 
@@ -363,7 +474,9 @@ func (i *initialSetupEnterpriseCmd) Run(ctx *context) error {
 		}
 	}
 
-	if err := table.SetBandMaster0Pin(lockingSession, band0pw); err != nil {
+	if i.DryRun {
+		planned = append(planned, "LockingSP: C_PIN_BandMaster0.Set PIN")
+	} else if err := table.SetBandMaster0Pin(lockingSession, band0pw); err != nil {
 		return fmt.Errorf("failed to set BandMaster0 PIN: %v", err)
 	}
 
@@ -377,6 +490,14 @@ func (i *initialSetupEnterpriseCmd) Run(ctx *context) error {
 		}
 	}
 
+	if i.DryRun {
+		planned = append(planned,
+			"LockingSP: C_PIN_EraseMaster.Set PIN",
+			"LockingSP: Band0.Set ReadLockEnabled=true WriteLockEnabled=true ReadLocked=true WriteLocked=true")
+		sedcli.PrintDryRun(os.Stdout, planned...)
+		return nil
+	}
+
 	if err := table.SetEraseMasterPin(lockingSession, erasePw); err != nil {
 		return fmt.Errorf("failed to set EraseMaster PIN: %v", err)
 	}
@@ -389,7 +510,7 @@ func (i *initialSetupEnterpriseCmd) Run(ctx *context) error {
 }
 
 func (r *resetDeviceEnterprise) Run(ctx *context) error {
-	coreObj, err := core.NewCore(r.Device)
+	coreObj, err := sedcli.NewCore(r.Device)
 	if err != nil {
 		return fmt.Errorf("NewCore(%s) failed: %v", r.Device, err)
 	}
@@ -422,7 +543,12 @@ func (r *resetDeviceEnterprise) Run(ctx *context) error {
 		return fmt.Errorf("authenticating as EraseMaster failed: %v", err)
 	}
 
-	if err := table.EraseBand(lockingSession, uid.InvokingID(uid.Band1Enterprise)); err != nil {
+	// In a dry run all authentications are still done, but the calls that
+	// change the drive are only collected.
+	var planned []string
+	if r.DryRun {
+		planned = append(planned, "LockingSP: Band1.Erase")
+	} else if err := table.EraseBand(lockingSession, uid.InvokingID(uid.Band1Enterprise)); err != nil {
 		return fmt.Errorf("failed to erase global range: %v", err)
 	}
 
@@ -446,7 +572,9 @@ func (r *resetDeviceEnterprise) Run(ctx *context) error {
 		return fmt.Errorf("failed to retrieve MSID: %v", err)
 	}
 
-	if err := table.Admin_C_Pin_SID_SetPIN(adminSession, msid); err != nil {
+	if r.DryRun {
+		planned = append(planned, "AdminSP: C_PIN_SID.Set PIN=MSID")
+	} else if err := table.Admin_C_Pin_SID_SetPIN(adminSession, msid); err != nil {
 		return fmt.Errorf("failed to set AdminSP credential to MSID: %v", err)
 	}
 
@@ -463,6 +591,11 @@ func (r *resetDeviceEnterprise) Run(ctx *context) error {
 		return fmt.Errorf("authenticating as EraseMaster failed: %v", err)
 	}
 
+	if r.DryRun {
+		planned = append(planned, "LockingSP: C_PIN_BandMaster0.Set PIN=MSID")
+		sedcli.PrintDryRun(os.Stdout, planned...)
+		return nil
+	}
 	if err := table.SetBandMaster0Pin(lockingSession, msid); err != nil {
 		return fmt.Errorf("failed to set BandMaster0 Pin to MSID")
 	}
@@ -471,7 +604,7 @@ func (r *resetDeviceEnterprise) Run(ctx *context) error {
 }
 
 func (u *unlockEnterprise) Run(ctx *context) error {
-	coreObj, err := core.NewCore(u.Device)
+	coreObj, err := sedcli.NewCore(u.Device)
 	if err != nil {
 		return fmt.Errorf("NewCore(%s) failed: %v", u.Device, err)
 	}
@@ -513,7 +646,7 @@ func (u *unlockEnterprise) Run(ctx *context) error {
 }
 
 func (r *resetSIDcmd) Run(ctx *context) error {
-	coreObj, err := core.NewCore(r.Device)
+	coreObj, err := sedcli.NewCore(r.Device)
 	if err != nil {
 		return fmt.Errorf("NewCore(%s) failed: %v", r.Device, err)
 	}
@@ -0,0 +1,61 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/open-source-firmware/go-tcg-storage/cmd/internal/sedcli"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+)
+
+// comIDCmd is the struct for the comid cmd required by kong command line parser
+type comIDCmd struct {
+	Device string `flag:"" required:"" short:"d" help:"Path to SED device (e.g. /dev/nvme0)"`
+	ComID  int    `flag:"" optional:"" name:"comid" help:"ComID to inspect, defaults to the one used for sessions"`
+	Reset  bool   `flag:"" optional:"" help:"Issue a STACK_RESET on the ComID, aborting all its sessions"`
+}
+
+func (c *comIDCmd) Run(ctx *context) error {
+	coreObj, err := sedcli.NewCore(c.Device)
+	if err != nil {
+		return fmt.Errorf("NewCore(%s) failed: %v", c.Device, err)
+	}
+	defer coreObj.Close()
+
+	comID, proto, err := core.FindComID(coreObj.DriveIntf, coreObj.DiskInfo.Level0Discovery)
+	if err != nil {
+		return fmt.Errorf("FindComID() failed: %v", err)
+	}
+	fmt.Printf("Protocol level:  %s\n", proto.String())
+	fmt.Printf("Session ComID:   0x%04x\n", int(comID))
+	if dyn, err := core.GetComID(coreObj.DriveIntf); err != nil {
+		fmt.Printf("Dynamic ComID:   not available (%v)\n", err)
+	} else {
+		fmt.Printf("Dynamic ComID:   0x%04x\n", int(dyn))
+	}
+	if c.ComID != 0 {
+		comID = core.ComID(c.ComID)
+	}
+
+	state, err := core.GetComIDState(coreObj.DriveIntf, comID)
+	if err != nil {
+		return fmt.Errorf("GetComIDState(0x%04x) failed: %v", int(comID), err)
+	}
+	fmt.Printf("ComID 0x%04x state: %s\n", int(comID), state)
+	if !c.Reset {
+		return nil
+	}
+
+	if err := core.StackReset(coreObj.DriveIntf, comID); err != nil {
+		return fmt.Errorf("StackReset(0x%04x) failed: %v", int(comID), err)
+	}
+	after, err := core.GetComIDState(coreObj.DriveIntf, comID)
+	if err != nil {
+		return fmt.Errorf("GetComIDState(0x%04x) failed: %v", int(comID), err)
+	}
+	fmt.Printf("ComID 0x%04x state after STACK_RESET: %s -> %s\n", int(comID), state, after)
+	return nil
+}
@@ -0,0 +1,183 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/open-source-firmware/go-tcg-storage/cmd/internal/sedcli"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/feature"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+// dataRemovalCmd groups the data-removal sub-commands required by kong command line parser
+type dataRemovalCmd struct {
+	List   dataRemovalListCmd   `cmd:"" help:"Lists the supported data removal mechanisms"`
+	Start  dataRemovalStartCmd  `cmd:"" help:"Selects a data removal mechanism and reverts the TPer to remove all data"`
+	Status dataRemovalStatusCmd `cmd:"" help:"Shows whether a data removal operation is in progress"`
+}
+
+type dataRemovalListCmd struct {
+	Device string `flag:"" required:"" short:"d" help:"Path to SED device (e.g. /dev/nvme0)"`
+}
+
+type dataRemovalStartCmd struct {
+	Device    string `flag:"" required:"" short:"d" help:"Path to SED device (e.g. /dev/nvme0)"`
+	Password  string `flag:"" required:"" short:"p" help:"Password of the SID authority"`
+	Mechanism string `flag:"" required:"" short:"m" enum:"overwrite,block-erase,crypto-erase,unmap,reset-write-pointers,vendor-specific" help:"Data removal mechanism; one of [overwrite, block-erase, crypto-erase, unmap, reset-write-pointers, vendor-specific]"`
+	Wait      bool   `flag:"" optional:"" short:"w" help:"Wait for the data removal to complete"`
+}
+
+type dataRemovalStatusCmd struct {
+	Device string `flag:"" required:"" short:"d" help:"Path to SED device (e.g. /dev/nvme0)"`
+	Wait   bool   `flag:"" optional:"" short:"w" help:"Wait for the data removal to complete"`
+}
+
+// dataRemovalPollInterval is the time between two Level 0 discoveries while
+// waiting for a data removal operation to complete.
+const dataRemovalPollInterval = 5 * time.Second
+
+func openDataRemoval(device string) (*core.Core, error) {
+	coreObj, err := sedcli.NewCore(device)
+	if err != nil {
+		return nil, fmt.Errorf("NewCore(%s) failed: %v", device, err)
+	}
+	if coreObj.DiskInfo.Level0Discovery.DataRemoval == nil {
+		coreObj.Close()
+		return nil, fmt.Errorf("device does not support the Data Removal Mechanism feature")
+	}
+	return coreObj, nil
+}
+
+func (l *dataRemovalListCmd) Run(ctx *context) error {
+	coreObj, err := openDataRemoval(l.Device)
+	if err != nil {
+		return err
+	}
+	defer coreObj.Close()
+
+	// The active mechanism is readable by Anybody, but do not fail the
+	// listing if the drive disagrees.
+	active := feature.DataRemovalMechanism(0xff)
+	if comID, _, err := core.FindComID(coreObj.DriveIntf, coreObj.DiskInfo.Level0Discovery); err == nil {
+		if cs, err := core.NewControlSession(coreObj.DriveIntf, coreObj.Level0Discovery, core.WithComID(comID)); err == nil {
+			defer cs.Close()
+			if s, err := cs.NewSession(uid.AdminSP); err == nil {
+				if m, err := table.Admin_DataRemovalMechanism_Get(s); err == nil {
+					active = m
+				}
+				s.Close()
+			}
+		}
+	}
+
+	dr := coreObj.DiskInfo.Level0Discovery.DataRemoval
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Mechanism\tTime\tActive")
+	for _, m := range dr.Mechanisms() {
+		t := "unknown"
+		if d := dr.Time(m); d > 0 {
+			t = d.String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", m, t, yesNo(m == active))
+	}
+	return w.Flush()
+}
+
+func (s *dataRemovalStartCmd) Run(ctx *context) error {
+	m, _ := feature.DataRemovalMechanismFromName(s.Mechanism)
+	coreObj, err := openDataRemoval(s.Device)
+	if err != nil {
+		return err
+	}
+	defer coreObj.Close()
+
+	if coreObj.DiskInfo.Level0Discovery.DataRemoval.SupportedMechanisms&(1<<m) == 0 {
+		return fmt.Errorf("data removal mechanism %s is not supported by the device", m)
+	}
+	pwhash, err := sedcli.HashPassword(coreObj, s.Password, sedcli.HashSedutil)
+	if err != nil {
+		return err
+	}
+	comID, _, err := core.FindComID(coreObj.DriveIntf, coreObj.DiskInfo.Level0Discovery)
+	if err != nil {
+		return fmt.Errorf("FindComID() failed: %v", err)
+	}
+	cs, err := core.NewControlSession(coreObj.DriveIntf, coreObj.Level0Discovery, core.WithComID(comID))
+	if err != nil {
+		return fmt.Errorf("NewControllSession() failed: %v", err)
+	}
+	defer cs.Close()
+	adminSession, err := cs.NewSession(uid.AdminSP)
+	if err != nil {
+		return fmt.Errorf("cs.NewSession() failed: %v", err)
+	}
+	if err := table.ThisSP_Authenticate(adminSession, uid.AuthoritySID, pwhash); err != nil {
+		adminSession.Close()
+		return fmt.Errorf("authenticating as SID failed: %v", err)
+	}
+	if err := table.Admin_DataRemovalMechanism_Set(adminSession, m); err != nil {
+		adminSession.Close()
+		return fmt.Errorf("Admin_DataRemovalMechanism_Set() failed: %v", err)
+	}
+	// Revert terminates the session on success
+	if err := table.RevertTPer(adminSession); err != nil {
+		adminSession.Close()
+		return fmt.Errorf("RevertTPer() failed: %v", err)
+	}
+	fmt.Printf("Data removal using %s started\n", m)
+	if !s.Wait {
+		return nil
+	}
+	return waitDataRemoval(coreObj)
+}
+
+func (s *dataRemovalStatusCmd) Run(ctx *context) error {
+	coreObj, err := openDataRemoval(s.Device)
+	if err != nil {
+		return err
+	}
+	defer coreObj.Close()
+
+	if s.Wait {
+		return waitDataRemoval(coreObj)
+	}
+	dr := coreObj.DiskInfo.Level0Discovery.DataRemoval
+	fmt.Printf("Processing: %s\n", yesNo(dr.OperationProcessing))
+	fmt.Printf("Interrupted: %s\n", yesNo(dr.OperationInterrupted))
+	return nil
+}
+
+// waitDataRemoval polls the Level 0 discovery until the drive no longer
+// reports a data removal operation in progress.
+func waitDataRemoval(coreObj *core.Core) error {
+	start := time.Now()
+	for polled := false; ; polled = true {
+		if err := coreObj.Discovery0(); err != nil {
+			return fmt.Errorf("Discovery0() failed: %v", err)
+		}
+		dr := coreObj.DiskInfo.Level0Discovery.DataRemoval
+		if dr == nil {
+			return fmt.Errorf("device no longer reports the Data Removal Mechanism feature")
+		}
+		if polled && (dr.OperationInterrupted || !dr.OperationProcessing) {
+			fmt.Fprintln(os.Stderr)
+		}
+		if dr.OperationInterrupted {
+			return fmt.Errorf("data removal was interrupted, revert again to resume")
+		}
+		if !dr.OperationProcessing {
+			fmt.Printf("Data removal completed after %s\n", time.Since(start).Round(time.Second))
+			return nil
+		}
+		fmt.Fprintf(os.Stderr, "\rData removal in progress (%s)", time.Since(start).Round(time.Second))
+		time.Sleep(dataRemovalPollInterval)
+	}
+}
@@ -0,0 +1,179 @@
+//go:build sim
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/kong"
+	"github.com/open-source-firmware/go-tcg-storage/cmd/internal/sedcli"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/locking"
+)
+
+// Run gosedctl with the given arguments.
+func gosedctl(t *testing.T, args ...string) error {
+	t.Helper()
+	t.Logf("gosedctl %v", args)
+	parser, err := kong.New(&cli, kong.Name(programName), kong.Exit(func(int) { t.Fatalf("gosedctl exited") }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, err := parser.Parse(args)
+	if err != nil {
+		t.Fatalf("parsing %v failed: %v", args, err)
+	}
+	return ctx.Run(&context{})
+}
+
+// The state of the global range and the shadow MBR as seen by Admin1.
+func globalRange(t *testing.T, device string, password string) (*locking.Range, bool) {
+	t.Helper()
+	s, err := sedcli.Open(sedcli.Options{Device: device, Password: password, ReadOnly: true})
+	if err != nil {
+		t.Fatalf("sedcli.Open() failed: %v", err)
+	}
+	defer s.Close()
+	return s.Locking.GlobalRange, s.Locking.MBRDone
+}
+
+func TestEndToEnd(t *testing.T) {
+	dev := "sim:" + filepath.Join(t.TempDir(), "drive.json")
+	const password = "correct horse battery staple"
+
+	for i := 0; i < 2; i++ {
+		if err := gosedctl(t, "initial-setup", "-d", dev, "-p", password); err != nil {
+			t.Fatalf("initial-setup failed: %v", err)
+		}
+		if err := gosedctl(t, "initial-setup", "-d", dev, "-p", password); err == nil {
+			t.Errorf("initial-setup of an owned drive succeeded")
+		}
+
+		// sedutil-cli would have set up the drive the same way
+		o := sedcli.Options{Device: dev, Password: password}
+		if s, err := sedcli.OpenSedutil(&o); err != nil {
+			t.Errorf("OpenSedutil() failed: %v", err)
+		} else {
+			s.Close()
+			if o.Hash != sedcli.HashSedutil {
+				t.Errorf("OpenSedutil() detected hash %q, want %q", o.Hash, sedcli.HashSedutil)
+			}
+		}
+		o = sedcli.Options{Device: dev, Password: "wrong password"}
+		if _, err := sedcli.OpenSedutil(&o); !errors.Is(err, table.ErrAuthenticationFailed) {
+			t.Errorf("OpenSedutil() with a wrong password = %v, want ErrAuthenticationFailed", err)
+		}
+
+		if err := gosedctl(t, "lock", "-d", dev, "-p", password); err != nil {
+			t.Fatalf("lock failed: %v", err)
+		}
+		if r, done := globalRange(t, dev, password); !r.ReadLocked || !r.WriteLocked || done {
+			t.Errorf("after lock: ReadLocked=%v WriteLocked=%v MBRDone=%v", r.ReadLocked, r.WriteLocked, done)
+		}
+		if err := gosedctl(t, "unlock", "-d", dev, "-p", "wrong password"); err == nil {
+			t.Errorf("unlock with a wrong password succeeded")
+		}
+		if err := gosedctl(t, "unlock", "-d", dev, "-p", password, "--verify"); err != nil {
+			t.Fatalf("unlock failed: %v", err)
+		}
+		if r, done := globalRange(t, dev, password); r.ReadLocked || r.WriteLocked || !done {
+			t.Errorf("after unlock: ReadLocked=%v WriteLocked=%v MBRDone=%v", r.ReadLocked, r.WriteLocked, done)
+		}
+
+		// The hashed password given byte-exact as PIN
+		coreObj, err := sedcli.NewCore(dev)
+		if err != nil {
+			t.Fatalf("NewCore() failed: %v", err)
+		}
+		pin, err := sedcli.HashPassword(coreObj, password, sedcli.HashSedutil)
+		coreObj.Close()
+		if err != nil {
+			t.Fatalf("HashPassword() failed: %v", err)
+		}
+		if err := gosedctl(t, "lock", "-d", dev, "--password-hex", hex.EncodeToString(pin)); err != nil {
+			t.Fatalf("lock with --password-hex failed: %v", err)
+		}
+		if r, _ := globalRange(t, dev, password); !r.ReadLocked || !r.WriteLocked {
+			t.Errorf("after lock with --password-hex: ReadLocked=%v WriteLocked=%v", r.ReadLocked, r.WriteLocked)
+		}
+
+		if err := gosedctl(t, "revert-tper", "-d", dev, "-p", "wrong password"); err == nil {
+			t.Errorf("revert-tper with a wrong password succeeded")
+		}
+		// After the revert the drive can be set up again
+		if err := gosedctl(t, "revert-tper", "-d", dev, "-p", password); err != nil {
+			t.Fatalf("revert-tper failed: %v", err)
+		}
+	}
+}
+
+func TestEndToEndAddUser(t *testing.T) {
+	dev := "sim:" + filepath.Join(t.TempDir(), "drive.json")
+	const password = "correct horse battery staple"
+
+	if err := gosedctl(t, "initial-setup", "-d", dev, "-p", password); err != nil {
+		t.Fatalf("initial-setup failed: %v", err)
+	}
+	users := []string{"User1", "User2"}
+	for _, u := range users {
+		if err := gosedctl(t, "add-user", "-d", dev, "-p", password, u, "-n", u+" password", "-r", "0"); err != nil {
+			t.Fatalf("add-user %s failed: %v", u, err)
+		}
+	}
+	if err := gosedctl(t, "enable-user", "-d", dev, "-p", password, "User1", "--disable"); err != nil {
+		t.Fatalf("enable-user --disable failed: %v", err)
+	}
+	if err := gosedctl(t, "enable-user", "-d", dev, "-p", password, "User1"); err != nil {
+		t.Fatalf("enable-user failed: %v", err)
+	}
+	// Adding User2 must not have revoked the access of User1. Users may not
+	// change MBRDone.
+	for _, u := range users {
+		if err := gosedctl(t, "lock", "-d", dev, "-u", u, "-p", u+" password", "--no-mbr"); err != nil {
+			t.Errorf("lock as %s failed: %v", u, err)
+		}
+		if err := gosedctl(t, "unlock", "-d", dev, "-u", u, "-p", u+" password", "--no-mbr"); err != nil {
+			t.Errorf("unlock as %s failed: %v", u, err)
+		}
+	}
+}
+
+// The JSON of status uses the same snake_case names as the ranges of list.
+func TestEndToEndStatus(t *testing.T) {
+	dev := "sim:" + filepath.Join(t.TempDir(), "drive.json")
+	if err := gosedctl(t, "initial-setup", "-d", dev, "-p", "password"); err != nil {
+		t.Fatalf("initial-setup failed: %v", err)
+	}
+	st, err := readStatus(dev)
+	if err != nil {
+		t.Fatalf("readStatus() failed: %v", err)
+	}
+	b, err := json.Marshal(st)
+	if err != nil {
+		t.Fatalf("marshaling failed: %v", err)
+	}
+	var out struct {
+		Device  *string `json:"device"`
+		Locking *struct {
+			LockingEnabled *bool `json:"locking_enabled"`
+			MBRDone        *bool `json:"mbr_done"`
+		} `json:"locking"`
+		LockingSPLifeCycleState *string `json:"locking_sp_life_cycle_state"`
+	}
+	if err := json.Unmarshal(b, &out); err != nil {
+		t.Fatalf("unmarshaling %s failed: %v", b, err)
+	}
+	if out.Device == nil || *out.Device != dev {
+		t.Errorf("%s does not have device %q", b, dev)
+	}
+	if out.Locking == nil || out.Locking.LockingEnabled == nil || !*out.Locking.LockingEnabled || out.Locking.MBRDone == nil {
+		t.Errorf("%s does not have locking.locking_enabled and locking.mbr_done", b)
+	}
+	if out.LockingSPLifeCycleState == nil || *out.LockingSPLifeCycleState != "Manufactured" {
+		t.Errorf("%s does not have locking_sp_life_cycle_state Manufactured", b)
+	}
+}
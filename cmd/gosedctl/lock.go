@@ -0,0 +1,151 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io"
+
+	"github.com/open-source-firmware/go-tcg-storage/cmd/internal/sedcli"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/locking"
+)
+
+// lockingFlags are the flags of all commands operating on an authenticated
+// session to the Locking SP.
+type lockingFlags struct {
+	Device          string `flag:"" required:"" short:"d" help:"Path to SED device (e.g. /dev/nvme0)"`
+	credentialFlags `embed:""`
+}
+
+// credentialFlags select the authority of the Locking SP session.
+type credentialFlags struct {
+	Password    string `flag:"" optional:"" short:"p" xor:"password" help:"Password of the authenticating user, defaults to the MSID"`
+	PasswordHex string `flag:"" optional:"" xor:"password" help:"PIN of the authenticating user as hex, used as-is without hashing (e.g. the MSID printed by the msid command)"`
+	User        string `flag:"" optional:"" short:"u" help:"Authority to authenticate as (e.g. User1), defaults to Admin1"`
+}
+
+func (f *credentialFlags) options(device string) sedcli.Options {
+	o := sedcli.Options{
+		Device:   device,
+		User:     f.User,
+		Password: f.Password,
+	}
+	if f.PasswordHex != "" {
+		o.Password = f.PasswordHex
+		o.Hash = sedcli.PINFormatHex
+	}
+	return o
+}
+
+func (f *credentialFlags) openDevice(device string) (*sedcli.Session, error) {
+	return sedcli.Open(f.options(device))
+}
+
+func (f *lockingFlags) open() (*sedcli.Session, error) {
+	return f.openDevice(f.Device)
+}
+
+// openReadOnly opens a session for commands that only inspect the drive, so
+// that they do not block other tools holding the write session.
+func (f *lockingFlags) openReadOnly() (*sedcli.Session, error) {
+	o := f.options(f.Device)
+	o.ReadOnly = true
+	return sedcli.Open(o)
+}
+
+// openMBR opens a session for the shadow MBR commands, failing early on
+// drives without a shadow MBR.
+func (f *lockingFlags) openMBR(readOnly bool) (*sedcli.Session, error) {
+	o := f.options(f.Device)
+	o.ReadOnly = readOnly
+	o.MBR = true
+	return sedcli.Open(o)
+}
+
+// lockCmd is the struct for the lock cmd required by kong command line parser
+type lockCmd struct {
+	deviceSelection `embed:""`
+	credentialFlags `embed:""`
+	Range           string `flag:"" optional:"" short:"r" help:"Range index or name, defaults to the global range"`
+	ReadOnly        bool   `flag:"" optional:"" xor:"rw" help:"Only lock the range for reading"`
+	WriteOnly       bool   `flag:"" optional:"" xor:"rw" help:"Only lock the range for writing"`
+	MBR             bool   `flag:"" default:"true" negatable:"" help:"Show the shadow MBR again (MBRDone=false) if enabled"`
+}
+
+// unlockCmd is the struct for the unlock cmd required by kong command line parser
+type unlockCmd struct {
+	deviceSelection `embed:""`
+	credentialFlags `embed:""`
+	Range           string `flag:"" optional:"" short:"r" help:"Range index or name, defaults to the global range"`
+	ReadOnly        bool   `flag:"" optional:"" xor:"rw" help:"Only unlock the range for reading"`
+	WriteOnly       bool   `flag:"" optional:"" xor:"rw" help:"Only unlock the range for writing"`
+	MBR             bool   `flag:"" default:"true" negatable:"" help:"Hide the shadow MBR (MBRDone=true) if enabled"`
+	Verify          bool   `flag:"" optional:"" help:"Read the range back, and from the device if it is a block device, to confirm the unlock"`
+}
+
+type lockAllCmd struct {
+	lockingFlags `embed:""`
+	MBR          bool `flag:"" optional:"" help:"Also show the shadow MBR again (MBRDone=false) if enabled"`
+}
+
+type unlockAllCmd struct {
+	lockingFlags `embed:""`
+	MBR          bool `flag:"" optional:"" help:"Also hide the shadow MBR (MBRDone=true) if enabled"`
+}
+
+func (l *lockCmd) Run(ctx *context) error {
+	return l.run(l.lock)
+}
+
+func (l *lockCmd) lock(device string, w io.Writer) error {
+	s, err := l.openDevice(device)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	s.Locking.SetMBRDoneOnUnlock = l.MBR
+	return sedcli.Lock(s.Locking, l.Range, !l.WriteOnly, !l.ReadOnly)
+}
+
+func (u *unlockCmd) Run(ctx *context) error {
+	return u.run(u.unlock)
+}
+
+func (u *unlockCmd) unlock(device string, w io.Writer) error {
+	s, err := u.openDevice(device)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	var opts []locking.UnlockOpt
+	if u.Verify {
+		var closeDev func()
+		opts, closeDev = sedcli.VerifyOptions(device)
+		defer closeDev()
+	}
+	s.Locking.SetMBRDoneOnUnlock = u.MBR
+	return sedcli.Unlock(s.Locking, u.Range, !u.WriteOnly, !u.ReadOnly, opts...)
+}
+
+func (l *lockAllCmd) Run(ctx *context) error {
+	s, err := l.open()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	s.Locking.SetMBRDoneOnUnlock = l.MBR
+	return sedcli.LockAll(s.Locking)
+}
+
+func (u *unlockAllCmd) Run(ctx *context) error {
+	s, err := u.open()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	s.Locking.SetMBRDoneOnUnlock = u.MBR
+	return sedcli.UnlockAll(s.Locking)
+}
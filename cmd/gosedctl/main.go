@@ -2,6 +2,8 @@ package main
 
 import (
 	"github.com/alecthomas/kong"
+	"github.com/open-source-firmware/go-tcg-storage/cmd/internal/sedcli"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
 )
 
 const (
@@ -20,7 +22,14 @@ func main() {
 			Summary: true,
 		}))
 
-	// Run the command
-	err := ctx.Run(&context{})
+	stopTrace, err := cli.TraceFlags.Start()
+	ctx.FatalIfErrorf(err)
+	defer stopTrace()
+
+	// Run the command, ending the sessions it left open also on errors as
+	// FatalIfErrorf exits without running deferred functions.
+	sedcli.CloseSessionsOnSignal()
+	err = ctx.Run(&context{})
+	core.CloseAllSessions()
 	ctx.FatalIfErrorf(err)
 }
@@ -0,0 +1,138 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/open-source-firmware/go-tcg-storage/cmd/internal/sedcli"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+)
+
+// mbrDoneCmd is the struct for the mbr-done cmd required by kong command line parser
+type mbrDoneCmd struct {
+	lockingFlags `embed:""`
+	Done         bool `arg:"" required:"" help:"Hide (true) or show (false) the shadow MBR"`
+}
+
+// mbrStatusCmd is the struct for the mbr-status cmd required by kong command line parser
+type mbrStatusCmd struct {
+	lockingFlags `embed:""`
+}
+
+// readMBRCmd is the struct for the read-mbr cmd required by kong command line parser
+type readMBRCmd struct {
+	lockingFlags `embed:""`
+	Size         int `flag:"" default:"0" help:"Number of bytes to read, defaults to the whole MBR table"`
+}
+
+// writeMBRCmd is the struct for the write-mbr cmd required by kong command line parser
+type writeMBRCmd struct {
+	lockingFlags      `embed:""`
+	sedcli.DryRunFlag `embed:""`
+	Path              string `arg:"" required:"" type:"existingfile" help:"Path to PBA image"`
+	Offset            uint32 `flag:"" default:"0" help:"Byte offset to resume an interrupted upload from"`
+	NoVerify          bool   `flag:"" optional:"" help:"Skip reading back the MBR and comparing it to the image"`
+	EmbedChecksum     bool   `flag:"" optional:"" help:"Pad the image and append a block with its SHA-256"`
+}
+
+// verifyPBACmd is the struct for the verify-pba cmd required by kong command line parser
+type verifyPBACmd struct {
+	lockingFlags `embed:""`
+	Path         string `arg:"" required:"" type:"existingfile" help:"Path to PBA image"`
+}
+
+func (m *mbrDoneCmd) Run(ctx *context) error {
+	s, err := m.openMBR(false)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if err := s.Locking.SetMBRDone(m.Done); err != nil {
+		return fmt.Errorf("SetMBRDone failed: %v", err)
+	}
+	return nil
+}
+
+func (m *mbrStatusCmd) Run(ctx *context) error {
+	s, err := m.openMBR(true)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	row, err := table.MBRControl_Get(s.Locking.Session)
+	if err != nil {
+		return fmt.Errorf("MBRControl_Get failed: %v", err)
+	}
+	if row.Enable != nil {
+		fmt.Printf("Enable: %v\n", *row.Enable)
+	}
+	if row.Done != nil {
+		fmt.Printf("Done: %v\n", *row.Done)
+	}
+	if row.MBRDoneOnReset != nil {
+		resets := []string{}
+		for _, r := range *row.MBRDoneOnReset {
+			resets = append(resets, r.String())
+		}
+		fmt.Printf("DoneOnReset: %s\n", strings.Join(resets, ", "))
+	}
+	return nil
+}
+
+func (r *readMBRCmd) Run(ctx *context) error {
+	s, err := r.openMBR(true)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return sedcli.ReadMBR(os.Stdout, s.Locking, r.Size)
+}
+
+func (w *writeMBRCmd) Run(ctx *context) error {
+	img, err := os.ReadFile(w.Path)
+	if err != nil {
+		return err
+	}
+	s, err := w.openMBR(false)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if w.EmbedChecksum {
+		img = table.EmbedPBAChecksum(img)
+	}
+	return sedcli.WriteMBR(os.Stdout, s.Locking, img, w.Offset, !w.NoVerify, w.DryRun)
+}
+
+func (v *verifyPBACmd) Run(ctx *context) error {
+	img, err := os.ReadFile(v.Path)
+	if err != nil {
+		return err
+	}
+	info, err := table.ValidatePBAImage(img, nil)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Image: %d bytes, sha256 %x\n", info.Size, info.SHA256)
+	if info.PartitionTable != "" {
+		fmt.Printf("Partition table: %s\n", info.PartitionTable)
+	}
+	if info.ChecksumEmbedded {
+		fmt.Printf("Embedded checksum valid: %v\n", info.ChecksumValid)
+	}
+	for _, warn := range info.Warnings {
+		fmt.Printf("Warning: %s\n", warn)
+	}
+
+	s, err := v.openMBR(true)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return sedcli.VerifyMBR(os.Stdout, s.Locking, img)
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/open-source-firmware/go-tcg-storage/cmd/internal/sedcli"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+// msidCmd is the struct for the msid cmd required by kong command line parser
+type msidCmd struct {
+	Device string `flag:"" required:"" short:"d" help:"Path to SED device (e.g. /dev/nvme0)"`
+	Format string `flag:"" short:"f" enum:"hex,base64,dump" default:"hex" help:"Output format; one of [hex, base64, dump]"`
+}
+
+func (m *msidCmd) Run(ctx *context) error {
+	coreObj, err := sedcli.NewCore(m.Device)
+	if err != nil {
+		return fmt.Errorf("NewCore(%s) failed: %v", m.Device, err)
+	}
+	defer coreObj.Close()
+
+	comID, _, err := core.FindComID(coreObj.DriveIntf, coreObj.DiskInfo.Level0Discovery)
+	if err != nil {
+		return fmt.Errorf("FindComID() failed: %v", err)
+	}
+	cs, err := core.NewControlSession(coreObj.DriveIntf, coreObj.Level0Discovery, core.WithComID(comID))
+	if err != nil {
+		return fmt.Errorf("NewControlSession() failed: %v", err)
+	}
+	defer cs.Close()
+
+	s, err := cs.NewSession(uid.AdminSP, core.WithReadOnly())
+	if err != nil {
+		return fmt.Errorf("cs.NewSession() failed: %v", err)
+	}
+	defer s.Close()
+
+	msid, err := table.Admin_C_PIN_MSID_GetPIN(s)
+	if err != nil {
+		return fmt.Errorf("Admin_C_PIN_MSID_GetPIN() failed: %v", err)
+	}
+	out, err := sedcli.FormatPIN(msid, m.Format)
+	if err != nil {
+		return err
+	}
+	// The dump already ends with a newline
+	fmt.Println(strings.TrimSuffix(out, "\n"))
+	return nil
+}
@@ -0,0 +1,90 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/open-source-firmware/go-tcg-storage/cmd/internal/sedcli"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+// changePasswordCmd is the struct for the change-password cmd required by kong command line parser
+type changePasswordCmd struct {
+	Device      string `flag:"" required:"" short:"d" help:"Path to SED device (e.g. /dev/nvme0)"`
+	Authority   string `arg:"" required:"" help:"Authority whose password to change (SID, Admin1, User1, BandMaster0, EraseMaster, ...)"`
+	OldPassword string `flag:"" required:"" short:"o" help:"Current password of the authority"`
+	NewPassword string `flag:"" required:"" short:"n" help:"New password of the authority"`
+}
+
+func (c *changePasswordCmd) Run(ctx *context) error {
+	if c.NewPassword == "" {
+		return fmt.Errorf("empty password not allowed")
+	}
+	if strings.EqualFold(c.Authority, "SID") {
+		return c.changeSID()
+	}
+
+	// Every Locking SP authority is allowed to change its own C_PIN.
+	s, err := sedcli.Open(sedcli.Options{Device: c.Device, User: c.Authority, Password: c.OldPassword})
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	pwhash, err := sedcli.HashPassword(s.Core, c.NewPassword, sedcli.HashSedutil)
+	if err != nil {
+		return err
+	}
+	if err := s.Locking.SetPIN(c.Authority, pwhash); err != nil {
+		return fmt.Errorf("setting the PIN of %s failed: %v", c.Authority, err)
+	}
+	return nil
+}
+
+// changeSID changes the SID credential, which lives in the Admin SP.
+func (c *changePasswordCmd) changeSID() error {
+	coreObj, err := sedcli.NewCore(c.Device)
+	if err != nil {
+		return fmt.Errorf("NewCore(%s) failed: %v", c.Device, err)
+	}
+	defer coreObj.Close()
+
+	oldHash, err := sedcli.HashPassword(coreObj, c.OldPassword, sedcli.HashSedutil)
+	if err != nil {
+		return err
+	}
+	newHash, err := sedcli.HashPassword(coreObj, c.NewPassword, sedcli.HashSedutil)
+	if err != nil {
+		return err
+	}
+
+	comID, _, err := core.FindComID(coreObj.DriveIntf, coreObj.DiskInfo.Level0Discovery)
+	if err != nil {
+		return fmt.Errorf("FindComID() failed: %v", err)
+	}
+	cs, err := core.NewControlSession(coreObj.DriveIntf, coreObj.Level0Discovery, core.WithComID(comID))
+	if err != nil {
+		return fmt.Errorf("NewControllSession() failed: %v", err)
+	}
+	defer cs.Close()
+
+	adminSession, err := cs.NewSession(uid.AdminSP)
+	if err != nil {
+		return fmt.Errorf("cs.NewSession() failed: %v", err)
+	}
+	defer adminSession.Close()
+
+	if err := table.ThisSP_Authenticate(adminSession, uid.AuthoritySID, oldHash); err != nil {
+		return fmt.Errorf("authenticating as SID failed: %v", err)
+	}
+	if err := table.Admin_C_Pin_SID_SetPIN(adminSession, newHash); err != nil {
+		return fmt.Errorf("Admin_C_PIN_SID_SetPIN() failed: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+
+	"github.com/open-source-firmware/go-tcg-storage/cmd/internal/sedcli"
+)
+
+// listCmd is the struct for the list cmd required by kong command line parser
+type listCmd struct {
+	lockingFlags `embed:""`
+	Output       string `flag:"" short:"o" enum:"text,json" default:"text" help:"Output format; one of [text, json]"`
+}
+
+// createRangeCmd is the struct for the create-range cmd required by kong command line parser
+type createRangeCmd struct {
+	lockingFlags `embed:""`
+	Start        string `arg:"" required:"" help:"Start of the range in sectors, or in bytes with a unit suffix (e.g. 1GiB)"`
+	Length       string `arg:"" required:"" help:"Length of the range in sectors, or in bytes with a unit suffix (e.g. 256GiB)"`
+	ReadLock     bool   `flag:"" default:"true" negatable:"" help:"Enable read locking on the range"`
+	WriteLock    bool   `flag:"" default:"true" negatable:"" help:"Enable write locking on the range"`
+	Grant        string `flag:"" optional:"" help:"Allow the given user (e.g. User1) to lock and unlock the range"`
+	Name         string `flag:"" optional:"" help:"Name of the range, to refer to it by name instead of its index"`
+}
+
+// deleteRangeCmd is the struct for the delete-range cmd required by kong command line parser
+type deleteRangeCmd struct {
+	lockingFlags `embed:""`
+	Range        string `arg:"" required:"" help:"Range index or name"`
+}
+
+// eraseCmd is the struct for the erase cmd required by kong command line parser
+type eraseCmd struct {
+	lockingFlags      `embed:""`
+	sedcli.DryRunFlag `embed:""`
+	Range             string `arg:"" required:"" help:"Range index or name"`
+	YesIKnow          bool   `flag:"" name:"yes-i-know" help:"Confirm that all data in the range will be irrecoverably lost"`
+}
+
+func (l *listCmd) Run(ctx *context) error {
+	s, err := l.openReadOnly()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return sedcli.ListRanges(os.Stdout, s.Locking, l.Output)
+}
+
+func (c *createRangeCmd) Run(ctx *context) error {
+	s, err := c.open()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return sedcli.CreateRange(os.Stdout, s.Locking, c.Start, c.Length, c.ReadLock, c.WriteLock, c.Grant, c.Name)
+}
+
+func (d *deleteRangeCmd) Run(ctx *context) error {
+	s, err := d.open()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return sedcli.DeleteRange(s.Locking, d.Range)
+}
+
+func (e *eraseCmd) Run(ctx *context) error {
+	s, err := e.open()
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	return sedcli.Erase(os.Stdout, s.Locking, e.Range, e.YesIKnow, e.DryRun)
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/locking"
+)
+
+// revertPolicy is how the revert commands treat the SSC of a drive.
+type revertPolicy struct {
+	SSC string
+	// The drive encrypts the user data, so that Revert and RevertSP can
+	// erase it by discarding the keys. Pyrite drives do not.
+	Encrypting bool
+	// RevertSP accepts KeepGlobalRangeKey to keep the data
+	KeepGlobalRangeKey bool
+	// Number of Admin authorities of the Locking SP, 0 if not announced
+	Admins uint16
+}
+
+func newRevertPolicy(d0 *core.Level0Discovery) (*revertPolicy, error) {
+	caps := core.GetCapabilities(d0)
+	switch {
+	case d0.OpalV2 != nil, d0.OpalV1 != nil, d0.Opalite != nil:
+		ssc := caps.SSC
+		if ssc == "" {
+			ssc = caps.SSCs[0]
+		}
+		return &revertPolicy{SSC: ssc, Encrypting: true, KeepGlobalRangeKey: true, Admins: caps.Admins}, nil
+	case d0.RubyV1 != nil:
+		return &revertPolicy{SSC: "Ruby 1", Encrypting: true, KeepGlobalRangeKey: true, Admins: caps.Admins}, nil
+	case d0.PyriteV2 != nil, d0.PyriteV1 != nil:
+		return &revertPolicy{SSC: caps.SSC}, nil
+	case d0.Enterprise != nil:
+		return nil, fmt.Errorf("device is an Enterprise SSC device, use revert-enterprise instead")
+	}
+	return nil, fmt.Errorf("device does not support a known SSC")
+}
+
+// adminAuthority resolves the Locking SP admin to authenticate as, checking
+// it against the number of admins announced by the SSC.
+func (p *revertPolicy) adminAuthority(name string) (uid.AuthorityObjectUID, error) {
+	auth, ok := locking.AuthorityUIDFromName(name)
+	if !ok || !strings.HasPrefix(strings.ToLower(name), "admin") {
+		return uid.AuthorityObjectUID{}, fmt.Errorf("%q is not an admin authority of the Locking SP", name)
+	}
+	if n := uint16(auth[7]); p.Admins > 0 && n > p.Admins {
+		return uid.AuthorityObjectUID{}, fmt.Errorf("%s SSC device only supports %d admins", p.SSC, p.Admins)
+	}
+	return auth, nil
+}
+
+// Warnings printed before reverting, as the outcome differs from the one on
+// Opal drives.
+func (p *revertPolicy) revertSPWarning() string {
+	if p.Encrypting {
+		return ""
+	}
+	return fmt.Sprintf("%s SSC devices do not encrypt data: reverting the Locking SP only removes the locking, the data stays readable to anyone", p.SSC)
+}
+
+func (p *revertPolicy) revertTPerWarning() string {
+	if p.Encrypting {
+		return ""
+	}
+	return fmt.Sprintf("%s SSC devices do not encrypt data: Revert removes it using the active data removal mechanism, which may be an overwrite taking hours, or not at all on Pyrite 1", p.SSC)
+}
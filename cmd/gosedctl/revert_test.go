@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/feature"
+)
+
+func TestRevertPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		d0       *core.Level0Discovery
+		keep     bool
+		admin    string
+		adminErr bool
+		err      bool
+	}{
+		{"Opal 2", &core.Level0Discovery{OpalV2: &feature.OpalV2{NumLockingSPAdminSupported: 4}}, true, "Admin4", false, false},
+		{"Opal 2 too many admins", &core.Level0Discovery{OpalV2: &feature.OpalV2{NumLockingSPAdminSupported: 4}}, true, "Admin5", true, false},
+		{"Ruby", &core.Level0Discovery{RubyV1: &feature.RubyV1{NumLockingSPAdminSupported: 1}}, true, "Admin2", true, false},
+		{"Pyrite 2", &core.Level0Discovery{PyriteV2: &feature.PyriteV2{}}, false, "Admin1", false, false},
+		{"not an admin", &core.Level0Discovery{PyriteV1: &feature.PyriteV1{}}, false, "User1", true, false},
+		{"Enterprise", &core.Level0Discovery{Enterprise: &feature.Enterprise{}}, false, "", false, true},
+	} {
+		p, err := newRevertPolicy(tc.d0)
+		if (err != nil) != tc.err {
+			t.Errorf("%s: newRevertPolicy() error = %v, want error %v", tc.name, err, tc.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if p.KeepGlobalRangeKey != tc.keep || p.Encrypting != tc.keep {
+			t.Errorf("%s: newRevertPolicy() = %+v", tc.name, p)
+		}
+		if (p.revertSPWarning() == "") != tc.keep {
+			t.Errorf("%s: unexpected warning %q", tc.name, p.revertSPWarning())
+		}
+		if _, err := p.adminAuthority(tc.admin); (err != nil) != tc.adminErr {
+			t.Errorf("%s: adminAuthority(%q) error = %v, want error %v", tc.name, tc.admin, err, tc.adminErr)
+		}
+	}
+}
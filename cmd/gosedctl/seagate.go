@@ -0,0 +1,103 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/open-source-firmware/go-tcg-storage/cmd/internal/sedcli"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/vendors/seagate"
+)
+
+// vendorCmd groups the vendor specific sub-commands required by kong command line parser
+type vendorCmd struct {
+	Seagate seagateCmd `cmd:"" help:"Commands for Seagate drives"`
+}
+
+type seagateCmd struct {
+	Ports seagatePortsCmd `cmd:"" help:"Lists, locks and unlocks the firmware download and diagnostic ports"`
+}
+
+type seagatePortsCmd struct {
+	Device   string   `flag:"" required:"" short:"d" help:"Path to SED device (e.g. /dev/nvme0)"`
+	Password string   `flag:"" optional:"" short:"p" help:"Password of the SID authority, required to lock or unlock ports"`
+	Lock     []string `flag:"" optional:"" enum:"fw-download,uds" help:"Port to lock; one of [fw-download, uds], can be repeated"`
+	Unlock   []string `flag:"" optional:"" enum:"fw-download,uds" help:"Port to unlock; one of [fw-download, uds], can be repeated"`
+}
+
+func (p *seagatePortsCmd) Run(ctx *context) error {
+	coreObj, err := sedcli.NewCore(p.Device)
+	if err != nil {
+		return fmt.Errorf("NewCore(%s) failed: %v", p.Device, err)
+	}
+	defer coreObj.Close()
+	var ops *seagate.Ops
+	for _, v := range coreObj.VendorOps() {
+		if o, ok := v.(seagate.Ops); ok {
+			ops = &o
+		}
+	}
+	if ops == nil {
+		return fmt.Errorf("device is not a Seagate drive")
+	}
+	ports := ops.Ports(coreObj.DiskInfo.Level0Discovery)
+	if len(ports) == 0 {
+		return fmt.Errorf("device does not report Seagate ports")
+	}
+
+	if len(p.Lock) == 0 && len(p.Unlock) == 0 {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "Port\tLocked")
+		for _, port := range ports {
+			fmt.Fprintf(w, "%s\t%s\n", port.Name, yesNo(port.Locked))
+		}
+		return w.Flush()
+	}
+
+	if p.Password == "" {
+		return fmt.Errorf("locking or unlocking ports requires the SID password")
+	}
+	pwhash, err := sedcli.HashPassword(coreObj, p.Password, sedcli.HashSedutil)
+	if err != nil {
+		return err
+	}
+	comID, _, err := core.FindComID(coreObj.DriveIntf, coreObj.DiskInfo.Level0Discovery)
+	if err != nil {
+		return fmt.Errorf("FindComID() failed: %v", err)
+	}
+	cs, err := core.NewControlSession(coreObj.DriveIntf, coreObj.Level0Discovery, core.WithComID(comID))
+	if err != nil {
+		return fmt.Errorf("NewControllSession() failed: %v", err)
+	}
+	defer cs.Close()
+	adminSession, err := cs.NewSession(uid.AdminSP)
+	if err != nil {
+		return fmt.Errorf("cs.NewSession() failed: %v", err)
+	}
+	defer adminSession.Close()
+	if err := table.ThisSP_Authenticate(adminSession, uid.AuthoritySID, pwhash); err != nil {
+		return fmt.Errorf("authenticating as SID failed: %v", err)
+	}
+	for _, name := range p.Lock {
+		row, _ := ops.PortByName(name)
+		if err := ops.SetPortLocked(adminSession, row, true); err != nil {
+			return fmt.Errorf("locking port %s failed: %v", name, err)
+		}
+		fmt.Printf("Port %s locked\n", name)
+	}
+	for _, name := range p.Unlock {
+		row, _ := ops.PortByName(name)
+		if err := ops.SetPortLocked(adminSession, row, false); err != nil {
+			return fmt.Errorf("unlocking port %s failed: %v", name, err)
+		}
+		fmt.Printf("Port %s unlocked\n", name)
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build sim
+
+package main
+
+// Built with "-tags sim", gosedctl also operates on simulated drives given as
+// "-d sim:/path/to/state.json", see the sim package.
+import _ "github.com/open-source-firmware/go-tcg-storage/pkg/drive/sim"
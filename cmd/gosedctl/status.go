@@ -0,0 +1,254 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/open-source-firmware/go-tcg-storage/cmd/internal/sedcli"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/feature"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+// statusCmd is the struct for the status cmd required by kong command line parser
+type statusCmd struct {
+	deviceSelection `embed:""`
+	Output          string `flag:"" short:"o" enum:"table,json" default:"table" help:"Output format; one of [table, json]"`
+}
+
+// deviceStatus is the JSON representation of a device as emitted by
+// "status --output json". The names follow sedcli.RangeState, fields must
+// only be added, never renamed or removed, to keep scripts working.
+type deviceStatus struct {
+	Device       string          `json:"device"`
+	Model        string          `json:"model"`
+	SerialNumber string          `json:"serial_number"`
+	Firmware     string          `json:"firmware"`
+	Protocol     string          `json:"protocol"`
+	SSC          []string        `json:"ssc"`
+	Locking      *lockingStatus  `json:"locking,omitempty"`
+	BlockSID     *blockSIDStatus `json:"block_sid,omitempty"`
+	// Life cycle state of the Locking SP, not available on Enterprise
+	LockingSPLifeCycleState *string `json:"locking_sp_life_cycle_state,omitempty"`
+	// All SPs of the TPer, not available on Enterprise
+	SPs []spStatus `json:"sps,omitempty"`
+	// Set instead of the above if the status of one of several devices
+	// could not be read
+	Error string `json:"error,omitempty"`
+}
+
+type spStatus struct {
+	Name           string `json:"name"`
+	UID            string `json:"uid"`
+	LifeCycleState string `json:"life_cycle_state"`
+}
+
+type lockingStatus struct {
+	LockingSupported bool `json:"locking_supported"`
+	LockingEnabled   bool `json:"locking_enabled"`
+	Locked           bool `json:"locked"`
+	MediaEncryption  bool `json:"media_encryption"`
+	MBREnabled       bool `json:"mbr_enabled"`
+	MBRDone          bool `json:"mbr_done"`
+}
+
+type blockSIDStatus struct {
+	SIDIsMSID                    bool `json:"sid_is_msid"`
+	SIDAuthenticationBlocked     bool `json:"sid_authentication_blocked"`
+	LockingSPFreezeLockSupported bool `json:"locking_sp_freeze_lock_supported"`
+	LockingSPFreezeLocked        bool `json:"locking_sp_freeze_locked"`
+}
+
+func newBlockSIDStatus(b *feature.BlockSID) *blockSIDStatus {
+	return &blockSIDStatus{
+		SIDIsMSID:                    !b.SIDValueState,
+		SIDAuthenticationBlocked:     b.SIDAuthenticationBlockedState,
+		LockingSPFreezeLockSupported: b.LockingSPFreezeLockSupported,
+		LockingSPFreezeLocked:        b.LockingSPFreezeLockState,
+	}
+}
+
+func printBlockSIDStatus(w io.Writer, b *blockSIDStatus) {
+	fmt.Fprintf(w, "SID is MSID:\t%s\n", yesNo(b.SIDIsMSID))
+	fmt.Fprintf(w, "SID authentication blocked:\t%s\n", yesNo(b.SIDAuthenticationBlocked))
+	fmt.Fprintf(w, "Locking SP freeze lock:\t%s (supported: %s)\n", yesNo(b.LockingSPFreezeLocked), yesNo(b.LockingSPFreezeLockSupported))
+}
+
+func (s *statusCmd) Run(ctx *context) error {
+	if s.Output != "json" {
+		return s.run(func(device string, w io.Writer) error {
+			st, err := readStatus(device)
+			if err != nil {
+				return err
+			}
+			printStatus(w, st)
+			return nil
+		})
+	}
+
+	devs, err := s.devices()
+	if err != nil {
+		return err
+	}
+	if !s.All && len(devs) == 1 {
+		st, err := readStatus(devs[0])
+		if err != nil {
+			return err
+		}
+		return printJSON(st)
+	}
+	// Several devices are reported as one JSON list
+	var mu sync.Mutex
+	byDevice := map[string]*deviceStatus{}
+	res := sedcli.RunBatch(devs, s.Parallel, func(device string, w io.Writer) error {
+		st, err := readStatus(device)
+		if err != nil {
+			st = &deviceStatus{Device: device, Error: err.Error()}
+		}
+		mu.Lock()
+		byDevice[device] = st
+		mu.Unlock()
+		return err
+	})
+	sts := []*deviceStatus{}
+	for _, d := range devs {
+		sts = append(sts, byDevice[d])
+	}
+	if err := printJSON(sts); err != nil {
+		return err
+	}
+	failed := 0
+	for _, r := range res {
+		if r.Err != nil {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d devices failed", failed, len(res))
+	}
+	return nil
+}
+
+func printJSON(v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
+
+func readStatus(device string) (*deviceStatus, error) {
+	coreObj, err := sedcli.NewCore(device)
+	if err != nil {
+		return nil, fmt.Errorf("NewCore(%s) failed: %v", device, err)
+	}
+	defer coreObj.Close()
+
+	d0 := coreObj.DiskInfo.Level0Discovery
+	st := &deviceStatus{
+		Device:       device,
+		Model:        coreObj.DiskInfo.Identity.Model,
+		SerialNumber: coreObj.DiskInfo.Identity.SerialNumber,
+		Firmware:     coreObj.DiskInfo.Identity.Firmware,
+		Protocol:     coreObj.DiskInfo.Identity.Protocol,
+		SSC:          core.GetCapabilities(d0).SSCs,
+	}
+	if l := d0.Locking; l != nil {
+		st.Locking = &lockingStatus{
+			LockingSupported: l.LockingSupported,
+			LockingEnabled:   l.LockingEnabled,
+			Locked:           l.Locked,
+			MediaEncryption:  l.MediaEncryption,
+			MBREnabled:       l.MBREnabled,
+			MBRDone:          l.MBRDone,
+		}
+	}
+	if b := d0.BlockSID; b != nil {
+		st.BlockSID = newBlockSIDStatus(b)
+	}
+
+	if d0.Enterprise == nil {
+		sps, err := listSPs(coreObj)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: unable to read the SP table: %v\n", device, err)
+		}
+		for _, sp := range sps {
+			lcs := "unknown"
+			if sp.LifeCycleState >= 0 {
+				lcs = sp.LifeCycleState.String()
+			}
+			spUID := fmt.Sprintf("%x", sp.UID[:])
+			name := sp.Name
+			if name == "" {
+				name = spUID
+			}
+			st.SPs = append(st.SPs, spStatus{Name: name, UID: spUID, LifeCycleState: lcs})
+			if sp.UID == uid.LockingSP && sp.LifeCycleState >= 0 {
+				st.LockingSPLifeCycleState = &lcs
+			}
+		}
+	}
+
+	return st, nil
+}
+
+func listSPs(coreObj *core.Core) ([]table.SPInfo, error) {
+	comID, _, err := core.FindComID(coreObj.DriveIntf, coreObj.DiskInfo.Level0Discovery)
+	if err != nil {
+		return nil, fmt.Errorf("FindComID() failed: %v", err)
+	}
+	cs, err := core.NewControlSession(coreObj.DriveIntf, coreObj.Level0Discovery, core.WithComID(comID))
+	if err != nil {
+		return nil, fmt.Errorf("NewControllSession() failed: %v", err)
+	}
+	defer cs.Close()
+	adminSession, err := cs.NewSession(uid.AdminSP, core.WithReadOnly())
+	if err != nil {
+		return nil, fmt.Errorf("cs.NewSession() failed: %v", err)
+	}
+	defer adminSession.Close()
+	return table.ListSPs(adminSession)
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func printStatus(out io.Writer, st *deviceStatus) {
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintf(w, "Device:\t%s\n", st.Device)
+	fmt.Fprintf(w, "Model:\t%s\n", st.Model)
+	fmt.Fprintf(w, "Serial:\t%s\n", st.SerialNumber)
+	fmt.Fprintf(w, "Firmware:\t%s\n", st.Firmware)
+	fmt.Fprintf(w, "Protocol:\t%s\n", st.Protocol)
+	fmt.Fprintf(w, "SSC:\t%s\n", strings.Join(st.SSC, ", "))
+	if l := st.Locking; l != nil {
+		fmt.Fprintf(w, "Locking supported:\t%s\n", yesNo(l.LockingSupported))
+		fmt.Fprintf(w, "Locking enabled:\t%s\n", yesNo(l.LockingEnabled))
+		fmt.Fprintf(w, "Locked:\t%s\n", yesNo(l.Locked))
+		fmt.Fprintf(w, "Media encryption:\t%s\n", yesNo(l.MediaEncryption))
+		fmt.Fprintf(w, "MBR enabled:\t%s\n", yesNo(l.MBREnabled))
+		fmt.Fprintf(w, "MBR done:\t%s\n", yesNo(l.MBRDone))
+	}
+	if b := st.BlockSID; b != nil {
+		printBlockSIDStatus(w, b)
+	}
+	for _, sp := range st.SPs {
+		fmt.Fprintf(w, "%s SP life cycle:\t%s\n", sp.Name, sp.LifeCycleState)
+	}
+}
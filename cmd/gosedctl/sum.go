@@ -0,0 +1,167 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/open-source-firmware/go-tcg-storage/cmd/internal/sedcli"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+// initialSetupSUMCmd is the struct for the initial-setup-sum cmd required by kong command line parser
+type initialSetupSUMCmd struct {
+	sedcli.DryRunFlag `embed:""`
+	Device            string `flag:"" required:"" short:"d" help:"Path to SED device (e.g. /dev/nvme0)"`
+	Password          string `flag:"" required:"" short:"p" help:"New password for the SID and Admin1 authorities"`
+	UserPassword      string `flag:"" required:"" short:"n" help:"Password for the users owning the selected ranges"`
+	Range             []int  `flag:"" optional:"" short:"r" help:"Range index to put into Single User Mode (repeatable), defaults to all ranges"`
+	AdminPolicy       bool   `flag:"" optional:"" help:"Only allow Admins to change start and length of the selected ranges"`
+}
+
+func (i *initialSetupSUMCmd) Run(ctx *context) error {
+	if i.Password == "" || i.UserPassword == "" {
+		return fmt.Errorf("empty password not allowed")
+	}
+	coreObj, err := sedcli.NewCore(i.Device)
+	if err != nil {
+		return fmt.Errorf("NewCore(%s) failed: %v", i.Device, err)
+	}
+	defer coreObj.Close()
+	caps := core.GetCapabilities(coreObj.DiskInfo.Level0Discovery)
+	if !caps.SingleUserMode {
+		return fmt.Errorf("device does not support Single User Mode")
+	}
+
+	ranges := i.Range
+	if len(ranges) == 0 {
+		for n := 0; n < int(caps.MaxRanges); n++ {
+			ranges = append(ranges, n)
+		}
+	}
+	// An empty selection list puts the whole Locking table into Single User Mode
+	var rows []uid.RowUID
+	for _, n := range i.Range {
+		rows = append(rows, uid.LockingRange(n))
+	}
+
+	pwhash, err := sedcli.HashPassword(coreObj, i.Password, sedcli.HashSedutil)
+	if err != nil {
+		return err
+	}
+	userhash, err := sedcli.HashPassword(coreObj, i.UserPassword, sedcli.HashSedutil)
+	if err != nil {
+		return err
+	}
+
+	comID, _, err := core.FindComID(coreObj.DriveIntf, coreObj.DiskInfo.Level0Discovery)
+	if err != nil {
+		return fmt.Errorf("FindComID() failed: %v", err)
+	}
+	cs, err := core.NewControlSession(coreObj.DriveIntf, coreObj.Level0Discovery, core.WithComID(comID))
+	if err != nil {
+		return fmt.Errorf("NewControllSession() failed: %v", err)
+	}
+	defer cs.Close()
+
+	// Take ownership the same way initial-setup does
+	adminSession, err := cs.NewSession(uid.AdminSP)
+	if err != nil {
+		return fmt.Errorf("cs.NewSession() failed: %v", err)
+	}
+	msid, err := table.Admin_C_PIN_MSID_GetPIN(adminSession)
+	if err != nil {
+		adminSession.Close()
+		return fmt.Errorf("Admin_C_PIN_MSID_GetPin() failed: %v", err)
+	}
+	if err := table.ThisSP_Authenticate(adminSession, uid.AuthoritySID, msid); err != nil {
+		adminSession.Close()
+		return fmt.Errorf("ThisSp_Authenticate failed: %v", err)
+	}
+	lcs, err := table.Admin_SP_GetLifeCycleState(adminSession, uid.LockingSP)
+	if err != nil {
+		adminSession.Close()
+		return fmt.Errorf("Admin_SP_GetLifeCycleState() failed: %v", err)
+	}
+	if lcs != table.ManufacturedInactive {
+		adminSession.Close()
+		return fmt.Errorf("LockingSP Lifecycle state of %s, but require %s", lcs.String(), table.ManufacturedInactive)
+	}
+	if i.DryRun {
+		adminSession.Close()
+		calls := []string{
+			"AdminSP: C_PIN_SID.Set PIN",
+			fmt.Sprintf("AdminSP: LockingSP.Activate SingleUserModeSelectionList=%v RangeStartRangeLengthPolicy=%v", i.Range, i.AdminPolicy),
+		}
+		if len(rows) == 0 {
+			calls[1] = fmt.Sprintf("AdminSP: LockingSP.Activate SingleUserModeSelectionList=Locking RangeStartRangeLengthPolicy=%v", i.AdminPolicy)
+		}
+		for _, n := range ranges {
+			calls = append(calls,
+				fmt.Sprintf("LockingSP: ThisSP.Authenticate as User%d with an empty PIN", n+1),
+				fmt.Sprintf("LockingSP: C_PIN_User%d.Set PIN", n+1),
+				fmt.Sprintf("LockingSP: K_AES of range %d.GenKey", n),
+				fmt.Sprintf("LockingSP: Locking range %d.Set ReadLockEnabled=true WriteLockEnabled=true", n))
+		}
+		sedcli.PrintDryRun(os.Stdout, calls...)
+		return nil
+	}
+	if err := table.Admin_C_Pin_SID_SetPIN(adminSession, pwhash); err != nil {
+		adminSession.Close()
+		return fmt.Errorf("Admin_C_PIN_SID_SetPIN() failed: %v", err)
+	}
+	if err := table.LockingSPActivateSUM(adminSession, rows, i.AdminPolicy); err != nil {
+		adminSession.Close()
+		return fmt.Errorf("LockingSPActivateSUM() failed: %v", err)
+	}
+	adminSession.Close()
+
+	// Each range in Single User Mode is owned by the user with the next higher
+	// number, whose PIN is empty after activation. The user takes ownership
+	// by setting its PIN, generating a fresh media key and enabling locking.
+	for _, n := range ranges {
+		user := uid.LockingAuthorityUser(n + 1)
+		if err := setupSUMRange(cs, n, user, userhash); err != nil {
+			return fmt.Errorf("setting up range %d as User%d failed: %v", n, n+1, err)
+		}
+	}
+	return nil
+}
+
+func setupSUMRange(cs *core.ControlSession, n int, user uid.AuthorityObjectUID, pwhash []byte) error {
+	s, err := cs.NewSession(uid.LockingSP)
+	if err != nil {
+		return fmt.Errorf("NewSession() to LockingSP failed: %v", err)
+	}
+	defer s.Close()
+	if err := table.ThisSP_Authenticate(s, user, []byte{}); err != nil {
+		return fmt.Errorf("authenticating with empty PIN failed: %v", err)
+	}
+	if err := table.C_PIN_SetPIN(s, uid.C_PINRowForAuthority(user), pwhash); err != nil {
+		return fmt.Errorf("C_PIN_SetPIN() failed: %v", err)
+	}
+	row, err := table.Locking_Get(s, uid.LockingRange(n))
+	if err != nil {
+		return fmt.Errorf("Locking_Get() failed: %v", err)
+	}
+	if row.ActiveKey != nil {
+		if err := table.GenKey(s, *row.ActiveKey); err != nil {
+			return fmt.Errorf("GenKey() failed: %v", err)
+		}
+	}
+	enabled := true
+	lr := &table.LockingRow{
+		UID:              uid.LockingRange(n),
+		ReadLockEnabled:  &enabled,
+		WriteLockEnabled: &enabled,
+	}
+	if err := table.Locking_Set(s, lr); err != nil {
+		return fmt.Errorf("Locking_Set() failed: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+
+	"github.com/open-source-firmware/go-tcg-storage/cmd/internal/sedcli"
+)
+
+// generateSystemdCmd is the struct for the generate-systemd cmd required by kong command line parser
+type generateSystemdCmd struct {
+	Device              []string `flag:"" optional:"" short:"d" help:"Path to SED device to unlock at boot (repeatable), preferably below /dev/disk/by-id"`
+	sedcli.SystemdFlags `embed:""`
+}
+
+func (g *generateSystemdCmd) Run(ctx *context) error {
+	return g.Generate(os.Stdout, programName+" generate-systemd", g.Device)
+}
@@ -0,0 +1,71 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/open-source-firmware/go-tcg-storage/cmd/internal/sedcli"
+)
+
+// addUserCmd is the struct for the add-user cmd required by kong command line parser
+type addUserCmd struct {
+	Device       string   `flag:"" required:"" short:"d" help:"Path to SED device (e.g. /dev/nvme0)"`
+	Password     string   `flag:"" required:"" short:"p" help:"Password of the Admin1 authority"`
+	User         string   `arg:"" required:"" help:"User authority to add (e.g. User1)"`
+	UserPassword string   `flag:"" required:"" short:"n" help:"New password for the user"`
+	Range        []string `flag:"" optional:"" short:"r" help:"Range index or name the user may lock and unlock (repeatable)"`
+}
+
+// enableUserCmd is the struct for the enable-user cmd required by kong command line parser
+type enableUserCmd struct {
+	Device   string `flag:"" required:"" short:"d" help:"Path to SED device (e.g. /dev/nvme0)"`
+	Password string `flag:"" required:"" short:"p" help:"Password of the Admin1 authority"`
+	User     string `arg:"" required:"" help:"User authority to enable (e.g. User1)"`
+	Disable  bool   `flag:"" optional:"" help:"Disable the user instead"`
+}
+
+func (a *addUserCmd) Run(ctx *context) error {
+	s, err := sedcli.Open(sedcli.Options{Device: a.Device, Password: a.Password})
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	lsp := s.Locking
+
+	if err := lsp.SetUserEnabled(a.User, true); err != nil {
+		return fmt.Errorf("enabling %s failed: %v", a.User, err)
+	}
+	pwhash, err := sedcli.HashPassword(s.Core, a.UserPassword, sedcli.HashSedutil)
+	if err != nil {
+		return err
+	}
+	if err := lsp.SetPIN(a.User, pwhash); err != nil {
+		return fmt.Errorf("setting the PIN of %s failed: %v", a.User, err)
+	}
+	for _, spec := range a.Range {
+		_, r, err := sedcli.FindRange(lsp, spec)
+		if err != nil {
+			return err
+		}
+		if err := r.AddUser(a.User); err != nil {
+			return fmt.Errorf("granting %s access to range %q failed: %v", a.User, spec, err)
+		}
+	}
+	return nil
+}
+
+func (e *enableUserCmd) Run(ctx *context) error {
+	s, err := sedcli.Open(sedcli.Options{Device: e.Device, Password: e.Password})
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	if err := s.Locking.SetUserEnabled(e.User, !e.Disable); err != nil {
+		return fmt.Errorf("changing enabled state of %s failed: %v", e.User, err)
+	}
+	return nil
+}
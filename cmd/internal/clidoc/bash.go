@@ -0,0 +1,111 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package clidoc
+
+import (
+	"fmt"
+	"strings"
+)
+
+const devicePattern = "/dev/nvme[0-9]* /dev/sd[a-z]*"
+
+func bashValueCompletion(kind ValueKind, enum []string) string {
+	switch {
+	case len(enum) > 0:
+		return fmt.Sprintf(`COMPREPLY=($(compgen -W "%s" -- "$cur"))`, strings.Join(enum, " "))
+	case kind == ValueDevice:
+		return fmt.Sprintf(`COMPREPLY=($(compgen -W "$(ls -d %s 2>/dev/null)" -- "$cur"))`, devicePattern)
+	case kind == ValueFile:
+		return `COMPREPLY=($(compgen -f -- "$cur"))`
+	}
+	return `COMPREPLY=()`
+}
+
+// Bash returns a bash completion script for the command.
+func Bash(c *Command) string {
+	var b strings.Builder
+	fn := "_" + strings.ReplaceAll(c.Name, "-", "_")
+	fmt.Fprintf(&b, "# bash completion for %s\n", c.Name)
+	fmt.Fprintf(&b, "%s() {\n", fn)
+	b.WriteString("\tlocal cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+	b.WriteString("\tlocal path=\"\" next i\n")
+
+	// Find the (sub-)command being completed
+	if len(c.Commands) > 0 {
+		b.WriteString("\tfor ((i = 1; i < COMP_CWORD; i++)); do\n")
+		b.WriteString("\t\tnext=\"${path:+$path }${COMP_WORDS[i]}\"\n")
+		b.WriteString("\t\tcase \"$next\" in\n")
+		var paths []string
+		c.walk(nil, func(path []string, _ *Command) {
+			if len(path) > 0 {
+				paths = append(paths, fmt.Sprintf("%q", joinPath(path)))
+			}
+		})
+		fmt.Fprintf(&b, "\t\t%s) path=\"$next\" ;;\n", strings.Join(paths, "|"))
+		b.WriteString("\t\tesac\n")
+		b.WriteString("\tdone\n")
+	}
+
+	// Complete flag values
+	b.WriteString("\tcase \"$path:$prev\" in\n")
+	c.walk(nil, func(path []string, cmd *Command) {
+		for _, f := range flagsFor(c, path) {
+			if f.Kind == ValueNone {
+				continue
+			}
+			var pats []string
+			for _, n := range cmd.flagNames(f) {
+				if strings.HasPrefix(n, "--no-") {
+					continue
+				}
+				pats = append(pats, fmt.Sprintf("%q", joinPath(path)+":"+n))
+			}
+			fmt.Fprintf(&b, "\t%s) %s; return ;;\n", strings.Join(pats, "|"), bashValueCompletion(f.Kind, f.Enum))
+		}
+	})
+	b.WriteString("\tesac\n")
+
+	// Complete sub-commands, flags and positional arguments
+	b.WriteString("\tcase \"$path\" in\n")
+	c.walk(nil, func(path []string, cmd *Command) {
+		var words []string
+		for _, sub := range cmd.Commands {
+			words = append(words, sub.Name)
+		}
+		for _, f := range flagsFor(c, path) {
+			words = append(words, cmd.flagNames(f)...)
+		}
+		fmt.Fprintf(&b, "\t%q)\n", joinPath(path))
+		fmt.Fprintf(&b, "\t\tCOMPREPLY=($(compgen -W %q -- \"$cur\"))\n", strings.Join(words, " "))
+		for _, a := range cmd.Args {
+			if a.Kind == ValueFile || a.Kind == ValueDevice || len(a.Enum) > 0 {
+				fmt.Fprintf(&b, "\t\t[[ \"$cur\" != -* ]] && %s\n", strings.Replace(bashValueCompletion(a.Kind, a.Enum), "COMPREPLY=(", "COMPREPLY+=(", 1))
+				break
+			}
+		}
+		b.WriteString("\t\t;;\n")
+	})
+	b.WriteString("\tesac\n")
+	b.WriteString("}\n")
+	fmt.Fprintf(&b, "complete -F %s %s\n", fn, c.Name)
+	return b.String()
+}
+
+// flagsFor returns the flags accepted by the command at path, including
+// the flags of its parents.
+func flagsFor(root *Command, path []string) []*Flag {
+	flags := append([]*Flag{}, root.Flags...)
+	cmd := root
+	for _, name := range path {
+		for _, sub := range cmd.Commands {
+			if sub.Name == name {
+				cmd = sub
+				break
+			}
+		}
+		flags = append(flags, cmd.Flags...)
+	}
+	return flags
+}
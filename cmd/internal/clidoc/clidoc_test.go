@@ -0,0 +1,49 @@
+package clidoc
+
+import (
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestFromFlagSet(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("output", "table", "Output format")
+	fs.Bool("no-header", false, "Supress the header")
+	fs.String("device", "", "Device")
+	c := FromFlagSet("test", "Test tool", fs, map[string][]string{"output": {"table", "json"}})
+
+	want := map[string]ValueKind{"output": ValueAny, "no-header": ValueNone, "device": ValueDevice}
+	for _, f := range c.Flags {
+		if f.Kind != want[f.Name] {
+			t.Errorf("flag %q has kind %d; want %d", f.Name, f.Kind, want[f.Name])
+		}
+	}
+
+	bash := Bash(c)
+	for _, s := range []string{
+		`":-output") COMPREPLY=($(compgen -W "table json" -- "$cur"))`,
+		`compgen -W "-device -no-header -output"`,
+		`complete -F _test test`,
+	} {
+		if !strings.Contains(bash, s) {
+			t.Errorf("bash completion does not contain %s:\n%s", s, bash)
+		}
+	}
+}
+
+func TestRoff(t *testing.T) {
+	testCases := []struct {
+		in   string
+		want string
+	}{
+		{"--device", `\-\-device`},
+		{`C:\path`, `C:\epath`},
+		{".hidden", `\&.hidden`},
+	}
+	for _, tc := range testCases {
+		if got := roff(tc.in); got != tc.want {
+			t.Errorf("roff(%q) = %q; want %q", tc.in, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package clidoc
+
+import (
+	"fmt"
+	"strings"
+)
+
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// Fish returns a fish completion script for the command.
+func Fish(c *Command) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# fish completion for %s\n", c.Name)
+	c.walk(nil, func(path []string, cmd *Command) {
+		// Condition under which the sub-commands of cmd are offered
+		subCond := "__fish_use_subcommand"
+		// Condition under which the flags of cmd are offered
+		flagCond := ""
+		if len(path) > 0 {
+			flagCond = "__fish_seen_subcommand_from " + path[len(path)-1]
+			var subs []string
+			for _, sub := range cmd.Commands {
+				subs = append(subs, sub.Name)
+			}
+			subCond = flagCond + "; and not __fish_seen_subcommand_from " + strings.Join(subs, " ")
+		}
+		for _, sub := range cmd.Commands {
+			fmt.Fprintf(&b, "complete -c %s -f -n %s -a %s -d %s\n", c.Name, fishQuote(subCond), sub.Name, fishQuote(sub.Help))
+		}
+		for _, f := range cmd.Flags {
+			fmt.Fprintf(&b, "complete -c %s", c.Name)
+			if flagCond != "" {
+				fmt.Fprintf(&b, " -n %s", fishQuote(flagCond))
+			}
+			if c.SingleDash {
+				fmt.Fprintf(&b, " -o %s", f.Name)
+			} else {
+				fmt.Fprintf(&b, " -l %s", f.Name)
+				if f.Short != 0 {
+					fmt.Fprintf(&b, " -s %c", f.Short)
+				}
+			}
+			switch {
+			case len(f.Enum) > 0:
+				fmt.Fprintf(&b, " -x -a %s", fishQuote(strings.Join(f.Enum, " ")))
+			case f.Kind == ValueDevice:
+				fmt.Fprintf(&b, " -x -a %s", fishQuote("(ls -d "+devicePattern+" 2>/dev/null)"))
+			case f.Kind == ValueFile:
+				b.WriteString(" -r -F")
+			case f.Kind == ValueAny:
+				b.WriteString(" -x")
+			}
+			fmt.Fprintf(&b, " -d %s\n", fishQuote(f.Help))
+			if f.Negatable {
+				fmt.Fprintf(&b, "complete -c %s -n %s -l no-%s -d %s\n", c.Name, fishQuote(flagCond), f.Name, fishQuote(f.Help))
+			}
+		}
+	})
+	return b.String()
+}
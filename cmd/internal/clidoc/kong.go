@@ -0,0 +1,51 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package clidoc
+
+import (
+	"fmt"
+
+	"github.com/alecthomas/kong"
+)
+
+// CompletionCmd can be added to a kong CLI as "completion" command. The
+// scripts are printed before any flag validation, so that required flags of
+// the application do not have to be given.
+type CompletionCmd struct {
+	Bash bashCmd `cmd:"" help:"Prints the bash completion script"`
+	Zsh  zshCmd  `cmd:"" help:"Prints the zsh completion script"`
+	Fish fishCmd `cmd:"" help:"Prints the fish completion script"`
+}
+
+type bashCmd struct{}
+type zshCmd struct{}
+type fishCmd struct{}
+
+func (bashCmd) BeforeApply(ctx *kong.Context) error {
+	fmt.Fprint(ctx.Stdout, Bash(FromKong(ctx.Model)))
+	ctx.Exit(0)
+	return nil
+}
+
+func (zshCmd) BeforeApply(ctx *kong.Context) error {
+	fmt.Fprint(ctx.Stdout, Zsh(FromKong(ctx.Model)))
+	ctx.Exit(0)
+	return nil
+}
+
+func (fishCmd) BeforeApply(ctx *kong.Context) error {
+	fmt.Fprint(ctx.Stdout, Fish(FromKong(ctx.Model)))
+	ctx.Exit(0)
+	return nil
+}
+
+// ManFlag can be added to a kong CLI as "--help-man" flag printing the man page.
+type ManFlag bool
+
+func (ManFlag) BeforeApply(ctx *kong.Context) error {
+	fmt.Fprint(ctx.Stdout, Man(FromKong(ctx.Model), 8))
+	ctx.Exit(0)
+	return nil
+}
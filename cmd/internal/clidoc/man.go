@@ -0,0 +1,77 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package clidoc
+
+import (
+	"fmt"
+	"strings"
+)
+
+var roffEscaper = strings.NewReplacer(`\`, `\e`, `-`, `\-`, `'`, `\(aq`)
+
+func roff(s string) string {
+	s = roffEscaper.Replace(s)
+	// Lines starting with a dot would be taken as requests
+	if strings.HasPrefix(s, ".") {
+		s = `\&` + s
+	}
+	return s
+}
+
+func manFlag(b *strings.Builder, c *Command, f *Flag) {
+	var names []string
+	for _, n := range c.flagNames(f) {
+		names = append(names, `\fB`+roff(n)+`\fR`)
+	}
+	b.WriteString(".TP\n")
+	b.WriteString(strings.Join(names, ", "))
+	switch {
+	case len(f.Enum) > 0:
+		fmt.Fprintf(b, `=\fI%s\fR`, roff(strings.Join(f.Enum, "|")))
+	case f.Kind != ValueNone:
+		fmt.Fprintf(b, `=\fI%s\fR`, roff(strings.ToUpper(f.Name)))
+	}
+	fmt.Fprintf(b, "\n%s\n", roff(f.Help))
+}
+
+// Man returns a man page in roff format for the command.
+func Man(c *Command, section int) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, ".TH %s %d\n", roff(strings.ToUpper(c.Name)), section)
+	fmt.Fprintf(&b, ".SH NAME\n%s \\- %s\n", roff(c.Name), roff(c.Help))
+	b.WriteString(".SH SYNOPSIS\n")
+	fmt.Fprintf(&b, ".B %s\n", roff(c.Name))
+	if len(c.Commands) > 0 {
+		b.WriteString("[\\fIFLAGS\\fR] \\fICOMMAND\\fR [\\fIARGS\\fR]\n")
+	} else {
+		b.WriteString("[\\fIFLAGS\\fR]\n")
+	}
+	if len(c.Flags) > 0 {
+		b.WriteString(".SH FLAGS\n")
+		for _, f := range c.Flags {
+			manFlag(&b, c, f)
+		}
+	}
+	if len(c.Commands) > 0 {
+		b.WriteString(".SH COMMANDS\n")
+		c.walk(nil, func(path []string, cmd *Command) {
+			if len(path) == 0 || len(cmd.Commands) > 0 {
+				return
+			}
+			fmt.Fprintf(&b, ".SS %s", roff(joinPath(path)))
+			for _, a := range cmd.Args {
+				fmt.Fprintf(&b, " \\fI%s\\fR", roff(strings.ToUpper(a.Name)))
+			}
+			fmt.Fprintf(&b, "\n%s\n", roff(cmd.Help))
+			for _, a := range cmd.Args {
+				fmt.Fprintf(&b, ".TP\n\\fI%s\\fR\n%s\n", roff(strings.ToUpper(a.Name)), roff(a.Help))
+			}
+			for _, f := range cmd.Flags {
+				manFlag(&b, cmd, f)
+			}
+		})
+	}
+	return b.String()
+}
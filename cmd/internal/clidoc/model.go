@@ -0,0 +1,149 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Shell completion and man page generation for the command line tools
+
+package clidoc
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+// ValueKind describes how the value of a flag or argument is completed.
+type ValueKind int
+
+const (
+	ValueNone ValueKind = iota
+	ValueAny
+	ValueFile
+	ValueDevice
+)
+
+// Command is the common description of a CLI built from either a kong
+// model or a flag.FlagSet.
+type Command struct {
+	Name     string
+	Help     string
+	Flags    []*Flag
+	Args     []*Arg
+	Commands []*Command
+	// Flags are written with a single dash, as with the flag package.
+	SingleDash bool
+}
+
+type Flag struct {
+	Name      string
+	Short     rune
+	Help      string
+	Kind      ValueKind
+	Enum      []string
+	Negatable bool
+}
+
+type Arg struct {
+	Name string
+	Help string
+	Kind ValueKind
+	Enum []string
+}
+
+func valueKind(name string, typ string) ValueKind {
+	switch {
+	case name == "device":
+		return ValueDevice
+	case typ == "existingfile" || typ == "path" || typ == "existingdir":
+		return ValueFile
+	}
+	return ValueAny
+}
+
+// FromKong converts a kong application model.
+func FromKong(app *kong.Application) *Command {
+	return fromKongNode(app.Node)
+}
+
+func fromKongNode(n *kong.Node) *Command {
+	c := &Command{Name: n.Name, Help: n.Help}
+	for _, f := range n.Flags {
+		if f.Hidden {
+			continue
+		}
+		cf := &Flag{
+			Name:      f.Name,
+			Short:     f.Short,
+			Help:      f.Help,
+			Negatable: f.Tag.Negatable,
+		}
+		if !f.IsBool() && !f.IsCounter() {
+			cf.Kind = valueKind(f.Name, f.Tag.Type)
+			if f.Enum != "" {
+				cf.Enum = f.EnumSlice()
+			}
+		}
+		c.Flags = append(c.Flags, cf)
+	}
+	for _, p := range n.Positional {
+		a := &Arg{
+			Name: p.Name,
+			Help: p.Help,
+			Kind: valueKind(p.Name, p.Tag.Type),
+		}
+		if p.Enum != "" {
+			a.Enum = p.EnumSlice()
+		}
+		c.Args = append(c.Args, a)
+	}
+	for _, child := range n.Children {
+		if child.Hidden || child.Type != kong.CommandNode {
+			continue
+		}
+		c.Commands = append(c.Commands, fromKongNode(child))
+	}
+	return c
+}
+
+// FromFlagSet converts a command using the flag package. Enum values of flags
+// can be passed in enums, keyed by flag name.
+func FromFlagSet(name string, help string, fs *flag.FlagSet, enums map[string][]string) *Command {
+	c := &Command{Name: name, Help: help, SingleDash: true}
+	fs.VisitAll(func(f *flag.Flag) {
+		cf := &Flag{Name: f.Name, Help: f.Usage, Enum: enums[f.Name]}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); !ok || !b.IsBoolFlag() {
+			cf.Kind = valueKind(f.Name, "")
+		}
+		c.Flags = append(c.Flags, cf)
+	})
+	return c
+}
+
+// flagNames returns all spellings of a flag as typed on the command line.
+func (c *Command) flagNames(f *Flag) []string {
+	if c.SingleDash {
+		return []string{"-" + f.Name}
+	}
+	names := []string{"--" + f.Name}
+	if f.Negatable {
+		names = append(names, "--no-"+f.Name)
+	}
+	if f.Short != 0 {
+		names = append(names, "-"+string(f.Short))
+	}
+	return names
+}
+
+// walk calls fn for c and all its sub-commands with the path of command
+// names leading to it, not including the program name.
+func (c *Command) walk(path []string, fn func(path []string, c *Command)) {
+	fn(path, c)
+	for _, sub := range c.Commands {
+		sub.walk(append(append([]string{}, path...), sub.Name), fn)
+	}
+}
+
+func joinPath(path []string) string {
+	return strings.Join(path, " ")
+}
@@ -0,0 +1,15 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package clidoc
+
+import (
+	"fmt"
+)
+
+// Zsh returns a zsh completion script for the command, using the bash
+// completion through zsh's bashcompinit.
+func Zsh(c *Command) string {
+	return fmt.Sprintf("#compdef %s\nautoload -U +X bashcompinit && bashcompinit\n%s", c.Name, Bash(c))
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sedcli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// BatchResult is the outcome of a command run on one of several devices.
+type BatchResult struct {
+	Device string
+	Output []byte
+	Err    error
+}
+
+// FindDevices returns all block devices that support TCG Storage. Devices
+// are matched by path or name against the include and exclude globs; if no
+// includes are given, all devices are included.
+func FindDevices(include []string, exclude []string) ([]string, error) {
+	match := func(globs []string, devpath string) bool {
+		for _, g := range globs {
+			if ok, _ := filepath.Match(g, devpath); ok {
+				return true
+			}
+			if ok, _ := filepath.Match(g, filepath.Base(devpath)); ok {
+				return true
+			}
+		}
+		return false
+	}
+	for _, g := range append(append([]string{}, include...), exclude...) {
+		if _, err := filepath.Match(g, ""); err != nil {
+			return nil, fmt.Errorf("invalid glob %q: %v", g, err)
+		}
+	}
+
+	sysblk, err := os.ReadDir("/sys/class/block/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to enumerate block devices: %v", err)
+	}
+	var devs []string
+	for _, fi := range sysblk {
+		devname := fi.Name()
+		// Partitions have no device link
+		if _, err := os.Stat(filepath.Join("/sys/class/block", devname, "device")); os.IsNotExist(err) {
+			continue
+		}
+		devpath := filepath.Join("/dev", devname)
+		if len(include) > 0 && !match(include, devpath) {
+			continue
+		}
+		if match(exclude, devpath) {
+			continue
+		}
+		coreObj, err := NewCore(devpath)
+		if err != nil {
+			continue
+		}
+		coreObj.Close()
+		devs = append(devs, devpath)
+	}
+	return devs, nil
+}
+
+// RunBatch runs fn for every device, at most parallel of them at a time. The
+// output of each device is buffered so that it is not interleaved. Results
+// are returned in the order of the devices.
+func RunBatch(devices []string, parallel int, fn func(device string, w io.Writer) error) []BatchResult {
+	results := make([]BatchResult, len(devices))
+	work := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < parallel || w == 0; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				var buf bytes.Buffer
+				err := fn(devices[i], &buf)
+				results[i] = BatchResult{Device: devices[i], Output: buf.Bytes(), Err: err}
+			}
+		}()
+	}
+	for i := range devices {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	return results
+}
+
+// ReportBatch prints the output of every device under a header, followed by
+// a summary of the failed devices. An error is returned if any failed.
+func ReportBatch(w io.Writer, results []BatchResult) error {
+	failed := 0
+	for _, r := range results {
+		fmt.Fprintf(w, "== %s ==\n", r.Device)
+		w.Write(r.Output)
+		if r.Err != nil {
+			failed++
+			fmt.Fprintf(w, "Error: %v\n", r.Err)
+		}
+	}
+	if failed == 0 {
+		return nil
+	}
+	fmt.Fprintf(w, "\nFailed devices:\n")
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Fprintf(w, "  %s: %v\n", r.Device, r.Err)
+		}
+	}
+	return fmt.Errorf("%d of %d devices failed", failed, len(results))
+}
@@ -0,0 +1,42 @@
+package sedcli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestRunBatch(t *testing.T) {
+	devs := []string{"/dev/sda", "/dev/sdb", "/dev/sdc"}
+	for _, tc := range []struct {
+		name     string
+		parallel int
+		fail     string
+		want     string
+		wantErr  bool
+	}{
+		{"All succeed", 2, "", "== /dev/sda ==\nok /dev/sda\n== /dev/sdb ==\nok /dev/sdb\n== /dev/sdc ==\nok /dev/sdc\n", false},
+		{"One fails", 0, "/dev/sdb", "== /dev/sda ==\nok /dev/sda\n== /dev/sdb ==\nok /dev/sdb\nError: locked out\n== /dev/sdc ==\nok /dev/sdc\n" +
+			"\nFailed devices:\n  /dev/sdb: locked out\n", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			res := RunBatch(devs, tc.parallel, func(device string, w io.Writer) error {
+				fmt.Fprintf(w, "ok %s\n", device)
+				if device == tc.fail {
+					return errors.New("locked out")
+				}
+				return nil
+			})
+			var buf bytes.Buffer
+			err := ReportBatch(&buf, res)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("ReportBatch() error = %v; wantErr %v", err, tc.wantErr)
+			}
+			if buf.String() != tc.want {
+				t.Errorf("ReportBatch() printed %q, want %q", buf.String(), tc.want)
+			}
+		})
+	}
+}
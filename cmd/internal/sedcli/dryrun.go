@@ -0,0 +1,24 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sedcli
+
+import (
+	"fmt"
+	"io"
+)
+
+// DryRunFlag is the --dry-run flag of destructive commands, meant to be
+// embedded in their kong command structs.
+type DryRunFlag struct {
+	DryRun bool `flag:"" help:"Check authentication and parameters, print the method calls that would be issued and stop before changing the drive"`
+}
+
+// PrintDryRun prints the method calls a destructive command would have issued.
+func PrintDryRun(w io.Writer, calls ...string) {
+	fmt.Fprintln(w, "Dry run, the drive has not been changed. The following method calls would be issued:")
+	for _, c := range calls {
+		fmt.Fprintf(w, "  %s\n", c)
+	}
+}
@@ -0,0 +1,12 @@
+// Copyright (c) 2021 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sedcli
+
+import "github.com/open-source-firmware/go-tcg-storage/pkg/sed"
+
+// HashSedutilDTA derives a PIN from a password like sedutil-cli does.
+func HashSedutilDTA(password string, serial string) []byte {
+	return sed.HashSedutilDTA(password, serial)
+}
@@ -0,0 +1,156 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Shadow MBR operations shared by gosedctl and sedlockctl
+
+package sedcli
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/locking"
+)
+
+// ReadMBR writes the contents of the MBR table to w. If size is positive
+// at most size bytes are read.
+func ReadMBR(w io.Writer, l *locking.LockingSP, size int) error {
+	mbi, err := table.MBR_TableInfo(l.Session)
+	if err != nil {
+		return fmt.Errorf("table.MBR_TableInfo failed: %v", err)
+	}
+	mbuf := make([]byte, mbi.SuggestBufferSize(l.Session))
+	sz := mbi.Size
+	if size > 0 && uint32(size) < sz {
+		sz = uint32(size)
+	}
+	pos := uint32(0)
+	chk := uint32(len(mbuf))
+	for i := sz; i != 0; i -= chk {
+		if n, err := table.MBR_Read(l.Session, mbuf, pos); n != len(mbuf) || err != nil {
+			return fmt.Errorf("table.MBR_Read failed: %v (read: %d)", err, n)
+		}
+		pos += chk
+		if i < chk {
+			w.Write(mbuf[:i])
+			break
+		} else {
+			w.Write(mbuf)
+		}
+	}
+	return nil
+}
+
+// WriteMBR uploads img to the MBR table starting at offset, printing the
+// progress to stderr. Unless verify is false the MBR is read back and
+// compared to the image afterwards. With dryRun the parameters are only
+// validated and the planned writes are printed to w.
+func WriteMBR(w io.Writer, l *locking.LockingSP, img []byte, offset uint32, verify bool, dryRun bool) error {
+	mbi, err := table.MBR_TableInfo(l.Session)
+	if err != nil {
+		return fmt.Errorf("table.MBR_TableInfo failed: %v", err)
+	}
+	info, err := table.ValidatePBAImage(img, mbi)
+	if err != nil {
+		return err
+	}
+	for _, warn := range info.Warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warn)
+	}
+	if offset > uint32(len(img)) {
+		return fmt.Errorf("offset %d is beyond the end of the %d byte image", offset, len(img))
+	}
+	if mbi.MandatoryWriteGranularity > 1 && offset%mbi.MandatoryWriteGranularity != 0 {
+		return fmt.Errorf("offset %d is not a multiple of the write granularity %d", offset, mbi.MandatoryWriteGranularity)
+	}
+
+	chk := uint32(mbi.SuggestBufferSize(l.Session))
+	total := uint32(len(img))
+	if dryRun {
+		calls := []string{fmt.Sprintf("LockingSP: MBR.Set %d bytes at offset %d in %d chunks of up to %d bytes",
+			total-offset, offset, (total-offset+chk-1)/chk, chk)}
+		if verify {
+			calls = append(calls, fmt.Sprintf("LockingSP: MBR.Get %d bytes to verify the image", total))
+		}
+		PrintDryRun(w, calls...)
+		return nil
+	}
+	wrote := false
+	opts := []table.LoadPBAOpt{
+		table.WithStartOffset(offset),
+		table.WithProgress(func(verifying bool, done, total uint32) {
+			if verifying {
+				if wrote {
+					fmt.Fprintln(os.Stderr)
+					wrote = false
+				}
+				fmt.Fprintf(os.Stderr, "\rVerifying MBR: %d / %d bytes", done, total)
+			} else {
+				wrote = true
+				fmt.Fprintf(os.Stderr, "\rWriting MBR: %d / %d bytes (%d%%)", done, total, uint64(done)*100/uint64(total))
+			}
+		}),
+	}
+	if verify {
+		opts = append(opts, table.WithVerify())
+	}
+	err = table.LoadPBAImage(l.Session, img, opts...)
+	fmt.Fprintln(os.Stderr)
+	var werr *table.PBAWriteError
+	if errors.As(err, &werr) {
+		return fmt.Errorf("%v (resume with --offset=%d)", werr, werr.Offset)
+	}
+	if err != nil {
+		return err
+	}
+	if verify {
+		fmt.Fprintf(w, "MBR verified, sha256 %x\n", sha256.Sum256(img))
+	}
+	return nil
+}
+
+// VerifyMBR reads back the start of the MBR table and compares it to img,
+// printing the progress to stderr and the result to w.
+func VerifyMBR(w io.Writer, l *locking.LockingSP, img []byte) error {
+	mbi, err := table.MBR_TableInfo(l.Session)
+	if err != nil {
+		return fmt.Errorf("table.MBR_TableInfo failed: %v", err)
+	}
+	if uint64(len(img)) > uint64(mbi.Size) {
+		return fmt.Errorf("image is %d bytes, but the MBR table only holds %d bytes", len(img), mbi.Size)
+	}
+	chk := uint32(mbi.SuggestBufferSize(l.Session))
+	total := uint32(len(img))
+	rb := make([]byte, 0, len(img))
+	mbuf := make([]byte, chk)
+	for pos := uint32(0); pos < total; pos += chk {
+		n := chk
+		if total-pos < n {
+			n = total - pos
+		}
+		got, err := table.MBR_Read(l.Session, mbuf[:n], pos)
+		if err != nil {
+			return fmt.Errorf("table.MBR_Read failed at offset %d: %v", pos, err)
+		}
+		rb = append(rb, mbuf[:got]...)
+		fmt.Fprintf(os.Stderr, "\rVerifying MBR: %d / %d bytes", len(rb), total)
+	}
+	fmt.Fprintln(os.Stderr)
+	want := sha256.Sum256(img)
+	got := sha256.Sum256(rb)
+	if !bytes.Equal(want[:], got[:]) {
+		off := 0
+		for off < len(rb) && rb[off] == img[off] {
+			off++
+		}
+		return fmt.Errorf("verification failed: MBR sha256 %x does not match image sha256 %x, first difference at offset %d", got, want, off)
+	}
+	fmt.Fprintf(w, "MBR verified, sha256 %x\n", got)
+	return nil
+}
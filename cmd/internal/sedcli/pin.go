@@ -0,0 +1,59 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sedcli
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Encodings of binary PINs such as the MSID that survive copy and paste
+// through terminals and locales byte-exact. As hash method of a password
+// they mean that the password is the encoded PIN, used as-is.
+const (
+	PINFormatHex    = "hex"
+	PINFormatBase64 = "base64"
+	// Hex dump with offsets and ASCII column, for display only
+	PINFormatDump = "dump"
+)
+
+// FormatPIN renders a PIN in the given format.
+func FormatPIN(pin []byte, format string) (string, error) {
+	switch format {
+	case "", PINFormatHex:
+		return hex.EncodeToString(pin), nil
+	case PINFormatBase64:
+		return base64.StdEncoding.EncodeToString(pin), nil
+	case PINFormatDump:
+		return hex.Dump(pin), nil
+	default:
+		return "", fmt.Errorf("unknown PIN format %q", format)
+	}
+}
+
+// ParsePIN decodes a PIN rendered by FormatPIN. Whitespace is ignored, as
+// are colons between hex bytes.
+func ParsePIN(s string, format string) ([]byte, error) {
+	if format == "" {
+		format = PINFormatHex
+	}
+	s = strings.Join(strings.Fields(s), "")
+	var pin []byte
+	var err error
+	switch format {
+	case PINFormatHex:
+		pin, err = hex.DecodeString(strings.ReplaceAll(s, ":", ""))
+	case PINFormatBase64:
+		pin, err = base64.StdEncoding.DecodeString(s)
+	default:
+		return nil, fmt.Errorf("unknown PIN format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s PIN failed: %v", format, err)
+	}
+	return pin, nil
+}
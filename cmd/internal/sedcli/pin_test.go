@@ -0,0 +1,50 @@
+package sedcli
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPINFormat(t *testing.T) {
+	pin := []byte{0x00, 'M', 'S', 'I', 'D', 0xff, '\n', 0x1b}
+	for _, format := range []string{PINFormatHex, PINFormatBase64} {
+		s, err := FormatPIN(pin, format)
+		if err != nil {
+			t.Fatalf("FormatPIN(%s) failed: %v", format, err)
+		}
+		got, err := ParsePIN(s, format)
+		if err != nil {
+			t.Fatalf("ParsePIN(%q, %s) failed: %v", s, format, err)
+		}
+		if !bytes.Equal(got, pin) {
+			t.Errorf("%s round trip: got %x want %x", format, got, pin)
+		}
+	}
+}
+
+func TestParsePIN(t *testing.T) {
+	tests := []struct {
+		in     string
+		format string
+		want   []byte
+		err    bool
+	}{
+		{"004d5349", PINFormatHex, []byte{0x00, 'M', 'S', 'I'}, false},
+		{"00:4D:53:49", "", []byte{0x00, 'M', 'S', 'I'}, false},
+		{" 00 4d\n53 49 ", PINFormatHex, []byte{0x00, 'M', 'S', 'I'}, false},
+		{"AE1TSQ==", PINFormatBase64, []byte{0x00, 'M', 'S', 'I'}, false},
+		{"004d534", PINFormatHex, nil, true},
+		{"MSID", PINFormatHex, nil, true},
+		{"AE1TSQ==", PINFormatDump, nil, true},
+	}
+	for _, tc := range tests {
+		got, err := ParsePIN(tc.in, tc.format)
+		if (err != nil) != tc.err {
+			t.Errorf("ParsePIN(%q, %q) error = %v, want error %v", tc.in, tc.format, err, tc.err)
+			continue
+		}
+		if !bytes.Equal(got, tc.want) {
+			t.Errorf("ParsePIN(%q, %q) = %x, want %x", tc.in, tc.format, got, tc.want)
+		}
+	}
+}
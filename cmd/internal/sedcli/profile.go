@@ -0,0 +1,164 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sedcli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/locking"
+	"gopkg.in/yaml.v3"
+)
+
+// Profile is the file format of device profiles, which describe the desired
+// state of a drive for locking.Provision. JSON profiles are read as well, as
+// JSON is a subset of YAML.
+//
+// Passwords may be given as "env:NAME" to read them from the environment
+// variable NAME instead of storing them in the profile.
+type Profile struct {
+	// Password of SID
+	Password string `yaml:"password"`
+	// Password of Admin1, defaults to the SID password
+	Admin1Password string `yaml:"admin1_password"`
+	// Hash method of the passwords, defaults to HashSedutil
+	Hash string `yaml:"hash"`
+
+	Users []struct {
+		Name     string `yaml:"name"`
+		Enabled  bool   `yaml:"enabled"`
+		Password string `yaml:"password"`
+	} `yaml:"users"`
+
+	Ranges []struct {
+		Index int `yaml:"index"`
+		// In sectors or bytes with a unit suffix, see ParseSectors
+		Start            string `yaml:"start"`
+		Length           string `yaml:"length"`
+		ReadLockEnabled  bool   `yaml:"read_lock_enabled"`
+		WriteLockEnabled bool   `yaml:"write_lock_enabled"`
+		// "power-cycle", "hardware" or "hot-plug"
+		LockOnReset []string `yaml:"lock_on_reset"`
+		Name        *string  `yaml:"name"`
+	} `yaml:"ranges"`
+
+	MBREnabled *bool `yaml:"mbr_enabled"`
+
+	SingleUserMode *struct {
+		Ranges      []int `yaml:"ranges"`
+		AdminPolicy bool  `yaml:"admin_policy"`
+	} `yaml:"single_user_mode"`
+}
+
+var resetTypeNames = map[string]table.ResetType{
+	"power-cycle": table.ResetPowerOff,
+	"hardware":    table.ResetHardware,
+	"hot-plug":    table.ResetHotPlug,
+}
+
+// LoadProfile reads a device profile. Unknown keys are rejected, so that a
+// misspelled setting is not silently ignored.
+func LoadProfile(r io.Reader) (*Profile, error) {
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	p := &Profile{}
+	if err := dec.Decode(p); err != nil {
+		return nil, fmt.Errorf("parsing profile failed: %v", err)
+	}
+	if p.Password == "" {
+		return nil, fmt.Errorf("profile has no password")
+	}
+	return p, nil
+}
+
+func profilePassword(v string) (string, error) {
+	name := strings.TrimPrefix(v, "env:")
+	if name == v {
+		return v, nil
+	}
+	pw, ok := os.LookupEnv(name)
+	if !ok || pw == "" {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return pw, nil
+}
+
+// ProvisionProfile resolves the passwords and sizes of the profile for the
+// given device.
+func (p *Profile) ProvisionProfile(coreObj *core.Core) (*locking.ProvisionProfile, error) {
+	hash := func(v string) ([]byte, error) {
+		pw, err := profilePassword(v)
+		if err != nil {
+			return nil, err
+		}
+		return HashPassword(coreObj, pw, p.Hash)
+	}
+	pp := &locking.ProvisionProfile{MBREnabled: p.MBREnabled}
+	var err error
+	if pp.SIDPIN, err = hash(p.Password); err != nil {
+		return nil, err
+	}
+	if p.Admin1Password != "" {
+		if pp.Admin1PIN, err = hash(p.Admin1Password); err != nil {
+			return nil, err
+		}
+	}
+	for _, u := range p.Users {
+		up := locking.UserProfile{Name: u.Name, Enabled: u.Enabled}
+		if u.Password != "" {
+			if up.PIN, err = hash(u.Password); err != nil {
+				return nil, err
+			}
+		}
+		pp.Users = append(pp.Users, up)
+	}
+
+	bs := uint64(512)
+	if g := coreObj.DiskInfo.Level0Discovery.Geometry; g != nil && g.LogicalBlockSize > 0 {
+		bs = uint64(g.LogicalBlockSize)
+	}
+	for _, r := range p.Ranges {
+		rp := locking.RangeProfile{
+			Index:            r.Index,
+			ReadLockEnabled:  r.ReadLockEnabled,
+			WriteLockEnabled: r.WriteLockEnabled,
+			Name:             r.Name,
+		}
+		if r.Start != "" {
+			v, err := ParseSectors(r.Start, bs)
+			if err != nil {
+				return nil, fmt.Errorf("range %d: %v", r.Index, err)
+			}
+			rp.Start = locking.LockRange(v)
+		}
+		if r.Length != "" {
+			v, err := ParseSectors(r.Length, bs)
+			if err != nil {
+				return nil, fmt.Errorf("range %d: %v", r.Index, err)
+			}
+			rp.Length = locking.LockRange(v)
+		}
+		if r.LockOnReset != nil {
+			rp.LockOnReset = []table.ResetType{}
+			for _, n := range r.LockOnReset {
+				t, ok := resetTypeNames[n]
+				if !ok {
+					return nil, fmt.Errorf("range %d: unknown reset type %q", r.Index, n)
+				}
+				rp.LockOnReset = append(rp.LockOnReset, t)
+			}
+		}
+		pp.Ranges = append(pp.Ranges, rp)
+	}
+
+	if sum := p.SingleUserMode; sum != nil {
+		pp.SingleUserMode = &locking.SUMProfile{Ranges: sum.Ranges, AdminPolicy: sum.AdminPolicy}
+	}
+	return pp, nil
+}
@@ -0,0 +1,52 @@
+package sedcli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadProfile(t *testing.T) {
+	testCases := []struct {
+		name    string
+		in      string
+		wantErr bool
+	}{
+		{"YAML", `
+password: env:SID_PASSWORD
+users:
+  - name: User1
+    enabled: true
+ranges:
+  - index: 1
+    start: 2048
+    length: 1GiB
+    read_lock_enabled: true
+    lock_on_reset: [power-cycle]
+mbr_enabled: false
+`, false},
+		{"JSON", `{"password": "secret", "ranges": [{"index": 1, "start": "0", "length": "8"}]}`, false},
+		{"Misspelled key", "password: secret\nmbr_enable: true\n", true},
+		{"No password", "mbr_enabled: true\n", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			p, err := LoadProfile(strings.NewReader(tc.in))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("LoadProfile() error = %v; wantErr %v", err, tc.wantErr)
+			}
+			if err == nil && p.Ranges[0].Index != 1 {
+				t.Errorf("LoadProfile() range index = %d, want 1", p.Ranges[0].Index)
+			}
+		})
+	}
+}
+
+func TestLoadProfileSizes(t *testing.T) {
+	p, err := LoadProfile(strings.NewReader("password: x\nranges:\n  - index: 1\n    start: 2048\n    length: 1GiB\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Ranges[0].Start != "2048" || p.Ranges[0].Length != "1GiB" {
+		t.Errorf("LoadProfile() sizes = %q %q, want \"2048\" \"1GiB\"", p.Ranges[0].Start, p.Ranges[0].Length)
+	}
+}
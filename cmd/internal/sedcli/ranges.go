@@ -0,0 +1,267 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Locking range operations shared by gosedctl and sedlockctl
+
+package sedcli
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/locking"
+)
+
+// RangeState is the JSON representation of a range as emitted by "list --output json".
+// Fields must only be added, never renamed or removed, to keep scripts working.
+type RangeState struct {
+	Index            int     `json:"index"`
+	UID              string  `json:"uid"`
+	Name             *string `json:"name"`
+	Global           bool    `json:"global"`
+	Start            uint64  `json:"start"`
+	End              uint64  `json:"end"`
+	ReadLockEnabled  bool    `json:"read_lock_enabled"`
+	WriteLockEnabled bool    `json:"write_lock_enabled"`
+	ReadLocked       bool    `json:"read_locked"`
+	WriteLocked      bool    `json:"write_locked"`
+}
+
+func RangeStates(l *locking.LockingSP) []RangeState {
+	res := []RangeState{}
+	for i, r := range l.Ranges {
+		res = append(res, RangeState{
+			Index:            i,
+			UID:              hex.EncodeToString(r.UID[:]),
+			Name:             r.Name,
+			Global:           r == l.GlobalRange,
+			Start:            uint64(r.Start),
+			End:              uint64(r.End),
+			ReadLockEnabled:  r.ReadLockEnabled,
+			WriteLockEnabled: r.WriteLockEnabled,
+			ReadLocked:       r.ReadLocked,
+			WriteLocked:      r.WriteLocked,
+		})
+	}
+	return res
+}
+
+// ListRanges prints all ranges accessible in the session, either as text or as json.
+func ListRanges(w io.Writer, l *locking.LockingSP, output string) error {
+	if len(l.Ranges) == 0 {
+		return fmt.Errorf("no available locking ranges as this user")
+	}
+	if output == "json" {
+		b, err := json.MarshalIndent(RangeStates(l), "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, string(b))
+		return nil
+	}
+	for i, r := range l.Ranges {
+		strr := "whole disk"
+		if r.End > 0 {
+			strr = fmt.Sprintf("%d to %d", r.Start, r.End)
+		}
+		if !r.WriteLockEnabled && !r.ReadLockEnabled {
+			strr = "disabled"
+		} else {
+			if r.WriteLocked {
+				strr += " [write locked]"
+			}
+			if r.ReadLocked {
+				strr += " [read locked]"
+			}
+		}
+		if r == l.GlobalRange {
+			strr += " [global]"
+		}
+		if r.Name != nil {
+			strr += fmt.Sprintf(" [name=%q]", *r.Name)
+		}
+		fmt.Fprintf(w, "Range %3d: %s\n", i, strr)
+	}
+	return nil
+}
+
+// FindRange looks up a range either by its index in the list output or by its
+// name. An empty spec selects the global range.
+func FindRange(l *locking.LockingSP, spec string) (int, *locking.Range, error) {
+	if spec == "" {
+		for i, r := range l.Ranges {
+			if r == l.GlobalRange {
+				return i, r, nil
+			}
+		}
+		return 0, nil, fmt.Errorf("global range is not accessible as this user")
+	}
+	if i, err := strconv.Atoi(spec); err == nil {
+		if i < 0 || i >= len(l.Ranges) {
+			return 0, nil, fmt.Errorf("range %d does not exist (%d ranges available)", i, len(l.Ranges))
+		}
+		return i, l.Ranges[i], nil
+	}
+	if r, ok := l.RangeByName(spec); ok {
+		for i, rr := range l.Ranges {
+			if rr == r {
+				return i, r, nil
+			}
+		}
+	}
+	return 0, nil, fmt.Errorf("no range named %q", spec)
+}
+
+// Lock locks reading and/or writing of the given range.
+func Lock(l *locking.LockingSP, spec string, read bool, write bool) error {
+	i, r, err := FindRange(l, spec)
+	if err != nil {
+		return err
+	}
+	if err := r.Lock(read, write); err != nil {
+		return fmt.Errorf("lock range %d failed: %v", i, err)
+	}
+	return nil
+}
+
+// VerifyOptions returns the options for Unlock that confirm the unlock took
+// effect: the range is read again from the drive and, if device is a block
+// device, its first block is read from the device. The returned function
+// closes the device.
+func VerifyOptions(device string) ([]locking.UnlockOpt, func()) {
+	opts := []locking.UnlockOpt{locking.WithVerify()}
+	fi, err := os.Stat(device)
+	if err != nil || fi.Mode()&os.ModeDevice == 0 || fi.Mode()&os.ModeCharDevice != 0 {
+		return opts, func() {}
+	}
+	f, err := os.Open(device)
+	if err != nil {
+		return opts, func() {}
+	}
+	return append(opts, locking.WithVerifyRead(f)), func() { f.Close() }
+}
+
+// Unlock unlocks reading and/or writing of the given range.
+func Unlock(l *locking.LockingSP, spec string, read bool, write bool, opts ...locking.UnlockOpt) error {
+	i, r, err := FindRange(l, spec)
+	if err != nil {
+		return err
+	}
+	if err := r.Unlock(read, write, opts...); err != nil {
+		return fmt.Errorf("unlock range %d failed: %v", i, err)
+	}
+	return nil
+}
+
+// LockAll locks all ranges accessible in the session completely.
+func LockAll(l *locking.LockingSP) error {
+	for i := range l.Ranges {
+		if err := Lock(l, strconv.Itoa(i), true, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UnlockAll unlocks all ranges accessible in the session completely.
+func UnlockAll(l *locking.LockingSP) error {
+	for i := range l.Ranges {
+		if err := Unlock(l, strconv.Itoa(i), true, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateRange configures an unused range to cover the given area, which may
+// be given in sectors or bytes (see ParseSectors), and prints the new range.
+// A non-empty name is set on the range, so that it can be referred to by
+// name afterwards.
+func CreateRange(w io.Writer, l *locking.LockingSP, start string, length string, readLock bool, writeLock bool, grant string, name string) error {
+	bs := l.LBAToBytes(1)
+	s, err := ParseSectors(start, bs)
+	if err != nil {
+		return err
+	}
+	n, err := ParseSectors(length, bs)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("range length must be non-zero")
+	}
+	r, err := l.CreateRange(locking.LockRange(s), locking.LockRange(n))
+	if err != nil {
+		return fmt.Errorf("CreateRange failed: %v", err)
+	}
+	if err := r.Enable(readLock, writeLock); err != nil {
+		return fmt.Errorf("enabling locking failed: %v", err)
+	}
+	if name != "" {
+		if err := r.SetName(name); err != nil {
+			return fmt.Errorf("SetName failed: %v", err)
+		}
+	}
+	if grant != "" {
+		if err := r.AddUser(grant); err != nil {
+			return fmt.Errorf("granting %s access failed: %v", grant, err)
+		}
+	}
+	for i, rr := range l.Ranges {
+		if rr == r {
+			fmt.Fprintf(w, "Range %3d: %d to %d\n", i, r.Start, r.End)
+		}
+	}
+	return nil
+}
+
+// DeleteRange resets a range to its unconfigured defaults.
+func DeleteRange(l *locking.LockingSP, spec string) error {
+	i, r, err := FindRange(l, spec)
+	if err != nil {
+		return err
+	}
+	if err := r.Reset(); err != nil {
+		return fmt.Errorf("reset of range %d failed: %v", i, err)
+	}
+	return nil
+}
+
+// Erase cryptographically erases a range. As this destroys all data on the
+// range, the caller has to confirm it explicitly. With dryRun the range is
+// only looked up and the method call that would erase it is printed to w.
+func Erase(w io.Writer, l *locking.LockingSP, spec string, confirmed bool, dryRun bool) error {
+	i, r, err := FindRange(l, spec)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		call := fmt.Sprintf("LockingSP: Band %x.Erase", r.UID)
+		if l.Session.ProtocolLevel != core.ProtocolLevelEnterprise {
+			lr, err := table.Locking_Get(l.Session, r.UID)
+			if err != nil {
+				return fmt.Errorf("reading active key failed: %v", err)
+			}
+			if lr.ActiveKey == nil {
+				return fmt.Errorf("range has no active key, media encryption not supported?")
+			}
+			call = fmt.Sprintf("LockingSP: K_AES %x.GenKey", *lr.ActiveKey)
+		}
+		PrintDryRun(w, call+fmt.Sprintf(" (erases range %d)", i))
+		return nil
+	}
+	if !confirmed {
+		return fmt.Errorf("erasing range %d destroys all data on it, pass --yes-i-know to confirm", i)
+	}
+	if err := r.Erase(); err != nil {
+		return fmt.Errorf("erase of range %d failed: %v", i, err)
+	}
+	return nil
+}
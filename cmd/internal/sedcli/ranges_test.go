@@ -0,0 +1,62 @@
+package sedcli
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/locking"
+)
+
+func TestFindRange(t *testing.T) {
+	boot := "boot"
+	global := &locking.Range{}
+	l := &locking.LockingSP{
+		GlobalRange: global,
+		Ranges:      []*locking.Range{global, {Name: &boot}, {}},
+	}
+	testCases := []struct {
+		name    string
+		spec    string
+		want    int
+		wantErr bool
+	}{
+		{"Global", "", 0, false},
+		{"Index", "2", 2, false},
+		{"Name", "boot", 1, false},
+		{"Out of bounds", "3", 0, true},
+		{"Negative", "-1", 0, true},
+		{"Unknown name", "data", 0, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			i, r, err := FindRange(l, tc.spec)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("FindRange(%q) error = %v; wantErr %v", tc.spec, err, tc.wantErr)
+			}
+			if err == nil && (i != tc.want || r != l.Ranges[tc.want]) {
+				t.Errorf("FindRange(%q) = %d; want %d", tc.spec, i, tc.want)
+			}
+		})
+	}
+}
+
+func TestRangeStatesJSON(t *testing.T) {
+	name := "boot"
+	global := &locking.Range{ReadLockEnabled: true, WriteLockEnabled: true, ReadLocked: true, WriteLocked: true}
+	global.UID[7] = 0x01
+	l := &locking.LockingSP{
+		GlobalRange: global,
+		Ranges:      []*locking.Range{global, {Name: &name, Start: 2048, End: 4096}},
+	}
+	b, err := json.Marshal(RangeStates(l))
+	if err != nil {
+		t.Fatalf("json.Marshal failed: %v", err)
+	}
+	want := `[{"index":0,"uid":"0000000000000001","name":null,"global":true,"start":0,"end":0,` +
+		`"read_lock_enabled":true,"write_lock_enabled":true,"read_locked":true,"write_locked":true},` +
+		`{"index":1,"uid":"0000000000000000","name":"boot","global":false,"start":2048,"end":4096,` +
+		`"read_lock_enabled":false,"write_lock_enabled":false,"read_locked":false,"write_locked":false}]`
+	if string(b) != want {
+		t.Errorf("RangeStates JSON = %s; want %s", b, want)
+	}
+}
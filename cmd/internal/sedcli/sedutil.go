@@ -0,0 +1,64 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Interoperability with drives provisioned by sedutil-cli
+//
+// The defaults of this package follow the conventions of sedutil-cli, so a
+// drive set up with `sedutil-cli --initialsetup` is managed as-is:
+//
+//   - Passwords are hashed with PBKDF2-HMAC-SHA1 (75000 iterations, 32 bytes)
+//     salted with the serial number of the drive padded to 20 characters,
+//     see HashSedutil. Passwords set with `sedutil-cli -n` are not hashed,
+//     see HashNone.
+//   - SID and Admin1 (BandMaster0 and EraseMaster on Enterprise) share the
+//     password, the ranges are locked and unlocked as Admin1.
+//   - Locking ranges are addressed by index, sedutil-cli does not name them.
+//     `--enablelockingrange N` corresponds to read and write locking enabled.
+//   - The shadow MBR is only controlled through MBREnable and MBRDone,
+//     sedutil-cli leaves MBRDoneOnReset at its default.
+
+package sedcli
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+)
+
+// HashNone uses the password as PIN without hashing, like `sedutil-cli -n`.
+const HashNone = "none"
+
+// SedutilHashes are the hash methods of sedutil-cli, most common first.
+var SedutilHashes = []string{HashSedutil, HashNone}
+
+// OpenSedutil opens a read-only session like Open, trying the hash methods
+// of sedutil-cli in turn until the password authenticates. o.Hash is set to
+// the method that did. Every failed attempt counts against the TryLimit of
+// the authority.
+func OpenSedutil(o *Options) (*Session, error) {
+	coreObj, err := NewCore(o.Device)
+	if err != nil {
+		return nil, fmt.Errorf("NewCore(%s) failed: %v", o.Device, err)
+	}
+	for _, hash := range SedutilHashes {
+		to := *o
+		to.Hash = hash
+		to.ReadOnly = true
+		s, err := open(coreObj, to)
+		if errors.Is(err, table.ErrAuthenticationFailed) {
+			continue
+		}
+		if err != nil {
+			coreObj.Close()
+			return nil, err
+		}
+		o.Hash = hash
+		return s, nil
+	}
+	coreObj.Close()
+	return nil, fmt.Errorf("%w with any of the hash methods of sedutil-cli (%s)",
+		table.ErrAuthenticationFailed, strings.Join(SedutilHashes, ", "))
+}
@@ -0,0 +1,164 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Device and session bootstrap shared by gosedctl and the sedlockctl
+// compatibility wrapper
+
+package sedcli
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/locking"
+)
+
+// HashSedutil is the default password hashing method, see sedutil.go.
+const HashSedutil = "sedutil-dta"
+
+// Options describe how to open and authenticate a session to the Locking SP.
+type Options struct {
+	Device string
+	// Authority to authenticate as (e.g. "User1"). If empty the default
+	// administrative authority of the SSC (Admin1 or BandMaster0) is used.
+	User string
+	// Password of the authority. If empty the MSID is used.
+	Password string
+	// Hash method of Password, defaults to HashSedutil. HashNone uses
+	// Password as-is, PINFormatHex and PINFormatBase64 take it as encoded PIN.
+	Hash string
+	// Optional SID credentials used to find the Locking SP on the Admin SP.
+	SIDPassword string
+	SIDHash     string
+	SIDMSID     bool
+	// Open read-only sessions, which do not take the write session slot of
+	// the drive but cannot change anything.
+	ReadOnly bool
+	// Fail with table.ErrMBRNotSupported before opening any session if the
+	// Level 0 Discovery shows that the drive has no shadow MBR.
+	MBR bool
+	// Only read the global range instead of enumerating all ranges, for
+	// flows that do not need the others.
+	GlobalRangeOnly bool
+}
+
+// Session is an authenticated session to the Locking SP together with the
+// underlying device and control session.
+type Session struct {
+	Core    *core.Core
+	Control *core.ControlSession
+	Locking *locking.LockingSP
+}
+
+// Close closes the Locking SP session, the control session and the device.
+func (s *Session) Close() error {
+	s.Locking.Close()
+	s.Control.Close()
+	return s.Core.Close()
+}
+
+// HashPassword hashes a password with the given method, using the serial
+// number of the device as salt. With HashNone the password is used as-is,
+// with PINFormatHex or PINFormatBase64 it is decoded instead of hashed.
+func HashPassword(coreObj *core.Core, password string, method string) ([]byte, error) {
+	switch method {
+	case PINFormatHex, PINFormatBase64:
+		return ParsePIN(password, method)
+	case HashNone:
+		return []byte(password), nil
+	}
+	serial, err := coreObj.SerialNumber()
+	if err != nil {
+		return nil, fmt.Errorf("coreObj.SerialNumber() failed: %v", err)
+	}
+	switch method {
+	case "", HashSedutil:
+		return HashSedutilDTA(password, string(serial)), nil
+	default:
+		return nil, fmt.Errorf("unknown hash method %q", method)
+	}
+}
+
+// Open opens the device and an authenticated session to its Locking SP.
+func Open(o Options) (*Session, error) {
+	coreObj, err := NewCore(o.Device)
+	if err != nil {
+		return nil, fmt.Errorf("NewCore(%s) failed: %v", o.Device, err)
+	}
+	s, err := open(coreObj, o)
+	if err != nil {
+		coreObj.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func open(coreObj *core.Core, o Options) (*Session, error) {
+	if o.MBR && !core.GetCapabilities(coreObj.DiskInfo.Level0Discovery).MBR {
+		return nil, table.ErrMBRNotSupported
+	}
+	initOps := []locking.InitializeOpt{}
+	if o.SIDPassword != "" {
+		spin, err := HashPassword(coreObj, o.SIDPassword, o.SIDHash)
+		if err != nil {
+			return nil, err
+		}
+		initOps = append(initOps, locking.WithAuth(locking.DefaultAdminAuthority(spin)))
+	}
+	if o.SIDMSID {
+		initOps = append(initOps, locking.WithAuth(locking.DefaultAuthorityWithMSID))
+	}
+
+	pin := []byte{}
+	if o.Password != "" {
+		var err error
+		if pin, err = HashPassword(coreObj, o.Password, o.Hash); err != nil {
+			return nil, err
+		}
+	}
+	var auth locking.LockingSPAuthenticator
+	switch {
+	case o.User != "":
+		a, ok := locking.AuthorityFromName(o.User, pin)
+		if !ok {
+			return nil, fmt.Errorf("authority %q is not known", o.User)
+		}
+		auth = a
+	case len(pin) == 0:
+		auth = locking.DefaultAuthorityWithMSID
+	default:
+		auth = locking.DefaultAuthority(pin)
+	}
+
+	var sessOpts []locking.SessionOpt
+	if o.ReadOnly {
+		initOps = append(initOps, locking.WithReadOnly())
+		sessOpts = append(sessOpts, locking.WithSessionOpts(core.WithReadOnly()))
+	}
+	if o.GlobalRangeOnly {
+		sessOpts = append(sessOpts, locking.WithoutRangeEnumeration())
+	}
+
+	cs, lmeta, err := locking.Initialize(coreObj, initOps...)
+	if err != nil {
+		return nil, fmt.Errorf("locking.Initialize() failed: %w", lockedOutHint(err))
+	}
+	l, err := locking.NewSessionWithOptions(cs, lmeta, auth, sessOpts...)
+	if err != nil {
+		cs.Close()
+		return nil, fmt.Errorf("locking.NewSession() failed: %w", lockedOutHint(err))
+	}
+	return &Session{Core: coreObj, Control: cs, Locking: l}, nil
+}
+
+// Tell the user how to recover from a locked out authority, instead of
+// letting them burn further attempts.
+func lockedOutHint(err error) error {
+	if errors.Is(err, table.ErrAuthorityLockedOut) {
+		return fmt.Errorf("%w; power cycle the drive before trying again", err)
+	}
+	return err
+}
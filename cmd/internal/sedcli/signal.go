@@ -0,0 +1,26 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sedcli
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+)
+
+// CloseSessionsOnSignal ends all open sessions when the program is
+// interrupted or terminated, so that the SPs are not left busy for the next
+// program, and exits with the usual status of a program killed by the signal.
+func CloseSessionsOnSignal() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-c
+		core.CloseAllSessions()
+		os.Exit(128 + int(sig.(syscall.Signal)))
+	}()
+}
@@ -0,0 +1,55 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sedcli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var sizeSuffixes = []struct {
+	suffix string
+	mult   uint64
+}{
+	// Longest suffixes first so that "KiB" is not matched as "B"
+	{"KiB", 1 << 10},
+	{"MiB", 1 << 20},
+	{"GiB", 1 << 30},
+	{"TiB", 1 << 40},
+	{"KB", 1000},
+	{"MB", 1000 * 1000},
+	{"GB", 1000 * 1000 * 1000},
+	{"TB", 1000 * 1000 * 1000 * 1000},
+	{"B", 1},
+}
+
+// ParseSectors parses a size given either as a plain number of sectors, or as
+// a number of bytes with a unit suffix (e.g. "512B", "1GiB", "20GB"), and
+// returns it in sectors of blockSize bytes.
+func ParseSectors(s string, blockSize uint64) (uint64, error) {
+	for _, u := range sizeSuffixes {
+		if !strings.HasSuffix(s, u.suffix) {
+			continue
+		}
+		v, err := strconv.ParseUint(strings.TrimSpace(strings.TrimSuffix(s, u.suffix)), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid size %q: %v", s, err)
+		}
+		b := v * u.mult
+		if v != 0 && b/v != u.mult {
+			return 0, fmt.Errorf("invalid size %q: too large", s)
+		}
+		if b%blockSize != 0 {
+			return 0, fmt.Errorf("size %q is not a multiple of the %d byte block size", s, blockSize)
+		}
+		return b / blockSize, nil
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %v", s, err)
+	}
+	return v, nil
+}
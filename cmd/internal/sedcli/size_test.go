@@ -0,0 +1,35 @@
+package sedcli
+
+import (
+	"testing"
+)
+
+func TestParseSectors(t *testing.T) {
+	testCases := []struct {
+		name      string
+		in        string
+		blockSize uint64
+		want      uint64
+		wantErr   bool
+	}{
+		{"Sectors", "2048", 512, 2048, false},
+		{"Bytes", "4096B", 512, 8, false},
+		{"KiB", "4KiB", 4096, 1, false},
+		{"GiB", "1GiB", 512, 2097152, false},
+		{"GB", "1GB", 512, 1953125, false},
+		{"Unaligned", "1000B", 512, 0, true},
+		{"Garbage", "lots", 512, 0, true},
+		{"Unknown unit", "1PiB", 512, 0, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseSectors(tc.in, tc.blockSize)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("ParseSectors(%q, %d) error = %v; wantErr %v", tc.in, tc.blockSize, err, tc.wantErr)
+			}
+			if got != tc.want {
+				t.Errorf("ParseSectors(%q, %d) = %d; want %d", tc.in, tc.blockSize, got, tc.want)
+			}
+		})
+	}
+}
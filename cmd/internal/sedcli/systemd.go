@@ -0,0 +1,338 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sedcli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// DefaultSedunlockPath is where the generated units expect sedunlock.
+const DefaultSedunlockPath = "/usr/bin/sedunlock"
+
+// UnlockUnit describes a systemd service that unlocks a drive with sedunlock
+// early during boot, before local file systems and encrypted volumes are set
+// up.
+type UnlockUnit struct {
+	Device string
+	// Exactly one credential source: the name of a systemd credential, a key
+	// file or the description of a key in the kernel keyring
+	Credential string
+	KeyFile    string
+	Keyring    string
+	// Encrypted credential (see systemd-creds) to load as Credential, if it is
+	// not provided to the service otherwise
+	CredentialFile string
+
+	User   string
+	Ranges []string
+	// Path of the sedunlock binary, defaults to DefaultSedunlockPath
+	Sedunlock string
+}
+
+var unitTemplate = template.Must(template.New("unit").Parse(`# Generated by {{.Generator}}, do not edit.
+[Unit]
+Description=Unlock self-encrypting drive {{.Device}}
+DefaultDependencies=no
+BindsTo={{.DeviceUnit}}
+After={{.DeviceUnit}}
+Wants=cryptsetup-pre.target local-fs-pre.target
+Before=cryptsetup-pre.target local-fs-pre.target
+Conflicts=shutdown.target
+Before=shutdown.target
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+{{- if .CredentialFile}}
+LoadCredentialEncrypted={{.Credential}}:{{.CredentialFile}}
+{{- end}}
+ExecStart={{.ExecStart}}
+
+[Install]
+WantedBy=sysinit.target
+`))
+
+// SystemdEscapePath escapes a path like "systemd-escape --path" does, so that
+// it can be used in a unit name.
+func SystemdEscapePath(p string) string {
+	var parts []string
+	for _, c := range strings.Split(p, "/") {
+		if c != "" {
+			parts = append(parts, c)
+		}
+	}
+	if len(parts) == 0 {
+		return "-"
+	}
+	p = strings.Join(parts, "/")
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case c == '/':
+			b.WriteByte('-')
+		case c == '.' && i == 0:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == ':', c == '_', c == '.':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		}
+	}
+	return b.String()
+}
+
+// Name returns the name of the unit file.
+func (u *UnlockUnit) Name() string {
+	return "sedunlock-" + SystemdEscapePath(u.Device) + ".service"
+}
+
+func (u *UnlockUnit) validate() error {
+	if !strings.HasPrefix(u.Device, "/dev/") {
+		return fmt.Errorf("device %q is not a path below /dev", u.Device)
+	}
+	n := 0
+	for _, s := range []string{u.Credential, u.KeyFile, u.Keyring} {
+		if s != "" {
+			n++
+		}
+	}
+	if n != 1 {
+		return fmt.Errorf("%s: exactly one of credential, key file and keyring is required", u.Device)
+	}
+	if u.CredentialFile != "" && u.Credential == "" {
+		return fmt.Errorf("%s: a credential file requires a credential name", u.Device)
+	}
+	return nil
+}
+
+// Quote an argument of ExecStart, which systemd splits like a shell would.
+// Specifiers and variables are escaped as well.
+func quoteExecArg(s string) string {
+	s = strings.ReplaceAll(s, "%", "%%")
+	s = strings.ReplaceAll(s, "$", "$$")
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\;") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// Write writes the unit file, generator names the tool in the header
+// comment.
+func (u *UnlockUnit) Write(w io.Writer, generator string) error {
+	if err := u.validate(); err != nil {
+		return err
+	}
+	bin := u.Sedunlock
+	if bin == "" {
+		bin = DefaultSedunlockPath
+	}
+	args := []string{bin}
+	switch {
+	case u.Credential != "":
+		args = append(args, "-credential", u.Credential)
+	case u.KeyFile != "":
+		args = append(args, "-key-file", u.KeyFile)
+	case u.Keyring != "":
+		args = append(args, "-keyring", u.Keyring)
+	}
+	if u.User != "" {
+		args = append(args, "-user", u.User)
+	}
+	for _, r := range u.Ranges {
+		args = append(args, "-range", r)
+	}
+	args = append(args, u.Device)
+	for i := range args {
+		args[i] = quoteExecArg(args[i])
+	}
+
+	return unitTemplate.Execute(w, struct {
+		*UnlockUnit
+		Generator  string
+		DeviceUnit string
+		ExecStart  string
+	}{
+		UnlockUnit: u,
+		Generator:  generator,
+		DeviceUnit: SystemdEscapePath(u.Device) + ".device",
+		ExecStart:  strings.Join(args, " "),
+	})
+}
+
+// ParseSedtab reads the drives to unlock at boot from a sedtab file. Every
+// line names a device, the credential source and optionally a comma
+// separated list of options:
+//
+//	# device               source                  options
+//	/dev/nvme0n1           credential:sed          credential-file=/etc/credstore.encrypted/sed
+//	/dev/disk/by-id/ata-X  keyring:sed-ata         user=User1,range=home,range=data
+//	/dev/sdb               /boot/keys/sdb.key
+//
+// The source is "credential:NAME", "keyring:DESCRIPTION" or the path of a
+// key file. Empty lines and lines starting with # are ignored.
+func ParseSedtab(r io.Reader) ([]UnlockUnit, error) {
+	var units []UnlockUnit
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		f := strings.Fields(line)
+		if len(f) < 2 || len(f) > 3 {
+			return nil, fmt.Errorf("sedtab line %d: expected device, source and options", n)
+		}
+		u := UnlockUnit{Device: f[0]}
+		switch {
+		case strings.HasPrefix(f[1], "credential:"):
+			u.Credential = strings.TrimPrefix(f[1], "credential:")
+		case strings.HasPrefix(f[1], "keyring:"):
+			u.Keyring = strings.TrimPrefix(f[1], "keyring:")
+		default:
+			u.KeyFile = f[1]
+		}
+		if len(f) == 3 {
+			for _, o := range strings.Split(f[2], ",") {
+				k, v, _ := strings.Cut(o, "=")
+				switch k {
+				case "user":
+					u.User = v
+				case "range":
+					u.Ranges = append(u.Ranges, v)
+				case "credential-file":
+					u.CredentialFile = v
+				default:
+					return nil, fmt.Errorf("sedtab line %d: unknown option %q", n, k)
+				}
+			}
+		}
+		if err := u.validate(); err != nil {
+			return nil, fmt.Errorf("sedtab line %d: %v", n, err)
+		}
+		units = append(units, u)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return units, nil
+}
+
+// WriteUnits writes the unit files into dir. As a systemd generator, the
+// units are pulled into the boot by symlinks instead of having to be
+// enabled.
+func WriteUnits(dir string, units []UnlockUnit, generator string, asGenerator bool) error {
+	for i := range units {
+		u := &units[i]
+		f, err := os.Create(filepath.Join(dir, u.Name()))
+		if err != nil {
+			return err
+		}
+		err = u.Write(f, generator)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		if !asGenerator {
+			continue
+		}
+		wants := filepath.Join(dir, "sysinit.target.wants")
+		if err := os.MkdirAll(wants, 0755); err != nil {
+			return err
+		}
+		if err := os.Symlink(filepath.Join("..", u.Name()), filepath.Join(wants, u.Name())); err != nil && !os.IsExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// SystemdFlags are the flags of the generate-systemd commands.
+type SystemdFlags struct {
+	Credential     string   `flag:"" optional:"" help:"Name of the systemd credential holding the password"`
+	CredentialFile string   `flag:"" optional:"" help:"Encrypted credential (see systemd-creds) to load as --credential"`
+	KeyFile        string   `flag:"" optional:"" help:"Read the password from this key file at boot"`
+	Keyring        string   `flag:"" optional:"" help:"Read the password from this user key in the kernel keyring at boot"`
+	UnlockUser     string   `flag:"" optional:"" name:"unlock-user" help:"Authority to unlock as (e.g. User1), defaults to Admin1"`
+	Range          []string `flag:"" optional:"" help:"Range index or name to unlock (repeatable), defaults to the global range"`
+	Sedunlock      string   `flag:"" default:"/usr/bin/sedunlock" help:"Path of the sedunlock binary"`
+	Sedtab         string   `flag:"" optional:"" help:"Generate units for the drives listed in this sedtab file instead"`
+	OutputDir      string   `flag:"" optional:"" help:"Write the units into this directory instead of printing them"`
+	Generator      bool     `flag:"" optional:"" help:"Act as systemd generator: pull the units into the boot without enabling them, a missing sedtab is not an error"`
+}
+
+// Generate prints or writes the units for the given devices, or for the
+// ones in the sedtab file. program names the tool in the generated units.
+func (f *SystemdFlags) Generate(w io.Writer, program string, devices []string) error {
+	var units []UnlockUnit
+	if f.Sedtab != "" {
+		if len(devices) > 0 {
+			return fmt.Errorf("devices cannot be given together with a sedtab file")
+		}
+		tab, err := os.Open(f.Sedtab)
+		if os.IsNotExist(err) && f.Generator {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		units, err = ParseSedtab(tab)
+		tab.Close()
+		if err != nil {
+			return err
+		}
+	} else {
+		if len(devices) == 0 {
+			return fmt.Errorf("either a device or a sedtab file is required")
+		}
+		for _, d := range devices {
+			units = append(units, UnlockUnit{
+				Device:         d,
+				Credential:     f.Credential,
+				CredentialFile: f.CredentialFile,
+				KeyFile:        f.KeyFile,
+				Keyring:        f.Keyring,
+				User:           f.UnlockUser,
+				Ranges:         f.Range,
+			})
+		}
+	}
+	for i := range units {
+		units[i].Sedunlock = f.Sedunlock
+	}
+
+	if f.OutputDir != "" {
+		if err := WriteUnits(f.OutputDir, units, program, f.Generator); err != nil {
+			return err
+		}
+		if !f.Generator {
+			for _, u := range units {
+				fmt.Fprintf(w, "Wrote %s, enable it with: systemctl enable %s\n", filepath.Join(f.OutputDir, u.Name()), u.Name())
+			}
+		}
+		return nil
+	}
+	if f.Generator {
+		return fmt.Errorf("a generator needs an output directory")
+	}
+	for i, u := range units {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "# %s\n", u.Name())
+		if err := u.Write(w, program); err != nil {
+			return err
+		}
+	}
+	return nil
+}
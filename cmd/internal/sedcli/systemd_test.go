@@ -0,0 +1,61 @@
+package sedcli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSystemdEscapePath(t *testing.T) {
+	testCases := []struct {
+		in   string
+		want string
+	}{
+		{"/dev/nvme0n1", "dev-nvme0n1"},
+		{"/dev/disk/by-id/ata-Samsung_SSD_860-S3Z", `dev-disk-by\x2did-ata\x2dSamsung_SSD_860\x2dS3Z`},
+		{"//dev//sda/", "dev-sda"},
+		{"/", "-"},
+		{"/.hidden", `\x2ehidden`},
+	}
+	for _, tc := range testCases {
+		if got := SystemdEscapePath(tc.in); got != tc.want {
+			t.Errorf("SystemdEscapePath(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestParseSedtab(t *testing.T) {
+	testCases := []struct {
+		name      string
+		in        string
+		wantExec  []string
+		wantError bool
+	}{
+		{"Credential", "/dev/nvme0n1 credential:sed credential-file=/etc/credstore.encrypted/sed\n",
+			[]string{"ExecStart=/usr/bin/sedunlock -credential sed /dev/nvme0n1"}, false},
+		{"Keyring", "# comment\n\n/dev/sda keyring:sed user=User1\n",
+			[]string{"ExecStart=/usr/bin/sedunlock -keyring sed -user User1 /dev/sda"}, false},
+		{"Space in options", "/dev/sda keyring:sed range=my home\n", nil, true},
+		{"Key file", "/dev/sda /boot/keys/100%.key range=home,range=data\n",
+			[]string{"ExecStart=/usr/bin/sedunlock -key-file /boot/keys/100%%.key -range home -range data /dev/sda"}, false},
+		{"Unknown option", "/dev/sda keyring:sed rescan=no\n", nil, true},
+		{"Not a device", "sda keyring:sed\n", nil, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			units, err := ParseSedtab(strings.NewReader(tc.in))
+			if (err != nil) != tc.wantError {
+				t.Fatalf("ParseSedtab() error = %v; wantError %v", err, tc.wantError)
+			}
+			for i, u := range units {
+				var buf bytes.Buffer
+				if err := u.Write(&buf, "test"); err != nil {
+					t.Fatalf("Write() failed: %v", err)
+				}
+				if !strings.Contains(buf.String(), tc.wantExec[i]+"\n") {
+					t.Errorf("unit %s does not contain %q:\n%s", u.Name(), tc.wantExec[i], buf.String())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Protocol-level tracing shared by the command line tools
+
+package sedcli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive"
+)
+
+// TraceFlags are the global tracing flags, meant to be embedded in the
+// kong command line struct.
+type TraceFlags struct {
+	Debug bool   `flag:"" help:"Print method calls and status codes exchanged with the drive to stderr, with passwords redacted"`
+	Trace string `flag:"" type:"path" placeholder:"FILE" help:"Dump all ComPackets exchanged with the drive to FILE. The dump contains the passwords sent to the drive in clear text"`
+}
+
+var coreOpts []core.CoreOpt
+
+// Start enables tracing as requested by the flags, see StartTrace.
+func (f *TraceFlags) Start() (func(), error) {
+	return StartTrace(f.Debug, f.Trace)
+}
+
+// StartTrace enables tracing for all devices opened with NewCore afterwards.
+// The trace file is only readable by the user, as it contains the passwords
+// sent to the drives. The returned function closes the trace file, if any.
+func StartTrace(debug bool, path string) (func(), error) {
+	t := &core.Tracer{}
+	if debug {
+		t.Methods = os.Stderr
+	}
+	closer := func() {}
+	if path != "" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create trace file: %v", err)
+		}
+		t.ComPackets = f
+		closer = func() { f.Close() }
+	}
+	if t.Methods != nil || t.ComPackets != nil {
+		coreOpts = []core.CoreOpt{core.WithTracer(t)}
+	}
+	return closer, nil
+}
+
+// NewCore opens a device, tracing it if StartTrace has been called.
+func NewCore(device string) (*core.Core, error) {
+	return core.NewCore(device, coreOpts...)
+}
+
+// NewCoreFromDrive is like NewCore for an already opened drive.
+func NewCoreFromDrive(d drive.DriveIntf) (*core.Core, error) {
+	return core.NewCoreFromDrive(d, coreOpts...)
+}
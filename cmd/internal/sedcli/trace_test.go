@@ -0,0 +1,24 @@
+package sedcli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStartTraceFileMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace")
+	stop, err := StartTrace(false, path)
+	if err != nil {
+		t.Fatalf("StartTrace() failed: %v", err)
+	}
+	defer func() { coreOpts = nil }()
+	defer stop()
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := fi.Mode().Perm(); mode&0077 != 0 {
+		t.Errorf("trace file has mode %v, want it readable only by the user", mode)
+	}
+}
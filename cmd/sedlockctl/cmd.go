@@ -7,8 +7,10 @@ package main
 import (
 	"fmt"
 	"os"
+	"text/tabwriter"
 
-	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+	"github.com/open-source-firmware/go-tcg-storage/cmd/internal/clidoc"
+	"github.com/open-source-firmware/go-tcg-storage/cmd/internal/sedcli"
 	"github.com/open-source-firmware/go-tcg-storage/pkg/locking"
 )
 
@@ -16,12 +18,47 @@ type context struct {
 	session *locking.LockingSP
 }
 
-type listCmd struct{}
+type listCmd struct {
+	Output string `flag:"" short:"o" enum:"text,json" default:"text" help:"Output format; one of [text, json]"`
+}
 
 type lockAllCmd struct{}
 
 type unlockAllCmd struct{}
 
+type lockCmd struct {
+	Range     string `arg:"" required:"" help:"Range index or name"`
+	ReadOnly  bool   `flag:"" optional:"" xor:"rw" help:"Only lock the range for reading"`
+	WriteOnly bool   `flag:"" optional:"" xor:"rw" help:"Only lock the range for writing"`
+	MBR       bool   `flag:"" optional:"" help:"Also show the shadow MBR again (MBRDone=false) if enabled"`
+}
+
+type unlockCmd struct {
+	Range     string `arg:"" required:"" help:"Range index or name"`
+	ReadOnly  bool   `flag:"" optional:"" xor:"rw" help:"Only unlock the range for reading"`
+	WriteOnly bool   `flag:"" optional:"" xor:"rw" help:"Only unlock the range for writing"`
+	MBR       bool   `flag:"" optional:"" help:"Also hide the shadow MBR (MBRDone=true) if enabled"`
+}
+
+type createRangeCmd struct {
+	Start     string `arg:"" required:"" help:"Start of the range in sectors, or in bytes with a unit suffix (e.g. 1GiB)"`
+	Length    string `arg:"" required:"" help:"Length of the range in sectors, or in bytes with a unit suffix (e.g. 256GiB)"`
+	ReadLock  bool   `flag:"" default:"true" negatable:"" help:"Enable read locking on the range"`
+	WriteLock bool   `flag:"" default:"true" negatable:"" help:"Enable write locking on the range"`
+	Grant     string `flag:"" optional:"" help:"Allow the given user (e.g. User1) to lock and unlock the range"`
+	Name      string `flag:"" optional:"" help:"Name of the range, to refer to it by name instead of its index"`
+}
+
+type deleteRangeCmd struct {
+	Range string `arg:"" required:"" help:"Range index or name"`
+}
+
+type eraseCmd struct {
+	sedcli.DryRunFlag `embed:""`
+	Range             string `arg:"" required:"" help:"Range index or name"`
+	YesIKnow          bool   `flag:"" name:"yes-i-know" help:"Confirm that all data in the range will be irrecoverably lost"`
+}
+
 type mbrDoneCmd struct {
 	Stat bool `required:"" help:"Status to set the MBRDone"`
 }
@@ -30,73 +67,79 @@ type readMBRCmd struct {
 	ReadMbrSize int `flag:"" default:"0"`
 }
 
+type writeMBRCmd struct {
+	sedcli.DryRunFlag `embed:""`
+	Path              string `arg:"" required:"" type:"existingfile" help:"Path to PBA image"`
+	Offset            uint32 `flag:"" default:"0" help:"Byte offset to resume an interrupted upload from"`
+	NoVerify          bool   `flag:"" optional:"" help:"Skip reading back the MBR and comparing it to the image"`
+}
+
+type importSedutilCmd struct{}
+
+type generateSystemdCmd struct {
+	sedcli.SystemdFlags `embed:""`
+}
+
 var cli struct {
-	Device     string       `flag:"" required:"" short:"d"  help:"Path to SED device (e.g. /dev/nvme0)"`
-	Sidpin     string       `flag:"" optional:""`
-	Sidpinmsid bool         `flag:"" optional:""`
-	Sidhash    string       `flag:"" optional:""`
-	User       string       `flag:"" optional:"" short:"u"`
-	Password   string       `flag:"" optional:"" short:"p"`
-	Hash       string       `flag:"" optional:"" default:"sedutil-dta"`
-	List       listCmd      `cmd:"" help:"List all ranges (default)"`
-	LockAll    lockAllCmd   `cmd:"" help:"Locks all ranges completely"`
-	UnlockAll  unlockAllCmd `cmd:"" help:"Unlocks all ranges completely"`
-	Mbrdone    mbrDoneCmd   `cmd:"" help:"Sets the MBRDone property (hide/show Shadow MBR)"`
-	ReadMbr    readMBRCmd   `cmd:"" help:"Prints the binary data in the MBR area"`
+	Device            string         `flag:"" required:"" short:"d"  help:"Path to SED device (e.g. /dev/nvme0)"`
+	Sidpin            string         `flag:"" optional:""`
+	Sidpinmsid        bool           `flag:"" optional:""`
+	Sidhash           string         `flag:"" optional:""`
+	User              string         `flag:"" optional:"" short:"u"`
+	Password          string         `flag:"" optional:"" short:"p" xor:"password"`
+	PasswordHex       string         `flag:"" optional:"" xor:"password" help:"PIN as hex, used as-is without hashing"`
+	Hash              string         `flag:"" optional:"" default:"sedutil-dta"`
+	HelpMan           clidoc.ManFlag `flag:"" name:"help-man" help:"Print the man page and exit"`
+	sedcli.TraceFlags `embed:""`
+	List              listCmd            `cmd:"" help:"List all ranges (default)"`
+	LockAll           lockAllCmd         `cmd:"" help:"Locks all ranges completely"`
+	UnlockAll         unlockAllCmd       `cmd:"" help:"Unlocks all ranges completely"`
+	Lock              lockCmd            `cmd:"" help:"Locks a single range by index or name"`
+	Unlock            unlockCmd          `cmd:"" help:"Unlocks a single range by index or name"`
+	CreateRange       createRangeCmd     `cmd:"" help:"Configures an unused range to cover the given area"`
+	DeleteRange       deleteRangeCmd     `cmd:"" help:"Resets a range to its unconfigured defaults"`
+	Erase             eraseCmd           `cmd:"" help:"Cryptographically erases a range (DESTROYS DATA)"`
+	Mbrdone           mbrDoneCmd         `cmd:"" help:"Sets the MBRDone property (hide/show Shadow MBR)"`
+	ReadMbr           readMBRCmd         `cmd:"" help:"Prints the binary data in the MBR area"`
+	WriteMbr          writeMBRCmd        `cmd:"" help:"Writes a PBA image to the MBR area"`
+	GenerateSystemd   generateSystemdCmd `cmd:"" help:"Generates a systemd unit unlocking the device with sedunlock at boot"`
+	ImportSedutil     importSedutilCmd   `cmd:"" name:"import-sedutil" help:"Verifies that a drive set up by sedutil-cli can be managed and shows its configuration"`
+
+	Completion clidoc.CompletionCmd `cmd:"" help:"Prints shell completion scripts"`
 }
 
 func (l listCmd) Run(ctx *context) error {
-	if len(ctx.session.Ranges) == 0 {
-		return fmt.Errorf("no available locking ranges as this user")
-	}
-	for i, r := range ctx.session.Ranges {
-		strr := "whole disk"
-		if r.End > 0 {
-			strr = fmt.Sprintf("%d to %d", r.Start, r.End)
-		}
-		if !r.WriteLockEnabled && !r.ReadLockEnabled {
-			strr = "disabled"
-		} else {
-			if r.WriteLocked {
-				strr += " [write locked]"
-			}
-			if r.ReadLocked {
-				strr += " [read locked]"
-			}
-		}
-		if r == ctx.session.GlobalRange {
-			strr += " [global]"
-		}
-		if r.Name != nil {
-			strr += fmt.Sprintf(" [name=%q]", *r.Name)
-		}
-		fmt.Printf("Range %3d: %s\n", i, strr)
-	}
-	return nil
+	return sedcli.ListRanges(os.Stdout, ctx.session, l.Output)
 }
 
 func (u unlockAllCmd) Run(ctx *context) error {
-	for i, r := range ctx.session.Ranges {
-		if err := r.UnlockRead(); err != nil {
-			return fmt.Errorf("read unlock range %d failed: %v", i, err)
-		}
-		if err := r.UnlockWrite(); err != nil {
-			return fmt.Errorf("write unlock range %d failed: %v", i, err)
-		}
-	}
-	return nil
+	return sedcli.UnlockAll(ctx.session)
 }
 
 func (l lockAllCmd) Run(ctx *context) error {
-	for i, r := range ctx.session.Ranges {
-		if err := r.LockRead(); err != nil {
-			return fmt.Errorf("read lock range %d failed: %v", i, err)
-		}
-		if err := r.LockWrite(); err != nil {
-			return fmt.Errorf("write lock range %d failed: %v", i, err)
-		}
-	}
-	return nil
+	return sedcli.LockAll(ctx.session)
+}
+
+func (l lockCmd) Run(ctx *context) error {
+	ctx.session.SetMBRDoneOnUnlock = l.MBR
+	return sedcli.Lock(ctx.session, l.Range, !l.WriteOnly, !l.ReadOnly)
+}
+
+func (u unlockCmd) Run(ctx *context) error {
+	ctx.session.SetMBRDoneOnUnlock = u.MBR
+	return sedcli.Unlock(ctx.session, u.Range, !u.WriteOnly, !u.ReadOnly)
+}
+
+func (c createRangeCmd) Run(ctx *context) error {
+	return sedcli.CreateRange(os.Stdout, ctx.session, c.Start, c.Length, c.ReadLock, c.WriteLock, c.Grant, c.Name)
+}
+
+func (d deleteRangeCmd) Run(ctx *context) error {
+	return sedcli.DeleteRange(ctx.session, d.Range)
+}
+
+func (e eraseCmd) Run(ctx *context) error {
+	return sedcli.Erase(os.Stdout, ctx.session, e.Range, e.YesIKnow, e.DryRun)
 }
 
 func (m mbrDoneCmd) Run(ctx *context) error {
@@ -107,28 +150,48 @@ func (m mbrDoneCmd) Run(ctx *context) error {
 }
 
 func (r readMBRCmd) Run(ctx *context) error {
-	mbi, err := table.MBR_TableInfo(ctx.session.Session)
+	return sedcli.ReadMBR(os.Stdout, ctx.session, r.ReadMbrSize)
+}
+
+func (w writeMBRCmd) Run(ctx *context) error {
+	img, err := os.ReadFile(w.Path)
 	if err != nil {
-		return fmt.Errorf("table.MBR_TableInfo failed: %v", err)
+		return err
+	}
+	return sedcli.WriteMBR(os.Stdout, ctx.session, img, w.Offset, !w.NoVerify, w.DryRun)
+}
+
+func (g generateSystemdCmd) Run(ctx *context) error {
+	var devices []string
+	if g.Sedtab == "" {
+		devices = []string{cli.Device}
 	}
-	mbuf := make([]byte, mbi.SuggestBufferSize(ctx.session.Session))
-	sz := mbi.Size
-	if r.ReadMbrSize > 0 && uint32(r.ReadMbrSize) < sz {
-		sz = uint32(r.ReadMbrSize)
+	return g.Generate(os.Stdout, programName+" generate-systemd", devices)
+}
+
+func (i importSedutilCmd) Run(ctx *context) error {
+	o := sedcli.Options{
+		Device:   cli.Device,
+		User:     cli.User,
+		Password: cli.Password,
+	}
+	s, err := sedcli.OpenSedutil(&o)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintf(w, "Hash:\t%s\n", o.Hash)
+	fmt.Fprintf(w, "MBR enabled:\t%v\n", s.Locking.MBREnabled)
+	fmt.Fprintf(w, "MBR done:\t%v\n", s.Locking.MBRDone)
+	if err := w.Flush(); err != nil {
+		return err
 	}
-	pos := uint32(0)
-	chk := uint32(len(mbuf))
-	for i := sz; i != 0; i -= chk {
-		if n, err := table.MBR_Read(ctx.session.Session, mbuf, pos); n != len(mbuf) || err != nil {
-			return fmt.Errorf("table.MBR_Read failed: %v (read: %d)", err, n)
-		}
-		pos += chk
-		if i < chk {
-			os.Stdout.Write(mbuf[:i])
-			break
-		} else {
-			os.Stdout.Write(mbuf)
-		}
+	fmt.Println()
+	if err := sedcli.ListRanges(os.Stdout, s.Locking, "text"); err != nil {
+		return err
 	}
+	fmt.Printf("\nManage the drive with: %s --device %s --hash %s ...\n", programName, cli.Device, o.Hash)
 	return nil
 }
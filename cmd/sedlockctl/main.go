@@ -2,20 +2,22 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
+// sedlockctl is a compatibility wrapper around the locking and MBR commands
+// of gosedctl, keeping the global flag conventions of the original tool.
+
 package main
 
 import (
 	"log"
+	"strings"
 
 	"github.com/alecthomas/kong"
-	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
-	"github.com/open-source-firmware/go-tcg-storage/pkg/locking"
-	// TODO: Move to locking API when it has MBR functions
+	"github.com/open-source-firmware/go-tcg-storage/cmd/internal/sedcli"
 )
 
 var (
 	programName = "sedlockctl"
-	programDesc = "Go SEDlock control (temporary name)"
+	programDesc = "Go SEDlock control (compatibility wrapper, see gosedctl)"
 )
 
 func main() {
@@ -29,74 +31,49 @@ func main() {
 			Summary: true,
 		}))
 
-	// Set up connection and initialize session to device.
-	coreObj, err := core.NewCore(cli.Device)
-	if err != nil {
-		log.Fatalf("drive.Open: %v", err)
-	}
-	defer coreObj.Close()
-
-	snRaw, err := coreObj.DriveIntf.SerialNumber()
+	stopTrace, err := cli.TraceFlags.Start()
 	if err != nil {
-		log.Fatalf("drive.SerialNumber: %v", err)
-	}
-	sn := string(snRaw)
-
-	spin := []byte{}
-	if cli.Sidpin != "" {
-		switch cli.Sidhash {
-		case "sedutil-dta":
-			spin = HashSedutilDTA(cli.Sidpin, sn)
-		default:
-			log.Fatalf("Unknown hash method %q", cli.Sidhash)
-		}
-	}
-
-	initOps := []locking.InitializeOpt{}
-	if len(spin) > 0 {
-		initOps = append(initOps, locking.WithAuth(locking.DefaultAdminAuthority(spin)))
-	}
-	if cli.Sidpinmsid {
-		initOps = append(initOps, locking.WithAuth(locking.DefaultAuthorityWithMSID))
+		log.Fatalf("%v", err)
 	}
+	defer stopTrace()
 
-	cs, lmeta, err := locking.Initialize(coreObj, initOps...)
-	if err != nil {
-		log.Fatalf("locking.Initalize: %v", err)
+	// Generating units does not talk to the drive, and import-sedutil
+	// finds out how to authenticate by itself
+	if ctx.Command() == "generate-systemd" || ctx.Command() == "import-sedutil" {
+		ctx.FatalIfErrorf(ctx.Run(&context{}))
+		return
 	}
-	defer cs.Close()
 
-	var auth locking.LockingSPAuthenticator
-	pin := []byte{}
-	if cli.Password != "" {
-		switch cli.Hash {
-		case "sedutil-dta":
-			pin = HashSedutilDTA(cli.Password, sn)
-		default:
-			log.Fatalf("Unknown hash method %q", cli.Hash)
-		}
+	o := sedcli.Options{
+		Device:      cli.Device,
+		User:        cli.User,
+		Password:    cli.Password,
+		Hash:        cli.Hash,
+		SIDPassword: cli.Sidpin,
+		SIDHash:     cli.Sidhash,
+		SIDMSID:     cli.Sidpinmsid,
+		MBR:         usesMBR(ctx.Command()),
 	}
-	if cli.User != "" {
-		var ok bool
-		auth, ok = locking.AuthorityFromName(cli.User, pin)
-		if !ok {
-			log.Fatalf("Authority %q is not known for this device", cli.User)
-		}
-	} else {
-		if len(pin) == 0 {
-			auth = locking.DefaultAuthorityWithMSID
-		} else {
-			auth = locking.DefaultAuthority(pin)
-		}
+	if cli.PasswordHex != "" {
+		o.Password = cli.PasswordHex
+		o.Hash = sedcli.PINFormatHex
 	}
-
-	l, err := locking.NewSession(cs, lmeta, auth)
+	s, err := sedcli.Open(o)
 	if err != nil {
-		log.Fatalf("locking.NewSession: %v", err)
+		log.Fatalf("%v", err)
 	}
-	defer l.Close()
+	defer s.Close()
 
 	// Run the command
-	err = ctx.Run(&context{session: l})
+	err = ctx.Run(&context{session: s.Locking})
 	ctx.FatalIfErrorf(err)
 }
+
+// usesMBR reports whether the command operates on the shadow MBR.
+func usesMBR(command string) bool {
+	switch strings.Fields(command)[0] {
+	case "mbrdone", "read-mbr", "write-mbr":
+		return true
+	}
+	return false
+}
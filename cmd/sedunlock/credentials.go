@@ -0,0 +1,93 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// readCredential reads the password from the one configured source.
+func readCredential(keyFile string, keyring string, credential string) (string, error) {
+	var pw string
+	var err error
+	switch {
+	case keyFile != "" && keyring == "" && credential == "":
+		pw, err = readKeyFile(keyFile)
+	case keyring != "" && keyFile == "" && credential == "":
+		pw, err = readKeyring(keyring)
+	case credential != "" && keyFile == "" && keyring == "":
+		pw, err = readSystemdCredential(credential)
+	default:
+		return "", errors.New("exactly one of -key-file, -keyring and -credential is required")
+	}
+	if err != nil {
+		return "", err
+	}
+	// An empty password would make sedcli.Open fall back to the MSID
+	if pw == "" {
+		return "", errors.New("password is empty")
+	}
+	return pw, nil
+}
+
+// Read a key file, ignoring a trailing newline like cryptsetup does.
+func readKeyFile(path string) (string, error) {
+	var b []byte
+	var err error
+	if path == "-" {
+		b, err = io.ReadAll(os.Stdin)
+	} else {
+		b, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("reading key file failed: %v", err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// Read a "user" key from the kernel keyring, e.g. one cached by
+// systemd-ask-password --keyname or added with keyctl.
+func readKeyring(desc string) (string, error) {
+	var id int
+	var err error
+	for _, ring := range []int{unix.KEY_SPEC_SESSION_KEYRING, unix.KEY_SPEC_USER_KEYRING} {
+		id, err = unix.KeyctlSearch(ring, "user", desc, 0)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("key %q not found in the kernel keyring: %v", desc, err)
+	}
+	n, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, nil, 0)
+	if err != nil {
+		return "", fmt.Errorf("reading key %q failed: %v", desc, err)
+	}
+	buf := make([]byte, n)
+	if _, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, buf, 0); err != nil {
+		return "", fmt.Errorf("reading key %q failed: %v", desc, err)
+	}
+	return string(buf), nil
+}
+
+// Read a credential passed by systemd, which decrypts credentials sealed to
+// the TPM with systemd-creds before starting the service.
+func readSystemdCredential(name string) (string, error) {
+	dir := os.Getenv("CREDENTIALS_DIRECTORY")
+	if dir == "" {
+		return "", errors.New("no systemd credentials passed (CREDENTIALS_DIRECTORY is not set)")
+	}
+	if strings.ContainsRune(name, '/') {
+		return "", fmt.Errorf("invalid credential name %q", name)
+	}
+	return readKeyFile(filepath.Join(dir, name))
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// sedunlock is a minimal unlocker meant to be embedded in an initramfs or a
+// PBA image. It shares the session and unlock code of the other commands in
+// cmd/internal/sedcli, so besides the TCG Storage packages it links
+// golang.org/x/sys, golang.org/x/crypto, github.com/dswarbrick/smart and
+// gopkg.in/yaml.v3. It needs no cgo and builds as a static binary.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/open-source-firmware/go-tcg-storage/cmd/internal/sedcli"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/locking"
+)
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+var (
+	keyFile    = flag.String("key-file", "", "Read the password from this file, - for stdin")
+	keyring    = flag.String("keyring", "", "Read the password from the user key with this description in the kernel keyring")
+	credential = flag.String("credential", "", "Read the password from this systemd credential, e.g. one sealed to the TPM by systemd-creds")
+	user       = flag.String("user", "", "Authority to authenticate as (e.g. User1), defaults to Admin1")
+	mbrDone    = flag.Bool("mbr-done", true, "Hide the shadow MBR (MBRDone=true) if it is enabled")
+	verify     = flag.Bool("verify", false, "Read the ranges back, and from DEVICE if it is a block device, to confirm the unlock")
+
+	ranges stringList
+)
+
+func main() {
+	flag.Var(&ranges, "range", "Range index or name to unlock (repeatable), defaults to the global range")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] DEVICE...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	log.SetFlags(0)
+	log.SetPrefix("sedunlock: ")
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	sedcli.CloseSessionsOnSignal()
+	password, err := readCredential(*keyFile, *keyring, *credential)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+
+	failed := 0
+	for _, device := range flag.Args() {
+		if err := unlock(device, password); err != nil {
+			log.Printf("%s: %v", device, err)
+			failed++
+			continue
+		}
+		log.Printf("%s: unlocked", device)
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func unlock(device string, password string) error {
+	// The global range does not need the Locking table to be enumerated
+	s, err := sedcli.Open(sedcli.Options{Device: device, User: *user, Password: password, GlobalRangeOnly: len(ranges) == 0})
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	specs := ranges
+	if len(specs) == 0 {
+		// The empty spec selects the global range
+		specs = []string{""}
+	}
+	var opts []locking.UnlockOpt
+	if *verify {
+		var closeDev func()
+		opts, closeDev = sedcli.VerifyOptions(device)
+		defer closeDev()
+	}
+	s.Locking.SetMBRDoneOnUnlock = *mbrDone
+	for _, spec := range specs {
+		if err := sedcli.Unlock(s.Locking, spec, true, true, opts...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
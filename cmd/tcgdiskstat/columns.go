@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive"
+)
+
+const defaultColumns = "device,model,serial,firmware,protocol,ssc,state"
+
+type column struct {
+	Name   string
+	Header string
+	Value  func(s *DeviceState) string
+}
+
+var allColumns = []column{
+	{"device", "DEVICE", func(s *DeviceState) string { return s.Device }},
+	{"model", "MODEL", identity(func(i *drive.Identity) string { return i.Model })},
+	{"serial", "SERIAL", identity(func(i *drive.Identity) string { return i.SerialNumber })},
+	{"firmware", "FIRMWARE", identity(func(i *drive.Identity) string { return i.Firmware })},
+	{"protocol", "PROTOCOL", identity(func(i *drive.Identity) string { return i.Protocol })},
+	{"ssc", "SSC", level0(func(l0 *core.Level0Discovery) string { return strings.Join(core.GetCapabilities(l0).SSCs, ",") })},
+	{"state", "STATE", level0(stateFlags)},
+	{"comid", "COMID", func(s *DeviceState) string {
+		if s.BaseComID == 0 {
+			return "-"
+		}
+		return fmt.Sprintf("0x%04x", s.BaseComID)
+	}},
+	{"block-sid", "BLOCK SID", level0(blockSIDColumn)},
+	{"data-removal", "DATA REMOVAL", level0(dataRemovalColumn)},
+	{"alignment", "ALIGNMENT", level0(alignmentColumn)},
+	{"kind", "KIND", func(s *DeviceState) string { return orDash(s.Kind) }},
+	{"controller", "CONTROLLER", func(s *DeviceState) string { return orDash(s.Controller) }},
+	{"nsid", "NSID", func(s *DeviceState) string {
+		if s.NamespaceID == 0 {
+			return "-"
+		}
+		return strconv.FormatUint(uint64(s.NamespaceID), 10)
+	}},
+	{"cnl", "NAMESPACE LOCKING", level0(namespaceLockingColumn)},
+	{"max-compacket", "MAX COMPACKET", properties(func(tp *core.TPerProperties) string {
+		return strconv.FormatUint(uint64(tp.MaxComPacketSize), 10)
+	})},
+	{"max-sessions", "MAX SESSIONS", properties(func(tp *core.TPerProperties) string {
+		if tp.MaxSessions == nil {
+			return "-"
+		}
+		return strconv.FormatUint(uint64(*tp.MaxSessions), 10)
+	})},
+}
+
+func orDash(v string) string {
+	if v == "" {
+		return "-"
+	}
+	return v
+}
+
+// identity wraps a column that needs the identity of the device.
+func identity(f func(i *drive.Identity) string) func(s *DeviceState) string {
+	return func(s *DeviceState) string {
+		if s.Identity == nil {
+			return "-"
+		}
+		return f(s.Identity)
+	}
+}
+
+// level0 wraps a column that needs a successful Level0 discovery.
+func level0(f func(l0 *core.Level0Discovery) string) func(s *DeviceState) string {
+	return func(s *DeviceState) string {
+		if s.Level0 == nil {
+			return "-"
+		}
+		return f(s.Level0)
+	}
+}
+
+// properties wraps a column that needs the properties of the TPer.
+func properties(f func(tp *core.TPerProperties) string) func(s *DeviceState) string {
+	return func(s *DeviceState) string {
+		if s.Properties == nil {
+			return "-"
+		}
+		return f(s.Properties)
+	}
+}
+
+func columnNames() []string {
+	var names []string
+	for _, c := range allColumns {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// selectColumns parses a comma separated list of column names, or "all".
+func selectColumns(spec string) ([]column, error) {
+	if spec == "all" {
+		return allColumns, nil
+	}
+	var res []column
+	for _, name := range strings.Split(spec, ",") {
+		found := false
+		for _, c := range allColumns {
+			if c.Name == strings.TrimSpace(name) {
+				res = append(res, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column %q, must be one of [%s]", name, strings.Join(columnNames(), ", "))
+		}
+	}
+	return res, nil
+}
+
+// row returns the values of the columns for a device.
+func row(cols []column, s *DeviceState) []string {
+	var res []string
+	for _, c := range cols {
+		if s.Error != "" && c.Name == "state" {
+			res = append(res, "error: "+s.Error)
+			continue
+		}
+		res = append(res, c.Value(s))
+	}
+	return res
+}
+
+func stateFlags(l0 *core.Level0Discovery) string {
+	state := ""
+	if l := l0.Locking; l != nil {
+		if l.LockingEnabled {
+			state += "L"
+		} else if l.LockingSupported {
+			state += "l"
+		}
+
+		if l.MBREnabled {
+			if l.MBRDone {
+				state += "m"
+			} else {
+				state += "M"
+			}
+		}
+		if l.MediaEncryption {
+			state += "E"
+		}
+		if l.MBRShadowingNotSupported {
+			state += "s"
+		}
+	}
+	if b := l0.BlockSID; b != nil {
+		if !b.SIDValueState {
+			state += "P"
+		}
+		if b.SIDAuthenticationBlockedState {
+			state += "!"
+		}
+	}
+	return state
+}
+
+func blockSIDColumn(l0 *core.Level0Discovery) string {
+	b := l0.BlockSID
+	if b == nil {
+		return "-"
+	}
+	res := []string{"sid-set"}
+	if !b.SIDValueState {
+		res[0] = "sid-msid"
+	}
+	if b.SIDAuthenticationBlockedState {
+		res = append(res, "blocked")
+	}
+	if b.LockingSPFreezeLockState {
+		res = append(res, "frozen")
+	} else if b.LockingSPFreezeLockSupported {
+		res = append(res, "freezable")
+	}
+	if b.HardwareReset {
+		res = append(res, "hw-reset")
+	}
+	return strings.Join(res, ",")
+}
+
+func dataRemovalColumn(l0 *core.Level0Discovery) string {
+	d := l0.DataRemoval
+	if d == nil {
+		return "-"
+	}
+	var res []string
+	for _, m := range d.Mechanisms() {
+		res = append(res, m.String())
+	}
+	if len(res) == 0 {
+		return "none"
+	}
+	return strings.Join(res, ",")
+}
+
+func alignmentColumn(l0 *core.Level0Discovery) string {
+	g := l0.Geometry
+	if g == nil {
+		return "-"
+	}
+	res := fmt.Sprintf("%d/%d/%d", g.LogicalBlockSize, g.AlignmentGranularity, g.LowestAlignedLBA)
+	if g.Align {
+		res += "*"
+	}
+	return res
+}
+
+func namespaceLockingColumn(l0 *core.Level0Discovery) string {
+	n := l0.NamespaceLocking
+	if n == nil {
+		return "-"
+	}
+	return fmt.Sprintf("ranges/ns=%d keys=%d/%d", n.MaxRangesPerNamespace, n.UnusedKeyCount, n.MaxKeyCount)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/feature"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive"
+)
+
+func TestRow(t *testing.T) {
+	cols, err := selectColumns("device,model,ssc,state,comid,block-sid,data-removal,alignment")
+	if err != nil {
+		t.Fatalf("selectColumns failed: %v", err)
+	}
+	testCases := []struct {
+		name  string
+		state DeviceState
+		want  []string
+	}{
+		{
+			name: "Opal",
+			state: DeviceState{
+				Device:   "/dev/nvme0n1",
+				Identity: &drive.Identity{Model: "Disk"},
+				Level0: &core.Level0Discovery{
+					OpalV2:      &feature.OpalV2{},
+					Locking:     &feature.Locking{LockingSupported: true, LockingEnabled: true},
+					BlockSID:    &feature.BlockSID{SIDValueState: true, LockingSPFreezeLockSupported: true},
+					DataRemoval: &feature.DataRemoval{SupportedMechanisms: 0x1},
+					Geometry:    &feature.Geometry{Align: true, LogicalBlockSize: 512, AlignmentGranularity: 8},
+				},
+				BaseComID: 0x7fe,
+			},
+			want: []string{"/dev/nvme0n1", "Disk", "Opal 2", "L", "0x07fe", "sid-set,freezable", "overwrite", "512/8/0*"},
+		},
+		{
+			name:  "Failed",
+			state: DeviceState{Device: "/dev/sda", Error: "timed out"},
+			want:  []string{"/dev/sda", "-", "-", "error: timed out", "-", "-", "-", "-"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := row(cols, &tc.state); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("row() = %q; want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// stringList is a repeatable string flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// patternList is a repeatable flag of device patterns. A pattern is a glob,
+// or a regular expression if it is enclosed in slashes.
+type patternList []func(string) bool
+
+func (l *patternList) String() string {
+	return ""
+}
+
+func (l *patternList) Set(v string) error {
+	if len(v) >= 2 && strings.HasPrefix(v, "/") && strings.HasSuffix(v, "/") {
+		re, err := regexp.Compile(v[1 : len(v)-1])
+		if err != nil {
+			return err
+		}
+		*l = append(*l, re.MatchString)
+		return nil
+	}
+	if _, err := filepath.Match(v, ""); err != nil {
+		return fmt.Errorf("invalid glob %q: %v", v, err)
+	}
+	*l = append(*l, func(s string) bool {
+		ok, _ := filepath.Match(v, s)
+		return ok
+	})
+	return nil
+}
+
+// match reports whether any pattern matches the device path or its name.
+func (l patternList) match(devpath string) bool {
+	name := filepath.Base(devpath)
+	for _, m := range l {
+		if m(name) || m(devpath) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestPatternList(t *testing.T) {
+	testCases := []struct {
+		pattern string
+		devpath string
+		want    bool
+	}{
+		{"nvme*", "/dev/nvme0n1", true},
+		{"nvme*", "/dev/sda", false},
+		{"/dev/sd?", "/dev/sdb", true},
+		{"/^sd[a-c]$/", "/dev/sdc", true},
+		{"/^sd[a-c]$/", "/dev/sdd", false},
+		{"/nvme0/", "/dev/nvme0n1", true},
+	}
+	for _, tc := range testCases {
+		var l patternList
+		if err := l.Set(tc.pattern); err != nil {
+			t.Fatalf("Set(%q) failed: %v", tc.pattern, err)
+		}
+		if got := l.match(tc.devpath); got != tc.want {
+			t.Errorf("pattern %q on %q = %v; want %v", tc.pattern, tc.devpath, got, tc.want)
+		}
+	}
+}
@@ -1,32 +1,86 @@
 package main
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"text/tabwriter"
+	"time"
 
+	"github.com/open-source-firmware/go-tcg-storage/cmd/internal/clidoc"
+	"github.com/open-source-firmware/go-tcg-storage/cmd/internal/sedcli"
 	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
 	"github.com/open-source-firmware/go-tcg-storage/pkg/drive"
 )
 
 var (
-	outputFmt = flag.String("output", "table", "Output format; one of [table, json, openmetrics]")
-	noHeader  = flag.Bool("no-header", false, "Supress the header in table format output")
+	outputFmt = flag.String("output", "table", "Output format; one of [table, json, openmetrics, csv]")
+	noHeader  = flag.Bool("no-header", false, "Supress the header in table and csv format output")
+	columns   = flag.String("columns", defaultColumns, "Comma-separated list of columns in table and csv format output, or \"all\"")
+
+	completion = flag.String("completion", "", "Print the shell completion script; one of [bash, zsh, fish]")
+	helpMan    = flag.Bool("help-man", false, "Print the man page and exit")
+
+	devices  stringList
+	includes patternList
+	excludes patternList
+
+	parallel = flag.Int("parallel", 8, "Number of devices to probe concurrently")
+	timeout  = flag.Duration("timeout", 10*time.Second, "Time after which probing a device is given up")
+	props    = flag.Bool("properties", false, "Negotiate the communication properties with the TPer, needed for the max-compacket and max-sessions columns")
+
+	listen            = flag.String("listen", "", "Serve the openmetrics output at /metrics on the given address (e.g. :9775), re-scanning on every scrape")
+	metricsTimestamps = flag.Bool("metrics-timestamps", false, "Add the time of the scan as explicit timestamp to the openmetrics output")
+
+	debug = flag.Bool("debug", false, "Print method calls and status codes exchanged with the drives to stderr, with passwords redacted")
+	trace = flag.String("trace", "", "Dump all ComPackets exchanged with the drives to the given file. The dump contains the passwords sent to the drives in clear text")
 )
 
+// JSONSchemaVersion is the version of the JSON output. It is increased with
+// every change that breaks existing consumers, see the README for the list.
+const JSONSchemaVersion = 2
+
+// JSONOutput is the top-level object of the JSON output.
+type JSONOutput struct {
+	SchemaVersion int     `json:"schema_version"`
+	Devices       Devices `json:"devices"`
+}
+
+// The JSON names of the fields are spelled out, so that renaming a field
+// does not change the JSON output by accident. The nested Identity, Level0
+// and Properties objects use the Go field names of pkg/drive and pkg/core,
+// which are pinned by testdata/schema.txt instead.
 type DeviceState struct {
-	Device   string
-	Identity *drive.Identity
-	Level0   *core.Level0Discovery
+	Device   string                `json:"Device"`
+	Identity *drive.Identity       `json:"Identity"`
+	Level0   *core.Level0Discovery `json:"Level0"`
+	Error    string                `json:"Error,omitempty"`
+	// Base ComID of the first supported SSC
+	BaseComID uint16 `json:"BaseComID,omitempty"`
+	// Communication properties of the TPer, only probed with -properties
+	Properties *core.TPerProperties `json:"Properties,omitempty"`
+	// For NVMe devices, whether this is a controller or a namespace and
+	// which controller the namespace belongs to
+	Kind        string `json:"Kind,omitempty"`
+	Controller  string `json:"Controller,omitempty"`
+	NamespaceID uint32 `json:"NamespaceID,omitempty"`
 }
 
 type Devices []DeviceState
 
+func init() {
+	flag.Var(&devices, "device", "Device node to probe instead of all block devices (repeatable)")
+	flag.Var(&includes, "include", "Only probe devices matching the pattern (repeatable), see below")
+	flag.Var(&excludes, "exclude", "Do not probe devices matching the pattern (repeatable), see below")
+}
+
 func main() {
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
@@ -37,51 +91,56 @@ func main() {
 		fmt.Println("  L/l - Locking is supported and is enabled (L) or disabled (l)")
 		fmt.Println("  M/m - MBR is enabled and is active (M) or hidden (m)")
 		fmt.Println("  E   - The device has media encryption")
+		fmt.Println("  s   - The device does not support MBR shadowing")
 		fmt.Println("  P   - The Admin SP SID PIN is set to MSID [Block SID feature specific]")
 		fmt.Println("  !   - Authentication to Admin SP is blocked [Block SID feature specific]")
 		fmt.Println()
+		fmt.Printf("The following columns are available: %s\n", strings.Join(columnNames(), ", "))
+		fmt.Println("ALIGNMENT shows the logical block size/alignment granularity/lowest aligned LBA,")
+		fmt.Println("followed by * if the device requires aligned locking ranges.")
+		fmt.Println()
+		fmt.Println("Patterns are shell globs (e.g. \"nvme*\"), or regular expressions when enclosed")
+		fmt.Println("in slashes (e.g. \"/^sd[a-c]$/\"). They are matched against the device name and")
+		fmt.Println("the path of the device node.")
+		fmt.Println()
 	}
 	flag.Parse()
 
-	sysblk, err := os.ReadDir("/sys/class/block/")
-	if err != nil {
-		log.Printf("Failed to enumerate block devices: %v", err)
+	if *completion != "" || *helpMan {
+		printDoc()
 		return
 	}
 
-	var state Devices
-
-	for _, fi := range sysblk {
-		devname := fi.Name()
-		if _, err := os.Stat(filepath.Join("/sys/class/block", devname, "device")); os.IsNotExist(err) {
-			continue
-		}
-		devpath := filepath.Join("/dev", devname)
-		if _, err := os.Stat(devpath); os.IsNotExist(err) {
-			log.Printf("Failed to find device node %s", devpath)
-			continue
-		}
+	stopTrace, err := sedcli.StartTrace(*debug, *trace)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	defer stopTrace()
 
-		core, err := core.NewCore(devpath)
-		if err != nil {
-			log.Printf("drive.Open(%s): %v", devpath, err)
-			continue
-		}
-		defer core.Close()
+	if *listen != "" {
+		log.Fatal(serveMetrics(*listen))
+	}
 
-		state = append(state, DeviceState{
-			Device:   devpath,
-			Identity: core.DiskInfo.Identity,
-			Level0:   core.DiskInfo.Level0Discovery,
-		})
+	if *outputFmt == "openmetrics" {
+		outputMetrics()
+		return
 	}
 
+	state, _ := scan()
+
 	if *outputFmt == "json" {
 		outputJSON(state)
-	} else if *outputFmt == "openmetrics" {
-		outputMetrics(state)
-	} else if *outputFmt == "table" {
-		outputTable(state)
+	} else if *outputFmt == "table" || *outputFmt == "csv" {
+		cols, err := selectColumns(*columns)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		if *outputFmt == "csv" {
+			outputCSV(state, cols)
+		} else {
+			outputTable(state, cols)
+		}
 	} else {
 		fmt.Printf("Unsupported output format %q\n", *outputFmt)
 		flag.Usage()
@@ -89,93 +148,201 @@ func main() {
 	}
 }
 
-func outputJSON(state Devices) {
-	b, err := json.MarshalIndent(state, "", "  ")
+// candidates returns the device nodes to probe, either the ones given with
+// -device or all block devices in the system, after applying the filters.
+func candidates() ([]string, error) {
+	var devs []string
+	if len(devices) > 0 {
+		devs = devices
+	} else {
+		sysblk, err := os.ReadDir("/sys/class/block/")
+		if err != nil {
+			return nil, fmt.Errorf("failed to enumerate block devices: %v", err)
+		}
+		for _, fi := range sysblk {
+			devname := fi.Name()
+			if _, err := os.Stat(filepath.Join("/sys/class/block", devname, "device")); os.IsNotExist(err) {
+				continue
+			}
+			devs = append(devs, filepath.Join("/dev", devname))
+		}
+	}
+
+	var res []string
+	for _, d := range devs {
+		if len(includes) > 0 && !includes.match(d) {
+			continue
+		}
+		if excludes.match(d) {
+			continue
+		}
+		res = append(res, d)
+	}
+	return res, nil
+}
+
+// scan probes the candidate devices in parallel. Devices that do not support
+// TCG Storage are omitted, devices that failed to be probed are returned with
+// their error. The error is set if the devices could not be listed.
+func scan() (Devices, error) {
+	devs, err := candidates()
 	if err != nil {
-		log.Fatalf("Failed to marshal JSON: %v", err)
+		log.Printf("%v", err)
+		return nil, err
 	}
-	os.Stdout.Write(b)
+
+	results := make([]*DeviceState, len(devs))
+	work := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < *parallel || w == 0; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				results[i] = probeWithTimeout(devs[i], *timeout)
+			}
+		}()
+	}
+	for i := range devs {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	var state Devices
+	for _, r := range results {
+		if r == nil {
+			continue
+		}
+		state = append(state, *r)
+	}
+	return state, nil
 }
 
-func sscFeatures(l0 *core.Level0Discovery) []string {
-	feat := []string{}
-	if l0.Enterprise != nil {
-		feat = append(feat, "Enterprise")
+// probeWithTimeout probes a device, giving up after the timeout. As a hanging
+// ioctl cannot be interrupted, the probe is abandoned and keeps the device
+// open until it eventually returns.
+func probeWithTimeout(devpath string, timeout time.Duration) *DeviceState {
+	res := make(chan *DeviceState, 1)
+	go func() {
+		res <- probe(devpath)
+	}()
+	var r *DeviceState
+	select {
+	case r = <-res:
+		if r == nil {
+			return nil
+		}
+	case <-time.After(timeout):
+		r = &DeviceState{Device: devpath, Error: fmt.Sprintf("timed out after %v", timeout)}
 	}
-	if l0.OpalV1 != nil {
-		feat = append(feat, "Opal 1")
+	r.Kind, r.Controller, r.NamespaceID = classifyNVMe(devpath)
+	return r
+}
+
+// probe returns the state of a device, or nil if it does not support TCG Storage.
+func probe(devpath string) *DeviceState {
+	if _, err := os.Stat(devpath); os.IsNotExist(err) {
+		return &DeviceState{Device: devpath, Error: "device node not found"}
 	}
-	if l0.OpalV2 != nil {
-		feat = append(feat, "Opal 2")
+	c, err := sedcli.NewCore(devpath)
+	if errors.Is(err, drive.ErrDeviceNotSupported) || errors.Is(err, core.ErrNotSupported) {
+		return nil
 	}
-	if l0.Opalite != nil {
-		feat = append(feat, "Opalite")
+	if err != nil {
+		return &DeviceState{Device: devpath, Error: err.Error()}
 	}
-	if l0.PyriteV1 != nil {
-		feat = append(feat, "Pyrite 1")
+	defer c.Close()
+	comID, _ := core.BaseComID(c.DiskInfo.Level0Discovery)
+	st := &DeviceState{
+		Device:    devpath,
+		Identity:  c.DiskInfo.Identity,
+		Level0:    c.DiskInfo.Level0Discovery,
+		BaseComID: uint16(comID),
 	}
-	if l0.PyriteV2 != nil {
-		feat = append(feat, "Pyrite 2")
+	if *props {
+		// Not every device supporting discovery accepts a Properties call,
+		// that is no reason to fail the probe.
+		p, err := core.Probe(c.DriveIntf, c.DiskInfo.Level0Discovery)
+		if err != nil {
+			if *debug {
+				log.Printf("%s: %v", devpath, err)
+			}
+		} else {
+			st.Properties = &p.TPerProperties
+		}
 	}
-	if l0.RubyV1 != nil {
-		feat = append(feat, "Ruby 1")
+	return st
+}
+
+// printDoc prints the completion script or man page as requested by the flags.
+func printDoc() {
+	cmd := clidoc.FromFlagSet("tcgdiskstat", "Lists TCG Storage capable devices and their state", flag.CommandLine,
+		map[string][]string{
+			"output":     {"table", "json", "openmetrics", "csv"},
+			"completion": {"bash", "zsh", "fish"},
+		})
+	switch *completion {
+	case "":
+		fmt.Print(clidoc.Man(cmd, 8))
+	case "bash":
+		fmt.Print(clidoc.Bash(cmd))
+	case "zsh":
+		fmt.Print(clidoc.Zsh(cmd))
+	case "fish":
+		fmt.Print(clidoc.Fish(cmd))
+	default:
+		fmt.Printf("Unsupported shell %q\n", *completion)
+		os.Exit(2)
+	}
+}
+
+func outputJSON(state Devices) {
+	b, err := marshalJSON(state)
+	if err != nil {
+		log.Fatalf("Failed to marshal JSON: %v", err)
+	}
+	os.Stdout.Write(b)
+}
+
+func marshalJSON(state Devices) ([]byte, error) {
+	if state == nil {
+		state = Devices{}
 	}
-	return feat
+	return json.MarshalIndent(JSONOutput{SchemaVersion: JSONSchemaVersion, Devices: state}, "", "  ")
 }
 
-func outputTable(state Devices) {
+func outputTable(state Devices, cols []column) {
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
 	if !*noHeader {
-		fmt.Fprintf(w, "DEVICE\tMODEL\tSERIAL\tFIRMWARE\tPROTOCOL\tSSC\tSTATE\n")
-	}
-	for _, s := range state {
-		var feat []string
-		state := ""
-		if s.Level0 != nil {
-			feat = sscFeatures(s.Level0)
-			if l := s.Level0.Locking; l != nil {
-				if l.LockingEnabled {
-					state += "L"
-				} else if l.LockingSupported {
-					state += "l"
-				}
-
-				if l.MBREnabled {
-					if l.MBRDone {
-						state += "m"
-					} else {
-						state += "M"
-					}
-				}
-				if l.MediaEncryption {
-					state += "E"
-				}
-				if l.MBRShadowing {
-					state += "S"
-				}
-			}
-			if b := s.Level0.BlockSID; b != nil {
-				if !b.SIDValueState {
-					state += "P"
-				}
-				if b.SIDAuthenticationBlockedState {
-					state += "!"
-				}
-			}
-		} else {
-			state = "-"
-			feat = []string{"-"}
+		var hdr []string
+		for _, c := range cols {
+			hdr = append(hdr, c.Header)
 		}
+		fmt.Fprintf(w, "%s\t\n", strings.Join(hdr, "\t"))
+	}
+	for i := range state {
+		fmt.Fprintf(w, "%s\t\n", strings.Join(row(cols, &state[i]), "\t"))
+	}
+	w.Flush()
+}
 
-		fmt.Fprint(w,
-			s.Device, "\t",
-			s.Identity.Model, "\t",
-			s.Identity.SerialNumber, "\t",
-			s.Identity.Firmware, "\t",
-			s.Identity.Protocol, "\t",
-			strings.Join(feat, ","), "\t",
-			state, "\t",
-			"\n")
+// outputCSV prints the selected columns as CSV. The header uses the column
+// names as accepted by -columns, which are kept stable for importing.
+func outputCSV(state Devices, cols []column) {
+	w := csv.NewWriter(os.Stdout)
+	if !*noHeader {
+		var hdr []string
+		for _, c := range cols {
+			hdr = append(hdr, c.Name)
+		}
+		w.Write(hdr)
+	}
+	for i := range state {
+		w.Write(row(cols, &state[i]))
 	}
 	w.Flush()
+	if err := w.Error(); err != nil {
+		log.Fatalf("Failed to write CSV: %v", err)
+	}
 }
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "Rewrite the JSON schema file with the current field names")
+
+func TestMarshalJSON(t *testing.T) {
+	for _, tc := range []struct {
+		state   Devices
+		devices int
+	}{
+		{nil, 0},
+		{Devices{{Device: "/dev/sda", Error: "timed out"}}, 1},
+	} {
+		b, err := marshalJSON(tc.state)
+		if err != nil {
+			t.Fatalf("marshalJSON() failed: %v", err)
+		}
+		var out struct {
+			SchemaVersion *int              `json:"schema_version"`
+			Devices       []json.RawMessage `json:"devices"`
+		}
+		if err := json.Unmarshal(b, &out); err != nil {
+			t.Fatalf("unmarshaling %s failed: %v", b, err)
+		}
+		if out.SchemaVersion == nil || *out.SchemaVersion != JSONSchemaVersion {
+			t.Errorf("%s does not have schema_version %d", b, JSONSchemaVersion)
+		}
+		if out.Devices == nil || len(out.Devices) != tc.devices {
+			t.Errorf("%s does not have %d devices", b, tc.devices)
+		}
+	}
+}
+
+// The nested objects are marshalled with the names of the Go fields of
+// pkg/core and pkg/drive. Their names are recorded in a file, so that a
+// renamed field fails here instead of silently breaking consumers, and the
+// file is rewritten with "go test -run JSONSchema -update" together with an
+// increase of JSONSchemaVersion.
+func TestJSONSchema(t *testing.T) {
+	var state DeviceState
+	fill(reflect.ValueOf(&state).Elem())
+	b, err := json.Marshal(state)
+	if err != nil {
+		t.Fatalf("marshaling failed: %v", err)
+	}
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		t.Fatalf("unmarshaling %s failed: %v", b, err)
+	}
+	var paths []string
+	jsonPaths("", v, &paths)
+	sort.Strings(paths)
+	got := strings.Join(paths, "\n") + "\n"
+
+	path := filepath.Join("testdata", "schema.txt")
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatalf("writing %s failed: %v", path, err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading %s failed: %v", path, err)
+	}
+	if got != string(want) {
+		t.Errorf("the JSON fields differ from %s, increase JSONSchemaVersion if that is intended\ngot:\n%s", path, got)
+	}
+}
+
+// fill allocates all nil pointers of a struct, so that every field is
+// present in the JSON output.
+func fill(v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		fill(v.Elem())
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Field(i).CanSet() {
+				fill(v.Field(i))
+			}
+		}
+	}
+}
+
+func jsonPaths(prefix string, v interface{}, paths *[]string) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		*paths = append(*paths, prefix)
+		return
+	}
+	for k, e := range m {
+		if prefix != "" {
+			k = prefix + "." + k
+		}
+		jsonPaths(k, e, paths)
+	}
+}
@@ -2,105 +2,69 @@ package main
 
 import (
 	"log"
+	"net/http"
 	"os"
 
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/metrics"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/expfmt"
 )
 
-type metricCollector struct {
-	m []prometheus.Metric
-}
-
-func (mc *metricCollector) Collect(c chan<- prometheus.Metric) {
-	for _, m := range mc.m {
-		c <- m
+// metrics returns the devices as exported by the metrics collector.
+func (state Devices) metrics() metrics.Devices {
+	devs := make(metrics.Devices, 0, len(state))
+	for _, s := range state {
+		devs = append(devs, metrics.Device{
+			Device:   s.Device,
+			Identity: s.Identity,
+			Level0:   s.Level0,
+			Error:    s.Error,
+		})
 	}
+	return devs
 }
 
-func (mc *metricCollector) Describe(c chan<- *prometheus.Desc) {
+// changeLogger logs how the Level 0 Discovery of the devices changed since
+// the previous scrape, e.g. when a drive was locked by a reset.
+type changeLogger struct {
+	// Level 0 Discovery of each device in the previous scrape
+	last map[string]*core.Level0Discovery
 }
 
-func outputMetrics(state Devices) {
-	var (
-		mDriveInfo = prometheus.NewDesc(
-			"tcg_storage_drive_info",
-			"Info metric regarding the detected drives",
-			[]string{"device", "model", "serial", "firmware", "protocol"}, nil,
-		)
-		mTCGSupported = prometheus.NewDesc(
-			"tcg_storage_supported",
-			"Boolean describing whether a drive supports any TCG storage standards",
-			[]string{"device"}, nil,
-		)
-		mSSCSupported = prometheus.NewDesc(
-			"tcg_storage_ssc_supported",
-			"Boolean describing whether a particular SSC is supported by the drive or not",
-			[]string{"device", "ssc"}, nil,
-		)
-		mLockingEnabled = prometheus.NewDesc(
-			"tcg_storage_locking_enabled",
-			"Boolean describing whether the drive is reporting range locking has been enabled",
-			[]string{"device"}, nil,
-		)
-		mSIDAuthBlocked = prometheus.NewDesc(
-			"tcg_storage_sid_authentication_blocked",
-			"Boolean describing if the Block SID feature has made authentication to the drive currently impossible",
-			[]string{"device"}, nil,
-		)
-		mDefaultSIDPIN = prometheus.NewDesc(
-			"tcg_storage_default_sid_pin_detected",
-			"Boolean describing if the Block SID feature reports the default SID PIN is in use",
-			[]string{"device"}, nil,
-		)
-	)
-	mc := &metricCollector{}
+func (cl *changeLogger) logChanges(state Devices) {
+	if cl.last == nil {
+		cl.last = map[string]*core.Level0Discovery{}
+	}
 	for _, s := range state {
-		mc.m = append(mc.m,
-			prometheus.MustNewConstMetric(mDriveInfo, prometheus.GaugeValue, 1,
-				s.Device, s.Identity.Model, s.Identity.SerialNumber, s.Identity.Firmware, s.Identity.Protocol))
-		sup := float64(0)
-		if s.Level0 != nil {
-			sup = 1
-		}
-		mc.m = append(mc.m, prometheus.MustNewConstMetric(mTCGSupported, prometheus.GaugeValue, sup, s.Device))
-
-		// This is how far we can make it without a successful Level0 discovery
 		if s.Level0 == nil {
 			continue
 		}
-
-		for _, ssc := range sscFeatures(s.Level0) {
-			mc.m = append(mc.m,
-				prometheus.MustNewConstMetric(mSSCSupported, prometheus.GaugeValue, 1,
-					s.Device, ssc))
-		}
-
-		lockEn := float64(0)
-		if l := s.Level0.Locking; l != nil {
-			if l.LockingEnabled {
-				lockEn = 1
+		if old, ok := cl.last[s.Device]; ok {
+			for _, c := range core.DiffDiscovery(old, s.Level0) {
+				log.Printf("%s: %s", s.Device, c)
 			}
 		}
-		mc.m = append(mc.m, prometheus.MustNewConstMetric(mLockingEnabled, prometheus.GaugeValue, lockEn, s.Device))
+		cl.last[s.Device] = s.Level0
+	}
+}
 
-		if b := s.Level0.BlockSID; b != nil {
-			authBlock := float64(0)
-			bDefaultSID := float64(0)
-			if !b.SIDValueState {
-				bDefaultSID = 1
-			}
-			if b.SIDAuthenticationBlockedState {
-				authBlock = 1
-			}
-			// Metrics only visible if Block SID feature is supported
-			mc.m = append(mc.m, prometheus.MustNewConstMetric(mSIDAuthBlocked, prometheus.GaugeValue, authBlock, s.Device))
-			mc.m = append(mc.m, prometheus.MustNewConstMetric(mDefaultSIDPIN, prometheus.GaugeValue, bDefaultSID, s.Device))
-		}
+func newCollector(scanned func(Devices)) *metrics.Collector {
+	var opts []metrics.CollectorOpt
+	if *metricsTimestamps {
+		opts = append(opts, metrics.WithTimestamps())
 	}
+	return metrics.NewCollector(func() (metrics.Devices, error) {
+		state, err := scan()
+		scanned(state)
+		return state.metrics(), err
+	}, opts...)
+}
 
+func outputMetrics() {
 	reg := prometheus.NewPedanticRegistry()
-	reg.MustRegister(mc)
+	reg.MustRegister(newCollector(func(Devices) {}))
 
 	mfs, err := reg.Gather()
 	if err != nil {
@@ -112,3 +76,18 @@ func outputMetrics(state Devices) {
 		}
 	}
 }
+
+// serveMetrics runs an exporter serving the device metrics at /metrics. All
+// devices are scanned on every scrape.
+func serveMetrics(addr string) error {
+	cl := &changeLogger{}
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(newCollector(cl.logChanges))
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{
+		ErrorLog: log.Default(),
+	}))
+	log.Printf("Serving metrics on %s/metrics", addr)
+	return http.ListenAndServe(addr, mux)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	kindController = "controller"
+	kindNamespace  = "namespace"
+)
+
+var (
+	reNVMeController = regexp.MustCompile(`^nvme(\d+)$`)
+	reNVMeNamespace  = regexp.MustCompile(`^nvme(\d+)n(\d+)$`)
+)
+
+// classifyNVMe tells NVMe controller character devices (/dev/nvme0) apart
+// from namespace block devices (/dev/nvme0n1). For namespaces the controller
+// device node and the namespace ID are returned as well.
+func classifyNVMe(devpath string) (kind string, controller string, nsid uint32) {
+	name := filepath.Base(devpath)
+	if reNVMeController.MatchString(name) {
+		return kindController, devpath, 0
+	}
+	m := reNVMeNamespace.FindStringSubmatch(name)
+	if m == nil {
+		return "", "", 0
+	}
+	controller = filepath.Join(filepath.Dir(devpath), "nvme"+m[1])
+	// The device link points to the controller, unless native multipathing
+	// is used in which case it points to the subsystem and the name is the
+	// best guess available.
+	if l, err := os.Readlink(filepath.Join("/sys/class/block", name, "device")); err == nil {
+		if c := filepath.Base(l); reNVMeController.MatchString(c) {
+			controller = filepath.Join(filepath.Dir(devpath), c)
+		}
+	}
+	n, _ := strconv.ParseUint(m[2], 10, 32)
+	if b, err := os.ReadFile(filepath.Join("/sys/class/block", name, "nsid")); err == nil {
+		if v, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 32); err == nil {
+			n = v
+		}
+	}
+	return kindNamespace, controller, uint32(n)
+}
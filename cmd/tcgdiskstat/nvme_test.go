@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestClassifyNVMe(t *testing.T) {
+	testCases := []struct {
+		devpath    string
+		kind       string
+		controller string
+		nsid       uint32
+	}{
+		{"/dev/nvme0", kindController, "/dev/nvme0", 0},
+		{"/dev/nvme1n2", kindNamespace, "/dev/nvme1", 2},
+		{"/dev/nvme0n1p1", "", "", 0},
+		{"/dev/sda", "", "", 0},
+	}
+	for _, tc := range testCases {
+		kind, controller, nsid := classifyNVMe(tc.devpath)
+		if kind != tc.kind || controller != tc.controller || nsid != tc.nsid {
+			t.Errorf("classifyNVMe(%q) = %q, %q, %d; want %q, %q, %d",
+				tc.devpath, kind, controller, nsid, tc.kind, tc.controller, tc.nsid)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/open-source-firmware/go-tcg-storage/cmd/internal/sedcli"
+	tcg "github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive"
+)
+
+// Open the device, returning a recorder of all its traffic if record is set.
+func openCore(device string, record bool) (*tcg.Core, *drive.Recorder, error) {
+	if !record {
+		core, err := sedcli.NewCore(device)
+		return core, nil, err
+	}
+	d, err := drive.Open(device)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open device %s failed: %w", device, err)
+	}
+	rec := drive.NewRecorder(d)
+	core, err := sedcli.NewCoreFromDrive(rec)
+	return core, rec, err
+}
+
+type captureProperties struct {
+	ProtocolLevel  string             `json:"protocol_level"`
+	TPerProperties tcg.TPerProperties `json:"tper_properties"`
+	HostProperties tcg.HostProperties `json:"host_properties"`
+}
+
+type captureFile struct {
+	name string
+	v    interface{}
+}
+
+// Write a bundle of everything needed to reproduce the behaviour of a drive
+// to a gzip-compressed tarball. The serial number of the drive is anonymized.
+func writeCapture(path string, rec *drive.Recording, core *tcg.Core, cs *tcg.ControlSession, rep *Report) error {
+	rec.Anonymize()
+	files := []captureFile{
+		{"identity.json", rec.Identity},
+		{"trace.json", rec},
+	}
+	if core != nil {
+		files = append(files, captureFile{"level0.json", core.DiskInfo.Level0Discovery})
+	}
+	if cs != nil {
+		files = append(files, captureFile{"properties.json", captureProperties{
+			ProtocolLevel:  cs.ProtocolLevel.String(),
+			TPerProperties: cs.TPerProperties,
+			HostProperties: cs.HostProperties,
+		}})
+	}
+	// The report contains the real serial number in the identity
+	anonRep := *rep
+	anonRep.Identity = rec.Identity
+	anonRep.Passed = anonRep.AllPassed()
+	files = append(files, captureFile{"report.json", &anonRep})
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	tw := tar.NewWriter(zw)
+	now := time.Now()
+	for _, file := range files {
+		b, err := json.MarshalIndent(file.v, "", "  ")
+		if err != nil {
+			return fmt.Errorf("encoding %s failed: %v", file.name, err)
+		}
+		hdr := &tar.Header{
+			Name:    file.name,
+			Mode:    0644,
+			Size:    int64(len(b)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(b); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
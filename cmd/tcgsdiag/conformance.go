@@ -0,0 +1,350 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	tcg "github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/feature"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+var errNoSession = errors.New("no Admin SP session")
+
+// conformance carries the state shared by the conformance checks.
+type conformance struct {
+	core *tcg.Core
+	d0   *tcg.Level0Discovery
+	cs   *tcg.ControlSession
+	s    *tcg.Session
+	// The first negotiated control session
+	negotiated *tcg.ControlSession
+}
+
+type check struct {
+	Name  string
+	Check func(c *conformance) error
+}
+
+// sscChecklist is the list of checks derived from the specification of an
+// SSC. The checks are only run if the drive claims to implement the SSC.
+type sscChecklist struct {
+	Name    string
+	Claimed func(d0 *tcg.Level0Discovery) bool
+	Checks  []check
+}
+
+// Minimum values of the TPer properties required by an SSC, zero means that
+// the SSC does not mandate a minimum.
+type propertyMinimums struct {
+	MaxComPacketSize         uint
+	MaxResponseComPacketSize uint
+	MaxPacketSize            uint
+	MaxIndTokenSize          uint
+	MaxPackets               uint
+	MaxSubpackets            uint
+	MaxMethods               uint
+	MaxSessions              uint
+	MaxAuthentications       uint
+	MaxTransactionLimit      uint
+}
+
+// Opal SSC v2.01 rev 1.00, 4.1.1.1 "Properties"
+var opalV2Minimums = propertyMinimums{
+	MaxComPacketSize:         2048,
+	MaxResponseComPacketSize: 2048,
+	MaxPacketSize:            2028,
+	MaxIndTokenSize:          1992,
+	MaxPackets:               1,
+	MaxSubpackets:            1,
+	MaxMethods:               1,
+	MaxSessions:              1,
+	MaxAuthentications:       2,
+	MaxTransactionLimit:      1,
+}
+
+// Enterprise SSC v1.01 rev 1.00, 6.3.1 "Properties"
+var enterpriseMinimums = propertyMinimums{
+	MaxComPacketSize:         2048,
+	MaxResponseComPacketSize: 2048,
+	MaxPacketSize:            2028,
+	MaxIndTokenSize:          1992,
+	MaxPackets:               1,
+	MaxSubpackets:            1,
+	MaxMethods:               1,
+	MaxSessions:              1,
+	MaxAuthentications:       2,
+}
+
+// Pyrite SSC v1.00 rev 1.00, 4.1.1.1 "Properties"
+var pyriteMinimums = propertyMinimums{
+	MaxComPacketSize:         2048,
+	MaxResponseComPacketSize: 2048,
+	MaxPacketSize:            2028,
+	MaxIndTokenSize:          1992,
+	MaxPackets:               1,
+	MaxSubpackets:            1,
+	MaxMethods:               1,
+	MaxSessions:              1,
+	MaxAuthentications:       2,
+	MaxTransactionLimit:      1,
+}
+
+var checklists = []sscChecklist{
+	{
+		Name:    "opal2",
+		Claimed: func(d0 *tcg.Level0Discovery) bool { return d0.OpalV2 != nil },
+		Checks: []check{
+			{"level0/tper", checkTPerFeature},
+			{"level0/locking", checkLockingFeature(true)},
+			{"level0/geometry", func(c *conformance) error {
+				return require(c.d0.Geometry != nil, "Geometry Reporting feature missing")
+			}},
+			{"level0/datastore", func(c *conformance) error {
+				return require(c.d0.DataStore != nil, "DataStore Table feature missing")
+			}},
+			{"level0/opal2", func(c *conformance) error {
+				f := c.d0.OpalV2
+				return firstError(
+					require(f.BaseComID != 0, "BaseComID is zero"),
+					require(f.NumComID >= 1, "NumComIDs is %d, expected at least 1", f.NumComID),
+					require(f.NumLockingSPAdminSupported >= 4, "NumLockingSPAdminSupported is %d, expected at least 4", f.NumLockingSPAdminSupported),
+					require(f.NumLockingSPUserSupported >= 8, "NumLockingSPUserSupported is %d, expected at least 8", f.NumLockingSPUserSupported),
+				)
+			}},
+			{"session/properties", checkProperties(opalV2Minimums)},
+			{"session/admin-sp", checkAdminSession},
+			{"admin-sp/c_pin-msid", checkMSID},
+			{"admin-sp/tperinfo", checkTPerInfo},
+			{"admin-sp/sp-lifecycle", checkLifeCycle(uid.LockingSP)},
+			{"admin-sp/random", checkRandom},
+		},
+	},
+	{
+		Name:    "enterprise",
+		Claimed: func(d0 *tcg.Level0Discovery) bool { return d0.Enterprise != nil },
+		Checks: []check{
+			{"level0/tper", checkTPerFeature},
+			{"level0/locking", checkLockingFeature(true)},
+			{"level0/enterprise", func(c *conformance) error {
+				f := c.d0.Enterprise
+				return firstError(
+					require(f.BaseComID != 0, "BaseComID is zero"),
+					require(f.NumComID >= 1, "NumComIDs is %d, expected at least 1", f.NumComID),
+				)
+			}},
+			{"session/properties", checkProperties(enterpriseMinimums)},
+			{"session/admin-sp", checkAdminSession},
+			{"admin-sp/c_pin-msid", checkMSID},
+		},
+	},
+	{
+		Name:    "pyrite",
+		Claimed: func(d0 *tcg.Level0Discovery) bool { return d0.PyriteV1 != nil || d0.PyriteV2 != nil },
+		Checks: []check{
+			{"level0/tper", checkTPerFeature},
+			{"level0/locking", checkLockingFeature(false)},
+			{"level0/pyrite", func(c *conformance) error {
+				var f feature.CommonSSC
+				if c.d0.PyriteV1 != nil {
+					f = c.d0.PyriteV1.CommonSSC
+				} else {
+					f = c.d0.PyriteV2.CommonSSC
+				}
+				return firstError(
+					require(f.BaseComID != 0, "BaseComID is zero"),
+					require(f.NumComID >= 1, "NumComIDs is %d, expected at least 1", f.NumComID),
+				)
+			}},
+			{"session/properties", checkProperties(pyriteMinimums)},
+			{"session/admin-sp", checkAdminSession},
+			{"admin-sp/c_pin-msid", checkMSID},
+			{"admin-sp/sp-lifecycle", checkLifeCycle(uid.LockingSP)},
+		},
+	},
+}
+
+// Run the checklists of all SSCs claimed by the drive and record the
+// deviations in the report. Returns the first negotiated control session, if
+// any.
+func runConformance(core *tcg.Core, rep *Report) *tcg.ControlSession {
+	c := &conformance{core: core, d0: core.DiskInfo.Level0Discovery}
+	claimed := 0
+	for _, cl := range checklists {
+		if !cl.Claimed(c.d0) {
+			continue
+		}
+		claimed++
+		log.Printf("Checking conformance to %s", cl.Name)
+		for _, chk := range cl.Checks {
+			rep.Add(cl.Name+"/"+chk.Name, chk.Check(c))
+		}
+		c.close()
+	}
+	if claimed == 0 {
+		rep.Add("ssc", errors.New("drive does not claim any supported SSC"))
+	}
+	return c.negotiated
+}
+
+func (c *conformance) close() {
+	if c.s != nil {
+		if err := c.s.Close(); err != nil {
+			log.Printf("Session.Close failed: %v", err)
+		}
+	}
+	c.s = nil
+	if c.cs != nil {
+		// Ends the sessions a failed check may have left open as well
+		if err := c.cs.CloseAll(); err != nil {
+			log.Printf("ControlSession.CloseAll failed: %v", err)
+		}
+		if err := c.cs.Close(); err != nil {
+			log.Printf("ControlSession.Close failed: %v", err)
+		}
+	}
+	c.cs = nil
+}
+
+func require(cond bool, format string, args ...interface{}) error {
+	if cond {
+		return nil
+	}
+	return fmt.Errorf(format, args...)
+}
+
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkTPerFeature(c *conformance) error {
+	f := c.d0.TPer
+	if f == nil {
+		return errors.New("TPer feature missing")
+	}
+	return require(f.SyncSupported, "synchronous protocol not supported")
+}
+
+func checkLockingFeature(encryption bool) func(c *conformance) error {
+	return func(c *conformance) error {
+		f := c.d0.Locking
+		if f == nil {
+			return errors.New("Locking feature missing")
+		}
+		return firstError(
+			require(f.LockingSupported, "LockingSupported is not set"),
+			require(!encryption || f.MediaEncryption, "MediaEncryption is not set"),
+		)
+	}
+}
+
+func checkProperties(min propertyMinimums) func(c *conformance) error {
+	return func(c *conformance) error {
+		c.close()
+		cs, err := tcg.NewControlSession(c.core.DriveIntf, c.d0)
+		if err != nil {
+			return fmt.Errorf("properties negotiation failed: %v", err)
+		}
+		c.cs = cs
+		if c.negotiated == nil {
+			c.negotiated = cs
+		}
+		tp := cs.TPerProperties
+		opt := func(v *uint) uint {
+			if v == nil {
+				return 0
+			}
+			return *v
+		}
+		for _, p := range []struct {
+			name     string
+			val, min uint
+		}{
+			{"MaxComPacketSize", tp.MaxComPacketSize, min.MaxComPacketSize},
+			{"MaxResponseComPacketSize", opt(tp.MaxResponseComPacketSize), min.MaxResponseComPacketSize},
+			{"MaxPacketSize", tp.MaxPacketSize, min.MaxPacketSize},
+			{"MaxIndTokenSize", tp.MaxIndTokenSize, min.MaxIndTokenSize},
+			{"MaxPackets", tp.MaxPackets, min.MaxPackets},
+			{"MaxSubpackets", tp.MaxSubpackets, min.MaxSubpackets},
+			{"MaxMethods", tp.MaxMethods, min.MaxMethods},
+			{"MaxSessions", opt(tp.MaxSessions), min.MaxSessions},
+			{"MaxAuthentications", opt(tp.MaxAuthentications), min.MaxAuthentications},
+			{"MaxTransactionLimit", opt(tp.MaxTransactionLimit), min.MaxTransactionLimit},
+		} {
+			if p.val < p.min {
+				return fmt.Errorf("%s is %d, expected at least %d", p.name, p.val, p.min)
+			}
+		}
+		return nil
+	}
+}
+
+func checkAdminSession(c *conformance) error {
+	if c.cs == nil {
+		return errors.New("no control session")
+	}
+	s, err := c.cs.NewSession(uid.AdminSP)
+	if err != nil {
+		return fmt.Errorf("StartSession on Admin SP failed: %v", err)
+	}
+	c.s = s
+	return nil
+}
+
+func checkMSID(c *conformance) error {
+	if c.s == nil {
+		return errNoSession
+	}
+	pin, err := table.Admin_C_PIN_MSID_GetPIN(c.s)
+	if err != nil {
+		return fmt.Errorf("reading C_PIN MSID failed: %v", err)
+	}
+	return require(len(pin) > 0, "C_PIN MSID is empty")
+}
+
+func checkTPerInfo(c *conformance) error {
+	if c.s == nil {
+		return errNoSession
+	}
+	rows, err := table.Admin_TPerInfo(c.s)
+	if err != nil {
+		return fmt.Errorf("reading TPerInfo failed: %v", err)
+	}
+	return require(len(rows) > 0, "TPerInfo table is empty")
+}
+
+func checkLifeCycle(spid uid.SPID) func(c *conformance) error {
+	return func(c *conformance) error {
+		if c.s == nil {
+			return errNoSession
+		}
+		lcs, err := table.Admin_SP_GetLifeCycleState(c.s, spid)
+		if err != nil {
+			return fmt.Errorf("reading SP LifeCycleState failed: %v", err)
+		}
+		return require(lcs == table.ManufacturedInactive || lcs == table.Manufactured,
+			"unexpected LifeCycleState %v", lcs)
+	}
+}
+
+func checkRandom(c *conformance) error {
+	if c.s == nil {
+		return errNoSession
+	}
+	rnd, err := table.ThisSP_Random(c.s, 32)
+	if err != nil {
+		return fmt.Errorf("Random failed: %v", err)
+	}
+	return require(len(rnd) == 32, "Random returned %d bytes, expected 32", len(rnd))
+}
@@ -5,46 +5,72 @@
 package main
 
 import (
-	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/davecgh/go-spew/spew"
+	"github.com/open-source-firmware/go-tcg-storage/cmd/internal/sedcli"
 	tcg "github.com/open-source-firmware/go-tcg-storage/pkg/core"
-	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
-	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
-	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
 	"github.com/open-source-firmware/go-tcg-storage/pkg/drive"
 )
 
-func TestComID(d drive.DriveIntf) tcg.ComID {
+var (
+	output   = flag.String("output", "text", "Output format (text, json)")
+	suiteSel = flag.String("suites", strings.Join(suiteNames(), ","), "Comma-separated list of test suites to run")
+	activate = flag.Bool("activate", os.Getenv("TCGSDIAG_ACTIVATE") != "", "Activate the Locking SP if it is inactive")
+	psid     = flag.String("psid", os.Getenv("TCGSDIAG_PSID"), "Authenticate to the Admin SP with this PSID")
+	asUser   = flag.Bool("as-user", os.Getenv("TCGSDIAG_AS_USER") != "", "Authenticate to the Opal Locking SP as User1 instead of Admin1")
+	clearLog = flag.Bool("clear-log", false, "Clear the log tables of the Admin SP after dumping them, authenticating as SID with the MSID")
+	capture  = flag.String("capture", "", "Write a bundle of the drive's traffic and properties to this .tar.gz file")
+	all      = flag.Bool("all", false, "Run the diagnostics on all TCG Storage devices instead of the given ones")
+	debug    = flag.Bool("debug", false, "Print method calls and status codes exchanged with the drive to stderr, with passwords redacted")
+	trace    = flag.String("trace", "", "Dump all ComPackets exchanged with the drive to the given file. The dump contains the passwords sent to the drive in clear text")
+
+	// out receives the human readable diagnostics, it is discarded when a
+	// machine-readable report is requested.
+	out io.Writer = os.Stdout
+)
+
+func TestComID(d drive.DriveIntf, rep *Report) tcg.ComID {
 	comID, err := tcg.GetComID(d)
 	if err != nil {
 		log.Printf("Unable to auto-allocate ComID: %v", err)
+		rep.Add("comid-allocate", err)
 		return tcg.ComIDInvalid
 	}
 	log.Printf("Allocated ComID 0x%08x", comID)
+	rep.Add("comid-allocate", nil, "comid", uint32(comID))
 	valid, err := tcg.IsComIDValid(d, comID)
 	if err != nil {
 		log.Printf("Unable to validate allocated ComID: %v", err)
+		rep.Add("comid-verify", err)
 		return tcg.ComIDInvalid
 	}
 	if !valid {
 		log.Printf("Allocated ComID not valid")
+		rep.Add("comid-verify", errors.New("allocated ComID not valid"))
 		return tcg.ComIDInvalid
 	}
 	log.Printf("ComID validated successfully")
+	rep.Add("comid-verify", nil)
 
 	if err := tcg.StackReset(d, comID); err != nil {
 		log.Printf("Unable to reset the synchronous protocol stack: %v", err)
+		rep.Add("stack-reset", err)
 		return tcg.ComIDInvalid
 	}
 	log.Printf("Synchronous protocol stack reset successfully")
+	rep.Add("stack-reset", nil)
 	return comID
 }
 
-func TestControlSession(d drive.DriveIntf, d0 *tcg.Level0Discovery, comID tcg.ComID) *tcg.ControlSession {
+func TestControlSession(d drive.DriveIntf, d0 *tcg.Level0Discovery, comID tcg.ComID, rep *Report) *tcg.ControlSession {
 	if comID == tcg.ComIDInvalid {
 		log.Printf("Auto-allocation ComID test failed earlier, selecting first available base ComID")
 		if d0.OpalV2 != nil {
@@ -61,6 +87,7 @@ func TestControlSession(d drive.DriveIntf, d0 *tcg.Level0Discovery, comID tcg.Co
 			comID = tcg.ComID(d0.Enterprise.BaseComID)
 		} else {
 			log.Printf("No supported feature found, giving up without a ComID ...")
+			rep.Add("control-session", errors.New("no supported feature found"))
 			return nil
 		}
 	}
@@ -68,13 +95,19 @@ func TestControlSession(d drive.DriveIntf, d0 *tcg.Level0Discovery, comID tcg.Co
 	cs, err := tcg.NewControlSession(d, d0, tcg.WithComID(comID))
 	if err != nil {
 		log.Printf("s.NewControlSession failed: %v", err)
+		rep.Add("control-session", err, "comid", uint32(comID))
 		return nil
 	}
 	log.Printf("Operating using protocol %q", cs.ProtocolLevel.String())
 	log.Printf("Negotiated TPerProperties:")
-	spew.Dump(cs.TPerProperties)
+	spew.Fdump(out, cs.TPerProperties)
 	log.Printf("Negotiated HostProperties:")
-	spew.Dump(cs.HostProperties)
+	spew.Fdump(out, cs.HostProperties)
+	rep.Add("control-session", nil,
+		"comid", uint32(comID),
+		"protocol", cs.ProtocolLevel.String(),
+		"tper_properties", cs.TPerProperties,
+		"host_properties", cs.HostProperties)
 	// TODO: Move this to a test case instead
 	if err := cs.Close(); err != nil {
 		log.Fatalf("Test of ControlSession Close failed: %v", err)
@@ -83,223 +116,171 @@ func TestControlSession(d drive.DriveIntf, d0 *tcg.Level0Discovery, comID tcg.Co
 }
 
 func main() {
-	spew.Config.Indent = "  "
-
-	core, err := tcg.NewCore(os.Args[1])
-	if err != nil {
-		log.Fatalf("core.Open: %v", err)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [conformance] DEVICE...\n", os.Args[0])
+		flag.PrintDefaults()
 	}
-	defer core.Close()
-
-	fmt.Printf("===> DRIVE SECURITY INFORMATION\n")
-	log.Printf("Drive identity: %s", core.DiskInfo.Identity)
-	spl, err := drive.SecurityProtocols(core.DriveIntf)
-	if err != nil {
-		log.Fatalf("drive.SecurityProtocols: %v", err)
+	flag.Parse()
+	args := flag.Args()
+	conformanceMode := len(args) > 0 && args[0] == "conformance"
+	if conformanceMode {
+		args = args[1:]
+	}
+	if *all == (len(args) > 0) {
+		flag.Usage()
+		os.Exit(2)
 	}
-	log.Printf("SecurityProtocols: %+v", spl)
-	crt, err := drive.Certificate(core.DriveIntf)
+	switch *output {
+	case "text":
+	case "json":
+		out = io.Discard
+	default:
+		log.Fatalf("Unknown output format %q", *output)
+	}
+	sel, err := selectSuites(*suiteSel)
 	if err != nil {
-		log.Printf("drive.Certificate: %v", err)
+		log.Fatalf("%v", err)
 	}
-	log.Printf("Drive certificate:")
-	spew.Dump(crt)
-	fmt.Printf("\n")
-
-	fmt.Printf("===> TCG AUTO ComID SELF-TEST\n")
-	comID := TestComID(core.DriveIntf)
-	fmt.Printf("\n")
-
-	fmt.Printf("===> TCG FEATURE DISCOVERY\n")
-	spew.Dump(core.DiskInfo.Level0Discovery)
-	fmt.Printf("\n")
-
-	fmt.Printf("===> TCG ADMIN SP SESSION\n")
-
-	cs := TestControlSession(core.DriveIntf, core.DiskInfo.Level0Discovery, comID)
-	if cs == nil {
-		log.Printf("No control session, unable to continue")
-		return
+	if *capture != "" && *psid != "" {
+		log.Fatalf("Refusing to capture a run with -psid, the PSID would be part of the capture")
 	}
+	spew.Config.Indent = "  "
 
-	var sessions []*tcg.Session
-	// Try to open as many sessions as we can
-	maxSessions := 10
-	if cs.TPerProperties.MaxSessions != nil {
-		maxSessions += int(*cs.TPerProperties.MaxSessions)
+	stopTrace, err := sedcli.StartTrace(*debug, *trace)
+	if err != nil {
+		log.Fatalf("%v", err)
 	}
-	for i := 0; i < maxSessions; i++ {
-		var s *tcg.Session
-		var err error
-		if i == 0 || cs.TPerProperties.MaxReadSessions == nil || *cs.TPerProperties.MaxReadSessions == 0 {
-			s, err = cs.NewSession(uid.AdminSP)
-		} else {
-			s, err = cs.NewSession(uid.AdminSP, tcg.WithReadOnly())
-		}
-		if err == method.ErrMethodStatusNoSessionsAvailable || err == method.ErrMethodStatusSPBusy {
-			break
+	defer stopTrace()
+
+	devices := args
+	if *all {
+		if devices, err = sedcli.FindDevices(nil, nil); err != nil {
+			log.Fatalf("%v", err)
 		}
-		if err != nil {
-			log.Printf("s.NewSession (#%d) failed: %v", i, err)
-			break
+		if len(devices) == 0 {
+			log.Fatalf("No TCG Storage devices found")
 		}
-		sessions = append(sessions, s)
-		log.Printf("Session #%d (HSN=0x%x, TSN=%0x) opened", i, s.HSN, s.TSN)
 	}
-
-	if len(sessions) == 0 {
-		log.Printf("No session, unable to continue")
+	if *capture != "" && len(devices) > 1 {
+		log.Fatalf("-capture is only supported for a single device")
+	}
+	if len(devices) == 1 {
+		runSingle(devices[0], conformanceMode, sel)
 		return
 	}
-	log.Printf("Opened %d sessions", len(sessions))
 
-	defer func() {
-		log.Printf("Diagnostics done, cleaning up")
-		for i, s := range sessions {
-			if s == nil {
-				log.Printf("Session #%d already closed", i)
-				continue
-			}
-			if err := s.Close(); err != nil {
-				log.Fatalf("Session.Close (#%d) failed: %v", i, err)
+	var reps []*Report
+	for _, device := range devices {
+		log.Printf("Running diagnostics of %s", device)
+		rep := &Report{Device: device}
+		core, _, err := openCore(device, false)
+		if err != nil {
+			log.Printf("core.Open: %v", err)
+			rep.Add("open", err)
+		} else {
+			rep.Identity = core.DiskInfo.Identity
+			if conformanceMode {
+				runConformance(core, rep)
+			} else {
+				rep.Add("open", nil)
+				newDiag(core, rep).run(sel)
 			}
-			log.Printf("Session #%d closed", i)
+			core.Close()
 		}
-	}()
-
-	s := sessions[0]
-	_ = s
-
-	msidPin, err := table.Admin_C_PIN_MSID_GetPIN(s)
-	if err != nil {
-		log.Printf("table.Admin_C_PIN_MSID_GetPIN failed: %v", err)
-		msidPin = nil
-	} else {
-		log.Printf("MSID PIN:\n%s", hex.Dump(msidPin))
+		reps = append(reps, rep)
 	}
 
-	rand, err := table.ThisSP_Random(s, 8)
-	if err != nil {
-		log.Printf("table.ThisSP_Random failed: %v", err)
-	} else {
-		log.Printf("Generated random numbers: %v", rand)
-	}
-
-	tperInfo, err := table.Admin_TPerInfo(s)
-	if err == nil {
-		log.Printf("TPerInfo table:")
-		spew.Dump(tperInfo)
+	passed := true
+	for _, rep := range reps {
+		passed = passed && rep.AllPassed()
 	}
-
-	llcs, err := table.Admin_SP_GetLifeCycleState(s, uid.LockingSP)
-	if err == nil {
-		log.Printf("Life cycle state on Locking SP: %d", llcs)
-	} else {
-		llcs = -1
-	}
-
-	msidOk := false
-	if msidPin != nil {
-		if err := table.ThisSP_Authenticate(s, uid.AuthoritySID, msidPin); err != nil {
-			log.Printf("table.ThisSP_Authenticate (SID) failed: %v", err)
-		} else {
-			log.Printf("Successfully authenticated as Admin SID")
-			msidOk = true
+	switch {
+	case *output == "json":
+		for _, rep := range reps {
+			rep.Passed = rep.AllPassed()
 		}
-		if llcs == 8 /* Manufactured-Inactive */ && os.Getenv("TCGSDIAG_ACTIVATE") != "" {
-			mc := method.NewMethodCall(uid.InvokingID(uid.LockingSP), uid.MethodIDActivate, s.MethodFlags)
-			if _, err := s.ExecuteMethod(mc); err != nil {
-				log.Printf("LockingSP.Activate failed: %v", err)
-			} else {
-				log.Printf("Locking SP activated")
-				llcs = 9
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(reps)
+	case conformanceMode:
+		for _, rep := range reps {
+			fmt.Printf("== %s\n", rep.Device)
+			if err = rep.WriteText(os.Stdout); err != nil {
+				break
 			}
 		}
-	}
-
-	psidPin := os.Getenv("TCGSDIAG_PSID")
-	if psidPin != "" {
-		if err := table.ThisSP_Authenticate(s, uid.AuthorityPSID, []byte(psidPin)); err != nil {
-			log.Printf("table.ThisSP_Authenticate (PSID) failed: %v", err)
-		} else {
-			log.Printf("Successfully authenticated as PSID SID")
+		if err == nil {
+			err = writeSummary(os.Stdout, reps)
 		}
+	default:
+		err = writeSummary(os.Stdout, reps)
 	}
-
-	log.Printf("Admin SP testing done")
-	s.Close()
-	sessions[0] = nil
-
-	fmt.Printf("\n")
-	fmt.Printf("===> TCG LOCKING SP SESSION\n")
-	if !msidOk {
-		log.Printf("SID is changed from MSID, will not continue")
-		return
+	if err != nil {
+		log.Fatalf("Writing report failed: %v", err)
 	}
-
-	if llcs == 8 /* Manufactured-Inactive */ {
-		log.Printf("Locking SP not activated")
-		return
+	if !passed {
+		os.Exit(1)
 	}
+}
 
-	auth := [8]byte{}
-	username := ""
-	if cs.ProtocolLevel == tcg.ProtocolLevelEnterprise {
-		s, err = cs.NewSession(uid.EnterpriseLockingSP)
-		copy(auth[:], []byte{0x00, 0x00, 0x00, 0x09, 0x00, 0x00, 0x80, 0x01}) // BandMaster0
-		username = "BandMaster0"
-	} else {
-		s, err = cs.NewSession(uid.LockingSP)
-		if os.Getenv("TCGSDIAG_AS_USER") == "" {
-			copy(auth[:], []byte{0x00, 0x00, 0x00, 0x09, 0x00, 0x01, 0x00, 0x01}) // Admin1
-			username = "Admin1"
-		} else {
-			copy(auth[:], []byte{0x00, 0x00, 0x00, 0x09, 0x00, 0x03, 0x00, 0x01}) // User1
-			username = "User1"
-		}
+func newDiag(core *tcg.Core, rep *Report) *diag {
+	return &diag{
+		core:  core,
+		rep:   rep,
+		comID: tcg.ComIDInvalid,
+		opts: diagOptions{
+			Activate: *activate,
+			PSID:     *psid,
+			AsUser:   *asUser,
+			ClearLog: *clearLog,
+		},
 	}
+}
+
+// runSingle runs the diagnostics of a single device, which unlike multiple
+// devices may be captured and only fail the run in conformance mode or with
+// the JSON report.
+func runSingle(device string, conformanceMode bool, sel []suite) {
+	var cs *tcg.ControlSession
+	rep := &Report{Device: device}
+	core, rec, err := openCore(device, *capture != "")
 	if err != nil {
-		log.Printf("Could not open Locking SP session: %v", err)
-		return
-	}
-	sessions[0] = s
-	if err := table.ThisSP_Authenticate(s, auth, msidPin); err != nil {
-		log.Printf("table.ThisSP_Authenticate (Locking SP, %s) failed: %v", username, err)
-		return
+		if *output != "json" {
+			log.Fatalf("core.Open: %v", err)
+		}
+		rep.Add("open", err)
+	} else if conformanceMode {
+		rep.Identity = core.DiskInfo.Identity
+		cs = runConformance(core, rep)
+		core.Close()
 	} else {
-		log.Printf("Successfully authenticated as %s", username)
+		rep.Identity = core.DiskInfo.Identity
+		rep.Add("open", nil)
+		d := newDiag(core, rep)
+		d.run(sel)
+		cs = d.cs
+		core.Close()
 	}
 
-	log.Printf("Locking SP LockingInfo:")
-	spew.Dump(table.LockingInfo(s))
-
-	log.Printf("Locking SP MBRTableInfo:")
-	mbi, err := table.MBR_TableInfo(s)
-	if err != nil {
-		log.Printf("Failed: %v", err)
-	} else {
-		spew.Dump(mbi)
-		mbuf := make([]byte, mbi.SuggestBufferSize(s))
-		log.Printf("Reading %d first bytes of MBR", len(mbuf))
-		if n, err := table.MBR_Read(s, mbuf, 0); n != len(mbuf) || err != nil {
-			log.Printf("Failed: %d, %v", n, err)
-		} else {
-			log.Printf("MBR start:\n%s", hex.Dump(mbuf[:128]))
+	if rec != nil {
+		if err := writeCapture(*capture, rec.Recording(), core, cs, rep); err != nil {
+			log.Fatalf("Writing capture failed: %v", err)
 		}
+		log.Printf("Capture written to %s", *capture)
 	}
 
-	lockList, err := table.Locking_Enumerate(s)
+	switch {
+	case *output == "json":
+		err = rep.WriteJSON(os.Stdout)
+	case conformanceMode:
+		err = rep.WriteText(os.Stdout)
+	default:
+		return
+	}
 	if err != nil {
-		log.Printf("table.Locking_Enumerate failed: %v", err)
-	} else {
-		log.Printf("Locking regions:")
-		for _, luid := range lockList {
-			lr, err := table.Locking_Get(s, luid)
-			if err != nil {
-				spew.Printf("Region %v: <UNKNOWN> (%v)\n", hex.EncodeToString(luid[:]), err)
-			} else {
-				spew.Printf("Region %v: %+v\n", hex.EncodeToString(luid[:]), lr)
-			}
-		}
+		log.Fatalf("Writing report failed: %v", err)
+	}
+	if !rep.AllPassed() {
+		os.Exit(1)
 	}
 }
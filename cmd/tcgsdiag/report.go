@@ -0,0 +1,109 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive"
+)
+
+// Result is the outcome of a single diagnostic test.
+type Result struct {
+	Name   string                 `json:"name"`
+	Passed bool                   `json:"passed"`
+	Error  string                 `json:"error,omitempty"`
+	Values map[string]interface{} `json:"values,omitempty"`
+}
+
+// Report is the machine-readable result of a diagnostics run.
+type Report struct {
+	Device   string          `json:"device"`
+	Identity *drive.Identity `json:"identity,omitempty"`
+	Passed   bool            `json:"passed"`
+	Results  []*Result       `json:"results"`
+}
+
+// Add records the result of a test, which passed if err is nil. Values are
+// captured as key/value pairs.
+func (r *Report) Add(name string, err error, kv ...interface{}) {
+	res := &Result{Name: name, Passed: err == nil}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		if res.Values == nil {
+			res.Values = map[string]interface{}{}
+		}
+		res.Values[kv[i].(string)] = kv[i+1]
+	}
+	r.Results = append(r.Results, res)
+}
+
+// AllPassed returns whether all tests in the report passed.
+func (r *Report) AllPassed() bool {
+	for _, res := range r.Results {
+		if !res.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteJSON writes the report as JSON, deriving the overall result from the
+// individual tests.
+func (r *Report) WriteJSON(w io.Writer) error {
+	r.Passed = r.AllPassed()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteText writes one line per test with its result.
+func (r *Report) WriteText(w io.Writer) error {
+	for _, res := range r.Results {
+		var err error
+		if res.Passed {
+			_, err = fmt.Fprintf(w, "PASS %s\n", res.Name)
+		} else {
+			_, err = fmt.Fprintf(w, "FAIL %s: %s\n", res.Name, res.Error)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSummary writes a table with the overall result of every device and the
+// tests that failed.
+func writeSummary(w io.Writer, reps []*Report) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "DEVICE\tMODEL\tRESULT\tFAILED")
+	for _, r := range reps {
+		model := "-"
+		if r.Identity != nil {
+			model = r.Identity.Model
+		}
+		result := "PASS"
+		var failed []string
+		for _, res := range r.Results {
+			if !res.Passed {
+				failed = append(failed, res.Name)
+			}
+		}
+		if len(failed) > 0 {
+			result = "FAIL"
+		} else {
+			failed = []string{"-"}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Device, model, result, strings.Join(failed, ","))
+	}
+	return tw.Flush()
+}
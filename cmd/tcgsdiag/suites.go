@@ -0,0 +1,492 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/davecgh/go-spew/spew"
+	tcg "github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive"
+)
+
+// Options that enable the destructive or otherwise intrusive parts of the
+// diagnostics. None of them are enabled by default.
+type diagOptions struct {
+	// Activate the Locking SP if it is in Manufactured-Inactive state
+	Activate bool
+	// PSID to authenticate with in the Admin SP
+	PSID string
+	// Authenticate to the Opal Locking SP as User1 instead of Admin1
+	AsUser bool
+	// Clear the log tables of the Admin SP after dumping them
+	ClearLog bool
+}
+
+// diag carries the state that is shared between the test suites.
+type diag struct {
+	core *tcg.Core
+	rep  *Report
+	opts diagOptions
+
+	comID    tcg.ComID
+	cs       *tcg.ControlSession
+	sessions []*tcg.Session
+	msidPin  []byte
+	msidOk   bool
+	llcs     table.LifeCycleState
+	lockingS *tcg.Session
+}
+
+type suite struct {
+	Name  string
+	Title string
+	// Suites that have to run before this one
+	Requires []string
+	Run      func(d *diag) error
+}
+
+var suites = []suite{
+	{"comid", "TCG AUTO ComID SELF-TEST", nil, (*diag).testComID},
+	{"discovery", "TCG FEATURE DISCOVERY", nil, (*diag).testDiscovery},
+	{"control-session", "TCG CONTROL SESSION", nil, (*diag).testControlSession},
+	{"admin-sp", "TCG ADMIN SP SESSION", []string{"control-session"}, (*diag).testAdminSP},
+	{"locking-sp", "TCG LOCKING SP SESSION", []string{"admin-sp"}, (*diag).testLockingSP},
+	{"mbr", "TCG LOCKING SP MBR", []string{"locking-sp"}, (*diag).testMBR},
+	{"log", "TCG TPER LOG", []string{"admin-sp"}, (*diag).testLog},
+}
+
+func suiteNames() []string {
+	var names []string
+	for _, s := range suites {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+// Select the suites to run from a comma-separated list of names, adding any
+// suites the selected ones depend on. The result is in execution order.
+func selectSuites(list string) ([]suite, error) {
+	byName := map[string]suite{}
+	for _, s := range suites {
+		byName[s.Name] = s
+	}
+	want := map[string]bool{}
+	var add func(name string) error
+	add = func(name string) error {
+		s, ok := byName[name]
+		if !ok {
+			return fmt.Errorf("unknown suite %q, valid suites are: %s", name, strings.Join(suiteNames(), ", "))
+		}
+		want[name] = true
+		for _, r := range s.Requires {
+			if err := add(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if err := add(name); err != nil {
+			return nil, err
+		}
+	}
+	var sel []suite
+	for _, s := range suites {
+		if want[s.Name] {
+			sel = append(sel, s)
+		}
+	}
+	return sel, nil
+}
+
+// Run the given suites in order. A suite is skipped if a suite it depends on
+// has failed.
+func (d *diag) run(sel []suite) {
+	defer d.cleanup()
+	failed := map[string]bool{}
+	for _, s := range sel {
+		fmt.Fprintf(out, "===> %s\n", s.Title)
+		skip := ""
+		for _, r := range s.Requires {
+			if failed[r] {
+				skip = r
+			}
+		}
+		if skip != "" {
+			log.Printf("Skipping suite %s, required suite %s failed", s.Name, skip)
+			failed[s.Name] = true
+		} else if err := s.Run(d); err != nil {
+			log.Printf("Suite %s failed: %v", s.Name, err)
+			failed[s.Name] = true
+		}
+		fmt.Fprintf(out, "\n")
+	}
+}
+
+func (d *diag) cleanup() {
+	log.Printf("Diagnostics done, cleaning up")
+	for i, s := range d.sessions {
+		if s == nil {
+			log.Printf("Session #%d already closed", i)
+			continue
+		}
+		if err := s.Close(); err != nil {
+			log.Fatalf("Session.Close (#%d) failed: %v", i, err)
+		}
+		log.Printf("Session #%d closed", i)
+	}
+	d.sessions = nil
+	if d.lockingS != nil {
+		if err := d.lockingS.Close(); err != nil {
+			log.Printf("Locking SP session close failed: %v", err)
+		}
+		d.lockingS = nil
+	}
+}
+
+func (d *diag) testComID() error {
+	d.comID = TestComID(d.core.DriveIntf, d.rep)
+	if d.comID == tcg.ComIDInvalid {
+		return errors.New("ComID self-test failed")
+	}
+	return nil
+}
+
+func (d *diag) testDiscovery() error {
+	log.Printf("Drive identity: %s", d.core.DiskInfo.Identity)
+	spl, err := drive.SecurityProtocols(d.core.DriveIntf)
+	if err != nil {
+		log.Printf("drive.SecurityProtocols: %v", err)
+		d.rep.Add("security-protocols", err)
+		return err
+	}
+	log.Printf("SecurityProtocols: %+v", spl)
+	d.rep.Add("security-protocols", nil, "protocols", spl)
+	crt, err := drive.Certificate(d.core.DriveIntf)
+	if err != nil {
+		log.Printf("drive.Certificate: %v", err)
+	}
+	// Not all drives carry a certificate, so only record its availability
+	d.rep.Add("certificate", nil, "available", crt != nil)
+	log.Printf("Drive certificate:")
+	spew.Fdump(out, crt)
+	log.Printf("Level 0 discovery:")
+	spew.Fdump(out, d.core.DiskInfo.Level0Discovery)
+	return nil
+}
+
+func (d *diag) testControlSession() error {
+	d.cs = TestControlSession(d.core.DriveIntf, d.core.DiskInfo.Level0Discovery, d.comID, d.rep)
+	if d.cs == nil {
+		return errors.New("no control session")
+	}
+	return nil
+}
+
+func (d *diag) testAdminSP() error {
+	cs := d.cs
+	// Try to open as many sessions as we can
+	maxSessions := 10
+	if cs.TPerProperties.MaxSessions != nil {
+		maxSessions += int(*cs.TPerProperties.MaxSessions)
+	}
+	for i := 0; i < maxSessions; i++ {
+		var s *tcg.Session
+		var err error
+		if i == 0 || cs.TPerProperties.MaxReadSessions == nil || *cs.TPerProperties.MaxReadSessions == 0 {
+			s, err = cs.NewSession(uid.AdminSP)
+		} else {
+			s, err = cs.NewSession(uid.AdminSP, tcg.WithReadOnly())
+		}
+		if errors.Is(err, method.ErrMethodStatusNoSessionsAvailable) || errors.Is(err, method.ErrMethodStatusSPBusy) {
+			break
+		}
+		if err != nil {
+			log.Printf("s.NewSession (#%d) failed: %v", i, err)
+			break
+		}
+		d.sessions = append(d.sessions, s)
+		log.Printf("Session #%d (HSN=0x%x, TSN=%0x) opened", i, s.HSN, s.TSN)
+	}
+
+	if len(d.sessions) == 0 {
+		err := errors.New("no session could be opened")
+		d.rep.Add("admin-sp-sessions", err)
+		return err
+	}
+	log.Printf("Opened %d sessions", len(d.sessions))
+	d.rep.Add("admin-sp-sessions", nil, "opened", len(d.sessions))
+
+	s := d.sessions[0]
+	msidPin, err := table.Admin_C_PIN_MSID_GetPIN(s)
+	if err != nil {
+		log.Printf("table.Admin_C_PIN_MSID_GetPIN failed: %v", err)
+		msidPin = nil
+	} else {
+		log.Printf("MSID PIN (hex): %s", hex.EncodeToString(msidPin))
+		log.Printf("MSID PIN:\n%s", hex.Dump(msidPin))
+	}
+	d.rep.Add("msid", err, "available", msidPin != nil)
+	d.msidPin = msidPin
+
+	rand, err := table.ThisSP_Random(s, 8)
+	if err != nil {
+		log.Printf("table.ThisSP_Random failed: %v", err)
+	} else {
+		log.Printf("Generated random numbers: %v", rand)
+	}
+	d.rep.Add("random", err)
+
+	tperInfo, err := table.Admin_TPerInfo(s)
+	if err == nil {
+		log.Printf("TPerInfo table:")
+		spew.Fdump(out, tperInfo)
+		d.rep.Add("tper-info", nil, "tper_info", tperInfo)
+	} else {
+		d.rep.Add("tper-info", err)
+	}
+
+	// The Clock template is optional, its absence is not a failure
+	clock, err := table.Clock_Get(s)
+	switch {
+	case err != nil:
+		log.Printf("table.Clock_Get failed: %v", err)
+		d.rep.Add("clock", nil, "supported", false, "error", err.Error())
+	case clock.Time == nil:
+		log.Printf("TPer clock: %v (not understood)", clock.Raw)
+		d.rep.Add("clock", nil, "supported", true, "raw", clock.Raw)
+	default:
+		drift := clock.Time.Sub(time.Now())
+		log.Printf("TPer clock: %v, drift %v", clock.Time, drift)
+		d.rep.Add("clock", nil, "supported", true, "time", clock.Time, "drift_seconds", drift.Seconds())
+	}
+
+	d.llcs = -1
+	if sps, err := table.ListSPs(s); err == nil {
+		for _, sp := range sps {
+			log.Printf("SP %x (%s): %v", sp.UID[:], sp.Name, sp.LifeCycleState)
+			if sp.UID == uid.LockingSP {
+				d.llcs = sp.LifeCycleState
+			}
+		}
+		d.rep.Add("sp-list", nil, "sps", sps)
+	} else {
+		log.Printf("table.ListSPs failed: %v", err)
+		d.rep.Add("sp-list", err)
+	}
+
+	if tables, err := table.ListTables(s); err == nil {
+		for _, t := range tables {
+			log.Printf("Table %x (%s): %v, %d columns, %d rows", t.UID[:4], t.Name, t.Kind, t.NumColumns, t.Rows)
+		}
+		d.rep.Add("admin-sp-tables", nil, "tables", tables)
+	} else {
+		log.Printf("table.ListTables failed: %v", err)
+		d.rep.Add("admin-sp-tables", err)
+	}
+
+	if d.llcs < 0 {
+		if d.llcs, err = table.Admin_SP_GetLifeCycleState(s, uid.LockingSP); err != nil {
+			d.rep.Add("locking-sp-lifecycle", err)
+			d.llcs = -1
+		}
+	}
+	if d.llcs >= 0 {
+		log.Printf("Life cycle state on Locking SP: %v", d.llcs)
+		d.rep.Add("locking-sp-lifecycle", nil, "state", d.llcs)
+	}
+
+	if msidPin != nil {
+		if err := table.ThisSP_Authenticate(s, uid.AuthoritySID, msidPin); err != nil {
+			log.Printf("table.ThisSP_Authenticate (SID) failed: %v", err)
+			d.rep.Add("sid-authenticate-msid", err)
+		} else {
+			log.Printf("Successfully authenticated as Admin SID")
+			d.rep.Add("sid-authenticate-msid", nil)
+			d.msidOk = true
+		}
+		if d.llcs == table.ManufacturedInactive && d.opts.Activate {
+			mc := method.NewMethodCall(uid.InvokingID(uid.LockingSP), uid.MethodIDActivate, s.MethodFlags)
+			if _, err := s.ExecuteMethod(mc); err != nil {
+				log.Printf("LockingSP.Activate failed: %v", err)
+				d.rep.Add("locking-sp-activate", err)
+			} else {
+				log.Printf("Locking SP activated")
+				d.rep.Add("locking-sp-activate", nil)
+				d.llcs = table.Manufactured
+			}
+		}
+	}
+
+	if d.opts.PSID != "" {
+		if err := table.ThisSP_Authenticate(s, uid.AuthorityPSID, []byte(d.opts.PSID)); err != nil {
+			log.Printf("table.ThisSP_Authenticate (PSID) failed: %v", err)
+		} else {
+			log.Printf("Successfully authenticated as PSID SID")
+		}
+		d.rep.Add("psid-authenticate", err)
+	}
+
+	log.Printf("Admin SP testing done")
+	s.Close()
+	d.sessions[0] = nil
+	return nil
+}
+
+func (d *diag) testLockingSP() error {
+	if !d.msidOk {
+		return errors.New("SID is changed from MSID, will not continue")
+	}
+	if d.llcs == table.ManufacturedInactive {
+		return errors.New("Locking SP not activated")
+	}
+
+	var s *tcg.Session
+	var err error
+	var auth uid.AuthorityObjectUID
+	if d.cs.ProtocolLevel == tcg.ProtocolLevelEnterprise {
+		s, err = d.cs.NewSession(uid.EnterpriseLockingSP)
+		auth = uid.LockingAuthorityBandMaster0
+	} else {
+		s, err = d.cs.NewSession(uid.LockingSP)
+		if !d.opts.AsUser {
+			auth = uid.LockingAuthorityAdmin1
+		} else {
+			auth = uid.LockingAuthorityUser(1)
+		}
+	}
+	username, _ := uid.Lookup(uid.UID(auth))
+	if err != nil {
+		d.rep.Add("locking-sp-session", err)
+		return fmt.Errorf("could not open Locking SP session: %v", err)
+	}
+	d.lockingS = s
+	d.rep.Add("locking-sp-session", nil)
+	if err := table.ThisSP_Authenticate(s, auth, d.msidPin); err != nil {
+		d.rep.Add("locking-sp-authenticate", err, "authority", username)
+		return fmt.Errorf("table.ThisSP_Authenticate (Locking SP, %s) failed: %v", username, err)
+	}
+	log.Printf("Successfully authenticated as %s", username)
+	d.rep.Add("locking-sp-authenticate", nil, "authority", username)
+
+	log.Printf("Locking SP LockingInfo:")
+	li, err := table.LockingInfo(s)
+	spew.Fdump(out, li, err)
+	d.rep.Add("locking-info", err, "locking_info", li)
+
+	lockList, err := table.Locking_Enumerate(s)
+	if err != nil {
+		log.Printf("table.Locking_Enumerate failed: %v", err)
+		d.rep.Add("locking-ranges", err)
+		return nil
+	}
+	log.Printf("Locking regions:")
+	for _, luid := range lockList {
+		lr, err := table.Locking_Get(s, luid)
+		if err != nil {
+			spew.Fprintf(out, "Region %v: <UNKNOWN> (%v)\n", hex.EncodeToString(luid[:]), err)
+		} else {
+			spew.Fprintf(out, "Region %v: %+v\n", hex.EncodeToString(luid[:]), lr)
+		}
+		d.rep.Add("locking-range", err, "uid", hex.EncodeToString(luid[:]), "range", lr)
+	}
+	return nil
+}
+
+func (d *diag) testMBR() error {
+	s := d.lockingS
+	log.Printf("Locking SP MBRTableInfo:")
+	mbi, err := table.MBR_TableInfo(s)
+	if err != nil {
+		d.rep.Add("mbr-table-info", err)
+		return fmt.Errorf("table.MBR_TableInfo failed: %v", err)
+	}
+	spew.Fdump(out, mbi)
+	d.rep.Add("mbr-table-info", nil, "mbr_table_info", mbi)
+	mbuf := make([]byte, mbi.SuggestBufferSize(s))
+	log.Printf("Reading %d first bytes of MBR", len(mbuf))
+	n, err := table.MBR_Read(s, mbuf, 0)
+	if err == nil && n != len(mbuf) {
+		err = fmt.Errorf("short read: %d of %d bytes", n, len(mbuf))
+	}
+	if err != nil {
+		d.rep.Add("mbr-read", err)
+		return fmt.Errorf("table.MBR_Read failed: %v", err)
+	}
+	log.Printf("MBR start:\n%s", hex.Dump(mbuf[:128]))
+	d.rep.Add("mbr-read", nil, "bytes", n)
+	return nil
+}
+
+// Number of log entries to dump per log table
+const logEntries = 20
+
+func (d *diag) testLog() error {
+	s, err := d.cs.NewSession(uid.AdminSP)
+	if err != nil {
+		d.rep.Add("admin-sp-log", err)
+		return fmt.Errorf("could not open Admin SP session: %v", err)
+	}
+	defer s.Close()
+	if d.opts.ClearLog && d.msidOk {
+		if err := table.ThisSP_Authenticate(s, uid.AuthoritySID, d.msidPin); err != nil {
+			log.Printf("table.ThisSP_Authenticate (SID) failed: %v", err)
+		}
+	}
+	d.dumpLogs("admin-sp", s, d.opts.ClearLog)
+	if d.lockingS != nil {
+		d.dumpLogs("locking-sp", d.lockingS, false)
+	}
+	return nil
+}
+
+// The Log template is optional, so a missing or unreadable log is not
+// counted as a failure.
+func (d *diag) dumpLogs(sp string, s *tcg.Session, clear bool) {
+	logs, err := table.LogTables(s)
+	if err != nil {
+		log.Printf("%s: listing log tables failed: %v", sp, err)
+		d.rep.Add(sp+"-log", nil, "supported", false, "error", err.Error())
+		return
+	}
+	if len(logs) == 0 {
+		log.Printf("%s: no log tables", sp)
+		d.rep.Add(sp+"-log", nil, "supported", false)
+		return
+	}
+	for _, t := range logs {
+		entries, err := table.Log_Read(s, t.UID, logEntries)
+		log.Printf("%s: log %s (%x), %d rows, last %d entries:", sp, t.Name, t.UID[:4], t.Rows, len(entries))
+		for _, e := range entries {
+			spew.Fprintf(out, "%x: %v\n", e.UID[:], e.Values)
+		}
+		if err != nil {
+			log.Printf("%s: reading log %s failed: %v", sp, t.Name, err)
+		}
+		d.rep.Add(sp+"-log", err, "supported", true, "table", t.Name, "entries", entries)
+		if !clear {
+			continue
+		}
+		err = table.Log_Clear(s, t.UID)
+		if err != nil {
+			log.Printf("%s: clearing log %s failed: %v", sp, t.Name, err)
+		} else {
+			log.Printf("%s: log %s cleared", sp, t.Name)
+		}
+		d.rep.Add(sp+"-log-clear", err, "table", t.Name)
+	}
+}
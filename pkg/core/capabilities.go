@@ -0,0 +1,93 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Summarizes the SSC feature descriptors of the Level 0 Discovery
+
+package core
+
+// Capabilities describes what a drive supports, independent of the SSC that
+// announced it.
+type Capabilities struct {
+	// Names of all announced SSCs, e.g. "Opal 2"
+	SSCs []string
+	// The SSC the other fields are derived from, the one BaseComID selects
+	SSC           string
+	ProtocolLevel ProtocolLevel
+	// Number of locking objects including the global range, 0 if not
+	// announced. This is a hint, the MaxRanges column of LockingInfo is
+	// authoritative.
+	MaxRanges uint32
+	// Number of Admin and User authorities of the Locking SP, 0 if not
+	// announced by the SSC
+	Admins uint16
+	Users  uint16
+	// Whether commands may address LBAs in more than one unlocked range
+	RangeCrossing bool
+	// The drive implements range locking, the shadow MBR and the Single
+	// User Mode Feature Set
+	Locking        bool
+	MBR            bool
+	SingleUserMode bool
+}
+
+// GetCapabilities summarizes the feature descriptors of a Level 0 Discovery.
+func GetCapabilities(d0 *Level0Discovery) *Capabilities {
+	c := &Capabilities{SSCs: []string{}}
+	if d0.Enterprise != nil {
+		c.SSCs = append(c.SSCs, "Enterprise")
+	}
+	if d0.OpalV1 != nil {
+		c.SSCs = append(c.SSCs, "Opal 1")
+	}
+	if d0.OpalV2 != nil {
+		c.SSCs = append(c.SSCs, "Opal 2")
+	}
+	if d0.Opalite != nil {
+		c.SSCs = append(c.SSCs, "Opalite")
+	}
+	if d0.PyriteV1 != nil {
+		c.SSCs = append(c.SSCs, "Pyrite 1")
+	}
+	if d0.PyriteV2 != nil {
+		c.SSCs = append(c.SSCs, "Pyrite 2")
+	}
+	if d0.RubyV1 != nil {
+		c.SSCs = append(c.SSCs, "Ruby 1")
+	}
+
+	// Same order of preference as BaseComID. The Range Crossing Behavior bit
+	// is set if the drive terminates commands crossing ranges.
+	_, c.ProtocolLevel = BaseComID(d0)
+	switch {
+	case d0.OpalV2 != nil:
+		c.SSC = "Opal 2"
+		c.Admins = d0.OpalV2.NumLockingSPAdminSupported
+		c.Users = d0.OpalV2.NumLockingSPUserSupported
+		c.RangeCrossing = !d0.OpalV2.RangeCrossingBehavior
+	case d0.PyriteV1 != nil:
+		c.SSC = "Pyrite 1"
+	case d0.PyriteV2 != nil:
+		c.SSC = "Pyrite 2"
+	case d0.Enterprise != nil:
+		c.SSC = "Enterprise"
+		c.RangeCrossing = !d0.Enterprise.RangeCrossingBehavior
+	case d0.RubyV1 != nil:
+		c.SSC = "Ruby 1"
+		c.Admins = d0.RubyV1.NumLockingSPAdminSupported
+		c.Users = d0.RubyV1.NumLockingSPUserSupported
+		c.RangeCrossing = !d0.RubyV1.RangeCrossingBehavior
+	}
+
+	if l := d0.Locking; l != nil {
+		c.Locking = l.LockingSupported
+		// Enterprise has no shadow MBR, even though older drives do not set
+		// the MBR Shadowing Not Supported bit
+		c.MBR = l.MBRShadowingSupported() && c.ProtocolLevel != ProtocolLevelEnterprise
+	}
+	if sum := d0.SingleUser; sum != nil {
+		c.SingleUserMode = true
+		c.MaxRanges = sum.NumberOfLockingObjectsSupported
+	}
+	return c
+}
@@ -0,0 +1,48 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/feature"
+)
+
+func TestGetCapabilities(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		d0   *Level0Discovery
+		want *Capabilities
+	}{
+		{"Opal with SUM", &Level0Discovery{
+			Locking:    &feature.Locking{LockingSupported: true},
+			OpalV2:     &feature.OpalV2{NumLockingSPAdminSupported: 4, NumLockingSPUserSupported: 9},
+			PyriteV2:   &feature.PyriteV2{},
+			SingleUser: &feature.SingleUser{NumberOfLockingObjectsSupported: 9},
+		}, &Capabilities{
+			SSCs: []string{"Opal 2", "Pyrite 2"}, SSC: "Opal 2", ProtocolLevel: ProtocolLevelCore,
+			MaxRanges: 9, Admins: 4, Users: 9, RangeCrossing: true,
+			Locking: true, MBR: true, SingleUserMode: true,
+		}},
+		{"Enterprise", &Level0Discovery{
+			Locking:    &feature.Locking{LockingSupported: true},
+			Enterprise: &feature.Enterprise{RangeCrossingBehavior: true},
+		}, &Capabilities{
+			SSCs: []string{"Enterprise"}, SSC: "Enterprise", ProtocolLevel: ProtocolLevelEnterprise,
+			Locking: true,
+		}},
+		{"Opal without shadow MBR", &Level0Discovery{
+			Locking: &feature.Locking{LockingSupported: true, MBRShadowingNotSupported: true},
+			OpalV2:  &feature.OpalV2{},
+		}, &Capabilities{
+			SSCs: []string{"Opal 2"}, SSC: "Opal 2", ProtocolLevel: ProtocolLevelCore,
+			RangeCrossing: true, Locking: true,
+		}},
+		{"None", &Level0Discovery{}, &Capabilities{SSCs: []string{}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := GetCapabilities(tc.d0); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("GetCapabilities() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Tracking of open sessions, to end them when the program exits
+
+package core
+
+import (
+	"runtime"
+	"sync"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
+)
+
+// Control sessions with open sessions, for CloseAllSessions
+var openControlSessions = struct {
+	sync.Mutex
+	m map[*ControlSession]struct{}
+}{m: map[*ControlSession]struct{}{}}
+
+// Register a started session. The control session keeps a copy of the
+// session only, so that a session the caller forgot to close can be garbage
+// collected and ended by its finalizer.
+func (cs *ControlSession) track(s *Session) {
+	cs.mu.Lock()
+	if cs.open == nil {
+		cs.open = map[int]Session{}
+	}
+	cs.open[s.TSN] = *s
+	n := len(cs.open)
+	cs.mu.Unlock()
+	if n == 1 {
+		openControlSessions.Lock()
+		openControlSessions.m[cs] = struct{}{}
+		openControlSessions.Unlock()
+	}
+	runtime.SetFinalizer(s, func(s *Session) {
+		if !s.isClosed() {
+			s.Close()
+		}
+	})
+}
+
+func (cs *ControlSession) untrack(s *Session) {
+	cs.mu.Lock()
+	delete(cs.open, s.TSN)
+	n := len(cs.open)
+	cs.mu.Unlock()
+	if n == 0 {
+		openControlSessions.Lock()
+		delete(openControlSessions.m, cs)
+		openControlSessions.Unlock()
+	}
+}
+
+// Whether the session has been closed, either by Close or by CloseAll of its
+// control session.
+func (s *Session) isClosed() bool {
+	if s.closed {
+		return true
+	}
+	if s.ControlSession == nil {
+		return false
+	}
+	s.ControlSession.mu.Lock()
+	defer s.ControlSession.mu.Unlock()
+	_, ok := s.ControlSession.open[s.TSN]
+	return !ok
+}
+
+// Ended marks the session as ended by the TPer, as it does on success of
+// e.g. Revert and RevertSP, so that it is not ended again by Close, CloseAll
+// or its finalizer.
+func (s *Session) Ended() {
+	s.closed = true
+	if s.ControlSession != nil {
+		s.ControlSession.untrack(s)
+	}
+}
+
+// CloseAll ends all sessions started with NewSession that have not been
+// closed yet. Sessions left open on a static ComID keep their SP busy and
+// make other programs fail with NO_SESSIONS_AVAILABLE or SP_BUSY until the
+// TPer times them out.
+func (cs *ControlSession) CloseAll() error {
+	cs.mu.Lock()
+	open := make([]Session, 0, len(cs.open))
+	for _, s := range cs.open {
+		open = append(open, s)
+	}
+	cs.mu.Unlock()
+
+	var firstErr error
+	for i := range open {
+		s := &open[i]
+		// The copy does not know the credit used since the session was
+		// started, the EndOfSession is sent regardless.
+		s.flowControl = false
+		if _, err := s.ExecuteMethod(&method.EOSMethodCall{}); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		cs.untrack(s)
+	}
+	return firstErr
+}
+
+// CloseAllSessions ends the open sessions of all control sessions, see
+// ControlSession.CloseAll. Finalizers do not run when a program exits, so
+// programs should call it before exiting, also when interrupted by a signal.
+func CloseAllSessions() error {
+	openControlSessions.Lock()
+	css := make([]*ControlSession, 0, len(openControlSessions.m))
+	for cs := range openControlSessions.m {
+		css = append(css, cs)
+	}
+	openControlSessions.Unlock()
+
+	var firstErr error
+	for _, cs := range css {
+		if err := cs.CloseAll(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
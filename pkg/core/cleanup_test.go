@@ -0,0 +1,34 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive/sim"
+)
+
+func TestCloseAll(t *testing.T) {
+	cs := simControlSession(t, sim.New())
+	s, err := cs.NewSession(uid.AdminSP)
+	if err != nil {
+		t.Fatalf("NewSession() failed: %v", err)
+	}
+	if _, err := cs.NewSession(uid.AdminSP); !errors.Is(err, method.ErrMethodStatusSPBusy) {
+		t.Fatalf("second write session returned %v", err)
+	}
+	if err := CloseAllSessions(); err != nil {
+		t.Fatalf("CloseAllSessions() failed: %v", err)
+	}
+	if err := s.Close(); !errors.Is(err, ErrSessionAlreadyClosed) {
+		t.Errorf("Close() after CloseAllSessions() returned %v", err)
+	}
+	s, err = cs.NewSession(uid.AdminSP)
+	if err != nil {
+		t.Fatalf("NewSession() after CloseAllSessions() failed: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("Close() failed: %v", err)
+	}
+}
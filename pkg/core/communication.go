@@ -16,8 +16,20 @@ import (
 )
 
 var (
-	ErrTooLargeComPacket = errors.New("encountered a too large ComPacket")
-	ErrTooLargePacket    = errors.New("encountered a too large Packet")
+	ErrTooLargeComPacket  = errors.New("encountered a too large ComPacket")
+	ErrTooLargePacket     = errors.New("encountered a too large Packet")
+	ErrMalformedComPacket = errors.New("encountered a malformed ComPacket")
+	ErrInsufficientCredit = errors.New("the TPer has not granted enough credit to send the Packet")
+	// The ComID of the response does not match the one of the session, or
+	// the TSN/HSN of the response do not match the session. Most likely
+	// another application is using the same statically allocated ComID.
+	ErrComIDMismatch   = errors.New("received a ComPacket for another ComID, is another application using the ComID?")
+	ErrSessionMismatch = errors.New("received a Packet for another session, is another application using the ComID?")
+)
+
+const (
+	subPacketKindData          = 0x0000
+	subPacketKindCreditControl = 0x8001
 )
 
 // NOTE: This is almost io.ReadWriter, but not quite - I couldn't figure out
@@ -28,9 +40,10 @@ type CommunicationIntf interface {
 }
 
 type plainCom struct {
-	d  drive.DriveIntf
-	hp HostProperties
-	tp TPerProperties
+	d       drive.DriveIntf
+	hp      HostProperties
+	tp      TPerProperties
+	padding uint
 }
 
 type comPacketHeader struct {
@@ -56,11 +69,34 @@ type subPacketHeader struct {
 	Length uint32
 }
 
+// Sizes of the headers on the wire
+const (
+	comPacketHeaderSize = 20
+	packetHeaderSize    = 24
+	subPacketHeaderSize = 12
+)
+
+// subPacketPadding returns the number of zero bytes following a subpacket
+// payload of length n, as subpackets are padded to a multiple of 4 bytes.
+// The padding is not included in the Length of the subpacket, and payloads
+// that are already aligned are not padded.
+func subPacketPadding(n uint) uint {
+	return (4 - n%4) % 4
+}
+
 // Low-level communication used to send/receive packets to a TPer or SP.
 //
-// Implements Subpacket-Packet-ComPacket packet format.
+// Implements Subpacket-Packet-ComPacket packet format. The ComPackets are
+// padded as declared by the drive, see drive.Padder.
 func NewPlainCommunication(d drive.DriveIntf, hp HostProperties, tp TPerProperties) *plainCom {
-	return &plainCom{d, hp, tp}
+	return &plainCom{d, hp, tp, drivePadding(d)}
+}
+
+func drivePadding(d drive.DriveIntf) uint {
+	if p, ok := d.(drive.Padder); ok {
+		return p.Padding()
+	}
+	return drive.DefaultPadding
 }
 
 func (c *plainCom) Send(ses *Session, data []byte) error {
@@ -71,18 +107,28 @@ func (c *plainCom) Send(ses *Session, data []byte) error {
 	// TODO: Implement fragmentation
 
 	subpkt := bytes.Buffer{}
+	if ses.flowControl && ses.consumed > 0 {
+		// Grant the TPer the credit it used up for the previous responses
+		crdhdr := subPacketHeader{
+			Kind:   subPacketKindCreditControl,
+			Length: 4,
+		}
+		if err := binary.Write(&subpkt, binary.BigEndian, &crdhdr); err != nil {
+			return err
+		}
+		if err := binary.Write(&subpkt, binary.BigEndian, uint32(ses.consumed)); err != nil {
+			return err
+		}
+	}
 	spkthdr := subPacketHeader{
-		Kind:   0, // Data
+		Kind:   subPacketKindData,
 		Length: uint32(len(data)),
 	}
 	if err := binary.Write(&subpkt, binary.BigEndian, &spkthdr); err != nil {
 		return err
 	}
 	subpkt.Write(data)
-	if (len(data) % 4) > 0 {
-		pad := 4 - (len(data) % 4)
-		subpkt.Write(make([]byte, pad))
-	}
+	subpkt.Write(make([]byte, subPacketPadding(uint(len(data)))))
 
 	pkt := bytes.Buffer{}
 	if uint(pkt.Len()) > c.tp.MaxPacketSize {
@@ -118,12 +164,41 @@ func (c *plainCom) Send(ses *Session, data []byte) error {
 	if uint(compkt.Len()) > c.tp.MaxComPacketSize {
 		return ErrTooLargeComPacket
 	}
+	if ses.flowControl && uint(subpkt.Len()) > ses.credit {
+		return ErrInsufficientCredit
+	}
+	if pad := c.pad(uint(compkt.Len())); pad > 0 {
+		compkt.Write(make([]byte, pad))
+	}
+	if err := c.d.IFSend(drive.SecurityProtocolTCGManagement, uint16(ses.ComID), compkt.Bytes()); err != nil {
+		return err
+	}
+	// Only a Packet that reached the TPer uses up credit and grants the
+	// consumed credit back
+	if ses.flowControl {
+		ses.credit -= uint(subpkt.Len())
+		ses.consumed = 0
+	}
 	if c.tp.SequenceNumbers && c.hp.SequenceNumbers {
 		ses.SeqLastXmit += 1
 	}
-	// Extend buffer to be aligned to 512 byte pages which some drives like
-	compkt.Write(make([]byte, 512-(compkt.Len()%512)))
-	return c.d.IFSend(drive.SecurityProtocolTCGManagement, uint16(ses.ComID), compkt.Bytes())
+	return nil
+}
+
+// pad returns the number of bytes to pad a ComPacket of length n with, never
+// exceeding the MaxComPacketSize of the TPer.
+func (c *plainCom) pad(n uint) uint {
+	if c.padding == 0 || n%c.padding == 0 {
+		return 0
+	}
+	padded := (n/c.padding + 1) * c.padding
+	if padded > c.tp.MaxComPacketSize {
+		padded = c.tp.MaxComPacketSize
+	}
+	if padded < n {
+		return 0
+	}
+	return padded - n
 }
 
 func (c *plainCom) Receive(ses *Session) ([]byte, error) {
@@ -131,6 +206,9 @@ func (c *plainCom) Receive(ses *Session) ([]byte, error) {
 	if err := c.d.IFRecv(drive.SecurityProtocolTCGManagement, uint16(ses.ComID), &buf); err != nil {
 		return nil, err
 	}
+	if len(buf) < comPacketHeaderSize+packetHeaderSize {
+		return nil, ErrMalformedComPacket
+	}
 	rdr := bytes.NewBuffer(buf)
 	compkthdr := comPacketHeader{}
 	if err := binary.Read(rdr, binary.BigEndian, &compkthdr); err != nil {
@@ -139,7 +217,15 @@ func (c *plainCom) Receive(ses *Session) ([]byte, error) {
 	if uint(compkthdr.Length) > c.hp.MaxComPacketSize {
 		return nil, ErrTooLargeComPacket
 	}
-	// TODO: Handle OutstandingData and MinTransfer (if needed, haven't checked)
+	// Empty ComPackets are not checked, as some TPers do not fill in the
+	// ComID when there is nothing to respond with yet.
+	if compkthdr.Length > 0 {
+		if comID := ComID(compkthdr.ComIDExt)<<16 | ComID(compkthdr.ComID); comID != ses.ComID {
+			return nil, fmt.Errorf("%w: got ComID 0x%08x, want 0x%08x", ErrComIDMismatch, comID, ses.ComID)
+		}
+	}
+	ses.outstandingData = compkthdr.OutstandingData
+	ses.minTransfer = compkthdr.MinTransfer
 	pkthdr := packetHeader{}
 	if err := binary.Read(rdr, binary.BigEndian, &pkthdr); err != nil {
 		return nil, err
@@ -147,17 +233,57 @@ func (c *plainCom) Receive(ses *Session) ([]byte, error) {
 	if uint(pkthdr.Length) > c.hp.MaxPacketSize {
 		return nil, ErrTooLargePacket
 	}
+	if compkthdr.Length > 0 && (pkthdr.TSN != uint32(ses.TSN) || pkthdr.HSN != uint32(ses.HSN)) {
+		return nil, fmt.Errorf("%w: got TSN %d HSN %d, want TSN %d HSN %d",
+			ErrSessionMismatch, pkthdr.TSN, pkthdr.HSN, ses.TSN, ses.HSN)
+	}
 	// TODO: Handle SeqNumber
 	// TODO: Handle AckType
-	subpkthdr := subPacketHeader{}
-	if err := binary.Read(rdr, binary.BigEndian, &subpkthdr); err != nil {
-		return nil, err
+	payload := rdr.Bytes()
+	if pkthdr.Length > 0 {
+		if uint(pkthdr.Length) > uint(len(payload)) {
+			return nil, ErrMalformedComPacket
+		}
+		payload = payload[:pkthdr.Length]
+		if ses.flowControl {
+			ses.consumed += uint(pkthdr.Length)
+		}
 	}
-	// TODO: Implement buffer management
-	if subpkthdr.Kind != 0 {
-		return nil, fmt.Errorf("only data subpackets are implemented")
+	var data []byte
+	for {
+		if len(payload) < subPacketHeaderSize {
+			return nil, ErrMalformedComPacket
+		}
+		subpkthdr := subPacketHeader{}
+		if err := binary.Read(bytes.NewReader(payload), binary.BigEndian, &subpkthdr); err != nil {
+			return nil, err
+		}
+		payload = payload[subPacketHeaderSize:]
+		if uint(subpkthdr.Length) > uint(len(payload)) {
+			return nil, ErrMalformedComPacket
+		}
+		switch subpkthdr.Kind {
+		case subPacketKindData:
+			if data == nil {
+				data = payload[:subpkthdr.Length:subpkthdr.Length]
+			} else {
+				data = append(data, payload[:subpkthdr.Length]...)
+			}
+		case subPacketKindCreditControl:
+			if subpkthdr.Length != 4 {
+				return nil, ErrMalformedComPacket
+			}
+			ses.credit += uint(binary.BigEndian.Uint32(payload))
+		default:
+			return nil, fmt.Errorf("unsupported subpacket kind 0x%04x", subpkthdr.Kind)
+		}
+		// Subpackets are padded to a multiple of 4 bytes, a packet without
+		// length holds a single subpacket at most.
+		n := uint(subpkthdr.Length) + subPacketPadding(uint(subpkthdr.Length))
+		if pkthdr.Length == 0 || n+subPacketHeaderSize > uint(len(payload)) {
+			break
+		}
+		payload = payload[n:]
 	}
-	data := rdr.Bytes()
-	data = data[0:subpkthdr.Length]
 	return data, nil
 }
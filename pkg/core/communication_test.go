@@ -0,0 +1,351 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive"
+)
+
+// loopbackDrive returns the last ComPacket sent on IF-RECV. The ComPacket
+// is kept in a buffer that is reused between calls, so that the benchmarks
+// measure the allocations of the communication layer only.
+type loopbackDrive struct {
+	nopDrive
+	buf []byte
+}
+
+func (d *loopbackDrive) IFSend(proto drive.SecurityProtocol, sps uint16, data []byte) error {
+	d.buf = append(d.buf[:0], data...)
+	return nil
+}
+
+func (d *loopbackDrive) IFRecv(proto drive.SecurityProtocol, sps uint16, data *[]byte) error {
+	copy(*data, d.buf)
+	return nil
+}
+
+var benchmarkProperties = struct {
+	hp HostProperties
+	tp TPerProperties
+}{
+	HostProperties{MaxPacketSize: 65516, MaxComPacketSize: 65536},
+	TPerProperties{MaxPacketSize: 65516, MaxComPacketSize: 65536},
+}
+
+// Payload sizes of a typical method call, a large Set and a Set of a
+// MBR or DataStore chunk
+var benchmarkSizes = []int{64, 1024, 60000}
+
+func BenchmarkSend(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		b.Run(fmt.Sprintf("%d", n), func(b *testing.B) {
+			d := &loopbackDrive{}
+			c := NewPlainCommunication(d, benchmarkProperties.hp, benchmarkProperties.tp)
+			s := &Session{ComID: 0x7fe, TSN: 1, HSN: 1}
+			data := make([]byte, n)
+			b.SetBytes(int64(n))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := c.Send(s, data); err != nil {
+					b.Fatalf("Send failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkReceive(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		b.Run(fmt.Sprintf("%d", n), func(b *testing.B) {
+			d := &loopbackDrive{}
+			c := NewPlainCommunication(d, benchmarkProperties.hp, benchmarkProperties.tp)
+			s := &Session{ComID: 0x7fe, TSN: 1, HSN: 1}
+			if err := c.Send(s, make([]byte, n)); err != nil {
+				b.Fatalf("Send failed: %v", err)
+			}
+			b.SetBytes(int64(n))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := c.Receive(s); err != nil {
+					b.Fatalf("Receive failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// Build the ComPacket of a response from its subpackets.
+func comPacket(t *testing.T, subpkts ...subPacketHeader) []byte {
+	t.Helper()
+	pkt := bytes.Buffer{}
+	for _, h := range subpkts {
+		binary.Write(&pkt, binary.BigEndian, &h)
+		body := make([]byte, (h.Length+3)&^3)
+		if h.Kind == subPacketKindCreditControl {
+			binary.BigEndian.PutUint32(body, 512)
+		}
+		pkt.Write(body)
+	}
+	b := bytes.Buffer{}
+	binary.Write(&b, binary.BigEndian, &comPacketHeader{ComID: 0x7fe, Length: uint32(24 + pkt.Len())})
+	binary.Write(&b, binary.BigEndian, &packetHeader{TSN: 1, HSN: 1, Length: uint32(pkt.Len())})
+	b.Write(pkt.Bytes())
+	return b.Bytes()
+}
+
+func TestCreditControl(t *testing.T) {
+	d := &loopbackDrive{}
+	c := NewPlainCommunication(d, InitialHostProperties, InitialTPerProperties)
+	s := &Session{ComID: 0x7fe, TSN: 1, HSN: 1, flowControl: true, credit: 100}
+
+	if err := c.Send(s, make([]byte, 64)); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if s.credit != 100-12-64 {
+		t.Errorf("credit after Send is %d", s.credit)
+	}
+	if err := c.Send(s, make([]byte, 64)); err != ErrInsufficientCredit {
+		t.Errorf("Send without credit returned %v", err)
+	}
+
+	d.buf = comPacket(t, subPacketHeader{Kind: subPacketKindCreditControl, Length: 4}, subPacketHeader{Length: 5})
+	data, err := c.Receive(s)
+	if err != nil {
+		t.Fatalf("Receive failed: %v", err)
+	}
+	if len(data) != 5 {
+		t.Errorf("received %d bytes of data, want 5", len(data))
+	}
+	if s.credit != 100-12-64+512 || s.consumed != 12+4+12+8 {
+		t.Errorf("credit %d and consumed %d after Receive", s.credit, s.consumed)
+	}
+
+	// The next Packet grants the consumed credit back to the TPer
+	if err := c.Send(s, make([]byte, 8)); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	grant := d.buf[44 : 44+16]
+	if kind, n := binary.BigEndian.Uint16(grant[6:8]), binary.BigEndian.Uint32(grant[12:16]); kind != subPacketKindCreditControl || n != 36 {
+		t.Errorf("Packet starts with subpacket kind 0x%04x granting %d, want credit control granting 36", kind, n)
+	}
+	if s.consumed != 0 {
+		t.Errorf("consumed %d after granting credit", s.consumed)
+	}
+}
+
+// Fails every IF-SEND.
+type failingDrive struct {
+	nopDrive
+}
+
+func (d *failingDrive) IFSend(proto drive.SecurityProtocol, sps uint16, data []byte) error {
+	return errors.New("IF-SEND failed")
+}
+
+func TestSendFailure(t *testing.T) {
+	c := NewPlainCommunication(&failingDrive{}, InitialHostProperties, InitialTPerProperties)
+	s := &Session{ComID: 0x7fe, TSN: 1, HSN: 1, flowControl: true, credit: 100, consumed: 36}
+	if err := c.Send(s, make([]byte, 8)); err == nil {
+		t.Fatalf("Send succeeded")
+	}
+	// Nothing reached the TPer, so neither is the credit used up nor the
+	// consumed credit granted back
+	if s.credit != 100 || s.consumed != 36 {
+		t.Errorf("credit %d and consumed %d after a failed Send", s.credit, s.consumed)
+	}
+}
+
+func TestReceiveMalformed(t *testing.T) {
+	// A Packet too short to hold a subpacket header
+	short := bytes.Buffer{}
+	binary.Write(&short, binary.BigEndian, &comPacketHeader{ComID: 0x7fe, Length: 24 + 8})
+	binary.Write(&short, binary.BigEndian, &packetHeader{TSN: 1, HSN: 1, Length: 8})
+	short.Write(make([]byte, 8))
+	// A subpacket longer than its Packet
+	long := comPacket(t, subPacketHeader{Length: 4})
+	binary.BigEndian.PutUint32(long[20+24+8:], 64)
+	for _, tc := range []struct {
+		name string
+		buf  []byte
+	}{
+		{"Short packet", short.Bytes()},
+		{"Long subpacket", long},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := &loopbackDrive{buf: tc.buf}
+			c := NewPlainCommunication(d, InitialHostProperties, InitialTPerProperties)
+			s := &Session{ComID: 0x7fe, TSN: 1, HSN: 1}
+			if _, err := c.Receive(s); !errors.Is(err, ErrMalformedComPacket) {
+				t.Errorf("Receive() returned %v; want ErrMalformedComPacket", err)
+			}
+		})
+	}
+}
+
+// Returns idle and busy ComPackets before the response.
+type busyDrive struct {
+	nopDrive
+	idle  int
+	busy  int
+	resp  []byte
+	polls int
+}
+
+func (d *busyDrive) IFRecv(proto drive.SecurityProtocol, sps uint16, data *[]byte) error {
+	d.polls++
+	for i := range *data {
+		(*data)[i] = 0
+	}
+	if d.idle > 0 {
+		d.idle--
+		return nil
+	}
+	if d.busy > 0 {
+		d.busy--
+		binary.BigEndian.PutUint32((*data)[8:12], 1)
+		return nil
+	}
+	copy(*data, d.resp)
+	return nil
+}
+
+func TestReceiveResponse(t *testing.T) {
+	tooLarge := make([]byte, 20)
+	binary.BigEndian.PutUint32(tooLarge[8:12], 4096)
+	binary.BigEndian.PutUint32(tooLarge[12:16], 4096)
+	otherComID := comPacket(t, subPacketHeader{Length: 1})
+	binary.BigEndian.PutUint16(otherComID[4:6], 0x7ff)
+	otherSession := comPacket(t, subPacketHeader{Length: 1})
+	binary.BigEndian.PutUint32(otherSession[20:24], 2)
+	for _, tc := range []struct {
+		name string
+		idle int
+		busy int
+		resp []byte
+		err  error
+	}{
+		{"Immediate", 0, 0, comPacket(t, subPacketHeader{Length: 1}), nil},
+		{"Busy beyond retries", 0, 20, comPacket(t, subPacketHeader{Length: 1}), nil},
+		// OutstandingData 0 while the TPer is still working
+		{"Idle", 2, 0, comPacket(t, subPacketHeader{Length: 1}), nil},
+		{"Idle then busy", 1, 20, comPacket(t, subPacketHeader{Length: 1}), nil},
+		{"No response", 0, 0, nil, ErrNoResponse},
+		{"Busy beyond busy timeout", 0, 1 << 30, nil, method.ErrMethodTimeout},
+		{"Too large", 0, 0, tooLarge, ErrTooLargeComPacket},
+		{"Other ComID", 0, 0, otherComID, ErrComIDMismatch},
+		{"Other session", 0, 0, otherSession, ErrSessionMismatch},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := &busyDrive{idle: tc.idle, busy: tc.busy, resp: tc.resp}
+			s := &Session{
+				c:                  NewPlainCommunication(d, InitialHostProperties, InitialTPerProperties),
+				ComID:              0x7fe,
+				TSN:                1,
+				HSN:                1,
+				ReceiveRetries:     2,
+				ReceiveInterval:    time.Millisecond,
+				ReceiveBusyTimeout: 100 * time.Millisecond,
+			}
+			_, err := s.receiveResponse()
+			if !errors.Is(err, tc.err) {
+				t.Errorf("receiveResponse() returned %v; want %v", err, tc.err)
+			}
+		})
+	}
+}
+
+func TestPadding(t *testing.T) {
+	for _, tc := range []struct {
+		padding uint
+		maxSize uint
+		data    int
+		want    int
+	}{
+		{512, 1024, 8, 512},
+		{0, 1024, 8, 64},
+		{512, 1024, 456, 512},
+		{512, 1000, 600, 1000},
+	} {
+		d := &loopbackDrive{}
+		tp := InitialTPerProperties
+		tp.MaxComPacketSize = tc.maxSize
+		c := &plainCom{d, InitialHostProperties, tp, tc.padding}
+		s := &Session{ComID: 0x7fe, TSN: 1, HSN: 1}
+		if err := c.Send(s, make([]byte, tc.data)); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+		if len(d.buf) != tc.want {
+			t.Errorf("Send of %d bytes with padding %d sent %d bytes, want %d", tc.data, tc.padding, len(d.buf), tc.want)
+		}
+	}
+}
+
+func TestSubPacketPadding(t *testing.T) {
+	for n, want := range []uint{0, 3, 2, 1, 0, 3, 2, 1, 0} {
+		if got := subPacketPadding(uint(n)); got != want {
+			t.Errorf("subPacketPadding(%d) = %d, want %d", n, got, want)
+		}
+	}
+
+	// The padding is part of the Packet but not of the subpacket Length
+	for _, n := range []int{4, 5, 7, 8} {
+		d := &loopbackDrive{}
+		c := &plainCom{d, InitialHostProperties, InitialTPerProperties, 0}
+		s := &Session{ComID: 0x7fe, TSN: 1, HSN: 1}
+		if err := c.Send(s, make([]byte, n)); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+		padded := (n + 3) &^ 3
+		if len(d.buf) != 56+padded {
+			t.Errorf("Send of %d bytes sent %d bytes, want %d", n, len(d.buf), 56+padded)
+		}
+		if l := binary.BigEndian.Uint32(d.buf[40:44]); l != uint32(12+padded) {
+			t.Errorf("Send of %d bytes has a Packet length of %d, want %d", n, l, 12+padded)
+		}
+		if l := binary.BigEndian.Uint32(d.buf[52:56]); l != uint32(n) {
+			t.Errorf("Send of %d bytes has a subpacket length of %d, want %d", n, l, n)
+		}
+	}
+
+	// Subpackets following a padded subpacket are found after the padding
+	d := &loopbackDrive{buf: comPacket(t, subPacketHeader{Length: 5}, subPacketHeader{Length: 8})}
+	c := NewPlainCommunication(d, InitialHostProperties, InitialTPerProperties)
+	data, err := c.Receive(&Session{ComID: 0x7fe, TSN: 1, HSN: 1})
+	if err != nil {
+		t.Fatalf("Receive failed: %v", err)
+	}
+	if len(data) != 13 {
+		t.Errorf("received %d bytes of data, want 13", len(data))
+	}
+}
+
+// A TPer that keeps reporting that nothing will follow fails the method
+// after a few polls, not after the whole retry budget.
+func TestReceiveResponseFailFast(t *testing.T) {
+	d := &busyDrive{}
+	s := &Session{
+		c:                  NewPlainCommunication(d, InitialHostProperties, InitialTPerProperties),
+		ComID:              0x7fe,
+		TSN:                1,
+		HSN:                1,
+		ReceiveRetries:     1000,
+		ReceiveInterval:    time.Second,
+		ReceiveBusyTimeout: time.Minute,
+	}
+	start := time.Now()
+	if _, err := s.receiveResponse(); !errors.Is(err, ErrNoResponse) {
+		t.Errorf("receiveResponse() returned %v; want %v", err, ErrNoResponse)
+	}
+	if d.polls != maxIdlePolls {
+		t.Errorf("receiveResponse() polled %d times; want %d", d.polls, maxIdlePolls)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("receiveResponse() took %v", elapsed)
+	}
+}
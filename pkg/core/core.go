@@ -22,6 +22,7 @@ type ComIDRequest [4]byte
 const (
 	ComIDInvalid     ComID = -1
 	ComIDDiscoveryL0 ComID = 1
+	ComIDBlockSID    ComID = 5
 )
 
 var (
@@ -62,18 +63,56 @@ func HandleComIDRequest(d drive.DriveIntf, comID ComID, req ComIDRequest) ([]byt
 	}
 
 	// TODO: Verify the request code in response?
-	size := binary.BigEndian.Uint16(buf[10:12])
+	size := int(binary.BigEndian.Uint16(buf[10:12]))
+	if 12+size > len(buf) {
+		return nil, fmt.Errorf("malformed ComID request response of %d bytes", size)
+	}
 	return buf[12 : 12+size], nil
 }
 
+// ComIDState is the state of a ComID as reported by VERIFY_COMID_VALID.
+type ComIDState uint32
+
+const (
+	ComIDStateInvalid    ComIDState = 0
+	ComIDStateInactive   ComIDState = 1
+	ComIDStateIssued     ComIDState = 2
+	ComIDStateAssociated ComIDState = 3
+)
+
+func (s ComIDState) String() string {
+	switch s {
+	case ComIDStateInvalid:
+		return "Invalid"
+	case ComIDStateInactive:
+		return "Inactive"
+	case ComIDStateIssued:
+		return "Issued"
+	case ComIDStateAssociated:
+		return "Associated"
+	}
+	return fmt.Sprintf("Unknown(%d)", uint32(s))
+}
+
+// GetComIDState queries the state of a ComID.
+func GetComIDState(d drive.DriveIntf, comID ComID) (ComIDState, error) {
+	res, err := HandleComIDRequest(d, comID, ComIDRequestVerifyComIDValid)
+	if err != nil {
+		return ComIDStateInvalid, err
+	}
+	if len(res) < 4 {
+		return ComIDStateInvalid, fmt.Errorf("short VERIFY_COMID_VALID response")
+	}
+	return ComIDState(binary.BigEndian.Uint32(res[0:4])), nil
+}
+
 // Validate a ComID.
 func IsComIDValid(d drive.DriveIntf, comID ComID) (bool, error) {
-	res, err := HandleComIDRequest(d, comID, ComIDRequestVerifyComIDValid)
+	state, err := GetComIDState(d, comID)
 	if err != nil {
 		return false, err
 	}
-	state := binary.BigEndian.Uint32(res[0:4])
-	return state == 2 || state == 3, nil
+	return state == ComIDStateIssued || state == ComIDStateAssociated, nil
 }
 
 // Reset the state of the synchronous protocol stack.
@@ -93,27 +132,46 @@ func StackReset(d drive.DriveIntf, comID ComID) error {
 	return nil
 }
 
+// BlockSID issues the Block SID Authentication command, which prevents
+// authentication as SID until the next power cycle, or the next hardware
+// reset if hwReset is set. If freezeLockingSP is set, the Locking SP is
+// additionally frozen (if the LockingSPFreezeLockSupported bit of the Block SID
+// feature is set), preventing its activation or revert.
+//
+// Ref: TCG Storage Feature Set: Block SID Authentication, 3.2 Block SID Authentication Command
+func BlockSID(d drive.DriveIntf, hwReset bool, freezeLockingSP bool) error {
+	var buf [512]byte
+	if hwReset {
+		buf[0] |= 0x1
+	}
+	if freezeLockingSP {
+		buf[1] |= 0x1
+	}
+	return d.IFSend(drive.SecurityProtocolTCGTPer, uint16(ComIDBlockSID), buf[:])
+}
+
+// BaseComID returns the base ComID and protocol level announced by the first
+// supported SSC in the Level0Discovery, without talking to the device.
+func BaseComID(d0 *Level0Discovery) (ComID, ProtocolLevel) {
+	switch {
+	case d0.OpalV2 != nil:
+		return ComID(d0.OpalV2.BaseComID), ProtocolLevelCore
+	case d0.PyriteV1 != nil:
+		return ComID(d0.PyriteV1.BaseComID), ProtocolLevelCore
+	case d0.PyriteV2 != nil:
+		return ComID(d0.PyriteV2.BaseComID), ProtocolLevelCore
+	case d0.Enterprise != nil:
+		return ComID(d0.Enterprise.BaseComID), ProtocolLevelEnterprise
+	case d0.RubyV1 != nil:
+		return ComID(d0.RubyV1.BaseComID), ProtocolLevelCore
+	}
+	return ComIDInvalid, ProtocolLevelUnknown
+}
+
 // FindComID checks data of Level0Discovery for the particular SSC and reads the standard ComID
 // of requests a ComID if no standard is set.
 func FindComID(d drive.DriveIntf, d0 *Level0Discovery) (ComID, ProtocolLevel, error) {
-	proto := ProtocolLevelUnknown
-	comID := ComIDInvalid
-	if d0.OpalV2 != nil {
-		comID = ComID(d0.OpalV2.BaseComID)
-		proto = ProtocolLevelCore
-	} else if d0.PyriteV1 != nil {
-		comID = ComID(d0.PyriteV1.BaseComID)
-		proto = ProtocolLevelCore
-	} else if d0.PyriteV2 != nil {
-		comID = ComID(d0.PyriteV2.BaseComID)
-		proto = ProtocolLevelCore
-	} else if d0.Enterprise != nil {
-		comID = ComID(d0.Enterprise.BaseComID)
-		proto = ProtocolLevelEnterprise
-	} else if d0.RubyV1 != nil {
-		comID = ComID(d0.RubyV1.BaseComID)
-		proto = ProtocolLevelCore
-	}
+	comID, proto := BaseComID(d0)
 
 	autoComID, err := GetComID(d)
 	if err == nil && autoComID > 0 {
@@ -122,3 +180,33 @@ func FindComID(d drive.DriveIntf, d0 *Level0Discovery) (ComID, ProtocolLevel, er
 
 	return comID, proto, nil
 }
+
+// ProbeResult holds the communication properties negotiated with
+// the TPer on a ComID.
+type ProbeResult struct {
+	ComID          ComID
+	ProtocolLevel  ProtocolLevel
+	HostProperties HostProperties
+	TPerProperties TPerProperties
+}
+
+// Probe allocates a ComID and negotiates the communication properties with
+// the TPer without starting any session. This shows the limits of a drive,
+// e.g. its MaxComPacketSize and MaxSessions, when debugging interoperability
+// issues. Note that the synchronous protocol stack of the ComID is reset.
+func Probe(d drive.DriveIntf, d0 *Level0Discovery, opts ...ControlSessionOpt) (*ProbeResult, error) {
+	comID, _, err := FindComID(d, d0)
+	if err != nil {
+		return nil, fmt.Errorf("FindComID() failed: %v", err)
+	}
+	cs, err := NewControlSession(d, d0, append([]ControlSessionOpt{WithComID(comID)}, opts...)...)
+	if err != nil {
+		return nil, fmt.Errorf("NewControlSession() failed: %v", err)
+	}
+	return &ProbeResult{
+		ComID:          cs.ComID,
+		ProtocolLevel:  cs.ProtocolLevel,
+		HostProperties: cs.HostProperties,
+		TPerProperties: cs.TPerProperties,
+	}, nil
+}
@@ -1,17 +1,82 @@
 package core
 
-// TODO: The plan here is to extract some RPC responses and test the parsing
-// against these known drives to ensure long-term compatibility.
-// Here are some Discovery Level0 bytes to get started.
+import (
+	"strconv"
+	"strings"
+	"testing"
 
-// Samsung EVO 860:
-// d0raw: [0 0 0 144 0 0 0 1 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 1 16 12 17 0 0 0 0 0 0 0 0 0 0 0 0 2 16 12 31 0 0 0 0 0 0 0 0 0 0 0 0 3 16 28 1 0 0 0 0 0 0 0 0 0 2 0 0 0 0 0 0 0 0 8 0 0 0 0 0 0 0 0 2 2 16 12 0 0 0 9 0 160 0 0 0 0 0 1 2 3 16 16 16 4 0 1 0 0 4 0 9 0 0 0 0 0 0 0]
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive/sim"
+)
 
-// Samsung SSD 970 EVO Plus 500GB (NVMe)
-// d0raw: [0 0 0 180 0 0 0 1 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 1 16 12 17 0 0 0 0 0 0 0 0 0 0 0 0 2 16 12 9 0 0 0 0 0 0 0 0 0 0 0 0 3 16 28 1 0 0 0 0 0 0 0 0 0 2 0 0 0 0 0 0 0 0 8 0 0 0 0 0 0 0 0 2 2 16 12 0 0 0 9 0 160 0 0 0 0 0 1 2 3 16 16 16 4 0 1 0 0 4 0 9 0 0 0 0 0 0 0 4 2 16 12 0 0 0 0 0 0 0 0 0 0 0 0 4 3 16 16 128 0 0 0 0 0 0 9 0 0 0 8 0 0 0 8]
+// Level 0 Discovery responses of real drives
+var d0Samples = []struct {
+	drive string
+	d0raw string
+	ssc   string
+}{
+	{"Samsung EVO 860",
+		"0 0 0 144 0 0 0 1 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 1 16 12 17 0 0 0 0 0 0 0 0 0 0 0 0 2 16 12 31 0 0 0 0 0 0 0 0 0 0 0 0 3 16 28 1 0 0 0 0 0 0 0 0 0 2 0 0 0 0 0 0 0 0 8 0 0 0 0 0 0 0 0 2 2 16 12 0 0 0 9 0 160 0 0 0 0 0 1 2 3 16 16 16 4 0 1 0 0 4 0 9 0 0 0 0 0 0 0",
+		"Opal 2"},
+	{"Samsung SSD 970 EVO Plus 500GB (NVMe)",
+		"0 0 0 180 0 0 0 1 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 1 16 12 17 0 0 0 0 0 0 0 0 0 0 0 0 2 16 12 9 0 0 0 0 0 0 0 0 0 0 0 0 3 16 28 1 0 0 0 0 0 0 0 0 0 2 0 0 0 0 0 0 0 0 8 0 0 0 0 0 0 0 0 2 2 16 12 0 0 0 9 0 160 0 0 0 0 0 1 2 3 16 16 16 4 0 1 0 0 4 0 9 0 0 0 0 0 0 0 4 2 16 12 0 0 0 0 0 0 0 0 0 0 0 0 4 3 16 16 128 0 0 0 0 0 0 9 0 0 0 8 0 0 0 8",
+		"Opal 2"},
+	{"Sabrent Rocket 4.0 2TB",
+		"0 0 0 112 0 0 0 1 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 1 16 12 17 0 0 0 0 0 0 0 0 0 0 0 0 2 32 12 65 0 0 0 0 0 0 0 0 0 0 0 3 2 16 16 7 254 0 1 0 0 0 0 0 0 0 0 0 0 0 0 4 2 16 12 0 0 0 0 0 0 0 0",
+		"Pyrite 1"},
+	{"SAMSUNG MZ1LB1T9HALS-00007",
+		"0 0 0 180 0 0 0 1 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 1 16 12 17 0 0 0 0 0 0 0 0 0 0 0 0 2 16 12 9 0 0 0 0 0 0 0 0 0 0 0 0 3 16 28 1 0 0 0 0 0 0 0 0 0 2 0 0 0 0 0 0 0 0 8 0 0 0 0 0 0 0 0 2 2 16 12 0 0 0 9 0 160 0 0 0 0 0 1 2 3 16 16 16 4 0 1 0 0 4 0 9 0 0 0 0 0 0 0 4 2 16 12 2 1 0 0 0 0 0 0 0 0 0 0 4 3 16 16 128 0 0 0 0 0 0 9 0 0 0 8",
+		"Opal 2"},
+}
 
-// Sabrent Rocket 4.0 2TB
-// d0raw: [0 0 0 112 0 0 0 1 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 1 16 12 17 0 0 0 0 0 0 0 0 0 0 0 0 2 32 12 65 0 0 0 0 0 0 0 0 0 0 0 3 2 16 16 7 254 0 1 0 0 0 0 0 0 0 0 0 0 0 0 4 2 16 12 0 0 0 0 0 0 0 0]
+// Decode a sample, zero padded like the buffer used by Discovery0.
+func sampleBytes(t testing.TB, d0raw string) []byte {
+	var b []byte
+	for _, f := range strings.Fields(d0raw) {
+		v, err := strconv.ParseUint(f, 10, 8)
+		if err != nil {
+			t.Fatalf("malformed sample: %v", err)
+		}
+		b = append(b, byte(v))
+	}
+	return append(b, make([]byte, 2048-len(b))...)
+}
 
-// SAMSUNG MZ1LB1T9HALS-00007
-// d0raw: [0 0 0 180 0 0 0 1 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 1 16 12 17 0 0 0 0 0 0 0 0 0 0 0 0 2 16 12 9 0 0 0 0 0 0 0 0 0 0 0 0 3 16 28 1 0 0 0 0 0 0 0 0 0 2 0 0 0 0 0 0 0 0 8 0 0 0 0 0 0 0 0 2 2 16 12 0 0 0 9 0 160 0 0 0 0 0 1 2 3 16 16 16 4 0 1 0 0 4 0 9 0 0 0 0 0 0 0 4 2 16 12 2 1 0 0 0 0 0 0 0 0 0 0 4 3 16 16 128 0 0 0 0 0 0 9 0 0 0 8]
+func TestParseDiscovery0(t *testing.T) {
+	for _, tc := range d0Samples {
+		t.Run(tc.drive, func(t *testing.T) {
+			d0, err := parseDiscovery0(sampleBytes(t, tc.d0raw))
+			if err != nil {
+				t.Fatalf("parseDiscovery0 failed: %v", err)
+			}
+			if d0.TPer == nil || d0.Locking == nil {
+				t.Errorf("TPer or Locking feature missing: %+v", d0)
+			}
+			if ssc := GetCapabilities(d0).SSC; ssc != tc.ssc {
+				t.Errorf("SSC is %q; want %q", ssc, tc.ssc)
+			}
+		})
+	}
+}
+
+func FuzzParseDiscovery0(f *testing.F) {
+	for _, tc := range d0Samples {
+		f.Add(sampleBytes(f, tc.d0raw))
+	}
+	f.Fuzz(func(t *testing.T, d0raw []byte) {
+		parseDiscovery0(d0raw)
+	})
+}
+
+func TestProbe(t *testing.T) {
+	c, err := NewCoreFromDrive(sim.New())
+	if err != nil {
+		t.Fatalf("NewCoreFromDrive() failed: %v", err)
+	}
+	p, err := Probe(c.DriveIntf, c.Level0Discovery)
+	if err != nil {
+		t.Fatalf("Probe() failed: %v", err)
+	}
+	if p.ComID != sim.BaseComID || p.TPerProperties.MaxComPacketSize == 0 {
+		t.Errorf("unexpected probe result %+v", p)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package coremetrics exports the protocol-level events of TCG Storage devices
+// as Prometheus metrics, for daemons embedding the library:
+//
+//	m := coremetrics.New()
+//	prometheus.MustRegister(m)
+//	coreObj, err := core.NewCore("/dev/nvme0", core.WithObserver(m.Device("/dev/nvme0")))
+//
+// The locking state of devices is exported by the metrics package.
+package coremetrics
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics holds the collectors of all devices, which are told apart by the
+// device label.
+type Metrics struct {
+	methodCalls    *prometheus.CounterVec
+	methodLatency  *prometheus.HistogramVec
+	transferBytes  *prometheus.CounterVec
+	transferErrors *prometheus.CounterVec
+	receiveRetries *prometheus.CounterVec
+	sessionOpen    *prometheus.HistogramVec
+	sessionClose   *prometheus.HistogramVec
+	collectors     []prometheus.Collector
+}
+
+// New creates the collectors, register them with prometheus.MustRegister.
+func New() *Metrics {
+	m := &Metrics{
+		methodCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "tcg_storage_method_calls_total",
+			Help: "Number of method calls by method and returned status",
+		}, []string{"device", "method", "status"}),
+		methodLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "tcg_storage_method_duration_seconds",
+			Help:    "Time from sending a method call to receiving its response",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 8),
+		}, []string{"device", "method"}),
+		transferBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "tcg_storage_transfer_bytes_total",
+			Help: "Number of bytes transferred by IF-SEND and IF-RECV",
+		}, []string{"device", "direction"}),
+		transferErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "tcg_storage_transfer_errors_total",
+			Help: "Number of failed IF-SEND and IF-RECV commands",
+		}, []string{"device", "direction"}),
+		receiveRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "tcg_storage_receive_retries_total",
+			Help: "Number of IF-RECV commands repeated because the TPer had not prepared the response yet",
+		}, []string{"device"}),
+		sessionOpen: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "tcg_storage_session_open_seconds",
+			Help:    "Time it took the TPer to start a session",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 8),
+		}, []string{"device"}),
+		sessionClose: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "tcg_storage_session_close_seconds",
+			Help:    "Time it took the TPer to close a session",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 8),
+		}, []string{"device"}),
+	}
+	m.collectors = []prometheus.Collector{
+		m.methodCalls, m.methodLatency, m.transferBytes, m.transferErrors,
+		m.receiveRetries, m.sessionOpen, m.sessionClose,
+	}
+	return m
+}
+
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors {
+		c.Describe(ch)
+	}
+}
+
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors {
+		c.Collect(ch)
+	}
+}
+
+// Device returns the observer for a device, to be passed to core.WithObserver.
+func (m *Metrics) Device(device string) core.Observer {
+	return &deviceObserver{m: m, device: device}
+}
+
+type deviceObserver struct {
+	m      *Metrics
+	device string
+}
+
+func (o *deviceObserver) transfer(direction string, bytes int, err error) {
+	if err != nil {
+		o.m.transferErrors.WithLabelValues(o.device, direction).Inc()
+		return
+	}
+	o.m.transferBytes.WithLabelValues(o.device, direction).Add(float64(bytes))
+}
+
+func (o *deviceObserver) IFSend(proto drive.SecurityProtocol, bytes int, err error) {
+	o.transfer("send", bytes, err)
+}
+
+func (o *deviceObserver) IFRecv(proto drive.SecurityProtocol, bytes int, err error) {
+	o.transfer("recv", bytes, err)
+}
+
+func (o *deviceObserver) ReceiveRetry() {
+	o.m.receiveRetries.WithLabelValues(o.device).Inc()
+}
+
+func (o *deviceObserver) MethodStatus(method string, status uint, latency time.Duration) {
+	o.m.methodCalls.WithLabelValues(o.device, method, StatusName(status)).Inc()
+	o.m.methodLatency.WithLabelValues(o.device, method).Observe(latency.Seconds())
+}
+
+func (o *deviceObserver) SessionOpened(latency time.Duration) {
+	o.m.sessionOpen.WithLabelValues(o.device).Observe(latency.Seconds())
+}
+
+func (o *deviceObserver) SessionClosed(latency time.Duration) {
+	o.m.sessionClose.WithLabelValues(o.device).Observe(latency.Seconds())
+}
+
+// StatusName returns the name of a method status code as used in the
+// specification, e.g. NOT_AUTHORIZED.
+func StatusName(status uint) string {
+	if err, ok := method.MethodStatusCodeMap[status]; ok {
+		return strings.TrimPrefix(err.Error(), "method returned status ")
+	}
+	return fmt.Sprintf("0x%02x", status)
+}
@@ -18,28 +18,76 @@ type Core struct {
 	DiskInfo
 }
 
-func NewCore(device string) (*Core, error) {
-	drive, err := drive.Open(device)
+type coreConfig struct {
+	tracer   *Tracer
+	observer Observer
+}
+
+type CoreOpt func(cc *coreConfig)
+
+// Report all traffic to and from the device to the tracer, including the
+// Level 0 Discovery done when opening it.
+func WithTracer(t *Tracer) CoreOpt {
+	return func(cc *coreConfig) {
+		cc.tracer = t
+	}
+}
+
+func NewCore(device string, opts ...CoreOpt) (*Core, error) {
+	d, err := drive.Open(device)
 	if err != nil {
-		return nil, fmt.Errorf("open device %s failed: %v", device, err)
+		return nil, fmt.Errorf("open device %s failed: %w", device, err)
+	}
+	return newCore(d, "device "+device, opts)
+}
+
+// Create a Core for an already opened drive, e.g. one that is wrapped to
+// record or replay its traffic. The drive is closed if it cannot be used.
+func NewCoreFromDrive(d drive.DriveIntf, opts ...CoreOpt) (*Core, error) {
+	return newCore(d, "device", opts)
+}
+
+func newCore(d drive.DriveIntf, name string, opts []CoreOpt) (*Core, error) {
+	cc := coreConfig{}
+	for _, o := range opts {
+		o(&cc)
+	}
+	if cc.observer != nil {
+		d = NewObserveDrive(d, cc.observer)
+	}
+	if cc.tracer != nil {
+		d = NewTraceDrive(d, cc.tracer)
 	}
-	ident, err := drive.Identify()
+	ident, err := d.Identify()
 	if err != nil {
-		return nil, fmt.Errorf("identify device %s failed: %v", device, err)
+		d.Close()
+		return nil, fmt.Errorf("identify %s failed: %v", name, err)
 	}
 	c := &Core{
-		DriveIntf: drive,
+		DriveIntf: d,
 		DiskInfo: DiskInfo{
 			Identity:        ident,
 			Level0Discovery: &Level0Discovery{},
 		},
 	}
 	if err := c.Discovery0(); err != nil {
-		return nil, err
+		d.Close()
+		return nil, raidControllerError(ident, err)
 	}
 	return c, nil
 }
 
+// Replace the error of a failed discovery on a logical drive of a RAID
+// controller, as such failures are otherwise taken for unsupported drives.
+func raidControllerError(ident *drive.Identity, err error) error {
+	ctrl, ok := drive.RAIDController(ident)
+	if !ok {
+		return err
+	}
+	return fmt.Errorf("%w (%s, %s): the self-encrypting drives behind it have to be managed with the tools of the controller, or exposed by switching the controller to HBA/JBOD mode (%v)",
+		drive.ErrBehindRAIDController, ident.Model, ctrl, err)
+}
+
 // diskInfo holds information obtained by Discovery0 and Identify functions.
 type DiskInfo struct {
 	*Level0Discovery
@@ -78,11 +126,21 @@ type Level0Discovery struct {
 func (d *Core) Discovery0() error {
 	d0raw := make([]byte, 2048)
 	if err := d.IFRecv(drive.SecurityProtocolTCGManagement, uint16(ComIDDiscoveryL0), &d0raw); err != nil {
-		if err == drive.ErrNotSupported {
-			return ErrNotSupported
+		if errors.Is(err, drive.ErrNotSupported) {
+			return fmt.Errorf("%w: %v", ErrNotSupported, err)
 		}
 		return err
 	}
+	d0, err := parseDiscovery0(d0raw)
+	if err != nil {
+		return err
+	}
+	d.DiskInfo.Level0Discovery = d0
+	return nil
+}
+
+// Parse the response to a Level 0 Discovery.
+func parseDiscovery0(d0raw []byte) (*Level0Discovery, error) {
 	d0 := &Level0Discovery{}
 	d0buf := bytes.NewBuffer(d0raw)
 	d0hdr := struct {
@@ -93,10 +151,10 @@ func (d *Core) Discovery0() error {
 		Vendor [32]byte
 	}{}
 	if err := binary.Read(d0buf, binary.BigEndian, &d0hdr); err != nil {
-		return fmt.Errorf("failed to parse Level 0 discovery: %v", err)
+		return nil, fmt.Errorf("failed to parse Level 0 discovery: %v", err)
 	}
 	if d0hdr.Size == 0 {
-		return ErrNotSupported
+		return nil, ErrNotSupported
 	}
 	d0.MajorVersion = int(d0hdr.Major)
 	d0.MinorVersion = int(d0hdr.Minor)
@@ -110,7 +168,7 @@ func (d *Core) Discovery0() error {
 			Size    uint8
 		}{}
 		if err := binary.Read(d0buf, binary.BigEndian, &fhdr); err != nil {
-			return fmt.Errorf("failed to parse feature header: %v", err)
+			return nil, fmt.Errorf("failed to parse feature header: %v", err)
 		}
 		frdr := io.LimitReader(d0buf, int64(fhdr.Size))
 		var err error
@@ -158,15 +216,14 @@ func (d *Core) Discovery0() error {
 			d0.UnknownFeatures = append(d0.UnknownFeatures, uint16(fhdr.Code))
 		}
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if _, err := io.CopyN(io.Discard, frdr, int64(fhdr.Size)); err != nil && !errors.Is(err, io.EOF) {
-			return err
+			return nil, err
 		}
 		fsize -= binary.Size(fhdr) + int(fhdr.Size)
 	}
-	d.DiskInfo.Level0Discovery = d0
-	return nil
+	return d0, nil
 }
 
 func (c *Core) Close() error {
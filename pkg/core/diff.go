@@ -0,0 +1,91 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// DiscoveryChange is a field that differs between two Level 0 Discoveries.
+// Field is the path of the field, e.g. "Locking.MBRDone". Features that are
+// reported by only one of the discoveries have the feature name as Field and
+// the nil or non-nil descriptors as values.
+type DiscoveryChange struct {
+	Field string
+	Old   interface{}
+	New   interface{}
+}
+
+func (c DiscoveryChange) String() string {
+	return fmt.Sprintf("%s: %s→%s", c.Field, formatDiscoveryValue(c.Old), formatDiscoveryValue(c.New))
+}
+
+func formatDiscoveryValue(v interface{}) string {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return "absent"
+		}
+		return "present"
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// DiffDiscovery returns the fields that changed between two Level 0
+// Discoveries of the same drive, e.g. LockingEnabled or MBRDone after a
+// reset, in the order of the fields of Level0Discovery.
+func DiffDiscovery(old, new *Level0Discovery) []DiscoveryChange {
+	if old == nil {
+		old = &Level0Discovery{}
+	}
+	if new == nil {
+		new = &Level0Discovery{}
+	}
+	var res []DiscoveryChange
+	diffValues("", reflect.ValueOf(old).Elem(), reflect.ValueOf(new).Elem(), &res)
+	return res
+}
+
+func diffValues(path string, a, b reflect.Value, res *[]DiscoveryChange) {
+	switch a.Kind() {
+	case reflect.Ptr:
+		if a.IsNil() != b.IsNil() {
+			*res = append(*res, DiscoveryChange{Field: path, Old: a.Interface(), New: b.Interface()})
+			return
+		}
+		if a.IsNil() {
+			return
+		}
+		diffValues(path, a.Elem(), b.Elem(), res)
+	case reflect.Struct:
+		t := a.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			name := f.Name
+			if path != "" {
+				name = path + "." + f.Name
+			}
+			diffValues(name, a.Field(i), b.Field(i), res)
+		}
+	default:
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			*res = append(*res, DiscoveryChange{Field: path, Old: a.Interface(), New: b.Interface()})
+		}
+	}
+}
+
+// Refresh performs a new Level 0 Discovery and returns how it differs from
+// the previous one.
+func (d *Core) Refresh() ([]DiscoveryChange, error) {
+	old := d.DiskInfo.Level0Discovery
+	if err := d.Discovery0(); err != nil {
+		return nil, err
+	}
+	return DiffDiscovery(old, d.DiskInfo.Level0Discovery), nil
+}
@@ -0,0 +1,35 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/feature"
+)
+
+func TestDiffDiscovery(t *testing.T) {
+	old := &Level0Discovery{
+		Locking:  &feature.Locking{LockingEnabled: false, MBRDone: true},
+		BlockSID: &feature.BlockSID{},
+	}
+	new := &Level0Discovery{
+		Locking:  &feature.Locking{LockingEnabled: true, MBRDone: false},
+		OpalV2:   &feature.OpalV2{},
+		BlockSID: &feature.BlockSID{},
+	}
+	var got []string
+	for _, c := range DiffDiscovery(old, new) {
+		got = append(got, c.String())
+	}
+	want := []string{
+		"Locking.LockingEnabled: false→true",
+		"Locking.MBRDone: true→false",
+		"OpalV2: absent→present",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffDiscovery() = %q, want %q", got, want)
+	}
+	if c := DiffDiscovery(new, new); len(c) != 0 {
+		t.Errorf("DiffDiscovery() of equal discoveries = %v", c)
+	}
+}
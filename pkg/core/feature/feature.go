@@ -8,7 +8,9 @@ package feature
 
 import (
 	"encoding/binary"
+	"fmt"
 	"io"
+	"time"
 )
 
 type FeatureCode uint16
@@ -51,7 +53,14 @@ type Locking struct {
 	MediaEncryption  bool
 	MBREnabled       bool
 	MBRDone          bool
-	MBRShadowing     bool
+	// The MBR Shadowing Not Supported bit, reserved and thus 0 before
+	// Opal 2.01
+	MBRShadowingNotSupported bool
+}
+
+// MBRShadowingSupported returns whether the drive supports the shadow MBR.
+func (f *Locking) MBRShadowingSupported() bool {
+	return !f.MBRShadowingNotSupported
 }
 
 type CommonSSC struct {
@@ -60,7 +69,10 @@ type CommonSSC struct {
 }
 
 type Geometry struct {
-	// TODO
+	Align                bool
+	LogicalBlockSize     uint32
+	AlignmentGranularity uint64
+	LowestAlignedLBA     uint64
 }
 type SecureMsg struct {
 	// TODO
@@ -75,7 +87,14 @@ type OpalV1 struct {
 	// TODO
 }
 type SingleUser struct {
-	// TODO
+	NumberOfLockingObjectsSupported uint32
+	// Any is set if at least one locking object is in Single User Mode
+	Any bool
+	// All is set if all locking objects are in Single User Mode
+	All bool
+	// Policy is set if only Admins may modify RangeStart/RangeLength
+	// of locking objects in Single User Mode
+	Policy bool
 }
 type DataStore struct {
 	// TODO
@@ -129,12 +148,88 @@ type BlockSID struct {
 	HardwareReset                 bool
 }
 
+// Configurable Namespace Locking Feature Descriptor (Opal Feature Set: CNL v1.00)
 type NamespaceLocking struct {
-	// TODO
+	// Range_C and Range_P bits of the descriptor
+	RangeC                bool
+	RangeP                bool
+	MaxKeyCount           uint32
+	UnusedKeyCount        uint32
+	MaxRangesPerNamespace uint32
 }
+
+// 3.1.1.6 Supported Data Removal Mechanism Feature Descriptor (Pyrite SSC v2.00)
 type DataRemoval struct {
-	// TODO
+	OperationProcessing  bool
+	OperationInterrupted bool
+	SupportedMechanisms  uint8
+	TimeFormat           uint8
+	Times                [6]uint16
+}
+
+// DataRemovalMechanism is the bit position of a data removal mechanism in
+// the DataRemoval feature as well as its value in the DataRemovalMechanism table.
+type DataRemovalMechanism uint8
+
+const (
+	DataRemovalOverwrite          DataRemovalMechanism = 0
+	DataRemovalBlockErase         DataRemovalMechanism = 1
+	DataRemovalCryptoErase        DataRemovalMechanism = 2
+	DataRemovalUnmap              DataRemovalMechanism = 3
+	DataRemovalResetWritePointers DataRemovalMechanism = 4
+	DataRemovalVendorSpecific     DataRemovalMechanism = 5
+)
+
+var dataRemovalMechanismNames = []string{
+	"overwrite",
+	"block-erase",
+	"crypto-erase",
+	"unmap",
+	"reset-write-pointers",
+	"vendor-specific",
+}
+
+func (m DataRemovalMechanism) String() string {
+	if int(m) < len(dataRemovalMechanismNames) {
+		return dataRemovalMechanismNames[m]
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(m))
+}
+
+// DataRemovalMechanismFromName is the inverse of DataRemovalMechanism.String.
+func DataRemovalMechanismFromName(name string) (DataRemovalMechanism, bool) {
+	for i, n := range dataRemovalMechanismNames {
+		if n == name {
+			return DataRemovalMechanism(i), true
+		}
+	}
+	return 0, false
+}
+
+// Mechanisms returns all supported data removal mechanisms.
+func (d *DataRemoval) Mechanisms() []DataRemovalMechanism {
+	var res []DataRemovalMechanism
+	for i := range d.Times {
+		if d.SupportedMechanisms&(1<<i) > 0 {
+			res = append(res, DataRemovalMechanism(i))
+		}
+	}
+	return res
+}
+
+// Time returns the time the drive reports to complete a data removal with the
+// given mechanism, or zero if not reported.
+func (d *DataRemoval) Time(m DataRemovalMechanism) time.Duration {
+	if int(m) >= len(d.Times) {
+		return 0
+	}
+	unit := 2 * time.Second
+	if d.TimeFormat&(1<<m) > 0 {
+		unit = 2 * time.Minute
+	}
+	return time.Duration(d.Times[m]) * unit
 }
+
 type NamespaceGeometry struct {
 	// TODO
 }
@@ -176,12 +271,26 @@ func ReadLockingFeature(rdr io.Reader) (*Locking, error) {
 	f.MBREnabled = raw&0x10 > 0
 	f.MBRDone = raw&0x20 > 0
 	// If MBR Shadowing feature is absent (i.e., is not supported), then this bit SHALL be 1.
-	f.MBRShadowing = raw&0x40 < 1
+	f.MBRShadowingNotSupported = raw&0x40 > 0
 	return f, nil
 }
 
 func ReadGeometryFeature(rdr io.Reader) (*Geometry, error) {
 	f := &Geometry{}
+	raw := struct {
+		Align                uint8
+		_                    [7]byte
+		LogicalBlockSize     uint32
+		AlignmentGranularity uint64
+		LowestAlignedLBA     uint64
+	}{}
+	if err := binary.Read(rdr, binary.BigEndian, &raw); err != nil {
+		return nil, err
+	}
+	f.Align = raw.Align&0x1 > 0
+	f.LogicalBlockSize = raw.LogicalBlockSize
+	f.AlignmentGranularity = raw.AlignmentGranularity
+	f.LowestAlignedLBA = raw.LowestAlignedLBA
 	return f, nil
 }
 
@@ -205,6 +314,16 @@ func ReadOpalV1Feature(rdr io.Reader) (*OpalV1, error) {
 
 func ReadSingleUserFeature(rdr io.Reader) (*SingleUser, error) {
 	f := &SingleUser{}
+	if err := binary.Read(rdr, binary.BigEndian, &f.NumberOfLockingObjectsSupported); err != nil {
+		return nil, err
+	}
+	var raw uint8
+	if err := binary.Read(rdr, binary.BigEndian, &raw); err != nil {
+		return nil, err
+	}
+	f.Any = raw&0x1 > 0
+	f.All = raw&0x2 > 0
+	f.Policy = raw&0x4 > 0
 	return f, nil
 }
 
@@ -274,11 +393,41 @@ func ReadBlockSIDFeature(rdr io.Reader) (*BlockSID, error) {
 
 func ReadNamespaceLockingFeature(rdr io.Reader) (*NamespaceLocking, error) {
 	f := &NamespaceLocking{}
+	raw := struct {
+		Flags                 uint8
+		_                     [3]byte
+		MaxKeyCount           uint32
+		UnusedKeyCount        uint32
+		MaxRangesPerNamespace uint32
+	}{}
+	if err := binary.Read(rdr, binary.BigEndian, &raw); err != nil {
+		return nil, err
+	}
+	f.RangeC = raw.Flags&0x80 > 0
+	f.RangeP = raw.Flags&0x40 > 0
+	f.MaxKeyCount = raw.MaxKeyCount
+	f.UnusedKeyCount = raw.UnusedKeyCount
+	f.MaxRangesPerNamespace = raw.MaxRangesPerNamespace
 	return f, nil
 }
 
 func ReadDataRemovalFeature(rdr io.Reader) (*DataRemoval, error) {
 	f := &DataRemoval{}
+	raw := struct {
+		_          uint8
+		Operation  uint8
+		Supported  uint8
+		TimeFormat uint8
+		Times      [6]uint16
+	}{}
+	if err := binary.Read(rdr, binary.BigEndian, &raw); err != nil {
+		return nil, err
+	}
+	f.OperationProcessing = raw.Operation&0x1 > 0
+	f.OperationInterrupted = raw.Operation&0x2 > 0
+	f.SupportedMechanisms = raw.Supported
+	f.TimeFormat = raw.TimeFormat
+	f.Times = raw.Times
 	return f, nil
 }
 
@@ -9,6 +9,7 @@ package method
 import (
 	"bytes"
 	"errors"
+	"fmt"
 
 	"github.com/open-source-firmware/go-tcg-storage/pkg/core/stream"
 	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
@@ -59,6 +60,42 @@ var (
 	ErrMethodStatusAuthorityLockedOut  = MethodStatusCodeMap[0x12]
 )
 
+// MethodStatusError is returned for a method that completed with a status
+// other than SUCCESS. It matches the errors of MethodStatusCodeMap with
+// errors.Is.
+type MethodStatusError struct {
+	Status uint
+	// The reserved values following the status code. Some drives report
+	// vendor specific data in them.
+	Reserved stream.List
+}
+
+func (e *MethodStatusError) Error() string {
+	msg := fmt.Sprintf("method returned unknown status code 0x%02x", e.Status)
+	if err, ok := MethodStatusCodeMap[e.Status]; ok {
+		msg = err.Error()
+	}
+	if ReservedSet(e.Reserved) {
+		msg += fmt.Sprintf(" (reserved values %s)", e.Reserved)
+	}
+	return msg
+}
+
+func (e *MethodStatusError) Unwrap() error {
+	return MethodStatusCodeMap[e.Status]
+}
+
+// ReservedSet reports whether any of the reserved values of a status code
+// list is not zero.
+func ReservedSet(reserved stream.List) bool {
+	for _, v := range reserved {
+		if n, ok := v.(uint); !ok || n != 0 {
+			return true
+		}
+	}
+	return false
+}
+
 type Call interface {
 	MarshalBinary() ([]byte, error)
 	IsEOS() bool
@@ -190,6 +227,25 @@ func (m *MethodCall) MarshalBinary() ([]byte, error) {
 	return mn.buf.Bytes(), nil
 }
 
+// String formats the method call for debugging, showing the invoking ID and
+// method by name followed by the parameters, with credentials redacted, e.g.
+//
+//	ThisSP.Authenticate[Admin1, 0=<redacted>]
+func (m *MethodCall) String() string {
+	b, err := m.MarshalBinary()
+	if err != nil {
+		return fmt.Sprintf("<incomplete method call: %v>", err)
+	}
+	l, err := stream.Decode(b)
+	if err != nil || len(l) < 4 {
+		return fmt.Sprintf("<undecodable method call: %x>", b)
+	}
+	iid, _ := l[1].([]byte)
+	mid, _ := l[2].([]byte)
+	args, _ := l[3].(stream.List)
+	return FormatCall(iid, mid, args)
+}
+
 type EOSMethodCall struct {
 }
 
@@ -0,0 +1,113 @@
+package method
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/stream"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+func TestMethodStatusError(t *testing.T) {
+	for _, tc := range []struct {
+		err  *MethodStatusError
+		is   error
+		want string
+	}{
+		{&MethodStatusError{Status: 0x01, Reserved: stream.List{uint(0), uint(0)}}, ErrMethodStatusNotAuthorized,
+			"method returned status NOT_AUTHORIZED"},
+		{&MethodStatusError{Status: 0x0C, Reserved: stream.List{uint(0x12), uint(0)}}, ErrMethodStatusInvalidParameter,
+			"method returned status INVALID_PARAMETER (reserved values [18, 0])"},
+		{&MethodStatusError{Status: 0x20}, nil,
+			"method returned unknown status code 0x20"},
+	} {
+		if got := tc.err.Error(); got != tc.want {
+			t.Errorf("Error() = %q, want %q", got, tc.want)
+		}
+		if tc.is != nil && !errors.Is(tc.err, tc.is) {
+			t.Errorf("%v does not match %v", tc.err, tc.is)
+		}
+	}
+}
+
+func TestMethodCallString(t *testing.T) {
+	pin := []byte("password")
+	for _, tc := range []struct {
+		name string
+		mc   func() *MethodCall
+		want string
+	}{
+		{"Authenticate", func() *MethodCall {
+			mc := NewMethodCall(uid.InvokeIDThisSP, uid.OpalAuthenticate, 0)
+			mc.Bytes(uid.LockingAuthorityAdmin1[:])
+			mc.StartOptionalParameter(0, "Challenge")
+			mc.Bytes(pin)
+			mc.EndOptionalParameter()
+			return mc
+		}, "ThisSP.Authenticate[Admin1, 0=<redacted>]"},
+		{"Enterprise Authenticate", func() *MethodCall {
+			mc := NewMethodCall(uid.InvokeIDThisSP, uid.OpalEnterpriseAuthenticate, MethodFlagOptionalAsName)
+			mc.Bytes(uid.LockingAuthorityAdmin1[:])
+			mc.StartOptionalParameter(0, "Challenge")
+			mc.Bytes(pin)
+			mc.EndOptionalParameter()
+			return mc
+		}, `ThisSP.Authenticate[Admin1, "Challenge"=<redacted>]`},
+		{"StartSession", func() *MethodCall {
+			mc := NewMethodCall(uid.InvokeIDSMU, uid.MethodIDSMStartSession, 0)
+			mc.UInt(1)
+			mc.Bytes(uid.LockingSP[:])
+			mc.Bool(true)
+			mc.StartOptionalParameter(0, "HostChallenge")
+			mc.Bytes(pin)
+			mc.EndOptionalParameter()
+			return mc
+		}, "SMUID.StartSession[1, LockingSP, 1, 0=<redacted>]"},
+		{"Set C_PIN", func() *MethodCall {
+			mc := NewMethodCall(uid.InvokingID(uid.Admin_C_PIN_SIDRow), uid.OpalSet, 0)
+			mc.StartOptionalParameter(1, "Values")
+			mc.StartList()
+			mc.StartOptionalParameter(3, "PIN")
+			mc.Bytes(pin)
+			mc.EndOptionalParameter()
+			mc.EndList()
+			mc.EndOptionalParameter()
+			return mc
+		}, "C_PIN_SID.Set[1=[3=<redacted>]]"},
+		{"Enterprise Set C_PIN", func() *MethodCall {
+			mc := NewMethodCall(uid.InvokingID(uid.Admin_C_Pin_EraseMaster), uid.OpalEnterpriseSet, MethodFlagOptionalAsName)
+			mc.StartList()
+			mc.EndList()
+			mc.StartList()
+			mc.StartList()
+			mc.StartOptionalParameter(3, "PIN")
+			mc.Bytes(pin)
+			mc.EndOptionalParameter()
+			mc.EndList()
+			mc.EndList()
+			return mc
+		}, `C_PIN_EraseMaster.Set[[], [["PIN"=<redacted>]]]`},
+		{"Set other table", func() *MethodCall {
+			mc := NewMethodCall(uid.InvokingID(uid.GlobalRangeRowUID), uid.OpalSet, 0)
+			mc.StartOptionalParameter(1, "Values")
+			mc.StartList()
+			mc.StartOptionalParameter(3, "RangeStart")
+			mc.UInt(8)
+			mc.EndOptionalParameter()
+			mc.EndList()
+			mc.EndOptionalParameter()
+			return mc
+		}, "Locking_GlobalRange.Set[1=[3=8]]"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.mc().String()
+			if got != tc.want {
+				t.Errorf("String() = %s; want %s", got, tc.want)
+			}
+			if strings.Contains(got, string(pin)) {
+				t.Errorf("String() = %s contains the PIN", got)
+			}
+		})
+	}
+}
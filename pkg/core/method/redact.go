@@ -0,0 +1,71 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Formatting of method calls without the credentials they carry
+
+package method
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/stream"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+// Redacted takes the place of a credential in formatted method calls.
+type Redacted struct{}
+
+func (Redacted) String() string {
+	return "<redacted>"
+}
+
+// FormatCall formats a method call for debugging like MethodCall.String.
+// The challenges of StartSession and Authenticate and the PIN column of a Set
+// on the C_PIN table are replaced by Redacted, so that passwords do not end
+// up in logs and traces.
+func FormatCall(iid, mid []byte, args stream.List) string {
+	return fmt.Sprintf("%s.%s%s", uid.Name(iid), uid.Name(mid), redactArgs(iid, mid, args))
+}
+
+// redactArgs returns a copy of the arguments of a method call with the
+// credentials replaced by Redacted, see FormatCall.
+func redactArgs(iid, mid []byte, args stream.List) stream.List {
+	switch {
+	case bytes.Equal(mid, uid.MethodIDSMStartSession[:]):
+		return redactNamed(args, 0, "HostChallenge", false)
+	case bytes.Equal(mid, uid.OpalAuthenticate[:]) || bytes.Equal(mid, uid.OpalEnterpriseAuthenticate[:]):
+		return redactNamed(args, 0, "Challenge", false)
+	case (bytes.Equal(mid, uid.OpalSet[:]) || bytes.Equal(mid, uid.OpalEnterpriseSet[:])) &&
+		len(iid) == len(uid.Admin_C_PINTable) && bytes.Equal(iid[:4], uid.Admin_C_PINTable[:4]):
+		// The row values are nested in the Values parameter, or in plain
+		// lists on Enterprise drives
+		return redactNamed(args, 3, "PIN", true)
+	}
+	return args
+}
+
+// redactNamed replaces the values of the named arguments with the given
+// number or name by Redacted, with nested lists as well if deep is set.
+func redactNamed(l stream.List, id uint, name string, deep bool) stream.List {
+	res := append(stream.List{}, l...)
+	for i := 0; i < len(res); i++ {
+		if deep {
+			if v, ok := res[i].(stream.List); ok {
+				res[i] = redactNamed(v, id, name, deep)
+				continue
+			}
+		}
+		if i+3 >= len(res) || !stream.EqualToken(res[i], stream.StartName) || !stream.EqualToken(res[i+3], stream.EndName) {
+			continue
+		}
+		if stream.EqualUInt(res[i+1], id) || stream.EqualBytes(res[i+1], []byte(name)) {
+			res[i+2] = Redacted{}
+		} else if v, ok := res[i+2].(stream.List); ok && deep {
+			res[i+2] = redactNamed(v, id, name, deep)
+		}
+		i += 3
+	}
+	return res
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Reports protocol-level events of the traffic to and from a TPer, e.g. to
+// export metrics
+
+package core
+
+import (
+	"sync"
+	"time"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/stream"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive"
+)
+
+// Observer receives protocol-level events of a device. It has to be safe for
+// concurrent use if it is shared between devices. See the metrics package for
+// an implementation exporting Prometheus metrics.
+type Observer interface {
+	// IFSend and IFRecv are called for every transfer with the size of the
+	// payload, err is set if the transfer failed.
+	IFSend(proto drive.SecurityProtocol, bytes int, err error)
+	IFRecv(proto drive.SecurityProtocol, bytes int, err error)
+	// ReceiveRetry is called for every IF-RECV that had to be repeated as
+	// the TPer had not prepared the response yet.
+	ReceiveRetry()
+	// MethodStatus is called for every method that returned a status, with
+	// the name of the method (see the trace output) and the status code.
+	MethodStatus(method string, status uint, latency time.Duration)
+	// SessionOpened and SessionClosed are called when the TPer confirmed a
+	// StartSession or an EndOfSession, with the time it took.
+	SessionOpened(latency time.Duration)
+	SessionClosed(latency time.Duration)
+}
+
+// Report the events of a device to the observer.
+func WithObserver(o Observer) CoreOpt {
+	return func(cc *coreConfig) {
+		cc.observer = o
+	}
+}
+
+type observeDrive struct {
+	drive.DriveIntf
+	o Observer
+
+	// The call waiting for its response. The communication is synchronous,
+	// so there is at most one per ComID.
+	mu      sync.Mutex
+	pending map[uint16]pendingCall
+}
+
+type pendingCall struct {
+	method string
+	eos    bool
+	start  time.Time
+}
+
+// Wrap a drive so that all traffic passing through it is reported to the observer.
+func NewObserveDrive(d drive.DriveIntf, o Observer) drive.DriveIntf {
+	return &observeDrive{DriveIntf: d, o: o, pending: map[uint16]pendingCall{}}
+}
+
+func (d *observeDrive) IFSend(proto drive.SecurityProtocol, sps uint16, data []byte) error {
+	err := d.DriveIntf.IFSend(proto, sps, data)
+	d.o.IFSend(proto, len(data), err)
+	if err != nil || proto != drive.SecurityProtocolTCGManagement {
+		return err
+	}
+	_, payload := comPacketPayload(data)
+	call, err := stream.Decode(payload)
+	if err != nil || len(call) == 0 {
+		return nil
+	}
+	pc := pendingCall{start: time.Now()}
+	switch {
+	case stream.EqualToken(call[0], stream.EndOfSession):
+		pc.eos = true
+	case len(call) >= 3 && stream.EqualToken(call[0], stream.Call):
+		mid, _ := call[2].([]byte)
+		pc.method = uid.Name(mid)
+	default:
+		return nil
+	}
+	d.mu.Lock()
+	d.pending[sps] = pc
+	d.mu.Unlock()
+	return nil
+}
+
+func (d *observeDrive) IFRecv(proto drive.SecurityProtocol, sps uint16, data *[]byte) error {
+	err := d.DriveIntf.IFRecv(proto, sps, data)
+	if err != nil {
+		d.o.IFRecv(proto, 0, err)
+		return err
+	}
+	d.o.IFRecv(proto, len(*data), nil)
+	if proto != drive.SecurityProtocolTCGManagement || sps == uint16(ComIDDiscoveryL0) {
+		return nil
+	}
+
+	d.mu.Lock()
+	pc, ok := d.pending[sps]
+	d.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	_, payload := comPacketPayload(*data)
+	if len(payload) == 0 {
+		d.o.ReceiveRetry()
+		return nil
+	}
+	d.mu.Lock()
+	delete(d.pending, sps)
+	d.mu.Unlock()
+
+	latency := time.Since(pc.start)
+	reply, err := stream.Decode(payload)
+	if err != nil || len(reply) == 0 {
+		return nil
+	}
+	if pc.eos {
+		if stream.EqualToken(reply[0], stream.EndOfSession) {
+			d.o.SessionClosed(latency)
+		}
+		return nil
+	}
+	if len(reply) < 2 || !stream.EqualToken(reply[len(reply)-2], stream.EndOfData) {
+		return nil
+	}
+	status, ok := reply[len(reply)-1].(stream.List)
+	if !ok || len(status) == 0 {
+		return nil
+	}
+	sc, ok := status[0].(uint)
+	if !ok {
+		return nil
+	}
+	d.o.MethodStatus(pc.method, sc, latency)
+	if pc.method == "StartSession" && sc == 0 {
+		d.o.SessionOpened(latency)
+	}
+	return nil
+}
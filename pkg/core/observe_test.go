@@ -0,0 +1,91 @@
+package core
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive"
+)
+
+type recordingObserver struct {
+	events []string
+}
+
+func (o *recordingObserver) IFSend(proto drive.SecurityProtocol, bytes int, err error) {
+	o.events = append(o.events, "send")
+}
+func (o *recordingObserver) IFRecv(proto drive.SecurityProtocol, bytes int, err error) {
+	o.events = append(o.events, "recv")
+}
+func (o *recordingObserver) ReceiveRetry() { o.events = append(o.events, "retry") }
+func (o *recordingObserver) MethodStatus(method string, status uint, latency time.Duration) {
+	o.events = append(o.events, fmt.Sprintf("%s 0x%02x", method, status))
+}
+func (o *recordingObserver) SessionOpened(latency time.Duration) {
+	o.events = append(o.events, "opened")
+}
+func (o *recordingObserver) SessionClosed(latency time.Duration) {
+	o.events = append(o.events, "closed")
+}
+
+// Returns the queued ComPackets on IF-RECV, or nothing once they are used up.
+type replyDrive struct {
+	nopDrive
+	sent    [][]byte
+	replies [][]byte
+}
+
+func (d *replyDrive) IFSend(proto drive.SecurityProtocol, sps uint16, data []byte) error {
+	d.sent = append(d.sent, append([]byte{}, data...))
+	return nil
+}
+
+func (d *replyDrive) IFRecv(proto drive.SecurityProtocol, sps uint16, data *[]byte) error {
+	for i := range *data {
+		(*data)[i] = 0
+	}
+	if len(d.replies) > 0 {
+		copy(*data, d.replies[0])
+		d.replies = d.replies[1:]
+	}
+	return nil
+}
+
+func TestObserveMethodStatus(t *testing.T) {
+	s := &Session{ComID: 0x7fe, TSN: 42}
+	// Let the communication build the ComPacket of the reply
+	rd := &replyDrive{}
+	reply := []byte{0xf9 /* EndOfData */, 0xf0, 0x01 /* NOT_AUTHORIZED */, 0x00, 0x00, 0xf1}
+	if err := NewPlainCommunication(rd, InitialHostProperties, InitialTPerProperties).Send(s, reply); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	rd.replies, rd.sent = rd.sent, nil
+
+	o := &recordingObserver{}
+	d := NewObserveDrive(rd, o)
+	mc := method.NewMethodCall(uid.InvokeIDThisSP, uid.OpalAuthenticate, 0)
+	b, err := mc.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	if err := NewPlainCommunication(d, InitialHostProperties, InitialTPerProperties).Send(s, b); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	buf := make([]byte, 2048)
+	// The first IF-RECV finds the reply not yet prepared
+	rd.replies = append([][]byte{nil}, rd.replies...)
+	for i := 0; i < 2; i++ {
+		if err := d.IFRecv(drive.SecurityProtocolTCGManagement, 0x7fe, &buf); err != nil {
+			t.Fatalf("IFRecv failed: %v", err)
+		}
+	}
+
+	want := []string{"send", "recv", "retry", "recv", "Authenticate 0x01"}
+	if !reflect.DeepEqual(o.events, want) {
+		t.Errorf("observed %q; want %q", o.events, want)
+	}
+}
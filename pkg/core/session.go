@@ -11,6 +11,7 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
+	"sync"
 	"time"
 
 	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
@@ -21,11 +22,12 @@ import (
 
 var (
 	ErrTPerSyncNotSupported        = errors.New("synchronous operation not supported by TPer")
-	ErrTPerBufferMgmtNotSupported  = errors.New("TPer supports buffer management, but that is not implemented in this library")
 	ErrInvalidPropertiesResponse   = errors.New("response was not the expected Properties call format")
 	ErrInvalidStartSessionResponse = errors.New("response was not the expected SyncSession format")
 	ErrPropertiesCallFailed        = errors.New("the properties call returned non-zero")
 	ErrSessionAlreadyClosed        = errors.New("the session has been closed by us")
+	ErrNoResponse                  = errors.New("the TPer reports that no response to the method will follow")
+	ErrMethodSkipped               = errors.New("the TPer did not respond to the method, as a previous one of the batch failed")
 
 	sessionRand *rand.Rand
 )
@@ -34,6 +36,16 @@ const (
 	DefaultMaxComPacketSize uint = 1024 * 1024
 	DefaultReceiveRetries        = 100
 	DefaultReceiveInterval       = 10 * time.Millisecond
+	// How long to keep waiting for a response while the TPer reports that
+	// it is still processing the method, e.g. during a Revert.
+	DefaultReceiveBusyTimeout = 10 * time.Minute
+
+	// First interval to poll for a response at, doubled up to the
+	// ReceiveInterval of the session with every empty response.
+	minReceiveInterval = 100 * time.Microsecond
+	// Number of polls in a row reporting an OutstandingData of 0 after which
+	// no response is expected anymore.
+	maxIdlePolls = 3
 )
 
 type ProtocolLevel uint
@@ -65,12 +77,30 @@ type Session struct {
 	ComID          ComID
 	TSN, HSN       int
 	// See "3.2.3.3.1.2 SeqNumber"
-	SeqLastXmit     int
-	SeqLastAcked    int
-	SeqNextExpected int
-	ReadOnly        bool // Ignored for Control Sessions
-	ReceiveRetries  int
-	ReceiveInterval time.Duration
+	SeqLastXmit        int
+	SeqLastAcked       int
+	SeqNextExpected    int
+	ReadOnly           bool // Ignored for Control Sessions
+	ReceiveRetries     int
+	ReceiveInterval    time.Duration
+	ReceiveBusyTimeout time.Duration
+	// Session and transaction timeouts requested in StartSession, zero for
+	// the defaults of the TPer. Limited to the range reported by the TPer.
+	SessionTimeout time.Duration
+	TransTimeout   time.Duration
+	// OutstandingData and MinTransfer of the last ComPacket received
+	outstandingData uint32
+	minTransfer     uint32
+	// Credit based flow control, used on sessions with TPers that support
+	// buffer management. credit is the number of bytes the host may still
+	// send to the TPer, consumed the number of bytes received from the TPer
+	// that have not been granted back to it yet.
+	flowControl bool
+	credit      uint
+	consumed    uint
+	// Serializes the methods of all sessions on the ComID of a control
+	// session, see ControlSession.CloseAll
+	exec *sync.Mutex
 }
 
 type ControlSession struct {
@@ -78,6 +108,13 @@ type ControlSession struct {
 	HostProperties           HostProperties
 	TPerProperties           TPerProperties
 	MaxComPacketSizeOverride uint
+	// Size the ComPackets sent are padded to a multiple of, 0 to not pad
+	// them. Defaults to what the drive declares, see drive.Padder.
+	Padding    uint
+	bufferMgmt bool
+	// Sessions that have been started and not closed yet, by TSN
+	mu   sync.Mutex
+	open map[int]Session
 }
 
 type HostProperties struct {
@@ -120,6 +157,61 @@ type TPerProperties struct {
 	Asynchronous             bool
 }
 
+// Timeouts reported by the TPer in its properties, zero if not reported.
+// See "5.2.2.1.1 TPer Properties".
+type Timeouts struct {
+	DefSession time.Duration
+	MinSession time.Duration
+	MaxSession time.Duration
+	DefTrans   time.Duration
+	MinTrans   time.Duration
+	MaxTrans   time.Duration
+}
+
+// Timeouts returns the session and transaction timeouts of the TPer.
+func (tp *TPerProperties) Timeouts() Timeouts {
+	ms := func(v *uint) time.Duration {
+		if v == nil {
+			return 0
+		}
+		return time.Duration(*v) * time.Millisecond
+	}
+	return Timeouts{
+		DefSession: ms(tp.DefSessionTimeout),
+		MinSession: ms(tp.MinSessionTimeout),
+		MaxSession: ms(tp.MaxSessionTimeout),
+		DefTrans:   ms(tp.DefTransTimeout),
+		MinTrans:   ms(tp.MinTransTimeout),
+		MaxTrans:   ms(tp.MaxTransTimeout),
+	}
+}
+
+func clampTimeout(d, min, max time.Duration) time.Duration {
+	if d == 0 {
+		return 0
+	}
+	if min > 0 && d < min {
+		return min
+	}
+	// A maximum of zero means no limit
+	if max > 0 && d > max {
+		return max
+	}
+	return d
+}
+
+func (t Timeouts) clampSession(d time.Duration) time.Duration {
+	return clampTimeout(d, t.MinSession, t.MaxSession)
+}
+
+func (t Timeouts) clampTrans(d time.Duration) time.Duration {
+	return clampTimeout(d, t.MinTrans, t.MaxTrans)
+}
+
+func milliseconds(d time.Duration) uint {
+	return uint(d / time.Millisecond)
+}
+
 var (
 	// Table 168: "Communications Initial Assumptions"
 	InitialTPerProperties = TPerProperties{
@@ -168,6 +260,14 @@ func WithMaxComPacketSize(size uint) ControlSessionOpt {
 	}
 }
 
+// WithPadding overrides the size the ComPackets sent are padded to a multiple
+// of, 0 disables the padding.
+func WithPadding(size uint) ControlSessionOpt {
+	return func(s *ControlSession) {
+		s.Padding = size
+	}
+}
+
 func WithReceiveTimeout(retries int, interval time.Duration) ControlSessionOpt {
 	return func(s *ControlSession) {
 		s.ReceiveRetries = retries
@@ -175,6 +275,31 @@ func WithReceiveTimeout(retries int, interval time.Duration) ControlSessionOpt {
 	}
 }
 
+// WithReceiveBusyTimeout sets how long to wait for a response beyond the
+// receive timeout while the TPer reports that it is still processing the
+// method.
+func WithReceiveBusyTimeout(timeout time.Duration) ControlSessionOpt {
+	return func(s *ControlSession) {
+		s.ReceiveBusyTimeout = timeout
+	}
+}
+
+// WithSessionTimeout asks the TPer to abort the session after it has been
+// idle for the given time.
+func WithSessionTimeout(timeout time.Duration) SessionOpt {
+	return func(s *Session) {
+		s.SessionTimeout = timeout
+	}
+}
+
+// WithTransTimeout asks the TPer to abort transactions of the session that
+// take longer than the given time.
+func WithTransTimeout(timeout time.Duration) SessionOpt {
+	return func(s *Session) {
+		s.TransTimeout = timeout
+	}
+}
+
 func WithHSN(hsn int) SessionOpt {
 	return func(s *Session) {
 		s.HSN = hsn
@@ -211,31 +336,32 @@ func NewControlSession(d drive.DriveIntf, d0 *Level0Discovery, opts ...ControlSe
 		return nil, ErrTPerSyncNotSupported
 	}
 
-	if d0.TPer.BufferMgmtSupported {
-		return nil, ErrTPerBufferMgmtNotSupported
-	}
-
 	hp := InitialHostProperties
 	tp := InitialTPerProperties
 	c := NewPlainCommunication(d, hp, tp)
 	s := &ControlSession{
 		Session: Session{
-			d:               d,
-			c:               c,
-			ComID:           ComIDInvalid,
-			TSN:             0,
-			HSN:             0,
-			ReceiveRetries:  DefaultReceiveRetries,
-			ReceiveInterval: DefaultReceiveInterval,
+			d:                  d,
+			c:                  c,
+			ComID:              ComIDInvalid,
+			TSN:                0,
+			HSN:                0,
+			ReceiveRetries:     DefaultReceiveRetries,
+			ReceiveInterval:    DefaultReceiveInterval,
+			ReceiveBusyTimeout: DefaultReceiveBusyTimeout,
+			exec:               &sync.Mutex{},
 		},
 		HostProperties:           hp,
 		TPerProperties:           tp,
 		MaxComPacketSizeOverride: DefaultMaxComPacketSize,
+		Padding:                  drivePadding(d),
+		bufferMgmt:               d0.TPer.BufferMgmtSupported,
 	}
 
 	for _, opt := range opts {
 		opt(s)
 	}
+	c.padding = s.Padding
 
 	if s.ComID == ComIDInvalid {
 		var err error
@@ -271,6 +397,8 @@ func NewControlSession(d drive.DriveIntf, d0 *Level0Discovery, opts ...ControlSe
 	rhp.MaxAggTokenSize = rhp.MaxComPacketSize - 20 - 24 - 12
 	rhp.MaxSubpackets = 1024
 	rhp.MaxPackets = 1024
+	// Responses to several methods at once, see ExecuteMethods
+	rhp.MaxMethods = 1024
 
 	// TODO: These are not fully implemented yet, so let's not advertise them
 	// rhp.SequenceNumbers = true
@@ -283,7 +411,7 @@ func NewControlSession(d drive.DriveIntf, d0 *Level0Discovery, opts ...ControlSe
 	}
 
 	// Update the communication with the active properties
-	s.c = NewPlainCommunication(d, hp, tp)
+	s.c = &plainCom{d, hp, tp, s.Padding}
 	s.HostProperties = hp
 	s.TPerProperties = tp
 	return s, nil
@@ -338,16 +466,18 @@ func (cs *ControlSession) NewSession(spid uid.SPID, opts ...SessionOpt) (*Sessio
 	// then and the call to NewSession() we would be out of sync. Oh well...
 
 	s := &Session{
-		MethodFlags:     cs.MethodFlags,
-		ProtocolLevel:   cs.ProtocolLevel,
-		d:               cs.d,
-		c:               cs.c,
-		ControlSession:  cs,
-		ComID:           cs.ComID,
-		TSN:             0,
-		HSN:             -1,
-		ReceiveRetries:  cs.ReceiveRetries,
-		ReceiveInterval: cs.ReceiveInterval,
+		MethodFlags:        cs.MethodFlags,
+		ProtocolLevel:      cs.ProtocolLevel,
+		d:                  cs.d,
+		c:                  cs.c,
+		ControlSession:     cs,
+		ComID:              cs.ComID,
+		TSN:                0,
+		HSN:                -1,
+		ReceiveRetries:     cs.ReceiveRetries,
+		ReceiveInterval:    cs.ReceiveInterval,
+		ReceiveBusyTimeout: cs.ReceiveBusyTimeout,
+		exec:               cs.exec,
 	}
 
 	for _, opt := range opts {
@@ -362,31 +492,55 @@ func (cs *ControlSession) NewSession(spid uid.SPID, opts ...SessionOpt) (*Sessio
 		s.HSN = int(sessionRand.Int31())
 	}
 
-	mc := method.NewMethodCall(uid.InvokeIDSMU, uid.MethodIDSMStartSession, s.MethodFlags)
-	mc.UInt(uint(s.HSN))
-	mc.Bytes(spid[:])
-	mc.Bool(!s.ReadOnly)
-	// "5.3.4.1.2.1 Anybody"
-	// > The Anybody authority is always considered "authenticated" within a session, even if the Anybody
-	// > authority was not specifically called out during session startup.
-	// Thus, we do not specify any authority here and let the users call ThisSP_Authenticate
-	// to elevate the session.
+	startSession := func(sessionTimeout time.Duration) method.Call {
+		mc := method.NewMethodCall(uid.InvokeIDSMU, uid.MethodIDSMStartSession, s.MethodFlags)
+		mc.UInt(uint(s.HSN))
+		mc.Bytes(spid[:])
+		mc.Bool(!s.ReadOnly)
+		// "5.3.4.1.2.1 Anybody"
+		// > The Anybody authority is always considered "authenticated" within a session, even if the Anybody
+		// > authority was not specifically called out during session startup.
+		// Thus, we do not specify any authority here and let the users call ThisSP_Authenticate
+		// to elevate the session.
+		if sessionTimeout > 0 {
+			mc.StartOptionalParameter(5, "SessionTimeout")
+			mc.UInt(milliseconds(sessionTimeout))
+			mc.EndOptionalParameter()
+		}
+		if s.TransTimeout > 0 {
+			mc.StartOptionalParameter(6, "TransTimeout")
+			mc.UInt(milliseconds(s.TransTimeout))
+			mc.EndOptionalParameter()
+		}
+		if cs.bufferMgmt {
+			// TPers supporting buffer management may enforce credit based flow
+			// control, grant them credit for a full ComPacket to respond with.
+			mc.StartOptionalParameter(7, "InitialCredit")
+			mc.UInt(cs.HostProperties.MaxComPacketSize)
+			mc.EndOptionalParameter()
+		}
+		return mc
+	}
 
-	basemc := mc.Clone()
-	if s.ProtocolLevel == ProtocolLevelEnterprise {
+	to := cs.TPerProperties.Timeouts()
+	sessionTimeout := to.clampSession(s.SessionTimeout)
+	defaultTimeout := false
+	if sessionTimeout == 0 && s.ProtocolLevel == ProtocolLevelEnterprise {
 		// sedutil recommends setting a timeout for session on Enterprise protocol
 		// level. For normal Core devices I can't get it to work (INVALID_PARAMETER)
 		// so only do it for Enterprise drives for now.
-		mc.StartOptionalParameter(5, "SessionTimeout")
-		mc.UInt(60000 /* 60 sec */) // Match it to the ATA implementation of sedutil
-		mc.EndOptionalParameter()
+		sessionTimeout = 60 * time.Second // Match it to the ATA implementation of sedutil
+		defaultTimeout = true
 	}
-
-	// Try with the method call with the optional parameters first,
-	// and if that fails fall back to the basic method call (basemc).
-	resp, err := cs.ExecuteMethod(mc)
-	if errors.Is(err, method.ErrMethodStatusInvalidParameter) {
-		resp, err = cs.ExecuteMethod(basemc)
+	s.TransTimeout = to.clampTrans(s.TransTimeout)
+
+	// Try with the default session timeout first, and if that fails fall back
+	// to the method call without it. Timeouts requested by the caller are
+	// not dropped.
+	resp, err := cs.ExecuteMethod(startSession(sessionTimeout))
+	if errors.Is(err, method.ErrMethodStatusInvalidParameter) && defaultTimeout {
+		sessionTimeout = 0
+		resp, err = cs.ExecuteMethod(startSession(0))
 	}
 	if err != nil {
 		return nil, err
@@ -412,16 +566,37 @@ func (cs *ControlSession) NewSession(spid uid.SPID, opts ...SessionOpt) (*Sessio
 	hsn, ok1 := params[0].(uint)
 	tsn, ok2 := params[1].(uint)
 	// TODO: other properties may be returned here
-	// TODO: Send InitialCredits if required
 
 	if !ok1 || !ok2 || int(hsn) != s.HSN {
 		return nil, ErrInvalidStartSessionResponse
 	}
 
 	s.TSN = int(tsn)
+	s.SessionTimeout = sessionTimeout
+	if credit, ok := syncSessionInitialCredit(params[2:]); ok && cs.bufferMgmt {
+		s.flowControl = true
+		s.credit = credit
+	}
+	cs.track(s)
 	return s, nil
 }
 
+// Find the InitialCredit among the optional parameters of a SyncSession
+// response, either by its number or by its name on Enterprise drives.
+func syncSessionInitialCredit(opt stream.List) (uint, bool) {
+	for i := 0; i+3 < len(opt); i++ {
+		if !stream.EqualToken(opt[i], stream.StartName) || !stream.EqualToken(opt[i+3], stream.EndName) {
+			continue
+		}
+		if !stream.EqualUInt(opt[i+1], 4) && !stream.EqualBytes(opt[i+1], []byte("InitialCredit")) {
+			continue
+		}
+		credit, ok := opt[i+2].(uint)
+		return credit, ok
+	}
+	return 0, false
+}
+
 // Fetch current Host and TPer properties, optionally changing the Host properties.
 func (cs *ControlSession) properties(rhp *HostProperties) (HostProperties, TPerProperties, error) {
 	mc := method.NewMethodCall(uid.InvokeIDSMU, uid.MethodIDSMProperties, cs.Session.MethodFlags)
@@ -494,24 +669,93 @@ func (cs *ControlSession) Close() error {
 }
 
 func (s *Session) Close() error {
-	if s.closed {
+	if s.isClosed() {
 		return ErrSessionAlreadyClosed
 	}
 	if _, err := s.ExecuteMethod(&method.EOSMethodCall{}); err != nil {
 		return err
 	}
 	s.closed = true
+	if s.ControlSession != nil {
+		s.ControlSession.untrack(s)
+	}
 	return nil
 }
 
-func (s *Session) ExecuteMethod(mc method.Call) (stream.List, error) {
-	if s.closed {
-		return nil, ErrSessionAlreadyClosed
+// Poll for the response to a method. The polling interval starts short and
+// backs off to ReceiveInterval, so that fast drives are not slowed down. The
+// response is waited for at least ReceiveRetries polls and ReceiveRetries
+// times ReceiveInterval, extended up to ReceiveBusyTimeout as long as the TPer
+// reports that it is still working on the method. An OutstandingData of 0
+// means that no response will follow, which fails the method right away
+// instead of using up the polls. As some TPers briefly report 0 while they
+// are still working, it is only taken as the final word after maxIdlePolls
+// polls in a row.
+func (s *Session) receiveResponse() ([]byte, error) {
+	start := time.Now()
+	timeout := time.Duration(s.ReceiveRetries) * s.ReceiveInterval
+	interval := minReceiveInterval
+	if interval > s.ReceiveInterval {
+		interval = s.ReceiveInterval
+	}
+	// Number of polls in a row that reported an OutstandingData of 0
+	idle := 0
+	for retries := 0; ; retries++ {
+		resp, err := s.c.Receive(s)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp) > 0 {
+			return resp, nil
+		}
+		// "3.3.10.2.1 Restrictions": An OutstandingData of 0x01 without MinTransfer
+		// means the response is still being prepared, otherwise MinTransfer is the
+		// size of the response that did not fit into the buffer.
+		if s.outstandingData > 0 && s.minTransfer > 0 {
+			return nil, fmt.Errorf("%w: response needs a transfer of %d bytes", ErrTooLargeComPacket, s.minTransfer)
+		}
+		if s.outstandingData == 0 {
+			idle++
+		} else {
+			idle = 0
+		}
+		if idle >= maxIdlePolls {
+			return nil, ErrNoResponse
+		}
+		elapsed := time.Since(start)
+		busy := s.outstandingData == 1 && elapsed < s.ReceiveBusyTimeout
+		if retries >= s.ReceiveRetries && elapsed >= timeout && !busy {
+			if idle > 0 {
+				return nil, ErrNoResponse
+			}
+			return nil, method.ErrMethodTimeout
+		}
+		time.Sleep(interval)
+		if interval *= 2; interval > s.ReceiveInterval {
+			interval = s.ReceiveInterval
+		}
 	}
+}
+
+// exchange sends the method call and returns the decoded response.
+func (s *Session) exchange(mc method.Call) (stream.List, error) {
 	b, err := mc.MarshalBinary()
 	if err != nil {
 		return nil, err
 	}
+	return s.exchangeBytes(b)
+}
+
+// exchangeBytes sends the encoded method calls and returns the decoded
+// response.
+func (s *Session) exchangeBytes(b []byte) (stream.List, error) {
+	if s.isClosed() {
+		return nil, ErrSessionAlreadyClosed
+	}
+	if s.exec != nil {
+		s.exec.Lock()
+		defer s.exec.Unlock()
+	}
 
 	// Synchronous mode specific: Ensure that there is no pending message
 	// before we start.
@@ -535,26 +779,69 @@ func (s *Session) ExecuteMethod(mc method.Call) (stream.List, error) {
 	// > response, any IF-RECV command for that ComID SHALL receive a ComPacket with a
 	// > Length field value of zero (no payload), an OutstandingData field value of 0x01, and a
 	// > MinTransfer field value of zero.
+	//
+	// An OutstandingData of zero on the other hand means that the TPer has
+	// nothing to respond with, e.g. as it discarded the method. It is only
+	// trusted once it was reported for several polls in a row, see
+	// receiveResponse.
 
-	for i := s.ReceiveRetries; i >= 0; i-- {
-		resp, err = s.c.Receive(s)
-		if err != nil {
-			return nil, err
-		}
-		if len(resp) > 0 {
-			break
+	resp, err = s.receiveResponse()
+	if err != nil {
+		return nil, err
+	}
+	return stream.Decode(resp)
+}
+
+// RawResponse is the response to a method as sent by the TPer.
+type RawResponse struct {
+	// Tokens preceding EndOfData, all tokens if there is no EndOfData
+	Tokens stream.List
+	// Status code list following EndOfData
+	Status []uint
+	// Tokens following the status code list
+	Trailing stream.List
+}
+
+// ExecuteMethodRaw executes the method and returns the response without
+// interpreting it, i.e. a status code other than success is not an error.
+// Meant for diagnostic tools and for methods not implemented by the library.
+func (s *Session) ExecuteMethodRaw(mc method.Call) (*RawResponse, error) {
+	reply, err := s.exchange(mc)
+	if err != nil {
+		return nil, err
+	}
+	r := &RawResponse{Tokens: reply}
+	for i, tok := range reply {
+		if !stream.EqualToken(tok, stream.EndOfData) {
+			continue
 		}
-		if i == 0 {
-			return nil, method.ErrMethodTimeout
+		r.Tokens, r.Trailing = reply[:i], reply[i+1:]
+		if len(r.Trailing) > 0 {
+			if status, ok := r.Trailing[0].(stream.List); ok {
+				for _, sc := range status {
+					if v, ok := sc.(uint); ok {
+						r.Status = append(r.Status, v)
+					}
+				}
+				r.Trailing = r.Trailing[1:]
+			}
 		}
-		time.Sleep(s.ReceiveInterval)
+		break
 	}
+	return r, nil
+}
 
-	reply, err := stream.Decode(resp)
+func (s *Session) ExecuteMethod(mc method.Call) (stream.List, error) {
+	reply, err := s.exchange(mc)
 	if err != nil {
 		return nil, err
 	}
+	return s.parseReply(mc, reply)
+}
 
+// parseReply checks the status of the response to a method and returns its
+// results.
+func (s *Session) parseReply(mc method.Call, reply stream.List) (stream.List, error) {
 	if mc.IsEOS() {
 		if len(reply) != 1 {
 			return nil, method.ErrReceivedUnexpectedResponse
@@ -577,7 +864,7 @@ func (s *Session) ExecuteMethod(mc method.Call) (stream.List, error) {
 		iid, ok2 := reply[1].([]byte)
 		mid, ok3 := reply[2].([]byte)
 		params, ok4 := reply[3].(stream.List)
-		if ok1 && ok2 && ok3 && ok4 &&
+		if ok1 && ok2 && ok3 && ok4 && len(params) >= 2 &&
 			tok == stream.Call &&
 			bytes.Equal(iid, uid.InvokeIDSMU[:]) &&
 			bytes.Equal(mid, uid.MethodIDSMCloseSession[:]) {
@@ -596,7 +883,7 @@ func (s *Session) ExecuteMethod(mc method.Call) (stream.List, error) {
 	// the last element should be the status code list.
 	tok, ok1 := reply[len(reply)-2].(stream.TokenType)
 	status, ok2 := reply[len(reply)-1].(stream.List)
-	if !ok1 || !ok2 || tok != stream.EndOfData {
+	if !ok1 || !ok2 || tok != stream.EndOfData || len(status) == 0 {
 		return nil, method.ErrMalformedMethodResponse
 	}
 
@@ -605,22 +892,124 @@ func (s *Session) ExecuteMethod(mc method.Call) (stream.List, error) {
 		return nil, method.ErrMalformedMethodResponse
 	}
 	if sc != method.MethodStatusSuccess {
-		err, ok := method.MethodStatusCodeMap[sc]
-		if !ok {
-			return nil, fmt.Errorf("method returned unknown status code 0x%02x", sc)
-		}
-		return nil, err
+		return nil, &method.MethodStatusError{Status: sc, Reserved: status[1:]}
 	}
 
 	return reply[:len(reply)-2], nil
 }
 
+// MethodResult is the outcome of one of the methods of ExecuteMethods.
+type MethodResult struct {
+	Result stream.List
+	Err    error
+}
+
+// Overhead of the subpackets around the method calls of a packet: the data
+// subpacket header and padding, and the credit control subpacket.
+const batchOverhead = 12 + 3 + 12 + 4
+
+// ExecuteMethods executes the methods in as few round trips as the TPer
+// allows, i.e. up to MaxMethods methods at a time if both the TPer and the
+// host support more than one. The error of each method is returned in its
+// MethodResult; methods the TPer did not respond to, e.g. as a previous
+// method failed, get ErrMethodSkipped. The returned error is only set if
+// the exchange itself failed.
+//
+// The caller is responsible for keeping the responses of the methods within
+// the MaxResponseComPacketSize of the TPer.
+func (s *Session) ExecuteMethods(mcs []*method.MethodCall) ([]MethodResult, error) {
+	maxMethods := uint(1)
+	maxPayload := 0
+	if cs := s.ControlSession; cs != nil {
+		maxMethods = cs.TPerProperties.MaxMethods
+		if cs.HostProperties.MaxMethods < maxMethods {
+			maxMethods = cs.HostProperties.MaxMethods
+		}
+		maxPayload = int(cs.TPerProperties.MaxPacketSize) - batchOverhead
+	}
+	if maxMethods < 1 {
+		maxMethods = 1
+	}
+
+	res := make([]MethodResult, 0, len(mcs))
+	for len(mcs) > 0 {
+		var batch []*method.MethodCall
+		var b []byte
+		for _, mc := range mcs {
+			if uint(len(batch)) >= maxMethods {
+				break
+			}
+			mb, err := mc.MarshalBinary()
+			if err != nil {
+				return nil, err
+			}
+			if len(batch) > 0 && len(b)+len(mb) > maxPayload {
+				break
+			}
+			batch = append(batch, mc)
+			b = append(b, mb...)
+		}
+		mcs = mcs[len(batch):]
+
+		if len(batch) == 1 {
+			result, err := s.ExecuteMethod(batch[0])
+			res = append(res, MethodResult{Result: result, Err: err})
+			continue
+		}
+		reply, err := s.exchangeBytes(b)
+		if err != nil {
+			return nil, err
+		}
+		replies := splitReplies(reply)
+		if len(replies) == 0 {
+			// Not a method response at all, e.g. the TPer closed the session
+			_, err := s.parseReply(batch[0], reply)
+			if err == nil {
+				err = method.ErrMalformedMethodResponse
+			}
+			return nil, err
+		}
+		for i, mc := range batch {
+			if i >= len(replies) {
+				res = append(res, MethodResult{Err: ErrMethodSkipped})
+				continue
+			}
+			result, err := s.parseReply(mc, replies[i])
+			res = append(res, MethodResult{Result: result, Err: err})
+		}
+	}
+	return res, nil
+}
+
+// splitReplies splits the response to several methods into the responses
+// to the single methods, each ending with EndOfData and the status list.
+func splitReplies(reply stream.List) []stream.List {
+	var replies []stream.List
+	start := 0
+	for i := 0; i+1 < len(reply); i++ {
+		if !stream.EqualToken(reply[i], stream.EndOfData) {
+			continue
+		}
+		if _, ok := reply[i+1].(stream.List); !ok {
+			continue
+		}
+		replies = append(replies, reply[start:i+2])
+		start = i + 2
+		i++
+	}
+	return replies
+}
+
 // Execute a prepared Method call but do not expect anything in return.
 func (s *Session) Notify(mc *method.MethodCall) error {
 	b, err := mc.MarshalBinary()
 	if err != nil {
 		return err
 	}
+	if s.exec != nil {
+		s.exec.Lock()
+		defer s.exec.Unlock()
+	}
 	if err = s.c.Send(s, b); err != nil {
 		return err
 	}
@@ -630,10 +1019,13 @@ func (s *Session) Notify(mc *method.MethodCall) error {
 func parseTPerProperties(params []interface{}, tp *TPerProperties) error {
 	for i, p := range params {
 		if stream.EqualToken(p, stream.StartName) {
+			if i+2 >= len(params) {
+				return fmt.Errorf("tper properties malformed: %w", method.ErrMalformedMethodResponse)
+			}
 			n, ok1 := params[i+1].([]byte)
 			v, ok2 := params[i+2].(uint)
 			if !ok1 || !ok2 {
-				return fmt.Errorf("tper properties malformed")
+				return fmt.Errorf("tper properties malformed: %w", method.ErrMalformedMethodResponse)
 			}
 			switch string(n) {
 			case "MaxMethods":
@@ -691,10 +1083,13 @@ func parseTPerProperties(params []interface{}, tp *TPerProperties) error {
 func parseHostProperties(params []interface{}, hp *HostProperties) error {
 	for i, p := range params {
 		if stream.EqualToken(p, stream.StartName) {
+			if i+2 >= len(params) {
+				return fmt.Errorf("host properties malformed: %w", method.ErrMalformedMethodResponse)
+			}
 			n, ok1 := params[i+1].([]byte)
 			v, ok2 := params[i+2].(uint)
 			if !ok1 || !ok2 {
-				return fmt.Errorf("host properties malformed")
+				return fmt.Errorf("host properties malformed: %w", method.ErrMalformedMethodResponse)
 			}
 			switch string(n) {
 			case "MaxMethods":
@@ -0,0 +1,201 @@
+package core
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/stream"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive/sim"
+)
+
+func TestClampSessionTimeout(t *testing.T) {
+	min, max := uint(1000), uint(60000)
+	tp := TPerProperties{MinSessionTimeout: &min, MaxSessionTimeout: &max}
+	for _, tc := range []struct {
+		name string
+		tp   TPerProperties
+		in   time.Duration
+		want time.Duration
+	}{
+		{"Default", tp, 0, 0},
+		{"In range", tp, 30 * time.Second, 30 * time.Second},
+		{"Below minimum", tp, time.Millisecond, time.Second},
+		{"Above maximum", tp, time.Hour, time.Minute},
+		{"Not reported", TPerProperties{}, time.Hour, time.Hour},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.tp.Timeouts().clampSession(tc.in); got != tc.want {
+				t.Errorf("clampSession(%v) = %v; want %v", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseReply(t *testing.T) {
+	success := stream.List{uint(0), uint(0), uint(0)}
+	for _, tc := range []struct {
+		name    string
+		reply   stream.List
+		want    stream.List
+		wantErr error
+	}{
+		// e.g. a Set, which has no return values
+		{"Empty success", stream.List{stream.EndOfData, success}, stream.List{}, nil},
+		{"Result", stream.List{stream.List{uint(1)}, stream.EndOfData, success}, stream.List{stream.List{uint(1)}}, nil},
+		{"Empty", stream.List{}, nil, method.ErrEmptyMethodResponse},
+		{"No status", stream.List{stream.EndOfData, stream.List{}}, nil, method.ErrMalformedMethodResponse},
+		{"Not authorized", stream.List{stream.EndOfData, stream.List{uint(1), uint(0), uint(0)}}, nil, method.ErrMethodStatusNotAuthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &Session{}
+			mc := method.NewMethodCall(uid.InvokeIDThisSP, uid.OpalAuthenticate, 0)
+			got, err := s.parseReply(mc, tc.reply)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("parseReply() error = %v; want %v", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parseReply() = %v; want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseTPerProperties(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		params  stream.List
+		wantErr error
+	}{
+		{"Valid", stream.List{stream.StartName, []byte("MaxMethods"), uint(4), stream.EndName}, nil},
+		{"Truncated", stream.List{stream.StartName, []byte("MaxMethods")}, method.ErrMalformedMethodResponse},
+		{"Name not bytes", stream.List{stream.StartName, uint(1), uint(4), stream.EndName}, method.ErrMalformedMethodResponse},
+		{"Value not uint", stream.List{stream.StartName, []byte("MaxMethods"), []byte{4}, stream.EndName}, method.ErrMalformedMethodResponse},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var tp TPerProperties
+			if err := parseTPerProperties(tc.params, &tp); !errors.Is(err, tc.wantErr) {
+				t.Errorf("parseTPerProperties() error = %v; want %v", err, tc.wantErr)
+			}
+			var hp HostProperties
+			if err := parseHostProperties(tc.params, &hp); !errors.Is(err, tc.wantErr) {
+				t.Errorf("parseHostProperties() error = %v; want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+// simControlSession opens a control session to the simulated drive d.
+func simControlSession(t *testing.T, d drive.DriveIntf) *ControlSession {
+	t.Helper()
+	c, err := NewCoreFromDrive(d)
+	if err != nil {
+		t.Fatalf("NewCoreFromDrive() failed: %v", err)
+	}
+	comID, _, err := FindComID(c.DriveIntf, c.Level0Discovery)
+	if err != nil {
+		t.Fatalf("FindComID() failed: %v", err)
+	}
+	cs, err := NewControlSession(c.DriveIntf, c.Level0Discovery, WithComID(comID))
+	if err != nil {
+		t.Fatalf("NewControlSession() failed: %v", err)
+	}
+	return cs
+}
+
+func TestExecuteMethodRaw(t *testing.T) {
+	cs := simControlSession(t, sim.New())
+	s, err := cs.NewSession(uid.AdminSP)
+	if err != nil {
+		t.Fatalf("NewSession() failed: %v", err)
+	}
+	defer s.Close()
+
+	for _, tc := range []struct {
+		invoker uid.InvokingID
+		status  uint
+	}{
+		{uid.InvokingID(uid.Admin_C_PIN_MSIDRow), method.MethodStatusSuccess},
+		{uid.InvokingID{0x00, 0x00, 0x00, 0x0b, 0xff, 0xff, 0xff, 0xff}, 0x0c},
+	} {
+		mc := method.NewMethodCall(tc.invoker, uid.OpalGet, s.MethodFlags)
+		mc.StartList()
+		mc.EndList()
+		r, err := s.ExecuteMethodRaw(mc)
+		if err != nil {
+			t.Fatalf("ExecuteMethodRaw() failed: %v", err)
+		}
+		if len(r.Status) != 3 || r.Status[0] != tc.status {
+			t.Errorf("Get on %x returned status %v, want %d", tc.invoker, r.Status, tc.status)
+		}
+		if len(r.Tokens) != 1 || len(r.Trailing) != 0 {
+			t.Errorf("Get on %x returned tokens %v and trailing %v", tc.invoker, r.Tokens, r.Trailing)
+		}
+	}
+}
+
+// countingDrive counts the ComPackets sent to the drive.
+type countingDrive struct {
+	drive.DriveIntf
+	sends int
+}
+
+func (d *countingDrive) IFSend(proto drive.SecurityProtocol, sps uint16, data []byte) error {
+	d.sends++
+	return d.DriveIntf.IFSend(proto, sps, data)
+}
+
+func TestExecuteMethods(t *testing.T) {
+	d := &countingDrive{DriveIntf: sim.New()}
+	cs := simControlSession(t, d)
+	s, err := cs.NewSession(uid.AdminSP)
+	if err != nil {
+		t.Fatalf("NewSession() failed: %v", err)
+	}
+	defer s.Close()
+
+	// The first batch fails at its fourth method, the second one succeeds
+	var mcs []*method.MethodCall
+	maxMethods := int(cs.TPerProperties.MaxMethods)
+	for i := 0; i < maxMethods+4; i++ {
+		invoker := uid.InvokingID(uid.Admin_C_PIN_MSIDRow)
+		if i == 3 {
+			invoker = uid.InvokingID{0x00, 0x00, 0x00, 0x0b, 0xff, 0xff, 0xff, 0xff}
+		}
+		mc := method.NewMethodCall(invoker, uid.OpalGet, s.MethodFlags)
+		mc.StartList()
+		mc.EndList()
+		mcs = append(mcs, mc)
+	}
+	sends := d.sends
+	res, err := s.ExecuteMethods(mcs)
+	if err != nil {
+		t.Fatalf("ExecuteMethods() failed: %v", err)
+	}
+	if n := d.sends - sends; n != 2 {
+		t.Errorf("ExecuteMethods() took %d round trips, want 2", n)
+	}
+	if len(res) != len(mcs) {
+		t.Fatalf("ExecuteMethods() returned %d results, want %d", len(res), len(mcs))
+	}
+	for i, r := range res {
+		switch {
+		case i == 3:
+			if !errors.Is(r.Err, method.ErrMethodStatusInvalidParameter) {
+				t.Errorf("method %d returned %v, want ErrMethodStatusInvalidParameter", i, r.Err)
+			}
+		case i > 3 && i < maxMethods:
+			if !errors.Is(r.Err, ErrMethodSkipped) {
+				t.Errorf("method %d returned %v, want ErrMethodSkipped", i, r.Err)
+			}
+		default:
+			if r.Err != nil || len(r.Result) != 1 {
+				t.Errorf("method %d returned %v, %v", i, r.Result, r.Err)
+			}
+		}
+	}
+}
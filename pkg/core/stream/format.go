@@ -0,0 +1,76 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Human-readable representation of decoded data streams
+
+package stream
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+// String formats the list for debugging, e.g.
+//
+//	[ThisSP, "Name"=1, [0x0102], EndOfData]
+//
+// Byte atoms that are well-known UIDs are shown by their name, printable
+// byte atoms are quoted and all other byte atoms are shown in hex.
+func (l List) String() string {
+	b := strings.Builder{}
+	b.WriteByte('[')
+	for i := 0; i < len(l); i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		// Named values are StartName, name, value, EndName
+		if EqualToken(l[i], StartName) && i+3 < len(l) && EqualToken(l[i+3], EndName) {
+			b.WriteString(formatAtom(l[i+1]))
+			b.WriteByte('=')
+			b.WriteString(formatAtom(l[i+2]))
+			i += 3
+			continue
+		}
+		b.WriteString(formatAtom(l[i]))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+func formatAtom(x interface{}) string {
+	switch v := x.(type) {
+	case uint:
+		return fmt.Sprintf("%d", v)
+	case []byte:
+		return formatBytes(v)
+	case List:
+		return v.String()
+	case TokenType:
+		return v.String()
+	}
+	return fmt.Sprintf("%v", x)
+}
+
+func formatBytes(b []byte) string {
+	var u uid.UID
+	if len(b) == len(u) {
+		copy(u[:], b)
+		if name, ok := uid.Lookup(u); ok {
+			return name
+		}
+	}
+	printable := len(b) > 0
+	for _, c := range b {
+		if c < 0x20 || c > 0x7e {
+			printable = false
+			break
+		}
+	}
+	if printable || len(b) == 0 {
+		return fmt.Sprintf("%q", b)
+	}
+	return fmt.Sprintf("0x%x", b)
+}
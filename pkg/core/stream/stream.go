@@ -37,6 +37,7 @@ var (
 	WriteLockEnabled TokenType = 0x06
 
 	ErrUnbalancedList = errors.New("message contained unbalanced list structures")
+	ErrTruncatedAtom  = errors.New("message contained a truncated atom")
 )
 
 func (t *TokenType) String() string {
@@ -119,6 +120,9 @@ func internalDecode(b []byte, depth int) (List, []byte, error) {
 			isbyte := b[0]&0x20 > 0
 			// Short atom
 			s = int(b[0] & 0xf)
+			if len(b) < 1+s {
+				return nil, nil, ErrTruncatedAtom
+			}
 			if isbyte {
 				bc := make([]byte, s)
 				copy(bc, b[1:1+s])
@@ -133,7 +137,13 @@ func internalDecode(b []byte, depth int) (List, []byte, error) {
 			s += 1
 		} else if b[0]&0xE0 == 0xC0 { // Medium atom
 			isbyte := b[0]&0x10 > 0
+			if len(b) < 2 {
+				return nil, nil, ErrTruncatedAtom
+			}
 			s = int(b[0]&0x7)<<8 | int(b[1])
+			if len(b) < 2+s {
+				return nil, nil, ErrTruncatedAtom
+			}
 			if isbyte {
 				bc := make([]byte, s)
 				copy(bc, b[2:2+s])
@@ -144,7 +154,13 @@ func internalDecode(b []byte, depth int) (List, []byte, error) {
 			}
 		} else if b[0]&0xF0 == 0xE0 { // Long atom
 			isbyte := b[0]&0x02 > 0
+			if len(b) < 4 {
+				return nil, nil, ErrTruncatedAtom
+			}
 			s = int(b[1])<<16 | int(b[2])<<8 | int(b[3])
+			if len(b) < 4+s {
+				return nil, nil, ErrTruncatedAtom
+			}
 			if isbyte {
 				bc := make([]byte, s)
 				copy(bc, b[4:4+s])
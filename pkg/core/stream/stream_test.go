@@ -9,6 +9,7 @@ package stream
 import (
 	"bytes"
 	"encoding/hex"
+	"fmt"
 	"reflect"
 	"strings"
 	"testing"
@@ -90,3 +91,75 @@ func TestDecodeLists(t *testing.T) {
 	}
 
 }
+
+func TestListString(t *testing.T) {
+	l := List{
+		[]byte{0x00, 0x00, 0x00, 0x0B, 0x00, 0x00, 0x84, 0x02},
+		List{StartName, uint(3), []byte("MSID"), EndName, []byte{0x01, 0xff}, []byte{}},
+		EndOfData,
+	}
+	want := `[C_PIN_MSID, [3="MSID", 0x01ff, ""], EndOfData]`
+	if got := l.String(); got != want {
+		t.Errorf("List.String() = %s; want %s", got, want)
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	for _, seed := range []string{
+		"A0", "81 8F", "D0 10 01 02 03 04 05 06 07 08 01 02 03 04 05 06 07 08", "E2 00 00 04 01 02 03 04",
+		"F0 F0 F2 03 A4 4D 53 49 44 F3 F1 F1 F9 F0 00 00 00 F1",
+	} {
+		b, _ := hex.DecodeString(strings.ReplaceAll(seed, " ", ""))
+		f.Add(b)
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		l, err := Decode(b)
+		if err == nil {
+			_ = l.String()
+		}
+	})
+}
+
+var sink []byte
+
+func BenchmarkUInt(b *testing.B) {
+	for _, v := range []uint{0x2f, 0x800, 0x10000000} {
+		b.Run(fmt.Sprintf("0x%x", v), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				sink = UInt(v)
+			}
+		})
+	}
+}
+
+func BenchmarkBytes(b *testing.B) {
+	for _, n := range []int{8, 1024, 65536} {
+		b.Run(fmt.Sprintf("%d", n), func(b *testing.B) {
+			data := make([]byte, n)
+			b.SetBytes(int64(n))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				sink = Bytes(data)
+			}
+		})
+	}
+}
+
+// Decode a Get result holding a single large byte atom, e.g. a chunk of the
+// MBR or the DataStore table.
+func BenchmarkDecode(b *testing.B) {
+	for _, n := range []int{1024, 65536} {
+		b.Run(fmt.Sprintf("%d", n), func(b *testing.B) {
+			enc := append([]byte{byte(StartList)}, Bytes(make([]byte, n))...)
+			enc = append(enc, byte(EndList))
+			b.SetBytes(int64(len(enc)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := Decode(enc); err != nil {
+					b.Fatalf("Decode failed: %v", err)
+				}
+			}
+		})
+	}
+}
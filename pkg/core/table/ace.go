@@ -0,0 +1,122 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Implements TCG Storage Core Table operations on the ACE table
+
+package table
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/stream"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+var (
+	ACE_ColumnBooleanExpr uint = 3
+
+	booleanOR uint = 1
+)
+
+// ErrUnsupportedBooleanExpr is returned for ACE expressions that are not a
+// plain disjunction of authorities, e.g. ones using AND.
+var ErrUnsupportedBooleanExpr = errors.New("ACE expression is not a disjunction of authorities")
+
+// ACE_GetBooleanExpression reads the authorities of which any satisfies the
+// BooleanExpr column of an ACE, the inverse of ACE_SetBooleanExpression.
+func ACE_GetBooleanExpression(s *core.Session, ace uid.RowUID) ([]uid.AuthorityObjectUID, error) {
+	if s.ProtocolLevel == core.ProtocolLevelEnterprise {
+		return nil, fmt.Errorf("invalid Protocol Level for operation")
+	}
+	val, err := GetPartialRow(s, ace, ACE_ColumnBooleanExpr, "BooleanExpr", ACE_ColumnBooleanExpr, "BooleanExpr")
+	if err != nil {
+		return nil, err
+	}
+	for col, v := range val {
+		if col != "3" && col != "BooleanExpr" {
+			continue
+		}
+		return parseBooleanExpr(v)
+	}
+	return nil, ErrEmptyResult
+}
+
+// Parse an expression in postfix notation, "A B OR C OR", into its
+// authorities.
+func parseBooleanExpr(v interface{}) ([]uid.AuthorityObjectUID, error) {
+	l, ok := v.(stream.List)
+	if !ok || len(l)%4 != 0 {
+		return nil, method.ErrMalformedMethodResponse
+	}
+	auths := []uid.AuthorityObjectUID{}
+	ors := 0
+	for i := 0; i < len(l); i += 4 {
+		if !stream.EqualToken(l[i], stream.StartName) || !stream.EqualToken(l[i+3], stream.EndName) {
+			return nil, method.ErrMalformedMethodResponse
+		}
+		name, ok := l[i+1].([]byte)
+		if !ok {
+			return nil, method.ErrMalformedMethodResponse
+		}
+		switch {
+		case bytes.Equal(name, uid.HalfUID_AuthorityObjectRef[:]):
+			b, ok := l[i+2].([]byte)
+			if !ok || len(b) != 8 {
+				return nil, method.ErrMalformedMethodResponse
+			}
+			var a uid.AuthorityObjectUID
+			copy(a[:], b)
+			auths = append(auths, a)
+		case bytes.Equal(name, uid.HalfUID_BooleanACE[:]):
+			if !stream.EqualUInt(l[i+2], booleanOR) {
+				return nil, ErrUnsupportedBooleanExpr
+			}
+			ors++
+		default:
+			return nil, method.ErrMalformedMethodResponse
+		}
+	}
+	if len(auths) > 0 && ors != len(auths)-1 {
+		return nil, method.ErrMalformedMethodResponse
+	}
+	return auths, nil
+}
+
+// ACE_SetBooleanExpression replaces the BooleanExpr column of an ACE so that
+// any of the given authorities satisfies it.
+//
+// The expression is encoded in postfix notation as described in
+// "5.1.3.2 ACE_expression", i.e. "A B OR C OR".
+func ACE_SetBooleanExpression(s *core.Session, ace uid.RowUID, auths []uid.AuthorityObjectUID) error {
+	if s.ProtocolLevel == core.ProtocolLevelEnterprise {
+		return fmt.Errorf("invalid Protocol Level for operation")
+	}
+	if len(auths) == 0 {
+		return fmt.Errorf("at least one authority is required")
+	}
+	mc := NewSetCall(s, ace)
+	mc.StartOptionalParameter(ACE_ColumnBooleanExpr, "BooleanExpr")
+	mc.StartList()
+	for i, a := range auths {
+		mc.Token(stream.StartName)
+		mc.Bytes(uid.HalfUID_AuthorityObjectRef[:])
+		mc.Bytes(a[:])
+		mc.Token(stream.EndName)
+		if i > 0 {
+			mc.Token(stream.StartName)
+			mc.Bytes(uid.HalfUID_BooleanACE[:])
+			mc.UInt(booleanOR)
+			mc.Token(stream.EndName)
+		}
+	}
+	mc.EndList()
+	mc.EndOptionalParameter()
+	FinishSetCall(s, mc)
+	_, err := s.ExecuteMethod(mc)
+	return err
+}
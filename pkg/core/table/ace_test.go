@@ -0,0 +1,53 @@
+package table
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/stream"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+func TestParseBooleanExpr(t *testing.T) {
+	ref := func(a uid.AuthorityObjectUID) stream.List {
+		return stream.List{stream.StartName, uid.HalfUID_AuthorityObjectRef[:], a[:], stream.EndName}
+	}
+	op := func(v uint) stream.List {
+		return stream.List{stream.StartName, uid.HalfUID_BooleanACE[:], v, stream.EndName}
+	}
+	expr := func(parts ...stream.List) stream.List {
+		l := stream.List{}
+		for _, p := range parts {
+			l = append(l, p...)
+		}
+		return l
+	}
+	admins, user1 := uid.AuthorityAdmins, uid.LockingAuthorityUser(1)
+	for _, tc := range []struct {
+		name    string
+		in      interface{}
+		want    []uid.AuthorityObjectUID
+		wantErr error
+	}{
+		{"single", expr(ref(admins)), []uid.AuthorityObjectUID{admins}, nil},
+		{"or", expr(ref(admins), ref(user1), op(booleanOR)), []uid.AuthorityObjectUID{admins, user1}, nil},
+		{"empty", stream.List{}, []uid.AuthorityObjectUID{}, nil},
+		{"and", expr(ref(admins), ref(user1), op(0)), nil, ErrUnsupportedBooleanExpr},
+		{"missing operator", expr(ref(admins), ref(user1)), nil, method.ErrMalformedMethodResponse},
+		{"not a list", uint(1), nil, method.ErrMalformedMethodResponse},
+		{"truncated", stream.List{stream.StartName, uid.HalfUID_AuthorityObjectRef[:]}, nil, method.ErrMalformedMethodResponse},
+		{"short UID", stream.List{stream.StartName, uid.HalfUID_AuthorityObjectRef[:], []byte{1}, stream.EndName}, nil, method.ErrMalformedMethodResponse},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseBooleanExpr(tc.in)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("parseBooleanExpr() error = %v, want %v", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parseBooleanExpr() = %x, want %x", got, tc.want)
+			}
+		})
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/feature"
 	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
 	"github.com/open-source-firmware/go-tcg-storage/pkg/core/stream"
 	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
@@ -18,7 +19,13 @@ import (
 
 var (
 	Admin_C_PIN_ColumnPIN         uint = 3
+	Admin_C_PIN_ColumnCharSet     uint = 4
+	Admin_C_PIN_ColumnTryLimit    uint = 5
+	Admin_C_PIN_ColumnTries       uint = 6
+	Admin_SP_ColumnName           uint = 1
 	Admin_SP_ColumnLifeCycleState uint = 6
+
+	Admin_C_PIN_PIN = Column{Admin_C_PIN_ColumnPIN, "PIN"}
 )
 
 func Admin_C_PIN_MSID_GetPIN(s *core.Session) ([]byte, error) {
@@ -39,29 +46,7 @@ func Admin_C_Pin_SID_SetPIN(s *core.Session, password []byte) error {
 	if len(password) < 16 {
 		return fmt.Errorf("invalid length of password hash")
 	}
-	mc := NewSetCall(s, uid.Admin_C_PIN_SIDRow)
-	mc.Token(stream.StartName)
-	if s.ProtocolLevel == core.ProtocolLevelEnterprise {
-		mc.Bytes([]byte("PIN"))
-	} else {
-		mc.Token(stream.OpalPIN)
-	}
-
-	mc.Bytes(password)
-	mc.Token(stream.EndName)
-	mc.EndList()
-	// We have to branch here for Enterprise SSC
-	if s.ProtocolLevel == core.ProtocolLevelEnterprise {
-		mc.EndList()
-	} else {
-		mc.EndOptionalParameter()
-	}
-
-	_, err := s.ExecuteMethod(mc)
-	if err != nil {
-		return err
-	}
-	return nil
+	return C_PIN_SetPIN(s, uid.Admin_C_PIN_SIDRow, password)
 }
 
 type Admin_TPerInfoRow struct {
@@ -82,16 +67,24 @@ func Admin_TPerInfo(s *core.Session) (map[uid.RowUID]Admin_TPerInfoRow, error) {
 	if err != nil {
 		return nil, err
 	}
+	row, err := parseTPerInfoRow(val)
+	if err != nil {
+		return nil, err
+	}
+	res[row.UID] = *row
+	return res, nil
+}
 
+func parseTPerInfoRow(val map[string]interface{}) (*Admin_TPerInfoRow, error) {
 	row := Admin_TPerInfoRow{}
 	for col, val := range val {
 		switch col {
 		case "0", "UID":
 			v, ok := val.([]byte)
-			if !ok {
+			if !ok || len(v) != 8 {
 				return nil, method.ErrMalformedMethodResponse
 			}
-			copy(row.UID[:], v[:8])
+			copy(row.UID[:], v)
 		case "1":
 			v, ok := val.(uint)
 			if !ok {
@@ -101,7 +94,7 @@ func Admin_TPerInfo(s *core.Session) (map[uid.RowUID]Admin_TPerInfoRow, error) {
 			row.Bytes = &vv
 		case "2":
 			v, ok := val.([]byte)
-			if !ok {
+			if !ok || len(v) != 12 {
 				return nil, method.ErrMalformedMethodResponse
 			}
 			vv := [12]byte{}
@@ -159,9 +152,7 @@ func Admin_TPerInfo(s *core.Session) (map[uid.RowUID]Admin_TPerInfoRow, error) {
 			row.ProgrammaticResetEnable = &vv
 		}
 	}
-
-	res[row.UID] = row
-	return res, nil
+	return &row, nil
 }
 
 type LifeCycleState int
@@ -232,6 +223,49 @@ func Admin_SP_GetLifeCycleState(s *core.Session, spid uid.SPID) (LifeCycleState,
 	return LifeCycleState(v), nil
 }
 
+// SPInfo is a row of the SP table of the Admin SP.
+type SPInfo struct {
+	UID  uid.SPID
+	Name string
+	// -1 if the state could not be read
+	LifeCycleState LifeCycleState
+}
+
+// Names of the SPs of the SSCs, for drives that do not let Anybody read the
+// Name column.
+var spNames = map[uid.SPID]string{
+	uid.AdminSP:             "Admin",
+	uid.LockingSP:           "Locking",
+	uid.EnterpriseLockingSP: "Locking",
+}
+
+// ListSPs enumerates the SPs of the TPer with their life cycle state. It has
+// to be called in a session to the Admin SP, which does not need to be
+// authenticated.
+func ListSPs(s *core.Session) ([]SPInfo, error) {
+	rows, err := Enumerate(s, uid.Admin_SPTable)
+	if err != nil {
+		return nil, err
+	}
+	sps := []SPInfo{}
+	for _, row := range rows {
+		sp := SPInfo{UID: uid.SPID(row), LifeCycleState: -1}
+		if val, err := GetCell(s, row, Admin_SP_ColumnName, "Name"); err == nil {
+			if name, ok := val.([]byte); ok {
+				sp.Name = string(name)
+			}
+		}
+		if sp.Name == "" {
+			sp.Name = spNames[sp.UID]
+		}
+		if lcs, err := Admin_SP_GetLifeCycleState(s, sp.UID); err == nil {
+			sp.LifeCycleState = lcs
+		}
+		sps = append(sps, sp)
+	}
+	return sps, nil
+}
+
 func RevertTPer(s *core.Session) error {
 	var invoking uid.InvokingID
 	copy(invoking[:], uid.AdminSP[:])
@@ -241,3 +275,31 @@ func RevertTPer(s *core.Session) error {
 	}
 	return nil
 }
+
+var Admin_DataRemovalMechanism_ColumnActive uint = 1
+
+// Admin_DataRemovalMechanism_Get returns the mechanism used by the drive when
+// removing user data on Revert or RevertSP.
+func Admin_DataRemovalMechanism_Get(s *core.Session) (feature.DataRemovalMechanism, error) {
+	val, err := GetCell(s, uid.Admin_DataRemovalMechanismObj, Admin_DataRemovalMechanism_ColumnActive, "ActiveDataRemovalMechanism")
+	if err != nil {
+		return 0, err
+	}
+	v, ok := val.(uint)
+	if !ok {
+		return 0, method.ErrMalformedMethodResponse
+	}
+	return feature.DataRemovalMechanism(v), nil
+}
+
+// Admin_DataRemovalMechanism_Set selects the mechanism used by the drive when
+// removing user data on Revert or RevertSP. This requires SID authentication.
+func Admin_DataRemovalMechanism_Set(s *core.Session, m feature.DataRemovalMechanism) error {
+	mc := NewSetCall(s, uid.Admin_DataRemovalMechanismObj)
+	mc.StartOptionalParameter(Admin_DataRemovalMechanism_ColumnActive, "ActiveDataRemovalMechanism")
+	mc.UInt(uint(m))
+	mc.EndOptionalParameter()
+	FinishSetCall(s, mc)
+	_, err := s.ExecuteMethod(mc)
+	return err
+}
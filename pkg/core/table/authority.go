@@ -0,0 +1,96 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Implements TCG Storage Core Table operations on Authority and C_PIN tables
+
+package table
+
+import (
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+var (
+	Authority_ColumnEnabled    uint = 5
+	Authority_ColumnOperation  uint = 9
+	Authority_ColumnCredential uint = 10
+)
+
+// AuthMethod is how an authority proves its identity, see the auth_method
+// type in the Core specification.
+type AuthMethod uint
+
+const (
+	AuthMethodNone         AuthMethod = 0
+	AuthMethodPassword     AuthMethod = 1
+	AuthMethodExchange     AuthMethod = 2
+	AuthMethodSign         AuthMethod = 3
+	AuthMethodSymK         AuthMethod = 4
+	AuthMethodHMAC         AuthMethod = 5
+	AuthMethodTPerSign     AuthMethod = 6
+	AuthMethodTPerExchange AuthMethod = 7
+)
+
+// Authority_SetEnabled enables or disables an authority, e.g. a Locking SP UserN.
+func Authority_SetEnabled(s *core.Session, auth uid.AuthorityObjectUID, enabled bool) error {
+	return SetColumns(s, uid.RowUID(auth), ColumnValue{Column{Authority_ColumnEnabled, "Enabled"}, enabled})
+}
+
+// Authority_GetEnabled reads whether an authority is enabled.
+func Authority_GetEnabled(s *core.Session, auth uid.AuthorityObjectUID) (bool, error) {
+	val, err := GetPartialRow(s, uid.RowUID(auth), Authority_ColumnEnabled, "Enabled", Authority_ColumnEnabled, "Enabled")
+	if err != nil {
+		return false, err
+	}
+	for col, val := range val {
+		if col != "5" && col != "Enabled" {
+			continue
+		}
+		v, ok := val.(uint)
+		if !ok {
+			return false, method.ErrMalformedMethodResponse
+		}
+		return v > 0, nil
+	}
+	return false, ErrEmptyResult
+}
+
+// C_PIN_SetPIN sets the PIN column of the given C_PIN row, after checking
+// the PIN against the constraints of the row, see C_PIN_GetConstraints.
+func C_PIN_SetPIN(s *core.Session, row uid.RowUID, pin []byte) error {
+	if err := validatePIN(s, row, pin); err != nil {
+		return err
+	}
+	return SetColumns(s, row, ColumnValue{Admin_C_PIN_PIN, pin})
+}
+
+// Authority_GetCredential reads how an authority authenticates and which
+// credential it uses, e.g. a row of the C_PIN or the C_RSA_2048 table. The
+// credential is the zero UID if the authority has none.
+func Authority_GetCredential(s *core.Session, auth uid.AuthorityObjectUID) (AuthMethod, uid.RowUID, error) {
+	val, err := GetPartialRow(s, uid.RowUID(auth), Authority_ColumnOperation, "Operation", Authority_ColumnCredential, "Credential")
+	if err != nil {
+		return AuthMethodNone, uid.RowUID{}, err
+	}
+	op := AuthMethodNone
+	cred := uid.RowUID{}
+	for col, val := range val {
+		switch col {
+		case "9", "Operation":
+			v, ok := val.(uint)
+			if !ok {
+				return AuthMethodNone, uid.RowUID{}, method.ErrMalformedMethodResponse
+			}
+			op = AuthMethod(v)
+		case "10", "Credential":
+			v, ok := val.([]byte)
+			if !ok || len(v) != 8 {
+				return AuthMethodNone, uid.RowUID{}, method.ErrMalformedMethodResponse
+			}
+			copy(cred[:], v)
+		}
+	}
+	return op, cred, nil
+}
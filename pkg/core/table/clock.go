@@ -0,0 +1,96 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Implements the methods of the Clock template
+
+package table
+
+import (
+	"time"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/stream"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+// ClockTime is the time reported by the Clock of the TPer.
+type ClockTime struct {
+	// The value as returned by the TPer
+	Raw interface{}
+	// The time, nil if Raw could not be interpreted
+	Time *time.Time
+}
+
+// Interpret a clock value, either seconds since the Unix epoch with an
+// optional fraction in units of 2^-32 seconds, or a date as year, month, day,
+// hour, minute and second.
+func parseClockTime(v interface{}) *time.Time {
+	var vals []uint
+	switch v := v.(type) {
+	case uint:
+		vals = []uint{v}
+	case stream.List:
+		for _, e := range v {
+			u, ok := e.(uint)
+			if !ok {
+				return nil
+			}
+			vals = append(vals, u)
+		}
+	default:
+		return nil
+	}
+	var t time.Time
+	switch {
+	case len(vals) == 1:
+		t = time.Unix(int64(vals[0]), 0)
+	case len(vals) == 2:
+		t = time.Unix(int64(vals[0]), int64(vals[1]*uint(time.Second)>>32))
+	case len(vals) >= 6:
+		t = time.Date(int(vals[0]), time.Month(vals[1]), int(vals[2]),
+			int(vals[3]), int(vals[4]), int(vals[5]), 0, time.UTC)
+	default:
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
+
+// Clock_Get reads the time of the TPer with GetClock. The Clock template is
+// optional, most Opal drives do not implement it.
+func Clock_Get(s *core.Session) (*ClockTime, error) {
+	mc := method.NewMethodCall(uid.InvokingID(uid.Clock_ClockTimeObj), uid.MethodIDGetClock, s.MethodFlags)
+	resp, err := s.ExecuteMethod(mc)
+	if err != nil {
+		return nil, err
+	}
+	res, err := methodResult(resp)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return nil, method.ErrMalformedMethodResponse
+	}
+	return &ClockTime{Raw: res[0], Time: parseClockTime(res[0])}, nil
+}
+
+func clockSet(s *core.Session, mid uid.MethodID, t time.Time) error {
+	mc := method.NewMethodCall(uid.InvokingID(uid.Clock_ClockTimeObj), mid, s.MethodFlags)
+	mc.UInt(uint(t.Unix()))
+	_, err := s.ExecuteMethod(mc)
+	return err
+}
+
+// Clock_SetHigh tells the TPer that the current time is not later than t,
+// which it uses to narrow down its clock. It needs an authority that is
+// allowed to set the clock.
+func Clock_SetHigh(s *core.Session, t time.Time) error {
+	return clockSet(s, uid.MethodIDSetClockHigh, t)
+}
+
+// Clock_SetLow tells the TPer that the current time is not earlier than t.
+func Clock_SetLow(s *core.Session, t time.Time) error {
+	return clockSet(s, uid.MethodIDSetClockLow, t)
+}
@@ -0,0 +1,31 @@
+package table
+
+import (
+	"testing"
+	"time"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/stream"
+)
+
+func TestParseClockTime(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   interface{}
+		want string
+	}{
+		{"Seconds", uint(1650000000), "2022-04-15T05:20:00Z"},
+		{"Fraction", stream.List{uint(1650000000), uint(1 << 31)}, "2022-04-15T05:20:00.5Z"},
+		{"Date", stream.List{uint(2022), uint(4), uint(15), uint(5), uint(20), uint(0)}, "2022-04-15T05:20:00Z"},
+		{"Malformed", stream.List{uint(2022), []byte("April")}, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := ""
+			if tm := parseClockTime(tc.in); tm != nil {
+				got = tm.Format(time.RFC3339Nano)
+			}
+			if got != tc.want {
+				t.Errorf("parseClockTime(%v) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
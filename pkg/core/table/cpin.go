@@ -7,6 +7,10 @@
 package table
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+
 	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
 	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
 	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
@@ -38,10 +42,10 @@ func CPINInfo(s *core.Session) (*CPINInfoRow, error) {
 		switch col {
 		case "0", "UID":
 			v, ok := val.([]byte)
-			if !ok {
+			if !ok || len(v) != 8 {
 				return nil, method.ErrMalformedMethodResponse
 			}
-			copy(row.UID[:], v[:8])
+			copy(row.UID[:], v)
 		case "1", "Name":
 			v, ok := val.([]byte)
 			if !ok {
@@ -98,3 +102,116 @@ func CPINInfo(s *core.Session) (*CPINInfoRow, error) {
 	}
 	return &row, nil
 }
+
+// C_PIN_GetTries reads the number of failed authentication attempts and the
+// limit after which the authority of the C_PIN row is locked out. A TryLimit
+// of zero means that there is no limit.
+func C_PIN_GetTries(s *core.Session, row uid.RowUID) (tries uint32, tryLimit uint32, err error) {
+	val, err := GetPartialRow(s, row, Admin_C_PIN_ColumnTryLimit, "TryLimit", Admin_C_PIN_ColumnTries, "Tries")
+	if err != nil {
+		return 0, 0, err
+	}
+	found := 0
+	for col, val := range val {
+		v, ok := val.(uint)
+		if !ok {
+			return 0, 0, method.ErrMalformedMethodResponse
+		}
+		switch col {
+		case "5", "TryLimit":
+			tryLimit = uint32(v)
+			found++
+		case "6", "Tries":
+			tries = uint32(v)
+			found++
+		}
+	}
+	if found != 2 {
+		return 0, 0, ErrEmptyResult
+	}
+	return tries, tryLimit, nil
+}
+
+// MaxPINLength is the size of the password type of the PIN column.
+const MaxPINLength = 32
+
+var ErrInvalidPIN = errors.New("PIN violates the C_PIN constraints of the drive")
+
+// PINConstraints are the constraints a C_PIN row places on its PIN.
+type PINConstraints struct {
+	MaxLength int
+	// Characters allowed in the PIN, empty if any byte is allowed
+	CharSet []byte
+}
+
+// C_PIN_GetConstraints reads the CharSet of the given C_PIN row and the byte
+// table it refers to. Rows without a CharSet allow any byte.
+func C_PIN_GetConstraints(s *core.Session, row uid.RowUID) (*PINConstraints, error) {
+	c := &PINConstraints{MaxLength: MaxPINLength}
+	val, err := GetCell(s, row, Admin_C_PIN_ColumnCharSet, "CharSet")
+	if errors.Is(err, ErrEmptyResult) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ref, ok := val.([]byte)
+	if !ok || len(ref) != 8 {
+		return nil, method.ErrMalformedMethodResponse
+	}
+	charSet := uid.TableUID{}
+	copy(charSet[:], ref)
+	if charSet == (uid.TableUID{}) {
+		return c, nil
+	}
+
+	trow := uid.Base_TableRowForTable(charSet)
+	tval, err := GetFullRow(s, trow)
+	if err != nil {
+		return nil, fmt.Errorf("reading CharSet table %x failed: %v", ref, err)
+	}
+	ti, err := parseTableRow(trow, tval)
+	if err != nil {
+		return nil, fmt.Errorf("reading CharSet table %x failed: %v", ref, err)
+	}
+	// A set of bytes never has more than 256 members
+	size := ti.Rows
+	if size > 256 {
+		size = 256
+	}
+	buf := make([]byte, size)
+	n, err := ReadBytes(s, charSet, buf, 0)
+	if err != nil {
+		return nil, fmt.Errorf("reading CharSet table %x failed: %v", ref, err)
+	}
+	c.CharSet = buf[:n]
+	return c, nil
+}
+
+// Validate returns an error wrapping ErrInvalidPIN that tells why the drive
+// would reject the PIN, or nil.
+func (c *PINConstraints) Validate(pin []byte) error {
+	if c.MaxLength > 0 && len(pin) > c.MaxLength {
+		return fmt.Errorf("%w: PIN is %d bytes long, at most %d are allowed", ErrInvalidPIN, len(pin), c.MaxLength)
+	}
+	if len(c.CharSet) == 0 {
+		return nil
+	}
+	for i, b := range pin {
+		if bytes.IndexByte(c.CharSet, b) < 0 {
+			return fmt.Errorf("%w: byte %d of the PIN (0x%02x) is not in the allowed character set %q", ErrInvalidPIN, i, b, c.CharSet)
+		}
+	}
+	return nil
+}
+
+// validatePIN checks a new PIN against the constraints of the C_PIN row.
+// Authorities that may set a PIN are not necessarily allowed to read the
+// CharSet, only the length is checked then.
+func validatePIN(s *core.Session, row uid.RowUID, pin []byte) error {
+	c, err := C_PIN_GetConstraints(s, row)
+	if err != nil {
+		c = &PINConstraints{MaxLength: MaxPINLength}
+	}
+	return c.Validate(pin)
+}
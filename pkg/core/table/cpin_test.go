@@ -0,0 +1,36 @@
+package table
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestPINConstraintsValidate(t *testing.T) {
+	digits := []byte("0123456789")
+	tests := []struct {
+		name string
+		c    PINConstraints
+		pin  []byte
+		ok   bool
+	}{
+		{"Any byte", PINConstraints{MaxLength: MaxPINLength}, []byte{0x00, 0xff, '\n'}, true},
+		{"Empty PIN", PINConstraints{MaxLength: MaxPINLength, CharSet: digits}, nil, true},
+		{"Maximum length", PINConstraints{MaxLength: MaxPINLength}, bytes.Repeat([]byte{0xaa}, MaxPINLength), true},
+		{"Too long", PINConstraints{MaxLength: MaxPINLength}, bytes.Repeat([]byte{0xaa}, MaxPINLength+1), false},
+		{"In CharSet", PINConstraints{MaxLength: MaxPINLength, CharSet: digits}, []byte("1234"), true},
+		{"Not in CharSet", PINConstraints{MaxLength: MaxPINLength, CharSet: digits}, []byte("12a4"), false},
+		{"Hash not in CharSet", PINConstraints{MaxLength: MaxPINLength, CharSet: digits}, []byte{0x4f, 0x2a}, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.c.Validate(tc.pin)
+			if tc.ok && err != nil {
+				t.Errorf("Validate() failed: %v", err)
+			}
+			if !tc.ok && !errors.Is(err, ErrInvalidPIN) {
+				t.Errorf("Validate() = %v, want ErrInvalidPIN", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,407 @@
+package table
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/feature"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/stream"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive"
+)
+
+var update = flag.Bool("update", false, "Rewrite the requests of the golden traces with the current encoders")
+
+// A golden trace is a text file of method payloads (the data of the first
+// subpacket of a ComPacket) exchanged with a drive. Lines starting with "->"
+// hold a request, lines starting with "<-" the response to it and lines
+// starting with "#" are comments. After an intended change of an encoder
+// the requests are rewritten with "go test -run Golden -update", responses
+// and comments are kept.
+type goldenExchange struct {
+	req, resp []byte
+}
+
+func readGolden(path string) ([]goldenExchange, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var ex []goldenExchange
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1024*1024)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if len(line) < 2 {
+			return nil, fmt.Errorf("%s:%d: malformed line", path, n)
+		}
+		b, err := hex.DecodeString(strings.ReplaceAll(line[2:], " ", ""))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+		}
+		switch line[:2] {
+		case "->":
+			ex = append(ex, goldenExchange{req: b})
+		case "<-":
+			if len(ex) == 0 || ex[len(ex)-1].resp != nil {
+				return nil, fmt.Errorf("%s:%d: response without request", path, n)
+			}
+			ex[len(ex)-1].resp = b
+		default:
+			return nil, fmt.Errorf("%s:%d: malformed line", path, n)
+		}
+	}
+	return ex, sc.Err()
+}
+
+// Replace the requests of a golden trace, keeping comments and responses.
+func updateGolden(path string, sent [][]byte) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	out := bytes.Buffer{}
+	for _, line := range strings.SplitAfter(string(b), "\n") {
+		if strings.HasPrefix(line, "->") && len(sent) > 0 {
+			line = fmt.Sprintf("-> %X\n", sent[0])
+			sent = sent[1:]
+		}
+		out.WriteString(line)
+	}
+	return os.WriteFile(path, out.Bytes(), 0644)
+}
+
+// goldenDrive answers IF-RECVs with the responses of a golden trace and
+// compares the IF-SENDs to its requests.
+type goldenDrive struct {
+	t       *testing.T
+	ex      []goldenExchange
+	sent    [][]byte
+	pending []byte
+	tsn     uint32
+	hsn     uint32
+	tper    bool
+}
+
+func (d *goldenDrive) IFSend(proto drive.SecurityProtocol, sps uint16, data []byte) error {
+	if proto == drive.SecurityProtocolTCGTPer {
+		// Only the stack reset of the control session is expected
+		d.tper = true
+		return nil
+	}
+	if len(data) < 56 {
+		return fmt.Errorf("short ComPacket")
+	}
+	d.tsn = binary.BigEndian.Uint32(data[20:24])
+	d.hsn = binary.BigEndian.Uint32(data[24:28])
+	payload := data[56 : 56+binary.BigEndian.Uint32(data[52:56])]
+	d.sent = append(d.sent, append([]byte(nil), payload...))
+	n := len(d.sent) - 1
+	if n >= len(d.ex) {
+		return fmt.Errorf("request %d beyond end of trace", n)
+	}
+	if !*update && !bytes.Equal(payload, d.ex[n].req) {
+		d.t.Errorf("request %d differs from the golden trace\n got: %X\n      %s\nwant: %X\n      %s",
+			n, payload, decoded(payload), d.ex[n].req, decoded(d.ex[n].req))
+	}
+	d.pending = d.ex[n].resp
+	return nil
+}
+
+func (d *goldenDrive) IFRecv(proto drive.SecurityProtocol, sps uint16, data *[]byte) error {
+	buf := *data
+	for i := range buf {
+		buf[i] = 0
+	}
+	if proto == drive.SecurityProtocolTCGTPer {
+		if !d.tper {
+			return fmt.Errorf("unexpected ComID request response")
+		}
+		// Stack reset response: 4 bytes of status, all zero for success
+		binary.BigEndian.PutUint16(buf[10:12], 4)
+		d.tper = false
+		return nil
+	}
+	if d.pending == nil {
+		// Empty ComPacket, nothing outstanding
+		return nil
+	}
+	sublen := uint32(len(d.pending))
+	padded := (sublen + 3) &^ 3
+	binary.BigEndian.PutUint16(buf[4:6], sps)
+	binary.BigEndian.PutUint32(buf[16:20], 24+12+padded)
+	binary.BigEndian.PutUint32(buf[20:24], d.tsn)
+	binary.BigEndian.PutUint32(buf[24:28], d.hsn)
+	binary.BigEndian.PutUint32(buf[40:44], 12+padded)
+	binary.BigEndian.PutUint32(buf[52:56], sublen)
+	copy(buf[56:], d.pending)
+	d.pending = nil
+	return nil
+}
+
+func (d *goldenDrive) Identify() (*drive.Identity, error) { return nil, drive.ErrNotSupported }
+func (d *goldenDrive) SerialNumber() ([]byte, error)      { return nil, drive.ErrNotSupported }
+func (d *goldenDrive) Close() error                       { return nil }
+
+func decoded(b []byte) string {
+	l, err := stream.Decode(b)
+	if err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+	return l.String()
+}
+
+var (
+	opal2D0 = &core.Level0Discovery{
+		TPer:   &feature.TPer{SyncSupported: true},
+		OpalV2: &feature.OpalV2{},
+	}
+	enterpriseD0 = &core.Level0Discovery{
+		TPer:       &feature.TPer{SyncSupported: true},
+		Enterprise: &feature.Enterprise{},
+	}
+)
+
+// Host session number used by the traces, the one sedutil uses
+const goldenHSN = 105
+
+func TestGoldenTraces(t *testing.T) {
+	for _, tc := range []struct {
+		trace string
+		d0    *core.Level0Discovery
+		run   func(t *testing.T, cs *core.ControlSession) error
+	}{
+		{"opal2-msid", opal2D0, func(t *testing.T, cs *core.ControlSession) error {
+			s, err := cs.NewSession(uid.AdminSP, core.WithHSN(goldenHSN), core.WithReadOnly())
+			if err != nil {
+				return err
+			}
+			msid, err := Admin_C_PIN_MSID_GetPIN(s)
+			if err != nil {
+				return err
+			}
+			if string(msid) != "MSIDMSIDMSIDMSID" {
+				t.Errorf("MSID is %q", msid)
+			}
+			return s.Close()
+		}},
+		{"opal2-locking", opal2D0, func(t *testing.T, cs *core.ControlSession) error {
+			s, err := cs.NewSession(uid.LockingSP, core.WithHSN(goldenHSN))
+			if err != nil {
+				return err
+			}
+			if err := ThisSP_Authenticate(s, uid.LockingAuthorityAdmin1, []byte("password")); err != nil {
+				return err
+			}
+			li, err := LockingInfo(s)
+			if err != nil {
+				return err
+			}
+			if li.MaxRanges == nil || *li.MaxRanges != 8 {
+				t.Errorf("unexpected LockingInfo %+v", li)
+			}
+			ranges, err := Locking_Enumerate(s)
+			if err != nil {
+				return err
+			}
+			if len(ranges) != 2 || ranges[0] != uid.GlobalRangeRowUID || ranges[1] != uid.LockingRange1 {
+				t.Errorf("unexpected locking ranges %x", ranges)
+			}
+			r, err := Locking_Get(s, uid.LockingRange1)
+			if err != nil {
+				return err
+			}
+			if r.RangeStart == nil || *r.RangeStart != 2048 || r.RangeLength == nil || *r.RangeLength != 4096 ||
+				r.ReadLocked == nil || !*r.ReadLocked {
+				t.Errorf("unexpected locking range %+v", r)
+			}
+			return s.Close()
+		}},
+		{"opal2-sum", opal2D0, func(t *testing.T, cs *core.ControlSession) error {
+			s, err := cs.NewSession(uid.AdminSP, core.WithHSN(goldenHSN))
+			if err != nil {
+				return err
+			}
+			if err := ThisSP_Authenticate(s, uid.AuthoritySID, []byte("password")); err != nil {
+				return err
+			}
+			if err := LockingSPActivateSUM(s, nil, false); err != nil {
+				return err
+			}
+			if err := s.Close(); err != nil {
+				return err
+			}
+			s, err = cs.NewSession(uid.LockingSP, core.WithHSN(goldenHSN))
+			if err != nil {
+				return err
+			}
+			if err := ThisSP_Authenticate(s, uid.LockingAuthorityAdmin1, []byte("password")); err != nil {
+				return err
+			}
+			ranges := []uid.RowUID{uid.GlobalRangeRowUID, uid.LockingRange1}
+			if err := LockingSPReactivateSUM(s, ranges, true, []byte("newpassword")); err != nil {
+				return err
+			}
+			return s.Close()
+		}},
+		{"enterprise-bandmaster", enterpriseD0, func(t *testing.T, cs *core.ControlSession) error {
+			s, err := cs.NewSession(uid.EnterpriseLockingSP, core.WithHSN(goldenHSN))
+			if err != nil {
+				return err
+			}
+			if err := ThisSP_Authenticate(s, uid.LockingAuthorityBandMaster0, []byte("password")); err != nil {
+				return err
+			}
+			return s.Close()
+		}},
+	} {
+		t.Run(tc.trace, func(t *testing.T) {
+			path := filepath.Join("testdata", "golden", tc.trace+".trace")
+			ex, err := readGolden(path)
+			if err != nil {
+				t.Fatalf("reading golden trace failed: %v", err)
+			}
+			d := &goldenDrive{t: t, ex: ex}
+			cs, err := core.NewControlSession(d, tc.d0, core.WithComID(0x07fe))
+			if err == nil {
+				err = tc.run(t, cs)
+			}
+			if err != nil {
+				t.Fatalf("replaying golden trace failed: %v", err)
+			}
+			if len(d.sent) != len(ex) {
+				t.Errorf("sent %d requests, golden trace has %d", len(d.sent), len(ex))
+			}
+			if *update {
+				if err := updateGolden(path, d.sent); err != nil {
+					t.Fatalf("updating golden trace failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// Fuzz the parsers of Get results with the responses of the golden traces
+// as seeds.
+func FuzzParseGetResult(f *testing.F) {
+	traces, _ := filepath.Glob(filepath.Join("testdata", "golden", "*.trace"))
+	for _, path := range traces {
+		ex, err := readGolden(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, e := range ex {
+			f.Add(e.resp)
+		}
+	}
+	f.Fuzz(func(t *testing.T, b []byte) {
+		reply, err := stream.Decode(b)
+		if err != nil || len(reply) == 0 {
+			return
+		}
+		val, err := parseGetResult(reply)
+		if err != nil {
+			return
+		}
+		parseLockingInfoRow(val)
+		parseLockingRow(val)
+		parseMBRControlRow(val)
+		parseTPerInfoRow(val)
+	})
+}
+
+// Columns of the wrong type or size must result in errors, not panics or
+// silently truncated values.
+func TestMalformedRows(t *testing.T) {
+	parsers := map[string]func(map[string]interface{}) error{
+		"LockingInfo": func(v map[string]interface{}) error { _, err := parseLockingInfoRow(v); return err },
+		"Locking":     func(v map[string]interface{}) error { _, err := parseLockingRow(v); return err },
+		"MBRControl":  func(v map[string]interface{}) error { _, err := parseMBRControlRow(v); return err },
+		"TPerInfo":    func(v map[string]interface{}) error { _, err := parseTPerInfoRow(v); return err },
+	}
+	for _, tc := range []struct {
+		parser string
+		name   string
+		val    map[string]interface{}
+	}{
+		{"LockingInfo", "Short UID", map[string]interface{}{"0": []byte{1, 2}}},
+		{"LockingInfo", "MaxRanges not uint", map[string]interface{}{"4": []byte{8}}},
+		{"LockingInfo", "Short range reference", map[string]interface{}{"393216": stream.List{[]byte{1}}}},
+		{"LockingInfo", "Range list of uints", map[string]interface{}{"393216": stream.List{uint(1)}}},
+		{"Locking", "Short UID", map[string]interface{}{"UID": []byte{}}},
+		{"Locking", "RangeStart not uint", map[string]interface{}{"3": stream.List{}}},
+		{"Locking", "ReadLocked not uint", map[string]interface{}{"7": []byte{1}}},
+		{"Locking", "LockOnReset not list", map[string]interface{}{"9": uint(0)}},
+		{"Locking", "LockOnReset of bytes", map[string]interface{}{"9": stream.List{[]byte{0}}}},
+		{"Locking", "Short ActiveKey", map[string]interface{}{"10": []byte{1, 2, 3}}},
+		{"MBRControl", "Enable not uint", map[string]interface{}{"1": []byte{1}}},
+		{"MBRControl", "Done not uint", map[string]interface{}{"Done": stream.List{}}},
+		{"MBRControl", "MBRDoneOnReset of bytes", map[string]interface{}{"3": stream.List{[]byte{0}}}},
+		{"TPerInfo", "Short UID", map[string]interface{}{"0": []byte{1}}},
+		{"TPerInfo", "Short GUDID", map[string]interface{}{"2": []byte{1, 2, 3}}},
+		{"TPerInfo", "Bytes not uint", map[string]interface{}{"1": []byte{1}}},
+		{"TPerInfo", "SSC of uints", map[string]interface{}{"7": stream.List{uint(1)}}},
+	} {
+		t.Run(tc.parser+"/"+tc.name, func(t *testing.T) {
+			if err := parsers[tc.parser](tc.val); !errors.Is(err, method.ErrMalformedMethodResponse) {
+				t.Errorf("parsing %v returned %v; want %v", tc.val, err, method.ErrMalformedMethodResponse)
+			}
+		})
+	}
+}
+
+// Malformed responses to the MSID read must result in errors, not panics.
+func TestMalformedResponses(t *testing.T) {
+	ex, err := readGolden(filepath.Join("testdata", "golden", "opal2-msid.trace"))
+	if err != nil {
+		t.Fatalf("reading golden trace failed: %v", err)
+	}
+	for _, tc := range []struct {
+		name string
+		resp string
+	}{
+		{"Only status", "F9F0000000F1"},
+		{"Empty status", "F0F1F9F0F1"},
+		{"Empty result", "F0F1F9F0000000F1"},
+		{"Empty row", "F0F0F1F1F9F0000000F1"},
+		{"Truncated name", "F0F0F203F1F1F9F0000000F1"},
+		{"PIN not bytes", "F0F0F20305F3F1F1F9F0000000F1"},
+		{"Truncated atom", "F0F0F203D010"},
+		{"Unbalanced", "F0F0F20303F3F1F9F0000000F1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := hex.DecodeString(tc.resp)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d := &goldenDrive{t: t, ex: append([]goldenExchange{}, ex[:3]...)}
+			d.ex[2].resp = resp
+			cs, err := core.NewControlSession(d, opal2D0, core.WithComID(0x07fe))
+			if err != nil {
+				t.Fatalf("NewControlSession failed: %v", err)
+			}
+			s, err := cs.NewSession(uid.AdminSP, core.WithHSN(goldenHSN), core.WithReadOnly())
+			if err != nil {
+				t.Fatalf("NewSession failed: %v", err)
+			}
+			if pin, err := Admin_C_PIN_MSID_GetPIN(s); err == nil {
+				t.Errorf("Admin_C_PIN_MSID_GetPIN returned %x, want error", pin)
+			}
+		})
+	}
+}
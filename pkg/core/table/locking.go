@@ -7,11 +7,8 @@
 package table
 
 import (
-	"bytes"
-	"encoding/binary"
 	"errors"
 	"fmt"
-	"io"
 
 	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
 	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
@@ -19,7 +16,17 @@ import (
 	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
 )
 
-var ErrMBRNotSupproted = errors.New("drive does not support MBR")
+var ErrMBRNotSupported = errors.New("drive does not support MBR")
+
+// Deprecated: Use ErrMBRNotSupported.
+var ErrMBRNotSupproted = ErrMBRNotSupported
+
+var (
+	Locking_ReadLockEnabled  = Column{5, "ReadLockEnabled"}
+	Locking_WriteLockEnabled = Column{6, "WriteLockEnabled"}
+	Locking_ReadLocked       = Column{7, "ReadLocked"}
+	Locking_WriteLocked      = Column{8, "WriteLocked"}
+)
 
 type (
 	EncryptSupport     uint
@@ -34,6 +41,19 @@ const (
 	ResetHotPlug  ResetType = 2
 )
 
+func (r ResetType) String() string {
+	switch r {
+	case ResetPowerOff:
+		return "Power Cycle"
+	case ResetHardware:
+		return "Hardware"
+	case ResetHotPlug:
+		return "Hot Plug"
+	default:
+		return fmt.Sprintf("ResetType(%d)", uint(r))
+	}
+}
+
 type LockingInfoRow struct {
 	UID                  uid.RowUID
 	Name                 *string
@@ -46,6 +66,13 @@ type LockingInfoRow struct {
 	LogicalBlockSize     *uint32
 	AlignmentGranularity *uint64
 	LowestAlignedLBA     *uint64
+	// Single User Mode Feature Set: the locking objects in Single User Mode,
+	// SingleUserModeAllRanges is set instead if all of them are
+	SingleUserModeRanges    []uid.RowUID
+	SingleUserModeAllRanges bool
+	// Single User Mode Feature Set: 0 if the users of the ranges in Single
+	// User Mode may change RangeStart and RangeLength, 1 if only Admins may
+	RangeStartLengthPolicy *uint32
 }
 
 func LockingSPActivate(s *core.Session) error {
@@ -71,15 +98,21 @@ func LockingInfo(s *core.Session) (*LockingInfoRow, error) {
 	if err != nil {
 		return nil, err
 	}
+	return parseLockingInfoRow(val)
+}
+
+// Parse a LockingInfo row. The columns added by the Single User Mode Feature
+// Set are numbered 0x060000 and 0x060001, which are keyed in decimal.
+func parseLockingInfoRow(val map[string]interface{}) (*LockingInfoRow, error) {
 	row := LockingInfoRow{}
 	for col, val := range val {
 		switch col {
 		case "0", "UID":
 			v, ok := val.([]byte)
-			if !ok {
+			if !ok || len(v) != 8 {
 				return nil, method.ErrMalformedMethodResponse
 			}
-			copy(row.UID[:], v[:8])
+			copy(row.UID[:], v)
 		case "1", "Name":
 			v, ok := val.([]byte)
 			if !ok {
@@ -122,7 +155,7 @@ func LockingInfo(s *core.Session) (*LockingInfoRow, error) {
 			}
 			vv := KeysAvailableConds(v)
 			row.KeysAvailableCfg = &vv
-		case "7":
+		case "7", "AlignmentRequired":
 			v, ok := val.(uint)
 			if !ok {
 				return nil, method.ErrMalformedMethodResponse
@@ -132,27 +165,56 @@ func LockingInfo(s *core.Session) (*LockingInfoRow, error) {
 				vv = true
 			}
 			row.AlignmentRequired = &vv
-		case "8":
+		case "8", "LogicalBlockSize":
 			v, ok := val.(uint)
 			if !ok {
 				return nil, method.ErrMalformedMethodResponse
 			}
 			vv := uint32(v)
 			row.LogicalBlockSize = &vv
-		case "9":
+		case "9", "AlignmentGranularity":
 			v, ok := val.(uint)
 			if !ok {
 				return nil, method.ErrMalformedMethodResponse
 			}
 			vv := uint64(v)
 			row.AlignmentGranularity = &vv
-		case "10":
+		case "10", "LowestAlignedLBA":
 			v, ok := val.(uint)
 			if !ok {
 				return nil, method.ErrMalformedMethodResponse
 			}
 			vv := uint64(v)
 			row.LowestAlignedLBA = &vv
+		case "393216", "SingleUserModeRanges":
+			switch v := val.(type) {
+			case []byte:
+				// A reference to the Locking table selects all ranges
+				if len(v) != 8 {
+					return nil, method.ErrMalformedMethodResponse
+				}
+				row.SingleUserModeAllRanges = true
+			case stream.List:
+				row.SingleUserModeRanges = []uid.RowUID{}
+				for _, e := range v {
+					r, ok := e.([]byte)
+					if !ok || len(r) != 8 {
+						return nil, method.ErrMalformedMethodResponse
+					}
+					var ru uid.RowUID
+					copy(ru[:], r)
+					row.SingleUserModeRanges = append(row.SingleUserModeRanges, ru)
+				}
+			default:
+				return nil, method.ErrMalformedMethodResponse
+			}
+		case "393217", "RangeStartLengthPolicy":
+			v, ok := val.(uint)
+			if !ok {
+				return nil, method.ErrMalformedMethodResponse
+			}
+			vv := uint32(v)
+			row.RangeStartLengthPolicy = &vv
 		}
 	}
 	return &row, nil
@@ -181,6 +243,29 @@ func Locking_Get(s *core.Session, row uid.RowUID) (*LockingRow, error) {
 	if err != nil {
 		return nil, err
 	}
+	return parseLockingRow(val)
+}
+
+// Locking_GetRows reads several rows of the Locking table with as few round
+// trips as the TPer allows. Rows that could not be read are nil.
+func Locking_GetRows(s *core.Session, rows []uid.RowUID) ([]*LockingRow, error) {
+	vals, errs, err := GetFullRows(s, rows)
+	if err != nil {
+		return nil, err
+	}
+	lrs := make([]*LockingRow, len(rows))
+	for i, val := range vals {
+		if errs[i] != nil {
+			continue
+		}
+		if lr, err := parseLockingRow(val); err == nil {
+			lrs[i] = lr
+		}
+	}
+	return lrs, nil
+}
+
+func parseLockingRow(val map[string]interface{}) (*LockingRow, error) {
 	lr := LockingRow{}
 	for col, val := range val {
 		switch col {
@@ -189,7 +274,7 @@ func Locking_Get(s *core.Session, row uid.RowUID) (*LockingRow, error) {
 			if !ok || len(v) != 8 {
 				return nil, method.ErrMalformedMethodResponse
 			}
-			copy(lr.UID[:], v[:8])
+			copy(lr.UID[:], v)
 		case "1", "Name":
 			v, ok := val.([]byte)
 			if !ok {
@@ -339,8 +424,18 @@ func Locking_Set(s *core.Session, row *LockingRow) error {
 		mc.EndOptionalParameter()
 	}
 
-	// TODO: Add these columns
-	// mc.StartOptionalParameter(9, "LockOnReset")
+	// A nil list leaves the column unchanged, an empty one clears it
+	if row.LockOnReset != nil {
+		mc.StartOptionalParameter(9, "LockOnReset")
+		mc.StartList()
+		for _, x := range row.LockOnReset {
+			mc.UInt(uint(x))
+		}
+		mc.EndList()
+		mc.EndOptionalParameter()
+	}
+
+	// TODO: Add this column
 	// mc.StartOptionalParameter(10, "ActiveKey")
 
 	FinishSetCall(s, mc)
@@ -354,19 +449,7 @@ func Admin_C_Pin_Admin1_SetPIN(s *core.Session, password []byte) error {
 	if len(password) < 16 {
 		return fmt.Errorf("invalid length of password hash")
 	}
-	mc := NewSetCall(s, uid.Admin_C_PIN_Admin1Row)
-	mc.Token(stream.StartName)
-	mc.Token(stream.OpalPIN)
-	mc.Bytes(password)
-	mc.Token(stream.EndName)
-	mc.EndList()
-	mc.EndOptionalParameter()
-
-	_, err := s.ExecuteMethod(mc)
-	if err != nil {
-		return err
-	}
-	return nil
+	return C_PIN_SetPIN(s, uid.Admin_C_PIN_Admin1Row, password)
 }
 
 type MBRControl struct {
@@ -402,6 +485,51 @@ func MBRControl_Set(s *core.Session, row *MBRControl) error {
 	return err
 }
 
+func MBRControl_Get(s *core.Session) (*MBRControl, error) {
+	val, err := GetFullRow(s, uid.MBRControlObj)
+	if err != nil {
+		return nil, err
+	}
+	return parseMBRControlRow(val)
+}
+
+func parseMBRControlRow(val map[string]interface{}) (*MBRControl, error) {
+	row := MBRControl{}
+	for col, val := range val {
+		switch col {
+		case "1", "Enable":
+			v, ok := val.(uint)
+			if !ok {
+				return nil, method.ErrMalformedMethodResponse
+			}
+			vv := v > 0
+			row.Enable = &vv
+		case "2", "Done":
+			v, ok := val.(uint)
+			if !ok {
+				return nil, method.ErrMalformedMethodResponse
+			}
+			vv := v > 0
+			row.Done = &vv
+		case "3", "MBRDoneOnReset":
+			vl, ok := val.(stream.List)
+			if !ok {
+				return nil, method.ErrMalformedMethodResponse
+			}
+			vv := []ResetType{}
+			for _, val := range vl {
+				v, ok := val.(uint)
+				if !ok {
+					return nil, method.ErrMalformedMethodResponse
+				}
+				vv = append(vv, ResetType(v))
+			}
+			row.MBRDoneOnReset = &vv
+		}
+	}
+	return &row, nil
+}
+
 type MBRTableInfo struct {
 	// Size in bytes
 	Size uint32
@@ -422,9 +550,14 @@ func (m *MBRTableInfo) SuggestBufferSize(s *core.Session) uint {
 	// Technially we should be fine if the TokenSize is less than the subpacket size
 	// but then we would have to actually, you know, do math.
 	ms -= 16
-	// Align to both MandatoryWriteGranularity and RecommendedAccessGranularity
-	ms = ms & ^uint(m.MandatoryWriteGranularity-1)
-	ms = ms & ^uint(m.RecommendedAccessGranularity-1)
+	// Align to both MandatoryWriteGranularity and RecommendedAccessGranularity,
+	// a granularity of 0 is treated as 1
+	if m.MandatoryWriteGranularity > 1 {
+		ms = ms & ^uint(m.MandatoryWriteGranularity-1)
+	}
+	if m.RecommendedAccessGranularity > 1 {
+		ms = ms & ^uint(m.RecommendedAccessGranularity-1)
+	}
 	return ms
 }
 
@@ -432,7 +565,7 @@ func MBR_TableInfo(s *core.Session) (*MBRTableInfo, error) {
 	tcol, err := GetFullRow(s, uid.Base_TableRowForTable(uid.Locking_MBRTable))
 	if err != nil {
 		if err == ErrEmptyResult {
-			return nil, ErrMBRNotSupproted
+			return nil, ErrMBRNotSupported
 		}
 		return nil, err
 	}
@@ -472,80 +605,25 @@ func MBR_TableInfo(s *core.Session) (*MBRTableInfo, error) {
 }
 
 func MBR_Read(s *core.Session, p []byte, off uint32) (int, error) {
-	mc := method.NewMethodCall(uid.InvokingID(uid.Locking_MBRTable), uid.OpalGet, s.MethodFlags)
-	mc.StartList()
-	mc.StartOptionalParameter(CellBlock_StartRow, "startRow")
-	mc.UInt(uint(off))
-	mc.EndOptionalParameter()
-	mc.StartOptionalParameter(CellBlock_EndRow, "endRow")
-	mc.UInt(uint(off) + uint(len(p)) - 1)
-	mc.EndOptionalParameter()
-	mc.EndList()
-	res, err := s.ExecuteMethod(mc)
-	if err != nil {
-		return 0, err
-	}
-	methodResult, ok := res[0].(stream.List)
-	if !ok {
-		return 0, method.ErrMalformedMethodResponse
-	}
-	if len(methodResult) == 0 {
-		return 0, ErrEmptyResult
-	}
-	inner, ok := methodResult[0].([]uint8)
-	if !ok {
-		return 0, method.ErrMalformedMethodResponse
-	}
-	if len(inner) == 0 {
-		return 0, ErrEmptyResult
-	}
-
-	l := len(inner)
-	if len(p) < l {
-		l = len(p)
-	}
-	copy(p, inner[:l])
-	return l, nil
+	return ReadBytes(s, uid.Locking_MBRTable, p, off)
 }
 
-func LoadPBAImage(s *core.Session, image []byte) error {
-	// Conversion between table and row is required by bad implementation.
-	// ToDo: Refactor uids to be the same for the sake of simplicity
-	var targerUId uid.InvokingID
-	copy(targerUId[:], uid.Locking_MBRTable[:])
-
-	imgReader := bytes.NewReader(image)
-
-	// Calculate max chunk size
-	// Let's do it like sedutil-cli
-	maxSize := s.ControlSession.TPerProperties.MaxComPacketSize - 200 // 200 just picked a random huge number to count for ComPaket and packet headers
-	fpos := uint(0)
-	readChunk := make([]byte, maxSize)
-	for imgReader.Len() > 0 {
-		if imgReader.Len() < int(maxSize) {
-			readChunk = make([]byte, imgReader.Len())
-		}
-		if err := binary.Read(imgReader, binary.LittleEndian, &readChunk); err != nil && !errors.Is(err, io.EOF) {
-			return fmt.Errorf("Read(img) failed: %v", err)
-		}
-		mc := method.NewMethodCall(targerUId, uid.OpalSet, s.MethodFlags)
-		mc.Token(stream.StartName)
-		mc.Token(stream.OpalWhere)
-		mc.UInt(fpos)
-		mc.Token(stream.EndName)
-		mc.Token(stream.StartName)
-		mc.Token(stream.OpalValue)
-		// Here comes the data (Long Atom).
-		mc.Bytes(readChunk)
-		mc.Token(stream.EndName)
-		if _, err := s.ExecuteMethod(mc); err != nil {
-			return err
-		}
-		fpos += maxSize
+// MBR_Write writes p to the MBR table starting at byte offset off.
+//
+// The caller is responsible for keeping len(p) within the token size limits
+// of the session, see MBRTableInfo.SuggestBufferSize.
+func MBR_Write(s *core.Session, p []byte, off uint32) error {
+	return WriteBytes(s, uid.Locking_MBRTable, p, off)
+}
 
-	}
+// DataStore_Read reads from the DataStore table starting at byte offset off.
+func DataStore_Read(s *core.Session, p []byte, off uint32) (int, error) {
+	return ReadBytes(s, uid.Locking_DataStoreTable, p, off)
+}
 
-	return nil
+// DataStore_Write writes p to the DataStore table starting at byte offset off.
+func DataStore_Write(s *core.Session, p []byte, off uint32) error {
+	return WriteBytes(s, uid.Locking_DataStoreTable, p, off)
 }
 
 func RevertLockingSP(s *core.Session, keep bool, pwhash []byte) error {
@@ -568,38 +646,14 @@ func SetBandMaster0Pin(s *core.Session, band0PinHash []byte) error {
 	if s.ProtocolLevel != core.ProtocolLevelEnterprise {
 		return fmt.Errorf("invalid Protocol Level for operation")
 	}
-	mc := NewSetCall(s, uid.Admin_C_Pin_BandMaster0)
-	mc.Token(stream.StartName)
-	mc.Bytes([]byte("PIN"))
-	mc.Bytes(band0PinHash)
-	mc.Token(stream.EndName)
-	mc.EndList()
-	mc.EndList()
-
-	if _, err := s.ExecuteMethod(mc); err != nil {
-		return err
-	}
-
-	return nil
+	return C_PIN_SetPIN(s, uid.Admin_C_Pin_BandMaster0, band0PinHash)
 }
 
 func SetEraseMasterPin(s *core.Session, erasePinHash []byte) error {
 	if s.ProtocolLevel != core.ProtocolLevelEnterprise {
 		return fmt.Errorf("invalid Protocol Level for operation")
 	}
-	mc := NewSetCall(s, uid.Admin_C_Pin_EraseMaster)
-	mc.Token(stream.StartName)
-	mc.Bytes([]byte("PIN"))
-	mc.Bytes(erasePinHash)
-	mc.Token(stream.EndName)
-	mc.EndList()
-	mc.EndList()
-
-	if _, err := s.ExecuteMethod(mc); err != nil {
-		return err
-	}
-
-	return nil
+	return C_PIN_SetPIN(s, uid.Admin_C_Pin_EraseMaster, erasePinHash)
 }
 
 func EraseBand(s *core.Session, band uid.InvokingID) error {
@@ -615,26 +669,14 @@ func EraseBand(s *core.Session, band uid.InvokingID) error {
 	return nil
 }
 
-func EnableGlobalRangeEnterprise(s *core.Session) error {
-	mc := NewSetCall(s, uid.GlobalRangeRowUID)
-	mc.Token(stream.StartName)
-	mc.Bytes([]byte("ReadLockEnabled"))
-	mc.Token(stream.OpalTrue)
-	mc.Token(stream.EndName)
-	mc.Token(stream.StartName)
-	mc.Bytes([]byte("WriteLockEnabled"))
-	mc.Token(stream.OpalTrue)
-	mc.Token(stream.EndName)
-	mc.Token(stream.StartName)
-	mc.Bytes([]byte("ReadLocked"))
-	mc.Token(stream.OpalTrue)
-	mc.Token(stream.EndName)
-	mc.Token(stream.StartName)
-	mc.Bytes([]byte("WriteLocked"))
-	mc.Token(stream.OpalTrue)
-	mc.Token(stream.EndName)
-	mc.EndList()
-	mc.EndList()
+// GenKey generates a new media encryption key for the given K_AES credential
+// object, cryptographically erasing all data protected by the previous key.
+func GenKey(s *core.Session, key uid.RowUID) error {
+	if s.ProtocolLevel == core.ProtocolLevelEnterprise {
+		return fmt.Errorf("invalid Protocol Level for operation")
+	}
+
+	mc := method.NewMethodCall(uid.InvokingID(key), uid.OpalGenKey, s.MethodFlags)
 
 	if _, err := s.ExecuteMethod(mc); err != nil {
 		return err
@@ -642,21 +684,16 @@ func EnableGlobalRangeEnterprise(s *core.Session) error {
 	return nil
 }
 
-func UnlockGlobalRangeEnterprise(s *core.Session, band uid.RowUID) error {
-	mc := NewSetCall(s, band)
-	mc.Token(stream.StartName)
-	mc.Bytes([]byte("ReadLocked"))
-	mc.Token(stream.OpalFalse)
-	mc.Token(stream.EndName)
-	mc.Token(stream.StartName)
-	mc.Bytes([]byte("WriteLocked"))
-	mc.Token(stream.OpalFalse)
-	mc.Token(stream.EndName)
-	mc.EndList()
-	mc.EndList()
+func EnableGlobalRangeEnterprise(s *core.Session) error {
+	return SetColumns(s, uid.GlobalRangeRowUID,
+		ColumnValue{Locking_ReadLockEnabled, true},
+		ColumnValue{Locking_WriteLockEnabled, true},
+		ColumnValue{Locking_ReadLocked, true},
+		ColumnValue{Locking_WriteLocked, true})
+}
 
-	if _, err := s.ExecuteMethod(mc); err != nil {
-		return err
-	}
-	return nil
+func UnlockGlobalRangeEnterprise(s *core.Session, band uid.RowUID) error {
+	return SetColumns(s, band,
+		ColumnValue{Locking_ReadLocked, false},
+		ColumnValue{Locking_WriteLocked, false})
 }
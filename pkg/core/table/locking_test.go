@@ -0,0 +1,43 @@
+package table
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/stream"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+func TestParseLockingInfoRow(t *testing.T) {
+	range1 := uid.RowUID{0x00, 0x00, 0x08, 0x02, 0x00, 0x03, 0x00, 0x01}
+	for _, tc := range []struct {
+		name string
+		in   map[string]interface{}
+		want func(*LockingInfoRow)
+	}{
+		{"Opal", map[string]interface{}{
+			"7": uint(1), "8": uint(4096), "393216": stream.List{range1[:]}, "393217": uint(1),
+		}, func(r *LockingInfoRow) {
+			r.SingleUserModeRanges = []uid.RowUID{range1}
+		}},
+		{"Enterprise names", map[string]interface{}{
+			"AlignmentRequired": uint(1), "LogicalBlockSize": uint(4096),
+			"SingleUserModeRanges": uid.Locking_LockingTable[:], "RangeStartLengthPolicy": uint(1),
+		}, func(r *LockingInfoRow) {
+			r.SingleUserModeAllRanges = true
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseLockingInfoRow(tc.in)
+			if err != nil {
+				t.Fatalf("parseLockingInfoRow() failed: %v", err)
+			}
+			aligned, bs, policy := true, uint32(4096), uint32(1)
+			want := &LockingInfoRow{AlignmentRequired: &aligned, LogicalBlockSize: &bs, RangeStartLengthPolicy: &policy}
+			tc.want(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("parseLockingInfoRow() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
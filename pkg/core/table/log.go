@@ -0,0 +1,71 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Implements reading and clearing the tables of the Log template
+
+package table
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+// LogEntry is a row of a log table. The columns of log entries are mostly
+// vendor specific, so they are returned as read.
+type LogEntry struct {
+	UID    uid.RowUID
+	Values map[string]interface{}
+}
+
+// LogTables returns the log tables of the SP the session is opened to, or
+// none if the SP does not implement the Log template.
+func LogTables(s *core.Session) ([]TableInfo, error) {
+	tables, err := ListTables(s)
+	if err != nil {
+		return nil, err
+	}
+	logs := []TableInfo{}
+	for _, t := range tables {
+		if bytes.Equal(t.UID[:4], uid.Log_LogListTable[:4]) {
+			continue
+		}
+		if bytes.Equal(t.UID[:4], uid.Log_LogTable[:4]) || strings.HasPrefix(t.Name, "Log") {
+			logs = append(logs, t)
+		}
+	}
+	return logs, nil
+}
+
+// Log_Read reads the last max entries of a log table, all of them if max is
+// zero.
+func Log_Read(s *core.Session, log uid.TableUID, max int) ([]LogEntry, error) {
+	rows, err := Enumerate(s, log)
+	if err != nil {
+		return nil, err
+	}
+	if max > 0 && len(rows) > max {
+		rows = rows[len(rows)-max:]
+	}
+	entries := []LogEntry{}
+	for _, row := range rows {
+		val, err := GetFullRow(s, row)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, LogEntry{UID: row, Values: val})
+	}
+	return entries, nil
+}
+
+// Log_Clear removes all entries of a log table. This usually requires an
+// authenticated administrative session.
+func Log_Clear(s *core.Session, log uid.TableUID) error {
+	mc := method.NewMethodCall(uid.InvokingID(log), uid.MethodIDClearLog, s.MethodFlags)
+	_, err := s.ExecuteMethod(mc)
+	return err
+}
@@ -0,0 +1,299 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Implements validation and upload of pre-boot authentication images for the shadow MBR
+
+package table
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
+)
+
+// The shadow MBR is presented to the host as a block device, so images
+// should be padded to the logical block size.
+const PBABlockSize = 512
+
+// Magic of the trailer block added by EmbedPBAChecksum
+var pbaTrailerMagic = []byte("GOTCGPBA")
+
+var (
+	ErrPBAImageEmpty    = errors.New("PBA image is empty")
+	ErrPBAImageTooLarge = errors.New("PBA image does not fit the MBR table")
+)
+
+// PBAImageInfo describes a pre-boot authentication image, see
+// ValidatePBAImage.
+type PBAImageInfo struct {
+	// Size of the image in bytes, including an embedded checksum trailer
+	Size int
+	// Bytes of zero padding needed to align the image to PBABlockSize
+	Padding int
+	// SHA-256 of the image
+	SHA256 [sha256.Size]byte
+
+	// Whether the image ends with a trailer written by EmbedPBAChecksum
+	ChecksumEmbedded bool
+	// Whether the embedded checksum matches the image
+	ChecksumValid bool
+
+	// Whether the first block carries the 0x55AA boot signature
+	BootSignature bool
+	// Partitioning found in the image: "GPT", "MBR", "ISO9660" or empty
+	PartitionTable string
+
+	// Things that are likely to make the image fail to boot
+	Warnings []string
+}
+
+// ValidatePBAImage checks an image before it is written to the shadow MBR.
+// An error is returned if it cannot be written at all; problems that are
+// likely to prevent it from booting are reported as warnings. If mbi is
+// nil the size is not checked against the MBR table.
+func ValidatePBAImage(img []byte, mbi *MBRTableInfo) (*PBAImageInfo, error) {
+	if len(img) == 0 {
+		return nil, ErrPBAImageEmpty
+	}
+	info := &PBAImageInfo{
+		Size:   len(img),
+		SHA256: sha256.Sum256(img),
+	}
+	if mbi != nil && uint64(len(img)) > uint64(mbi.Size) {
+		return nil, fmt.Errorf("%w: image is %d bytes, but the MBR table only holds %d bytes",
+			ErrPBAImageTooLarge, len(img), mbi.Size)
+	}
+	if rem := len(img) % PBABlockSize; rem != 0 {
+		info.Padding = PBABlockSize - rem
+		info.Warnings = append(info.Warnings,
+			fmt.Sprintf("image size is not a multiple of %d bytes, the last block is incomplete", PBABlockSize))
+	}
+	if mbi != nil && mbi.MandatoryWriteGranularity > 1 && len(img)%int(mbi.MandatoryWriteGranularity) != 0 {
+		info.Warnings = append(info.Warnings,
+			fmt.Sprintf("image size is not a multiple of the MBR write granularity %d", mbi.MandatoryWriteGranularity))
+	}
+
+	if body, sum, ok := pbaTrailer(img); ok {
+		info.ChecksumEmbedded = true
+		info.ChecksumValid = sha256.Sum256(body) == sum
+		if !info.ChecksumValid {
+			info.Warnings = append(info.Warnings, "embedded checksum does not match the image")
+		}
+	}
+
+	if len(img) >= PBABlockSize && img[510] == 0x55 && img[511] == 0xAA {
+		info.BootSignature = true
+	}
+	switch {
+	case len(img) >= 2*PBABlockSize && bytes.Equal(img[PBABlockSize:PBABlockSize+8], []byte("EFI PART")):
+		info.PartitionTable = "GPT"
+	case info.BootSignature && hasMBRPartitions(img):
+		info.PartitionTable = "MBR"
+	case len(img) >= 0x8006 && bytes.Equal(img[0x8001:0x8006], []byte("CD001")):
+		info.PartitionTable = "ISO9660"
+	}
+	if !info.BootSignature {
+		info.Warnings = append(info.Warnings, "first block has no boot signature, BIOS systems will not boot the image")
+	}
+	if info.PartitionTable == "" {
+		info.Warnings = append(info.Warnings, "no partition table found, UEFI systems will not find a boot loader")
+	}
+	return info, nil
+}
+
+// EmbedPBAChecksum pads img to a multiple of PBABlockSize and appends a
+// block with its length and SHA-256, which ValidatePBAImage verifies. The
+// trailer makes it possible to check an MBR read back from a drive without
+// having the original image at hand.
+func EmbedPBAChecksum(img []byte) []byte {
+	padded := len(img)
+	if rem := padded % PBABlockSize; rem != 0 {
+		padded += PBABlockSize - rem
+	}
+	res := make([]byte, padded+PBABlockSize)
+	copy(res, img)
+	sum := sha256.Sum256(res[:padded])
+	trailer := res[padded:]
+	copy(trailer, pbaTrailerMagic)
+	binary.BigEndian.PutUint64(trailer[8:16], uint64(padded))
+	copy(trailer[16:], sum[:])
+	return res
+}
+
+// Find the trailer written by EmbedPBAChecksum, returning the image it
+// covers and the recorded checksum.
+func pbaTrailer(img []byte) ([]byte, [sha256.Size]byte, bool) {
+	var sum [sha256.Size]byte
+	if len(img) < PBABlockSize || len(img)%PBABlockSize != 0 {
+		return nil, sum, false
+	}
+	trailer := img[len(img)-PBABlockSize:]
+	if !bytes.Equal(trailer[:8], pbaTrailerMagic) {
+		return nil, sum, false
+	}
+	n := binary.BigEndian.Uint64(trailer[8:16])
+	if n != uint64(len(img)-PBABlockSize) {
+		return nil, sum, false
+	}
+	copy(sum[:], trailer[16:])
+	return img[:n], sum, true
+}
+
+// Whether any of the four primary partition entries is in use.
+func hasMBRPartitions(img []byte) bool {
+	for i := 0; i < 4; i++ {
+		// Partition type of entry i
+		if img[446+i*16+4] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+var ErrPBAVerifyFailed = errors.New("MBR contents do not match the PBA image")
+
+// PBAWriteError is returned by LoadPBAImage when writing a chunk failed.
+// Passing Offset to WithStartOffset resumes the upload.
+type PBAWriteError struct {
+	Offset uint32
+	Err    error
+}
+
+func (e *PBAWriteError) Error() string {
+	return fmt.Sprintf("writing PBA image failed at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e *PBAWriteError) Unwrap() error {
+	return e.Err
+}
+
+// PBAProgressFunc is called after every chunk written or verified by
+// LoadPBAImage with the number of bytes done so far.
+type PBAProgressFunc func(verifying bool, done, total uint32)
+
+type loadPBAConfig struct {
+	offset   uint32
+	verify   bool
+	retries  int
+	backoff  time.Duration
+	progress PBAProgressFunc
+}
+
+type LoadPBAOpt func(lc *loadPBAConfig)
+
+// Start writing at the given byte offset of the image, e.g. to resume an
+// upload that failed with a PBAWriteError.
+func WithStartOffset(off uint32) LoadPBAOpt {
+	return func(lc *loadPBAConfig) {
+		lc.offset = off
+	}
+}
+
+// Read back the whole image after writing it and compare it.
+func WithVerify() LoadPBAOpt {
+	return func(lc *loadPBAConfig) {
+		lc.verify = true
+	}
+}
+
+// Retry a chunk up to n times if the SP reports to be busy, waiting a
+// little longer after each attempt.
+func WithBusyRetries(n int) LoadPBAOpt {
+	return func(lc *loadPBAConfig) {
+		lc.retries = n
+	}
+}
+
+func WithProgress(fn PBAProgressFunc) LoadPBAOpt {
+	return func(lc *loadPBAConfig) {
+		lc.progress = fn
+	}
+}
+
+// LoadPBAImage writes image to the shadow MBR in chunks that fit the
+// session's token size limits.
+func LoadPBAImage(s *core.Session, image []byte, opts ...LoadPBAOpt) error {
+	lc := loadPBAConfig{
+		retries: 5,
+		backoff: 100 * time.Millisecond,
+	}
+	for _, o := range opts {
+		o(&lc)
+	}
+	total := uint32(len(image))
+	if lc.offset > total {
+		return fmt.Errorf("offset %d is beyond the end of the %d byte image", lc.offset, total)
+	}
+
+	chunk := uint32(0)
+	if mbi, err := MBR_TableInfo(s); err == nil {
+		if mbi.MandatoryWriteGranularity > 1 && lc.offset%mbi.MandatoryWriteGranularity != 0 {
+			return fmt.Errorf("offset %d is not a multiple of the write granularity %d", lc.offset, mbi.MandatoryWriteGranularity)
+		}
+		chunk = uint32(mbi.SuggestBufferSize(s))
+		if chunk == 0 {
+			return fmt.Errorf("granularity of the MBR table (write %d, access %d) exceeds the token size limit of the session",
+				mbi.MandatoryWriteGranularity, mbi.RecommendedAccessGranularity)
+		}
+	} else {
+		// Not all drives describe the MBR table, fall back to what sedutil-cli does.
+		// 200 just picked a random huge number to count for ComPacket and packet headers.
+		chunk = uint32(s.ControlSession.TPerProperties.MaxComPacketSize) - 200
+	}
+
+	for pos := lc.offset; pos < total; {
+		end := pos + chunk
+		if end > total {
+			end = total
+		}
+		err := MBR_Write(s, image[pos:end], pos)
+		for i := 0; i < lc.retries && errors.Is(err, method.ErrMethodStatusSPBusy); i++ {
+			time.Sleep(lc.backoff * time.Duration(i+1))
+			err = MBR_Write(s, image[pos:end], pos)
+		}
+		if err != nil {
+			return &PBAWriteError{Offset: pos, Err: err}
+		}
+		pos = end
+		if lc.progress != nil {
+			lc.progress(false, pos, total)
+		}
+	}
+
+	if !lc.verify {
+		return nil
+	}
+	buf := make([]byte, chunk)
+	for pos := uint32(0); pos < total; {
+		n := chunk
+		if total-pos < n {
+			n = total - pos
+		}
+		got, err := MBR_Read(s, buf[:n], pos)
+		if err != nil {
+			return fmt.Errorf("reading back MBR failed at offset %d: %v", pos, err)
+		}
+		if got == 0 {
+			return fmt.Errorf("reading back MBR failed at offset %d: %v", pos, ErrEmptyResult)
+		}
+		if !bytes.Equal(buf[:got], image[pos:pos+uint32(got)]) {
+			off := pos
+			for i := 0; i < got && buf[i] == image[pos+uint32(i)]; i++ {
+				off++
+			}
+			return fmt.Errorf("%w: first difference at offset %d", ErrPBAVerifyFailed, off)
+		}
+		pos += uint32(got)
+		if lc.progress != nil {
+			lc.progress(true, pos, total)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package table
+
+import (
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+func TestValidatePBAImage(t *testing.T) {
+	mbr := make([]byte, 1024)
+	mbr[510], mbr[511] = 0x55, 0xAA
+	mbr[446+4] = 0x0c
+	gpt := make([]byte, 1024)
+	gpt[510], gpt[511] = 0x55, 0xAA
+	copy(gpt[512:], "EFI PART")
+	corrupt := EmbedPBAChecksum(mbr)
+	corrupt[0] = 1
+
+	for _, tc := range []struct {
+		name      string
+		img       []byte
+		size      uint32
+		err       error
+		table     string
+		padding   int
+		checksum  bool
+		valid     bool
+		nWarnings int
+	}{
+		{name: "empty", img: nil, size: 4096, err: ErrPBAImageEmpty},
+		{name: "too large", img: mbr, size: 512, err: ErrPBAImageTooLarge},
+		{name: "mbr", img: mbr, size: 4096, table: "MBR"},
+		{name: "gpt", img: gpt, size: 4096, table: "GPT"},
+		{name: "unaligned", img: mbr[:1000], size: 4096, table: "MBR", padding: 24, nWarnings: 1},
+		{name: "no boot signature", img: make([]byte, 512), size: 4096, nWarnings: 2},
+		{name: "checksum", img: EmbedPBAChecksum(mbr[:1000]), size: 4096, table: "MBR", checksum: true, valid: true},
+		{name: "bad checksum", img: corrupt, size: 4096, table: "MBR", checksum: true, nWarnings: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			info, err := ValidatePBAImage(tc.img, &MBRTableInfo{Size: tc.size, MandatoryWriteGranularity: 1})
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("ValidatePBAImage() returned %v, want %v", err, tc.err)
+			}
+			if err != nil {
+				return
+			}
+			if info.PartitionTable != tc.table || info.Padding != tc.padding ||
+				info.ChecksumEmbedded != tc.checksum || info.ChecksumValid != tc.valid ||
+				len(info.Warnings) != tc.nWarnings {
+				t.Errorf("ValidatePBAImage() = %+v", info)
+			}
+		})
+	}
+}
+
+func TestSuggestBufferSize(t *testing.T) {
+	s := &core.Session{ControlSession: &core.ControlSession{HostProperties: core.HostProperties{MaxIndTokenSize: 2064}}}
+	for _, tc := range []struct {
+		name        string
+		write, read uint32
+		want        uint
+	}{
+		{"unaligned", 1, 1, 2048},
+		{"aligned", 512, 1024, 2048},
+		{"aligned to write", 1024, 1, 2048},
+		// Some TPers report 0, which must not divide by zero or mask all bits
+		{"zero granularity", 0, 0, 2048},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mbi := &MBRTableInfo{MandatoryWriteGranularity: tc.write, RecommendedAccessGranularity: tc.read}
+			if got := mbi.SuggestBufferSize(s); got != tc.want {
+				t.Errorf("SuggestBufferSize() = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+// A write granularity larger than the token size limit leaves no room for a
+// single chunk, which must fail instead of writing empty chunks forever.
+func TestLoadPBAImageGranularity(t *testing.T) {
+	ex, err := readGolden(filepath.Join("testdata", "golden", "opal2-locking.trace"))
+	if err != nil {
+		t.Fatalf("reading golden trace failed: %v", err)
+	}
+	// Get of the MBR row of the Table table, returning a Size of 128 MiB
+	// and a MandatoryWriteGranularity of 1 MiB
+	req, _ := hex.DecodeString("F8A80000000100000804A80000000600000016F0F0F1F1F9F0000000F1")
+	resp, _ := hex.DecodeString("F0F0F2078408000000F3F20D83100000F3F1F1F9F0000000F1")
+	d := &goldenDrive{t: t, ex: append(append([]goldenExchange{}, ex[:3]...), goldenExchange{req, resp})}
+	cs, err := core.NewControlSession(d, opal2D0, core.WithComID(0x07fe))
+	if err != nil {
+		t.Fatalf("NewControlSession failed: %v", err)
+	}
+	s, err := cs.NewSession(uid.LockingSP, core.WithHSN(goldenHSN))
+	if err != nil {
+		t.Fatalf("NewSession failed: %v", err)
+	}
+	if err := ThisSP_Authenticate(s, uid.LockingAuthorityAdmin1, []byte("password")); err != nil {
+		t.Fatalf("ThisSP_Authenticate failed: %v", err)
+	}
+	err = LoadPBAImage(s, make([]byte, 4096))
+	if err == nil || !strings.Contains(err.Error(), "exceeds the token size limit") {
+		t.Errorf("LoadPBAImage() returned %v", err)
+	}
+	if len(d.sent) != len(d.ex) {
+		t.Errorf("sent %d requests, want %d", len(d.sent), len(d.ex))
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Implements reading the Table and Column meta-tables
+
+package table
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+type TableKind uint
+
+const (
+	TableKindObject TableKind = 1
+	TableKindByte   TableKind = 2
+)
+
+func (k TableKind) String() string {
+	switch k {
+	case TableKindObject:
+		return "Object"
+	case TableKindByte:
+		return "Byte"
+	default:
+		return fmt.Sprintf("Kind(%d)", uint(k))
+	}
+}
+
+// TableInfo is a row of the Table table, describing a table of the SP.
+type TableInfo struct {
+	UID  uid.TableUID
+	Name string
+	Kind TableKind
+	// First row of the Column table describing the columns of the table
+	Column     *uid.RowUID
+	NumColumns uint
+	// Number of rows, or bytes of a byte table
+	Rows    uint
+	MaxSize uint
+}
+
+// ColumnInfo is a row of the Column table, describing a column of a table.
+type ColumnInfo struct {
+	// Number of the column in its table
+	Number   uint
+	UID      uid.RowUID
+	Name     string
+	IsUnique bool
+	Type     *uid.RowUID
+}
+
+func parseTableRow(row uid.RowUID, val map[string]interface{}) (*TableInfo, error) {
+	// The Table table row of a table carries the upper half of its UID
+	ti := &TableInfo{UID: uid.TableUID{row[4], row[5], row[6], row[7]}}
+	for col, val := range val {
+		switch col {
+		case "1", "Name":
+			v, ok := val.([]byte)
+			if !ok {
+				return nil, method.ErrMalformedMethodResponse
+			}
+			ti.Name = string(v)
+		case "4", "Kind":
+			v, ok := val.(uint)
+			if !ok {
+				return nil, method.ErrMalformedMethodResponse
+			}
+			ti.Kind = TableKind(v)
+		case "5", "Column":
+			v, ok := val.([]byte)
+			if !ok || len(v) != 8 {
+				return nil, method.ErrMalformedMethodResponse
+			}
+			r := uid.RowUID{}
+			copy(r[:], v)
+			ti.Column = &r
+		case "6", "NumColumns":
+			v, ok := val.(uint)
+			if !ok {
+				return nil, method.ErrMalformedMethodResponse
+			}
+			ti.NumColumns = v
+		case "7", "Rows":
+			v, ok := val.(uint)
+			if !ok {
+				return nil, method.ErrMalformedMethodResponse
+			}
+			ti.Rows = v
+		case "12", "MaxSize":
+			v, ok := val.(uint)
+			if !ok {
+				return nil, method.ErrMalformedMethodResponse
+			}
+			ti.MaxSize = v
+		}
+	}
+	return ti, nil
+}
+
+func parseColumnRow(row uid.RowUID, number uint, val map[string]interface{}) (*ColumnInfo, error) {
+	ci := &ColumnInfo{Number: number, UID: row}
+	for col, val := range val {
+		switch col {
+		case "1", "Name":
+			v, ok := val.([]byte)
+			if !ok {
+				return nil, method.ErrMalformedMethodResponse
+			}
+			ci.Name = string(v)
+		case "3", "IsUnique":
+			v, ok := val.(uint)
+			if !ok {
+				return nil, method.ErrMalformedMethodResponse
+			}
+			ci.IsUnique = v != 0
+		case "4", "ColumnType":
+			v, ok := val.([]byte)
+			if !ok || len(v) != 8 {
+				return nil, method.ErrMalformedMethodResponse
+			}
+			r := uid.RowUID{}
+			copy(r[:], v)
+			ci.Type = &r
+		}
+	}
+	return ci, nil
+}
+
+// ListTables enumerates the tables of the SP the session is opened to.
+func ListTables(s *core.Session) ([]TableInfo, error) {
+	rows, err := Enumerate(s, uid.Base_TableTable)
+	if err != nil {
+		return nil, err
+	}
+	tables := []TableInfo{}
+	for _, row := range rows {
+		val, err := GetFullRow(s, row)
+		if err != nil {
+			return nil, fmt.Errorf("reading table %x failed: %v", row[:], err)
+		}
+		ti, err := parseTableRow(row, val)
+		if err != nil {
+			return nil, fmt.Errorf("reading table %x failed: %v", row[:], err)
+		}
+		tables = append(tables, *ti)
+	}
+	return tables, nil
+}
+
+// Columns reads the description of the columns of a table from the Column
+// table. The Column table is optional in the Opal family SSCs, many drives
+// do not implement it.
+func Columns(s *core.Session, table uid.TableUID) ([]ColumnInfo, error) {
+	row := uid.Base_TableRowForTable(table)
+	val, err := GetFullRow(s, row)
+	if err != nil {
+		return nil, err
+	}
+	ti, err := parseTableRow(row, val)
+	if err != nil {
+		return nil, err
+	}
+	if ti.Column == nil {
+		return nil, fmt.Errorf("table %x has no column description", table[:4])
+	}
+	// The columns of a table are described by consecutive rows
+	cols := []ColumnInfo{}
+	first := binary.BigEndian.Uint32(ti.Column[4:])
+	for n := uint(0); n < ti.NumColumns; n++ {
+		r := *ti.Column
+		binary.BigEndian.PutUint32(r[4:], first+uint32(n))
+		val, err := GetFullRow(s, r)
+		if err != nil {
+			return nil, fmt.Errorf("reading column %d failed: %v", n, err)
+		}
+		ci, err := parseColumnRow(r, n, val)
+		if err != nil {
+			return nil, fmt.Errorf("reading column %d failed: %v", n, err)
+		}
+		cols = append(cols, *ci)
+	}
+	return cols, nil
+}
+
+// ColumnNumber returns the number of the column with the given name.
+func ColumnNumber(cols []ColumnInfo, name string) (uint, bool) {
+	for _, c := range cols {
+		if c.Name == name {
+			return c.Number, true
+		}
+	}
+	return 0, false
+}
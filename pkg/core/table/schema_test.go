@@ -0,0 +1,49 @@
+package table
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+func TestParseTableRow(t *testing.T) {
+	col := uid.RowUID{0x00, 0x00, 0x00, 0x04, 0x00, 0x00, 0x08, 0x02}
+	row := uid.Base_TableRowForTable(uid.Locking_LockingTable)
+	got, err := parseTableRow(row, map[string]interface{}{
+		"0": row[:],
+		"1": []byte("Locking"),
+		"4": uint(1),
+		"5": col[:],
+		"6": uint(19),
+		"7": uint(9),
+	})
+	if err != nil {
+		t.Fatalf("parseTableRow() failed: %v", err)
+	}
+	want := &TableInfo{
+		UID:        uid.Locking_LockingTable,
+		Name:       "Locking",
+		Kind:       TableKindObject,
+		Column:     &col,
+		NumColumns: 19,
+		Rows:       9,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTableRow() = %+v, want %+v", got, want)
+	}
+
+	if _, err := parseTableRow(row, map[string]interface{}{"5": []byte{1, 2}}); err == nil {
+		t.Errorf("parseTableRow() accepted a malformed Column reference")
+	}
+}
+
+func TestColumnNumber(t *testing.T) {
+	cols := []ColumnInfo{{Number: 0, Name: "UID"}, {Number: 3, Name: "RangeStart"}}
+	if n, ok := ColumnNumber(cols, "RangeStart"); !ok || n != 3 {
+		t.Errorf("ColumnNumber(RangeStart) = %d, %v", n, ok)
+	}
+	if _, ok := ColumnNumber(cols, "LockOnReset"); ok {
+		t.Errorf("ColumnNumber(LockOnReset) found a column")
+	}
+}
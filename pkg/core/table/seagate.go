@@ -0,0 +1,111 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Implements the vendor specific Port table of Seagate drives
+
+package table
+
+import (
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/stream"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+var (
+	Seagate_Port_LockOnReset = Column{2, "LockOnReset"}
+	Seagate_Port_PortLocked  = Column{3, "PortLocked"}
+)
+
+// SeagatePortRow is a row of the Port table of the Admin SP, which controls
+// the firmware download and diagnostic ports of Seagate drives. Changing it
+// requires the session to be authenticated as SID.
+type SeagatePortRow struct {
+	UID         uid.RowUID
+	Name        *string
+	LockOnReset []ResetType
+	PortLocked  *bool
+}
+
+// SeagatePortFromIdentifier returns the Port row of a port identifier as
+// reported by the Seagate ports feature of Level 0 Discovery.
+func SeagatePortFromIdentifier(ident int32) (uid.RowUID, bool) {
+	switch ident {
+	case 0x01000002:
+		return uid.Seagate_Port_FWDownload, true
+	case 0x0100000E:
+		return uid.Seagate_Port_UDS, true
+	}
+	return uid.RowUID{}, false
+}
+
+func Seagate_Port_Get(s *core.Session, row uid.RowUID) (*SeagatePortRow, error) {
+	val, err := GetFullRow(s, row)
+	if err != nil {
+		return nil, err
+	}
+	return parseSeagatePortRow(val)
+}
+
+func parseSeagatePortRow(val map[string]interface{}) (*SeagatePortRow, error) {
+	row := SeagatePortRow{}
+	for col, val := range val {
+		switch col {
+		case "0", "UID":
+			v, ok := val.([]byte)
+			if !ok || len(v) != 8 {
+				return nil, method.ErrMalformedMethodResponse
+			}
+			copy(row.UID[:], v)
+		case "1", "Name":
+			v, ok := val.([]byte)
+			if !ok {
+				return nil, method.ErrMalformedMethodResponse
+			}
+			vv := string(v)
+			row.Name = &vv
+		case "2", "LockOnReset":
+			vl, ok := val.(stream.List)
+			if !ok {
+				return nil, method.ErrMalformedMethodResponse
+			}
+			row.LockOnReset = []ResetType{}
+			for _, val := range vl {
+				v, ok := val.(uint)
+				if !ok {
+					return nil, method.ErrMalformedMethodResponse
+				}
+				row.LockOnReset = append(row.LockOnReset, ResetType(v))
+			}
+		case "3", "PortLocked":
+			v, ok := val.(uint)
+			if !ok {
+				return nil, method.ErrMalformedMethodResponse
+			}
+			vv := v > 0
+			row.PortLocked = &vv
+		}
+	}
+	return &row, nil
+}
+
+// Seagate_Port_SetLocked locks or unlocks a port.
+func Seagate_Port_SetLocked(s *core.Session, row uid.RowUID, locked bool) error {
+	return SetColumns(s, row, ColumnValue{Seagate_Port_PortLocked, locked})
+}
+
+// Seagate_Port_SetLockOnReset selects the resets that lock the port again.
+func Seagate_Port_SetLockOnReset(s *core.Session, row uid.RowUID, types []ResetType) error {
+	mc := NewSetCall(s, row)
+	mc.StartOptionalParameter(Seagate_Port_LockOnReset.Num, Seagate_Port_LockOnReset.Name)
+	mc.StartList()
+	for _, t := range types {
+		mc.UInt(uint(t))
+	}
+	mc.EndList()
+	mc.EndOptionalParameter()
+	FinishSetCall(s, mc)
+	_, err := s.ExecuteMethod(mc)
+	return err
+}
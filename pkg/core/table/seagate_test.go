@@ -0,0 +1,38 @@
+package table
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/stream"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+func TestParseSeagatePortRow(t *testing.T) {
+	name := "FWDownload"
+	locked := true
+	for _, tc := range []struct {
+		name    string
+		in      map[string]interface{}
+		want    *SeagatePortRow
+		wantErr bool
+	}{
+		{"locked", map[string]interface{}{
+			"0": uid.Seagate_Port_FWDownload[:], "1": []byte(name), "2": stream.List{uint(0)}, "3": uint(1),
+		}, &SeagatePortRow{
+			UID: uid.Seagate_Port_FWDownload, Name: &name,
+			LockOnReset: []ResetType{ResetPowerOff}, PortLocked: &locked,
+		}, false},
+		{"malformed PortLocked", map[string]interface{}{"3": []byte{1}}, nil, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseSeagatePortRow(tc.in)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("parseSeagatePortRow() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parseSeagatePortRow() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Implements TCG Storage Core Table operations on the SecretProtect table
+
+package table
+
+import (
+	"fmt"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/stream"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+// ProtectMechanism is a protect_types value describing how a secret column
+// is protected by the TPer.
+type ProtectMechanism uint
+
+const (
+	ProtectNone                       ProtectMechanism = 0
+	ProtectAuthenticationDataRequired ProtectMechanism = 1
+)
+
+var SecretProtect_ColumnProtectMechanisms uint = 3
+
+// ref: 5.3.2.16 SecretProtect (Object Table)
+type SecretProtectRow struct {
+	UID uid.RowUID
+	// Table holding the protected column, e.g. K_AES_256 or C_PIN
+	Table        *uid.TableUID
+	ColumnNumber *uint
+	// A nil list means the column was not returned
+	ProtectMechanisms []ProtectMechanism
+}
+
+// SecretProtect_Get reads a row of the SecretProtect table.
+func SecretProtect_Get(s *core.Session, row uid.RowUID) (*SecretProtectRow, error) {
+	if s.ProtocolLevel == core.ProtocolLevelEnterprise {
+		return nil, fmt.Errorf("invalid Protocol Level for operation")
+	}
+	val, err := GetFullRow(s, row)
+	if err != nil {
+		return nil, err
+	}
+	return parseSecretProtectRow(val)
+}
+
+func parseSecretProtectRow(val map[string]interface{}) (*SecretProtectRow, error) {
+	row := SecretProtectRow{}
+	for col, val := range val {
+		switch col {
+		case "0":
+			v, ok := val.([]byte)
+			if !ok || len(v) != 8 {
+				return nil, method.ErrMalformedMethodResponse
+			}
+			copy(row.UID[:], v)
+		case "1":
+			v, ok := val.([]byte)
+			if !ok || len(v) != 8 {
+				return nil, method.ErrMalformedMethodResponse
+			}
+			vv := uid.TableUID{}
+			copy(vv[:], v)
+			row.Table = &vv
+		case "2":
+			v, ok := val.(uint)
+			if !ok {
+				return nil, method.ErrMalformedMethodResponse
+			}
+			row.ColumnNumber = &v
+		case "3":
+			vl, ok := val.(stream.List)
+			if !ok {
+				return nil, method.ErrMalformedMethodResponse
+			}
+			vv := []ProtectMechanism{}
+			for _, val := range vl {
+				v, ok := val.(uint)
+				if !ok {
+					return nil, method.ErrMalformedMethodResponse
+				}
+				vv = append(vv, ProtectMechanism(v))
+			}
+			row.ProtectMechanisms = vv
+		}
+	}
+	return &row, nil
+}
+
+// SecretProtect_SetProtectMechanisms replaces the ProtectMechanisms column of
+// a SecretProtect row.
+func SecretProtect_SetProtectMechanisms(s *core.Session, row uid.RowUID, mechs []ProtectMechanism) error {
+	if s.ProtocolLevel == core.ProtocolLevelEnterprise {
+		return fmt.Errorf("invalid Protocol Level for operation")
+	}
+	mc := NewSetCall(s, row)
+	mc.StartOptionalParameter(SecretProtect_ColumnProtectMechanisms, "ProtectMechanisms")
+	mc.StartList()
+	for _, m := range mechs {
+		mc.UInt(uint(m))
+	}
+	mc.EndList()
+	mc.EndOptionalParameter()
+	FinishSetCall(s, mc)
+	_, err := s.ExecuteMethod(mc)
+	return err
+}
@@ -0,0 +1,41 @@
+package table
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/stream"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+func TestParseSecretProtectRow(t *testing.T) {
+	row := uid.RowUID{0x00, 0x00, 0x00, 0x1D, 0x00, 0x00, 0x00, 0x1E}
+	col := uint(3)
+	for _, tc := range []struct {
+		name    string
+		in      map[string]interface{}
+		want    *SecretProtectRow
+		wantErr bool
+	}{
+		{"K_AES_256", map[string]interface{}{
+			"0": row[:], "1": uid.Locking_K_AES_256Table[:], "2": uint(3), "3": stream.List{uint(1)},
+		}, &SecretProtectRow{
+			UID: row, Table: &uid.Locking_K_AES_256Table, ColumnNumber: &col,
+			ProtectMechanisms: []ProtectMechanism{ProtectAuthenticationDataRequired},
+		}, false},
+		{"empty mechanisms", map[string]interface{}{"3": stream.List{}}, &SecretProtectRow{
+			ProtectMechanisms: []ProtectMechanism{},
+		}, false},
+		{"malformed mechanism", map[string]interface{}{"3": stream.List{[]byte{1}}}, nil, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseSecretProtectRow(tc.in)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("parseSecretProtectRow() error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("parseSecretProtectRow() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
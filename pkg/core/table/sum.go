@@ -0,0 +1,71 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Implements the Opal Single User Mode (SUM) Feature Set extensions
+// to the Activate and Reactivate methods
+
+package table
+
+import (
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+// Optional parameters of Activate and Reactivate as defined in
+// "Opal SSC Feature Set: Single User Mode", 3.1.1 and 3.1.2.
+const (
+	sumParamSelectionList uint = 0x060000
+	sumParamRangePolicy   uint = 0x060001
+	sumParamAdmin1PIN     uint = 0x060002
+)
+
+// addSUMParameters encodes the Single User Mode selection list. If ranges is
+// empty the whole Locking table, i.e. all locking objects, are selected.
+// If adminPolicy is set only Admins may change RangeStart and RangeLength of
+// locking objects in Single User Mode.
+func addSUMParameters(mc *method.MethodCall, ranges []uid.RowUID, adminPolicy bool) {
+	mc.StartOptionalParameter(sumParamSelectionList, "SingleUserModeSelectionList")
+	if len(ranges) == 0 {
+		mc.Bytes(uid.Locking_LockingTable[:])
+	} else {
+		mc.StartList()
+		for _, r := range ranges {
+			mc.Bytes(r[:])
+		}
+		mc.EndList()
+	}
+	mc.EndOptionalParameter()
+	mc.StartOptionalParameter(sumParamRangePolicy, "RangeStartRangeLengthPolicy")
+	mc.Bool(adminPolicy)
+	mc.EndOptionalParameter()
+}
+
+// LockingSPActivateSUM activates the Locking SP like LockingSPActivate, but
+// puts the selected locking ranges into Single User Mode. Each range in Single
+// User Mode is owned by exactly one user authority (User1 for the global range,
+// UserN+1 for range N), and only that user may change its PIN and locking state.
+func LockingSPActivateSUM(s *core.Session, ranges []uid.RowUID, adminPolicy bool) error {
+	var lockingsp uid.InvokingID
+	copy(lockingsp[:], uid.LockingSP[:])
+	mc := method.NewMethodCall(lockingsp, uid.MethodIDActivate, s.MethodFlags)
+	addSUMParameters(mc, ranges, adminPolicy)
+	_, err := s.ExecuteMethod(mc)
+	return err
+}
+
+// LockingSPReactivateSUM changes the set of ranges in Single User Mode of an
+// already active Locking SP. This requires the session to be authenticated as
+// Admin1. If admin1PIN is not nil the Admin1 PIN is changed as well.
+func LockingSPReactivateSUM(s *core.Session, ranges []uid.RowUID, adminPolicy bool, admin1PIN []byte) error {
+	mc := method.NewMethodCall(uid.InvokeIDThisSP, uid.OpalReactivate, s.MethodFlags)
+	addSUMParameters(mc, ranges, adminPolicy)
+	if admin1PIN != nil {
+		mc.StartOptionalParameter(sumParamAdmin1PIN, "Admin1PIN")
+		mc.Bytes(admin1PIN)
+		mc.EndOptionalParameter()
+	}
+	_, err := s.ExecuteMethod(mc)
+	return err
+}
@@ -41,41 +41,28 @@ func GetCell(s *core.Session, row uid.RowUID, column uint, columnName string) (i
 }
 
 func GetPartialRow(s *core.Session, row uid.RowUID, startCol uint, startColName string, endCol uint, endColName string) (map[string]interface{}, error) {
-	getUID := uid.MethodID{}
-	if s.ProtocolLevel == core.ProtocolLevelEnterprise {
-		copy(getUID[:], uid.OpalEnterpriseGet[:])
-	} else {
-		copy(getUID[:], uid.OpalGet[:])
+	resp, err := GetCellBlock(s, uid.InvokingID(row), CellBlock{
+		StartColumn: &startCol, StartColumnName: startColName,
+		EndColumn: &endCol, EndColumnName: endColName,
+	})
+	if err != nil {
+		return nil, err
 	}
-	mc := method.NewMethodCall(uid.InvokingID(row), getUID, s.MethodFlags)
-	mc.StartList()
-	mc.StartOptionalParameter(CellBlock_StartColumn, "startColumn")
-	if s.ProtocolLevel == core.ProtocolLevelEnterprise {
-		mc.Bytes([]byte(startColName))
-	} else {
-		mc.UInt(startCol)
+	val, err := parseGetResult(resp)
+	if err != nil {
+		return nil, err
 	}
-	mc.EndOptionalParameter()
-	mc.StartOptionalParameter(CellBlock_EndColumn, "endColumn")
-	if s.ProtocolLevel == core.ProtocolLevelEnterprise {
-		mc.Bytes([]byte(endColName))
-	} else {
-		mc.UInt(endCol)
+	if len(val) == 0 {
+		return nil, ErrEmptyResult
 	}
-	mc.EndOptionalParameter()
-	mc.EndList()
-	resp, err := s.ExecuteMethod(mc)
+	return val, nil
+}
+
+func GetFullRow(s *core.Session, row uid.RowUID) (map[string]interface{}, error) {
+	resp, err := GetCellBlock(s, uid.InvokingID(row), CellBlock{})
 	if err != nil {
 		return nil, err
 	}
-	// The Enterprise Get has an extra level of lists
-	if s.ProtocolLevel == core.ProtocolLevelEnterprise {
-		var ok bool
-		resp, ok = resp[0].(stream.List)
-		if !ok {
-			return nil, method.ErrMalformedMethodResponse
-		}
-	}
 	val, err := parseGetResult(resp)
 	if err != nil {
 		return nil, err
@@ -86,46 +73,221 @@ func GetPartialRow(s *core.Session, row uid.RowUID, startCol uint, startColName
 	return val, nil
 }
 
-func GetFullRow(s *core.Session, row uid.RowUID) (map[string]interface{}, error) {
-	getUID := uid.MethodID{}
-	if s.ProtocolLevel == core.ProtocolLevelEnterprise {
-		copy(getUID[:], uid.OpalEnterpriseGet[:])
-	} else {
-		copy(getUID[:], uid.OpalGet[:])
+// GetFullRows reads several rows with as few round trips as the TPer allows,
+// see core.Session.ExecuteMethods. The values or the error of each row are
+// returned in order.
+func GetFullRows(s *core.Session, rows []uid.RowUID) ([]map[string]interface{}, []error, error) {
+	mcs := make([]*method.MethodCall, len(rows))
+	for i, row := range rows {
+		mcs[i] = newGetCall(s, uid.InvokingID(row), CellBlock{})
 	}
-	mc := method.NewMethodCall(uid.InvokingID(row), getUID, s.MethodFlags)
-	mc.StartList()
-	mc.EndList()
-	resp, err := s.ExecuteMethod(mc)
+	res, err := s.ExecuteMethods(mcs)
+	if err != nil {
+		return nil, nil, err
+	}
+	vals := make([]map[string]interface{}, len(rows))
+	errs := make([]error, len(rows))
+	for i, r := range res {
+		if r.Err != nil {
+			errs[i] = r.Err
+			continue
+		}
+		resp, err := getResult(s, r.Result)
+		if err == nil {
+			vals[i], err = parseGetResult(resp)
+		}
+		if err == nil && len(vals[i]) == 0 {
+			err = ErrEmptyResult
+		}
+		errs[i] = err
+	}
+	return vals, errs, nil
+}
+
+// CellBlock selects the cells returned by Get, see "5.3.3.6 Get". Rows are
+// row UIDs for object tables and byte offsets for byte tables. Unset fields
+// select from the first or up to the last row or column.
+type CellBlock struct {
+	StartRow    *uint
+	EndRow      *uint
+	StartColumn *uint
+	EndColumn   *uint
+	// Names of the columns, used instead of the numbers on Enterprise drives
+	StartColumnName string
+	EndColumnName   string
+}
+
+// GetCellBlock calls Get on a row, object table or byte table and returns the
+// method result. For Enterprise drives the extra level of lists of their Get
+// is removed, so that the result has the same form on all drives.
+func GetCellBlock(s *core.Session, invoker uid.InvokingID, cb CellBlock) (stream.List, error) {
+	resp, err := s.ExecuteMethod(newGetCall(s, invoker, cb))
 	if err != nil {
 		return nil, err
 	}
-	// The Enterprise Get has an extra level of lists
+	return getResult(s, resp)
+}
+
+func newGetCall(s *core.Session, invoker uid.InvokingID, cb CellBlock) *method.MethodCall {
+	getUID := uid.OpalGet
 	if s.ProtocolLevel == core.ProtocolLevelEnterprise {
-		var ok bool
-		resp, ok = resp[0].(stream.List)
-		if !ok {
-			return nil, method.ErrMalformedMethodResponse
+		getUID = uid.OpalEnterpriseGet
+	}
+	mc := method.NewMethodCall(invoker, getUID, s.MethodFlags)
+	mc.StartList()
+	if cb.StartRow != nil {
+		mc.StartOptionalParameter(CellBlock_StartRow, "startRow")
+		mc.UInt(*cb.StartRow)
+		mc.EndOptionalParameter()
+	}
+	if cb.EndRow != nil {
+		mc.StartOptionalParameter(CellBlock_EndRow, "endRow")
+		mc.UInt(*cb.EndRow)
+		mc.EndOptionalParameter()
+	}
+	column := func(col *uint, name string) {
+		if s.ProtocolLevel == core.ProtocolLevelEnterprise {
+			mc.Bytes([]byte(name))
+		} else {
+			mc.UInt(*col)
 		}
 	}
-	val, err := parseGetResult(resp)
+	if cb.StartColumn != nil {
+		mc.StartOptionalParameter(CellBlock_StartColumn, "startColumn")
+		column(cb.StartColumn, cb.StartColumnName)
+		mc.EndOptionalParameter()
+	}
+	if cb.EndColumn != nil {
+		mc.StartOptionalParameter(CellBlock_EndColumn, "endColumn")
+		column(cb.EndColumn, cb.EndColumnName)
+		mc.EndOptionalParameter()
+	}
+	mc.EndList()
+	return mc
+}
+
+func getResult(s *core.Session, resp stream.List) (stream.List, error) {
+	// The Enterprise Get has an extra level of lists
+	if s.ProtocolLevel == core.ProtocolLevelEnterprise {
+		return methodResult(resp)
+	}
+	return resp, nil
+}
+
+// methodResult returns the result list of a method response. Methods with
+// results reply with one list, a response without it is malformed.
+func methodResult(resp stream.List) (stream.List, error) {
+	if len(resp) == 0 {
+		return nil, method.ErrMalformedMethodResponse
+	}
+	res, ok := resp[0].(stream.List)
+	if !ok {
+		return nil, method.ErrMalformedMethodResponse
+	}
+	return res, nil
+}
+
+// ReadBytes reads up to len(p) bytes from a byte table starting at byte
+// offset off and returns the number of bytes read.
+func ReadBytes(s *core.Session, table uid.TableUID, p []byte, off uint32) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	start, end := uint(off), uint(off)+uint(len(p))-1
+	res, err := GetCellBlock(s, uid.InvokingID(table), CellBlock{StartRow: &start, EndRow: &end})
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
-	if len(val) == 0 {
-		return nil, ErrEmptyResult
+	result, err := methodResult(res)
+	if err != nil {
+		return 0, err
 	}
-	return val, nil
+	if len(result) == 0 {
+		return 0, ErrEmptyResult
+	}
+	inner, ok := result[0].([]uint8)
+	if !ok {
+		return 0, method.ErrMalformedMethodResponse
+	}
+	if len(inner) == 0 {
+		return 0, ErrEmptyResult
+	}
+	return copy(p, inner), nil
+}
+
+// WriteBytes writes p to a byte table starting at byte offset off.
+//
+// The caller is responsible for keeping len(p) within the token size limits
+// of the session.
+func WriteBytes(s *core.Session, table uid.TableUID, p []byte, off uint32) error {
+	mc := method.NewMethodCall(uid.InvokingID(table), uid.OpalSet, s.MethodFlags)
+	mc.StartOptionalParameter(0, "Where")
+	mc.UInt(uint(off))
+	mc.EndOptionalParameter()
+	mc.StartOptionalParameter(1, "Values")
+	mc.Bytes(p)
+	mc.EndOptionalParameter()
+	_, err := s.ExecuteMethod(mc)
+	return err
 }
 
+// Rows requested per Next call by Enumerate
+var enumerateCount uint = 64
+
+// Enumerate returns the UIDs of all rows of a table. The rows are requested
+// in pages of enumerateCount rows with Next, continuing after the last row
+// of the previous page until the TPer returns a short page.
 func Enumerate(s *core.Session, table uid.TableUID) ([]uid.RowUID, error) {
+	res := []uid.RowUID{}
+	seen := map[uid.RowUID]bool{}
+	var where *uid.RowUID
+	for {
+		page, err := next(s, table, where, enumerateCount)
+		if errors.Is(err, method.ErrMethodStatusInvalidParameter) && where == nil {
+			// Fall back to a single Next for TPers that reject Count
+			return next(s, table, nil, 0)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range page {
+			if seen[r] {
+				// The TPer ignored Where, avoid looping forever
+				return res, nil
+			}
+			seen[r] = true
+			res = append(res, r)
+		}
+		if uint(len(page)) < enumerateCount {
+			return res, nil
+		}
+		where = &page[len(page)-1]
+	}
+}
+
+// Call Next on a table, optionally continuing after the row where and
+// limited to count rows if count is not zero.
+func next(s *core.Session, table uid.TableUID, where *uid.RowUID, count uint) ([]uid.RowUID, error) {
 	mc := method.NewMethodCall(uid.InvokingID(table), uid.OpalNext, s.MethodFlags)
+	if where != nil {
+		mc.StartOptionalParameter(0, "Where")
+		mc.Bytes(where[:])
+		mc.EndOptionalParameter()
+	}
+	if count > 0 {
+		mc.StartOptionalParameter(1, "Count")
+		mc.UInt(count)
+		mc.EndOptionalParameter()
+	}
 	resp, err := s.ExecuteMethod(mc)
 	if err != nil {
 		return nil, err
 	}
-	result, ok := resp[0].(stream.List)
-	if !ok {
+	result, err := methodResult(resp)
+	if err != nil {
+		return nil, err
+	}
+	if len(result) == 0 {
 		return nil, method.ErrMalformedMethodResponse
 	}
 	uidrefs, ok := result[0].(stream.List)
@@ -146,14 +308,14 @@ func Enumerate(s *core.Session, table uid.TableUID) ([]uid.RowUID, error) {
 }
 
 func parseGetResult(res stream.List) (map[string]interface{}, error) {
-	methodResult, ok := res[0].(stream.List)
-	if !ok {
-		return nil, method.ErrMalformedMethodResponse
+	result, err := methodResult(res)
+	if err != nil {
+		return nil, err
 	}
-	if len(methodResult) == 0 {
+	if len(result) == 0 {
 		return nil, ErrEmptyResult
 	}
-	inner, ok := methodResult[0].(stream.List)
+	inner, ok := result[0].(stream.List)
 	if !ok {
 		return nil, method.ErrMalformedMethodResponse
 	}
@@ -171,6 +333,9 @@ func parseRowValues(rv stream.List) (map[string]interface{}, error) {
 	res := map[string]interface{}{}
 	for i := range rv {
 		if stream.EqualToken(rv[i], stream.StartName) {
+			if i+2 >= len(rv) {
+				return nil, method.ErrMalformedMethodResponse
+			}
 			colID, okID := rv[i+1].(uint)
 			colRawName, okString := rv[i+1].([]byte)
 			if !okID && !okString {
@@ -221,3 +386,49 @@ func FinishSetCall(s *core.Session, mc *method.MethodCall) {
 		mc.EndOptionalParameter()
 	}
 }
+
+// Column identifies a table column by its number and by the name that
+// Enterprise drives use instead of the number.
+type Column struct {
+	Num  uint
+	Name string
+}
+
+// ColumnValue is a value to set in a column, either a bool, uint or []byte.
+type ColumnValue struct {
+	Column
+	Value interface{}
+}
+
+// NewSetCallColumns is like NewSetCall but also adds the given column values,
+// named by number or by name depending on the protocol level of the session.
+// The call is finished with FinishSetCall.
+func NewSetCallColumns(s *core.Session, row uid.RowUID, values ...ColumnValue) (*method.MethodCall, error) {
+	mc := NewSetCall(s, row)
+	for _, cv := range values {
+		mc.StartOptionalParameter(cv.Num, cv.Name)
+		switch v := cv.Value.(type) {
+		case bool:
+			mc.Bool(v)
+		case uint:
+			mc.UInt(v)
+		case []byte:
+			mc.Bytes(v)
+		default:
+			return nil, fmt.Errorf("unsupported value %T for column %q", cv.Value, cv.Name)
+		}
+		mc.EndOptionalParameter()
+	}
+	return mc, nil
+}
+
+// SetColumns sets the given column values of a row.
+func SetColumns(s *core.Session, row uid.RowUID, values ...ColumnValue) error {
+	mc, err := NewSetCallColumns(s, row, values...)
+	if err != nil {
+		return err
+	}
+	FinishSetCall(s, mc)
+	_, err = s.ExecuteMethod(mc)
+	return err
+}
@@ -0,0 +1,135 @@
+package table
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/stream"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive/sim"
+)
+
+func TestEnumeratePages(t *testing.T) {
+	c, err := core.NewCoreFromDrive(sim.New())
+	if err != nil {
+		t.Fatalf("NewCoreFromDrive() failed: %v", err)
+	}
+	cs, err := core.NewControlSession(c.DriveIntf, c.Level0Discovery, core.WithComID(sim.BaseComID))
+	if err != nil {
+		t.Fatalf("NewControlSession() failed: %v", err)
+	}
+	s, err := cs.NewSession(uid.AdminSP, core.WithReadOnly())
+	if err != nil {
+		t.Fatalf("NewSession() failed: %v", err)
+	}
+	defer s.Close()
+
+	want := []uid.RowUID{uid.RowUID(uid.AdminSP), uid.RowUID(uid.LockingSP)}
+	for _, count := range []uint{1, 2, 64} {
+		enumerateCount = count
+		rows, err := Enumerate(s, uid.Admin_SPTable)
+		if err != nil {
+			t.Fatalf("Enumerate() with %d rows per page failed: %v", count, err)
+		}
+		if !reflect.DeepEqual(rows, want) {
+			t.Errorf("Enumerate() with %d rows per page = %x; want %x", count, rows, want)
+		}
+	}
+	enumerateCount = 64
+}
+
+func TestNewSetCallColumns(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		s     *core.Session
+		col   func(mc *method.MethodCall)
+		setID uid.MethodID
+	}{
+		{
+			name:  "Opal",
+			s:     &core.Session{ProtocolLevel: core.ProtocolLevelCore},
+			col:   func(mc *method.MethodCall) { mc.Token(stream.OpalPIN) },
+			setID: uid.OpalSet,
+		},
+		{
+			name:  "Enterprise",
+			s:     &core.Session{ProtocolLevel: core.ProtocolLevelEnterprise, MethodFlags: method.MethodFlagOptionalAsName},
+			col:   func(mc *method.MethodCall) { mc.Bytes([]byte("PIN")) },
+			setID: uid.OpalEnterpriseSet,
+		},
+	} {
+		mc, err := NewSetCallColumns(tc.s, uid.Admin_C_PIN_SIDRow, ColumnValue{Admin_C_PIN_PIN, []byte("secret")})
+		if err != nil {
+			t.Fatalf("%s: NewSetCallColumns() failed: %v", tc.name, err)
+		}
+		FinishSetCall(tc.s, mc)
+
+		want := method.NewMethodCall(uid.InvokingID(uid.Admin_C_PIN_SIDRow), tc.setID, tc.s.MethodFlags)
+		if tc.s.ProtocolLevel == core.ProtocolLevelEnterprise {
+			want.StartList()
+			want.EndList()
+			want.StartList()
+			want.StartList()
+		} else {
+			want.Token(stream.StartName)
+			want.UInt(1)
+			want.StartList()
+		}
+		want.Token(stream.StartName)
+		tc.col(want)
+		want.Bytes([]byte("secret"))
+		want.Token(stream.EndName)
+		want.EndList()
+		if tc.s.ProtocolLevel == core.ProtocolLevelEnterprise {
+			want.EndList()
+		} else {
+			want.Token(stream.EndName)
+		}
+
+		got, _ := mc.MarshalBinary()
+		wantb, _ := want.MarshalBinary()
+		if !bytes.Equal(got, wantb) {
+			t.Errorf("%s: NewSetCallColumns() = %x; want %x", tc.name, got, wantb)
+		}
+	}
+
+	if _, err := NewSetCallColumns(&core.Session{}, uid.Admin_C_PIN_SIDRow, ColumnValue{Admin_C_PIN_PIN, "secret"}); err == nil {
+		t.Errorf("NewSetCallColumns() with a string value succeeded; want error")
+	}
+}
+
+// Since methods without results may succeed with an empty reply, the
+// readers of results must not index into it unchecked.
+func TestMethodResult(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		resp    stream.List
+		want    stream.List
+		wantErr error
+	}{
+		{"Result", stream.List{stream.List{uint(1)}}, stream.List{uint(1)}, nil},
+		{"Empty result", stream.List{stream.List{}}, stream.List{}, nil},
+		{"Empty reply", stream.List{}, nil, method.ErrMalformedMethodResponse},
+		{"Not a list", stream.List{uint(1)}, nil, method.ErrMalformedMethodResponse},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := methodResult(tc.resp)
+			if err != tc.wantErr {
+				t.Fatalf("methodResult() error = %v; want %v", err, tc.wantErr)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("methodResult() = %v; want %v", got, tc.want)
+			}
+		})
+	}
+	s := &core.Session{ProtocolLevel: core.ProtocolLevelEnterprise}
+	if _, err := getResult(s, stream.List{}); err != method.ErrMalformedMethodResponse {
+		t.Errorf("getResult() of an empty Enterprise reply returned %v; want %v", err, method.ErrMalformedMethodResponse)
+	}
+	if _, err := parseGetResult(stream.List{}); err != method.ErrMalformedMethodResponse {
+		t.Errorf("parseGetResult() of an empty reply returned %v; want %v", err, method.ErrMalformedMethodResponse)
+	}
+}
@@ -7,19 +7,50 @@
 package table
 
 import (
+	"crypto"
+	"crypto/rand"
 	"errors"
 	"fmt"
 
 	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
 	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
-	"github.com/open-source-firmware/go-tcg-storage/pkg/core/stream"
 	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
 )
 
 var (
 	ErrAuthenticationFailed = errors.New("authentication failed")
+	// Returned by ThisSP_Authenticate when the TPer answers with a challenge,
+	// see ThisSP_AuthenticateSigned.
+	ErrChallengeRequired = errors.New("authority requires a signed challenge")
+	// Returned when the TryLimit of the authority has been reached, further
+	// attempts fail until the TPer is power cycled.
+	ErrAuthorityLockedOut = method.ErrMethodStatusAuthorityLockedOut
 )
 
+// AuthenticationError is returned by ThisSP_Authenticate when the proof was
+// rejected and the try counters of the authority could be read. It matches
+// ErrAuthenticationFailed, and ErrAuthorityLockedOut once the limit is hit.
+type AuthenticationError struct {
+	Authority uid.AuthorityObjectUID
+	Tries     uint32
+	TryLimit  uint32
+}
+
+func (e *AuthenticationError) LockedOut() bool {
+	return e.TryLimit > 0 && e.Tries >= e.TryLimit
+}
+
+func (e *AuthenticationError) Error() string {
+	if e.LockedOut() {
+		return fmt.Sprintf("authentication failed, authority is locked out (%d of %d attempts used)", e.Tries, e.TryLimit)
+	}
+	return fmt.Sprintf("authentication failed (%d of %d attempts used)", e.Tries, e.TryLimit)
+}
+
+func (e *AuthenticationError) Is(target error) bool {
+	return target == ErrAuthenticationFailed || (target == ErrAuthorityLockedOut && e.LockedOut())
+}
+
 func ThisSP_Random(s *core.Session, count uint) ([]byte, error) {
 	mc := method.NewMethodCall(uid.InvokeIDThisSP, uid.OpalRandom, s.MethodFlags)
 	mc.UInt(count)
@@ -27,8 +58,11 @@ func ThisSP_Random(s *core.Session, count uint) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	res, ok := resp[0].(stream.List)
-	if !ok {
+	res, err := methodResult(resp)
+	if err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
 		return nil, method.ErrMalformedMethodResponse
 	}
 	rnd, ok := res[0].([]byte)
@@ -38,7 +72,118 @@ func ThisSP_Random(s *core.Session, count uint) ([]byte, error) {
 	return rnd, nil
 }
 
+// Random reads count bytes from the random number generator of the TPer. The
+// bytes are requested in chunks that fit into an individual token of both the
+// host and the TPer.
+func Random(s *core.Session, count uint) ([]byte, error) {
+	chunk := s.ControlSession.HostProperties.MaxIndTokenSize
+	if tp := s.ControlSession.TPerProperties.MaxIndTokenSize; tp < chunk {
+		chunk = tp
+	}
+	// Leave room for the header of a long atom
+	if chunk > 4 {
+		chunk -= 4
+	}
+	res := make([]byte, 0, count)
+	for uint(len(res)) < count {
+		n := count - uint(len(res))
+		if n > chunk {
+			n = chunk
+		}
+		rnd, err := ThisSP_Random(s, n)
+		if err != nil {
+			return nil, err
+		}
+		if len(rnd) == 0 || uint(len(rnd)) > n {
+			return nil, method.ErrMalformedMethodResponse
+		}
+		res = append(res, rnd...)
+	}
+	return res, nil
+}
+
+// RandomReader is an io.Reader over the random number generator of the TPer.
+type RandomReader struct {
+	s *core.Session
+}
+
+func NewRandomReader(s *core.Session) *RandomReader {
+	return &RandomReader{s: s}
+}
+
+func (r *RandomReader) Read(p []byte) (int, error) {
+	rnd, err := Random(r.s, uint(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	return copy(p, rnd), nil
+}
+
 func ThisSP_Authenticate(s *core.Session, authority uid.AuthorityObjectUID, proof []byte) error {
+	res, err := authenticate(s, authority, proof, true)
+	if err != nil {
+		return err
+	}
+	if _, ok := res.([]byte); ok {
+		return ErrChallengeRequired
+	}
+	success, ok := res.(uint)
+	if !ok {
+		return method.ErrMalformedMethodResponse
+	}
+	if success == 0 {
+		return authenticationError(s, authority)
+	}
+	return nil
+}
+
+// ThisSP_GetChallenge starts the authentication of an authority using public
+// key cryptography by calling Authenticate without a proof, and returns the
+// challenge of the TPer. The signed challenge is the proof to pass to
+// ThisSP_Authenticate.
+func ThisSP_GetChallenge(s *core.Session, authority uid.AuthorityObjectUID) ([]byte, error) {
+	res, err := authenticate(s, authority, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	challenge, ok := res.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("authority did not return a challenge")
+	}
+	return challenge, nil
+}
+
+// ThisSP_AuthenticateSigned authenticates an authority with the Sign
+// operation, answering the challenge of the TPer using sign.
+func ThisSP_AuthenticateSigned(s *core.Session, authority uid.AuthorityObjectUID, sign ChallengeSigner) error {
+	challenge, err := ThisSP_GetChallenge(s, authority)
+	if err != nil {
+		return err
+	}
+	proof, err := sign(challenge)
+	if err != nil {
+		return fmt.Errorf("signing challenge failed: %v", err)
+	}
+	return ThisSP_Authenticate(s, authority, proof)
+}
+
+// ChallengeSigner signs the challenge returned by the TPer for an authority
+// using public key cryptography.
+type ChallengeSigner func(challenge []byte) ([]byte, error)
+
+// CryptoSigner returns a ChallengeSigner that signs the digest of the
+// challenge, as computed by hash, with signer.
+func CryptoSigner(signer crypto.Signer, hash crypto.Hash) ChallengeSigner {
+	return func(challenge []byte) ([]byte, error) {
+		h := hash.New()
+		h.Write(challenge)
+		return signer.Sign(rand.Reader, h.Sum(nil), hash)
+	}
+}
+
+// Call Authenticate and return the result, which is a boolean for the
+// success or a challenge.
+func authenticate(s *core.Session, authority uid.AuthorityObjectUID, proof []byte, withProof bool) (interface{}, error) {
 	authUID := uid.MethodID{}
 	if s.ProtocolLevel == core.ProtocolLevelEnterprise {
 		copy(authUID[:], uid.OpalEnterpriseAuthenticate[:])
@@ -47,27 +192,31 @@ func ThisSP_Authenticate(s *core.Session, authority uid.AuthorityObjectUID, proo
 	}
 	mc := method.NewMethodCall(uid.InvokeIDThisSP, authUID, s.MethodFlags)
 	mc.Bytes(authority[:])
-	mc.StartOptionalParameter(0, "Challenge")
-	mc.Bytes(proof)
-	mc.EndOptionalParameter()
+	if withProof {
+		mc.StartOptionalParameter(0, "Challenge")
+		mc.Bytes(proof)
+		mc.EndOptionalParameter()
+	}
 	resp, err := s.ExecuteMethod(mc)
 	if err != nil {
-		return err
-	}
-	res, ok := resp[0].(stream.List)
-	if !ok {
-		return method.ErrMalformedMethodResponse
+		return nil, err
 	}
-	success, okUint := res[0].(uint)
-	_, okByte := res[0].([]byte)
-	if okByte {
-		return fmt.Errorf("got a challenge back, not implemented")
+	res, err := methodResult(resp)
+	if err != nil {
+		return nil, err
 	}
-	if !okUint {
-		return method.ErrMalformedMethodResponse
+	if len(res) == 0 {
+		return nil, method.ErrMalformedMethodResponse
 	}
-	if success == 0 {
+	return res[0], nil
+}
+
+// Add the try counters of the authority to a failed authentication, if the
+// session is allowed to read them.
+func authenticationError(s *core.Session, authority uid.AuthorityObjectUID) error {
+	tries, limit, err := C_PIN_GetTries(s, uid.C_PINRowForAuthority(authority))
+	if err != nil || limit == 0 {
 		return ErrAuthenticationFailed
 	}
-	return nil
+	return &AuthenticationError{Authority: authority, Tries: tries, TryLimit: limit}
 }
@@ -0,0 +1,84 @@
+package table
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive/sim"
+)
+
+func TestAuthenticationError(t *testing.T) {
+	for _, tc := range []struct {
+		tries, limit uint32
+		lockedOut    bool
+		msg          string
+	}{
+		{2, 5, false, "authentication failed (2 of 5 attempts used)"},
+		{5, 5, true, "authentication failed, authority is locked out (5 of 5 attempts used)"},
+	} {
+		err := error(&AuthenticationError{Tries: tc.tries, TryLimit: tc.limit})
+		if !errors.Is(err, ErrAuthenticationFailed) {
+			t.Errorf("%v does not match ErrAuthenticationFailed", err)
+		}
+		if errors.Is(err, ErrAuthorityLockedOut) != tc.lockedOut {
+			t.Errorf("errors.Is(%v, ErrAuthorityLockedOut) != %v", err, tc.lockedOut)
+		}
+		if err.Error() != tc.msg {
+			t.Errorf("Error() = %q, want %q", err.Error(), tc.msg)
+		}
+	}
+}
+
+func TestRandom(t *testing.T) {
+	c, err := core.NewCoreFromDrive(sim.New())
+	if err != nil {
+		t.Fatalf("NewCoreFromDrive() failed: %v", err)
+	}
+	cs, err := core.NewControlSession(c.DriveIntf, c.Level0Discovery, core.WithComID(sim.BaseComID))
+	if err != nil {
+		t.Fatalf("NewControlSession() failed: %v", err)
+	}
+	s, err := cs.NewSession(uid.AdminSP, core.WithReadOnly())
+	if err != nil {
+		t.Fatalf("NewSession() failed: %v", err)
+	}
+	defer s.Close()
+
+	// Larger than an individual token, so that it takes several calls
+	count := 3*cs.HostProperties.MaxIndTokenSize + 1
+	rnd, err := Random(s, count)
+	if err != nil {
+		t.Fatalf("Random(%d) failed: %v", count, err)
+	}
+	if uint(len(rnd)) != count {
+		t.Errorf("Random(%d) returned %d bytes", count, len(rnd))
+	}
+	buf := make([]byte, 100)
+	if _, err := io.ReadFull(NewRandomReader(s), buf); err != nil {
+		t.Errorf("reading from RandomReader failed: %v", err)
+	}
+}
+
+func TestCryptoSigner(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+	challenge := []byte("0123456789abcdef0123456789abcdef")
+	sig, err := CryptoSigner(key, crypto.SHA256)(challenge)
+	if err != nil {
+		t.Fatalf("signing the challenge failed: %v", err)
+	}
+	digest := sha256.Sum256(challenge)
+	if !ecdsa.VerifyASN1(&key.PublicKey, digest[:], sig) {
+		t.Errorf("signature of the challenge does not verify")
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Implements protocol-level tracing of the traffic to and from a TPer
+
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/stream"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive"
+)
+
+// Tracer describes where protocol-level events are reported. A nil writer
+// disables that kind of event.
+type Tracer struct {
+	// Methods receives one line per method call and per method status, with
+	// the credentials redacted, see method.FormatCall.
+	Methods io.Writer
+	// ComPackets receives a hex dump of every IF-SEND and IF-RECV payload,
+	// including the passwords sent to the TPer.
+	ComPackets io.Writer
+}
+
+type traceDrive struct {
+	drive.DriveIntf
+	t *Tracer
+}
+
+// Wrap a drive so that all traffic passing through it is reported to the tracer.
+func NewTraceDrive(d drive.DriveIntf, t *Tracer) drive.DriveIntf {
+	return &traceDrive{d, t}
+}
+
+func (d *traceDrive) IFSend(proto drive.SecurityProtocol, sps uint16, data []byte) error {
+	d.dump("IF-SEND", proto, sps, data)
+	if proto == drive.SecurityProtocolTCGManagement {
+		d.method("->", data)
+	}
+	err := d.DriveIntf.IFSend(proto, sps, data)
+	if err != nil && d.t.Methods != nil {
+		fmt.Fprintf(d.t.Methods, "-> IF-SEND failed: %v\n", err)
+	}
+	return err
+}
+
+func (d *traceDrive) IFRecv(proto drive.SecurityProtocol, sps uint16, data *[]byte) error {
+	err := d.DriveIntf.IFRecv(proto, sps, data)
+	if err != nil {
+		if d.t.Methods != nil {
+			fmt.Fprintf(d.t.Methods, "<- IF-RECV failed: %v\n", err)
+		}
+		return err
+	}
+	d.dump("IF-RECV", proto, sps, *data)
+	if proto == drive.SecurityProtocolTCGManagement && sps != uint16(ComIDDiscoveryL0) {
+		d.method("<-", *data)
+	}
+	return nil
+}
+
+func (d *traceDrive) dump(op string, proto drive.SecurityProtocol, sps uint16, data []byte) {
+	if d.t.ComPackets == nil {
+		return
+	}
+	// Skip the padding of ComPackets, it only makes the dumps harder to read
+	if proto == drive.SecurityProtocolTCGManagement && sps != uint16(ComIDDiscoveryL0) && len(data) >= 20 {
+		if n := int(binary.BigEndian.Uint32(data[16:20])) + 20; n < len(data) {
+			data = data[:n]
+		}
+	}
+	fmt.Fprintf(d.t.ComPackets, "%s protocol 0x%02x ComID 0x%04x, %d bytes\n", op, int(proto), sps, len(data))
+	fmt.Fprintf(d.t.ComPackets, "%s\n", hex.Dump(data))
+}
+
+func (d *traceDrive) method(dir string, data []byte) {
+	if d.t.Methods == nil {
+		return
+	}
+	tsn, payload := comPacketPayload(data)
+	if len(payload) == 0 {
+		// Nothing sent, or the TPer has not processed the command yet
+		return
+	}
+	reply, err := stream.Decode(payload)
+	if err != nil || len(reply) == 0 {
+		fmt.Fprintf(d.t.Methods, "%s TSN %d: undecodable payload: %v\n", dir, tsn, err)
+		return
+	}
+	if stream.EqualToken(reply[0], stream.EndOfSession) {
+		fmt.Fprintf(d.t.Methods, "%s TSN %d: EndOfSession\n", dir, tsn)
+		return
+	}
+	if len(reply) >= 3 && stream.EqualToken(reply[0], stream.Call) {
+		iid, _ := reply[1].([]byte)
+		mid, _ := reply[2].([]byte)
+		args := stream.List{}
+		if len(reply) >= 4 {
+			args, _ = reply[3].(stream.List)
+		}
+		fmt.Fprintf(d.t.Methods, "%s TSN %d: %s\n", dir, tsn, method.FormatCall(iid, mid, args))
+	} else if result, ok := reply[0].(stream.List); ok && dir == "<-" {
+		fmt.Fprintf(d.t.Methods, "%s TSN %d: result %s\n", dir, tsn, result)
+	}
+	if dir == "->" || len(reply) < 2 || !stream.EqualToken(reply[len(reply)-2], stream.EndOfData) {
+		return
+	}
+	status, ok := reply[len(reply)-1].(stream.List)
+	if !ok || len(status) == 0 {
+		return
+	}
+	sc, ok := status[0].(uint)
+	if !ok {
+		return
+	}
+	reserved := ""
+	if method.ReservedSet(status[1:]) {
+		reserved = fmt.Sprintf(", reserved values %s", status[1:])
+	}
+	if serr, ok := method.MethodStatusCodeMap[sc]; ok {
+		fmt.Fprintf(d.t.Methods, "%s TSN %d: status 0x%02x (%v)%s\n", dir, tsn, sc, serr, reserved)
+	} else {
+		fmt.Fprintf(d.t.Methods, "%s TSN %d: status 0x%02x (unknown)%s\n", dir, tsn, sc, reserved)
+	}
+}
+
+// Extract the TSN and the data of the first subpacket of a ComPacket.
+func comPacketPayload(data []byte) (uint32, []byte) {
+	rdr := bytes.NewReader(data)
+	compkthdr := comPacketHeader{}
+	pkthdr := packetHeader{}
+	subpkthdr := subPacketHeader{}
+	if err := binary.Read(rdr, binary.BigEndian, &compkthdr); err != nil || compkthdr.Length == 0 {
+		return 0, nil
+	}
+	if err := binary.Read(rdr, binary.BigEndian, &pkthdr); err != nil {
+		return 0, nil
+	}
+	if err := binary.Read(rdr, binary.BigEndian, &subpkthdr); err != nil || subpkthdr.Kind != 0 {
+		return pkthdr.TSN, nil
+	}
+	rest := data[len(data)-rdr.Len():]
+	if uint32(len(rest)) < subpkthdr.Length {
+		return pkthdr.TSN, nil
+	}
+	return pkthdr.TSN, rest[:subpkthdr.Length]
+}
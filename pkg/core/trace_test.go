@@ -0,0 +1,54 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive"
+)
+
+type nopDrive struct{}
+
+func (nopDrive) IFRecv(proto drive.SecurityProtocol, sps uint16, data *[]byte) error { return nil }
+func (nopDrive) IFSend(proto drive.SecurityProtocol, sps uint16, data []byte) error  { return nil }
+func (nopDrive) Identify() (*drive.Identity, error)                                  { return nil, nil }
+func (nopDrive) SerialNumber() ([]byte, error)                                       { return nil, nil }
+func (nopDrive) Close() error                                                        { return nil }
+
+func TestTraceMethods(t *testing.T) {
+	methods := bytes.Buffer{}
+	compkts := bytes.Buffer{}
+	d := NewTraceDrive(nopDrive{}, &Tracer{Methods: &methods, ComPackets: &compkts})
+	c := NewPlainCommunication(d, InitialHostProperties, InitialTPerProperties)
+
+	mc := method.NewMethodCall(uid.InvokeIDThisSP, uid.OpalAuthenticate, 0)
+	mc.Bytes(uid.LockingAuthorityAdmin1[:])
+	mc.StartOptionalParameter(0, "Challenge")
+	mc.Bytes([]byte("password"))
+	mc.EndOptionalParameter()
+	call := `ThisSP.Authenticate[Admin1, 0=<redacted>]`
+	if got := mc.String(); got != call {
+		t.Errorf("MethodCall.String() = %s; want %s", got, call)
+	}
+	b, err := mc.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary failed: %v", err)
+	}
+	if err := c.Send(&Session{ComID: 0x7fe, TSN: 42}, b); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	want := "-> TSN 42: " + call + "\n"
+	if got := methods.String(); got != want {
+		t.Errorf("method trace is %q; want %q", got, want)
+	}
+	if strings.Contains(methods.String(), "password") {
+		t.Errorf("method trace %q contains the password", methods.String())
+	}
+	if !strings.HasPrefix(compkts.String(), "IF-SEND protocol 0x01 ComID 0x07fe") {
+		t.Errorf("unexpected ComPacket trace:\n%s", compkts.String())
+	}
+}
@@ -37,4 +37,14 @@ var (
 	OpalAuthenticate           = MethodID{0x00, 0x00, 0x00, 0x06, 0x00, 0x00, 0x00, 0x1c}
 	OpalRandom                 = MethodID{0x00, 0x00, 0x00, 0x06, 0x00, 0x00, 0x06, 0x01}
 	OpalErase                  = MethodID{0x00, 0x00, 0x00, 0x06, 0x00, 0x00, 0x08, 0x03}
+	OpalReactivate             = MethodID{0x00, 0x00, 0x00, 0x06, 0x00, 0x00, 0x08, 0x01} // Single User Mode Feature Set
+
+	// Clock template
+	MethodIDGetClock     = MethodID{0x00, 0x00, 0x00, 0x06, 0x00, 0x00, 0x04, 0x01}
+	MethodIDSetClockHigh = MethodID{0x00, 0x00, 0x00, 0x06, 0x00, 0x00, 0x04, 0x03}
+	MethodIDSetClockLow  = MethodID{0x00, 0x00, 0x00, 0x06, 0x00, 0x00, 0x04, 0x05}
+
+	// Log template
+	MethodIDClearLog = MethodID{0x00, 0x00, 0x00, 0x06, 0x00, 0x00, 0x0A, 0x03}
+	MethodIDFlushLog = MethodID{0x00, 0x00, 0x00, 0x06, 0x00, 0x00, 0x0A, 0x04}
 )
@@ -0,0 +1,195 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Names of the well-known UIDs of the Session Manager, Admin SP and Locking SP
+
+package uid
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+var (
+	Base_SPInfoTable        = TableUID{0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00}
+	Base_SPTemplatesTable   = TableUID{0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00, 0x00}
+	Base_C_RSA_1024Table    = TableUID{0x00, 0x00, 0x00, 0x0C, 0x00, 0x00, 0x00, 0x00}
+	Base_C_RSA_2048Table    = TableUID{0x00, 0x00, 0x00, 0x0D, 0x00, 0x00, 0x00, 0x00}
+	Base_C_EC_256Table      = TableUID{0x00, 0x00, 0x00, 0x13, 0x00, 0x00, 0x00, 0x00}
+	Base_C_EC_384Table      = TableUID{0x00, 0x00, 0x00, 0x14, 0x00, 0x00, 0x00, 0x00}
+	Base_C_EC_521Table      = TableUID{0x00, 0x00, 0x00, 0x15, 0x00, 0x00, 0x00, 0x00}
+	Base_SecretProtectTable = TableUID{0x00, 0x00, 0x00, 0x1D, 0x00, 0x00, 0x00, 0x00}
+	Admin_TemplateTable     = TableUID{0x00, 0x00, 0x02, 0x04, 0x00, 0x00, 0x00, 0x00}
+	Locking_LockingInfo     = TableUID{0x00, 0x00, 0x08, 0x01, 0x00, 0x00, 0x00, 0x00}
+	Locking_MBRControl      = TableUID{0x00, 0x00, 0x08, 0x03, 0x00, 0x00, 0x00, 0x00}
+	Locking_K_AES_128Table  = TableUID{0x00, 0x00, 0x08, 0x05, 0x00, 0x00, 0x00, 0x00}
+	Locking_K_AES_256Table  = TableUID{0x00, 0x00, 0x08, 0x06, 0x00, 0x00, 0x00, 0x00}
+	Locking_DataStoreTable  = TableUID{0x00, 0x00, 0x10, 0x01, 0x00, 0x00, 0x00, 0x00}
+	Admin_DataRemovalTable  = TableUID{0x00, 0x00, 0x11, 0x01, 0x00, 0x00, 0x00, 0x00} // Pyrite SSC v2.00
+
+	Base_SPInfoObj RowUID = Base_SPInfoTable.Row([4]byte{0x00, 0x00, 0x00, 0x01})
+
+	AuthorityAdmins        = AuthorityObjectUID{0x00, 0x00, 0x00, 0x09, 0x00, 0x00, 0x00, 0x02}
+	AuthorityMakers        = AuthorityObjectUID{0x00, 0x00, 0x00, 0x09, 0x00, 0x00, 0x00, 0x03}
+	AuthorityMakerSymK     = AuthorityObjectUID{0x00, 0x00, 0x00, 0x09, 0x00, 0x00, 0x00, 0x04}
+	AuthorityMakerPuK      = AuthorityObjectUID{0x00, 0x00, 0x00, 0x09, 0x00, 0x00, 0x00, 0x05}
+	AdminSPAuthorityAdmin1 = AuthorityObjectUID{0x00, 0x00, 0x00, 0x09, 0x00, 0x00, 0x02, 0x01} // Admin1 of the Admin SP
+	LockingAuthorityUsers  = AuthorityObjectUID{0x00, 0x00, 0x00, 0x09, 0x00, 0x03, 0x00, 0x00}
+)
+
+// Catalog of UIDs with a fixed name. UIDs which exist once per range or
+// authority, like User1 or Locking_Range1, are handled by Lookup.
+var names = map[UID]string{
+	UID(InvokeIDThisSP): "ThisSP",
+	UID(InvokeIDSMU):    "SMUID",
+
+	UID(MethodIDSMProperties):          "Properties",
+	UID(MethodIDSMStartSession):        "StartSession",
+	UID(MethodIDSMSyncSession):         "SyncSession",
+	UID(MethodIDSMStartTrustedSession): "StartTrustedSession",
+	UID(MethodIDSMSyncTrustedSession):  "SyncTrustedSession",
+	UID(MethodIDSMCloseSession):        "CloseSession",
+	UID(OpalRevert):                    "Revert",
+	UID(OpalActivate):                  "Activate",
+	UID(OpalEnterpriseGet):             "Get",
+	UID(OpalEnterpriseSet):             "Set",
+	UID(OpalNext):                      "Next",
+	UID(OpalEnterpriseAuthenticate):    "Authenticate",
+	UID(OpalGetACL):                    "GetACL",
+	UID(OpalGenKey):                    "GenKey",
+	UID(OpalRevertSP):                  "RevertSP",
+	UID(OpalGet):                       "Get",
+	UID(OpalSet):                       "Set",
+	UID(OpalAuthenticate):              "Authenticate",
+	UID(OpalRandom):                    "Random",
+	UID(OpalErase):                     "Erase",
+	UID(OpalReactivate):                "Reactivate",
+	UID(MethodIDGetClock):              "GetClock",
+	UID(MethodIDSetClockHigh):          "SetClockHigh",
+	UID(MethodIDSetClockLow):           "SetClockLow",
+	UID(MethodIDClearLog):              "ClearLog",
+	UID(MethodIDFlushLog):              "FlushLog",
+
+	UID(Base_TableTable):         "Table",
+	UID(Base_SPInfoTable):        "SPInfo",
+	UID(Base_SPTemplatesTable):   "SPTemplates",
+	UID(Base_ColumnTable):        "Column",
+	UID(Base_MethodIDTable):      "MethodID",
+	UID(Base_AccessControlTable): "AccessControl",
+	UID(Base_ACETable):           "ACE",
+	UID(AuthorityTable):          "Authority",
+	UID(Admin_C_PINTable):        "C_PIN",
+	UID(Base_C_RSA_1024Table):    "C_RSA_1024",
+	UID(Base_C_RSA_2048Table):    "C_RSA_2048",
+	UID(Base_C_EC_256Table):      "C_EC_256",
+	UID(Base_C_EC_384Table):      "C_EC_384",
+	UID(Base_C_EC_521Table):      "C_EC_521",
+	UID(Base_SecretProtectTable): "SecretProtect",
+	UID(Admin_TPerInfoTable):     "TPerInfo",
+	UID(Admin_TemplateTable):     "Template",
+	UID(Admin_SPTable):           "SP",
+	UID(Clock_ClockTimeTable):    "ClockTime",
+	UID(Log_LogTable):            "Log",
+	UID(Log_LogListTable):        "LogList",
+	UID(Locking_LockingInfo):     "LockingInfo",
+	UID(Locking_LockingTable):    "Locking",
+	UID(Locking_MBRControl):      "MBRControl",
+	UID(Locking_MBRTable):        "MBR",
+	UID(Locking_K_AES_128Table):  "K_AES_128",
+	UID(Locking_K_AES_256Table):  "K_AES_256",
+	UID(Locking_DataStoreTable):  "DataStore",
+	UID(Admin_DataRemovalTable):  "DataRemovalMechanism",
+	UID(Seagate_PortTable):       "Port",
+
+	UID(Base_SPInfoObj):                "SPInfo",
+	UID(Admin_TPerInfoObj):             "TPerInfo",
+	UID(Clock_ClockTimeObj):            "ClockTime",
+	UID(AdminSP):                       "AdminSP",
+	UID(LockingSP):                     "LockingSP",
+	UID(EnterpriseLockingSP):           "EnterpriseLockingSP",
+	UID(LockingInfoObj):                "LockingInfo",
+	UID(EnterpriseLockingInfoObj):      "LockingInfo",
+	UID(MBRControlObj):                 "MBRControl",
+	UID(Admin_DataRemovalMechanismObj): "DataRemovalMechanism",
+	UID(GlobalRangeRowUID):             "Locking_GlobalRange",
+	UID(Admin_C_PIN_SIDRow):            "C_PIN_SID",
+	UID(Admin_C_PIN_MSIDRow):           "C_PIN_MSID",
+	UID(Admin_C_Pin_EraseMaster):       "C_PIN_EraseMaster",
+	UID(Seagate_Port_FWDownload):       "Port_FWDownload",
+	UID(Seagate_Port_UDS):              "Port_UDS",
+
+	UID(AdminSPAuthorityAdmin1): "Admin1",
+	UID(AuthorityAnybody):       "Anybody",
+	UID(AuthorityAdmins):        "Admins",
+	UID(AuthorityMakers):        "Makers",
+	UID(AuthorityMakerSymK):     "MakerSymK",
+	UID(AuthorityMakerPuK):      "MakerPuK",
+	UID(AuthoritySID):           "SID",
+	UID(AuthorityPSID):          "PSID",
+	UID(EraseMaster):            "EraseMaster",
+	UID(LockingAuthorityUsers):  "Users",
+
+	UID(ACE_Locking_GlobalRange_Set_RdLocked): "ACE_Locking_GlobalRange_Set_RdLocked",
+	UID(ACE_Locking_GlobalRange_Set_WrLocked): "ACE_Locking_GlobalRange_Set_WrLocked",
+}
+
+// Lookup returns the name of a well-known UID as used by the TCG
+// specifications, e.g. "C_PIN_MSID" or "Admin1".
+func Lookup(u UID) (string, bool) {
+	if name, ok := names[u]; ok {
+		return name, true
+	}
+	n := int(u[6])<<8 | int(u[7])
+	if n == 0 {
+		return "", false
+	}
+	switch [6]byte{u[0], u[1], u[2], u[3], u[4], u[5]} {
+	case [6]byte{0x00, 0x00, 0x00, 0x09, 0x00, 0x01}:
+		return fmt.Sprintf("Admin%d", n), true
+	case [6]byte{0x00, 0x00, 0x00, 0x09, 0x00, 0x03}:
+		return fmt.Sprintf("User%d", n), true
+	case [6]byte{0x00, 0x00, 0x00, 0x0B, 0x00, 0x01}:
+		return fmt.Sprintf("C_PIN_Admin%d", n), true
+	case [6]byte{0x00, 0x00, 0x00, 0x0B, 0x00, 0x03}:
+		return fmt.Sprintf("C_PIN_User%d", n), true
+	case [6]byte{0x00, 0x00, 0x08, 0x02, 0x00, 0x03}:
+		return fmt.Sprintf("Locking_Range%d", n), true
+	case [6]byte{0x00, 0x00, 0x08, 0x06, 0x00, 0x03}:
+		return fmt.Sprintf("K_AES_256_Range%d_Key", n), true
+	case [6]byte{0x00, 0x00, 0x08, 0x05, 0x00, 0x03}:
+		return fmt.Sprintf("K_AES_128_Range%d_Key", n), true
+	case [6]byte{0x00, 0x00, 0x00, 0x08, 0x00, 0x03}:
+		switch {
+		case n&0xFF00 == 0xE000:
+			return fmt.Sprintf("ACE_Locking_Range%d_Set_RdLocked", n&0xFF), true
+		case n&0xFF00 == 0xE800:
+			return fmt.Sprintf("ACE_Locking_Range%d_Set_WrLocked", n&0xFF), true
+		}
+	case [6]byte{0x00, 0x00, 0x00, 0x09, 0x00, 0x00}:
+		if n&0xFF00 == 0x8000 {
+			return fmt.Sprintf("BandMaster%d", n&0xFF-1), true
+		}
+	case [6]byte{0x00, 0x00, 0x00, 0x0B, 0x00, 0x00}:
+		if n&0xFF00 == 0x8000 {
+			return fmt.Sprintf("C_PIN_BandMaster%d", n&0xFF-1), true
+		}
+	case [6]byte{0x00, 0x00, 0x08, 0x02, 0x00, 0x00}:
+		// Enterprise SSC: Band0 is the global range
+		return fmt.Sprintf("Band%d", n-1), true
+	}
+	return "", false
+}
+
+// Name returns the name of a well-known UID, or the UID in hex if it is not
+// known or b is not a UID at all.
+func Name(b []byte) string {
+	var u UID
+	if len(b) == len(u) {
+		copy(u[:], b)
+		if name, ok := Lookup(u); ok {
+			return name
+		}
+	}
+	return hex.EncodeToString(b)
+}
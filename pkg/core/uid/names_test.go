@@ -0,0 +1,29 @@
+package uid
+
+import "testing"
+
+func TestLookup(t *testing.T) {
+	for _, tc := range []struct {
+		uid  UID
+		want string
+	}{
+		{UID(OpalAuthenticate), "Authenticate"},
+		{UID(Admin_C_PIN_MSIDRow), "C_PIN_MSID"},
+		{UID(LockingAuthorityAdmin1), "Admin1"},
+		{UID(LockingAuthorityUser(9)), "User9"},
+		{UID(C_PINRowForAuthority(LockingAuthorityUser(2))), "C_PIN_User2"},
+		{UID(LockingRange(3)), "Locking_Range3"},
+		{UID(ACE_Locking_Range_Set_WrLocked(1)), "ACE_Locking_Range1_Set_WrLocked"},
+		{UID(LockingAuthorityBandMaster0), "BandMaster0"},
+		{UID(Band1Enterprise), "Band1"},
+		{UID{0x00, 0x00, 0x00, 0x09, 0x00, 0x05, 0x00, 0x01}, ""},
+	} {
+		got, ok := Lookup(tc.uid)
+		if got != tc.want || ok != (tc.want != "") {
+			t.Errorf("Lookup(%x) = %q, %v; want %q", tc.uid, got, ok, tc.want)
+		}
+	}
+	if got := Name([]byte{0x01, 0x02}); got != "0102" {
+		t.Errorf("Name of a short UID is %q; want hex", got)
+	}
+}
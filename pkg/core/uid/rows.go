@@ -6,6 +6,7 @@ package uid
 
 var (
 	Admin_TPerInfoObj       RowUID = Admin_TPerInfoTable.Row([4]byte{0x00, 0x03, 0x00, 0x01})
+	Clock_ClockTimeObj      RowUID = Clock_ClockTimeTable.Row([4]byte{0x00, 0x00, 0x00, 0x01})
 	Admin_C_PIN_MSIDRow     RowUID = Admin_C_PINTable.Row([4]byte{0x00, 0x00, 0x84, 0x02})
 	Admin_C_PIN_SIDRow      RowUID = Admin_C_PINTable.Row([4]byte{0x00, 0x00, 0x00, 0x01})
 	Admin_C_PIN_Admin1Row   RowUID = Admin_C_PINTable.Row([4]byte{0x00, 0x01, 0x00, 0x01})
@@ -16,5 +17,41 @@ var (
 	EnterpriseLockingInfoObj RowUID = [8]byte{0x00, 0x00, 0x08, 0x01, 0x00, 0x00, 0x00, 0x00}
 	MBRControlObj            RowUID = [8]byte{0x00, 0x00, 0x08, 0x03, 0x00, 0x00, 0x00, 0x01}
 
+	Admin_DataRemovalMechanismObj RowUID = [8]byte{0x00, 0x00, 0x11, 0x01, 0x00, 0x00, 0x00, 0x01} // Pyrite SSC v2.00
+
+	// Ports of Seagate drives, see Seagate_PortTable
+	Seagate_Port_FWDownload RowUID = Seagate_PortTable.Row([4]byte{0x00, 0x01, 0x00, 0x02})
+	Seagate_Port_UDS        RowUID = Seagate_PortTable.Row([4]byte{0x00, 0x01, 0x00, 0x0E})
+
 	LockingRange1 RowUID = [8]byte{0x00, 0x00, 0x08, 0x02, 0x00, 0x03, 0x00, 0x01}
+
+	ACE_Locking_GlobalRange_Set_RdLocked RowUID = Base_ACETable.Row([4]byte{0x00, 0x03, 0xE0, 0x00})
+	ACE_Locking_GlobalRange_Set_WrLocked RowUID = Base_ACETable.Row([4]byte{0x00, 0x03, 0xE8, 0x00})
 )
+
+// Half-UIDs used in ACE boolean expressions
+var (
+	HalfUID_AuthorityObjectRef = [4]byte{0x00, 0x00, 0x0C, 0x05}
+	HalfUID_BooleanACE         = [4]byte{0x00, 0x00, 0x04, 0x0E}
+)
+
+// LockingRange returns the row of the Opal locking range n (0 being the
+// global range).
+func LockingRange(n int) RowUID {
+	if n == 0 {
+		return GlobalRangeRowUID
+	}
+	return RowUID{0x00, 0x00, 0x08, 0x02, 0x00, 0x03, uint8(n >> 8), uint8(n)}
+}
+
+// ACE_Locking_Range_Set_RdLocked returns the ACE controlling who may set
+// ReadLocked on the Opal locking range n (0 being the global range).
+func ACE_Locking_Range_Set_RdLocked(n int) RowUID {
+	return Base_ACETable.Row([4]byte{0x00, 0x03, 0xE0 | uint8(n>>8), uint8(n)})
+}
+
+// ACE_Locking_Range_Set_WrLocked returns the ACE controlling who may set
+// WriteLocked on the Opal locking range n (0 being the global range).
+func ACE_Locking_Range_Set_WrLocked(n int) RowUID {
+	return Base_ACETable.Row([4]byte{0x00, 0x03, 0xE8 | uint8(n>>8), uint8(n)})
+}
@@ -10,19 +10,38 @@ type TableUID UID
 var (
 	AuthorityTable          = TableUID{0x00, 0x00, 0x00, 0x09, 0x00, 0x00, 0x00, 0x00}
 	Base_TableTable         = TableUID{0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00}
+	Base_ColumnTable        = TableUID{0x00, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00, 0x00}
 	Base_MethodIDTable      = TableUID{0x00, 0x00, 0x00, 0x06, 0x00, 0x00, 0x00, 0x00}
 	Base_AccessControlTable = TableUID{0x00, 0x00, 0x00, 0x07, 0x00, 0x00, 0x00, 0x00}
+	Base_ACETable           = TableUID{0x00, 0x00, 0x00, 0x08, 0x00, 0x00, 0x00, 0x00}
 	Admin_TPerInfoTable     = TableUID{0x00, 0x00, 0x02, 0x01, 0x00, 0x00, 0x00, 0x00}
 	Admin_C_PINTable        = TableUID{0x00, 0x00, 0x00, 0x0B, 0x00, 0x00, 0x00, 0x00}
+	Admin_SPTable           = TableUID{0x00, 0x00, 0x02, 0x05, 0x00, 0x00, 0x00, 0x00}
 	Locking_LockingTable    = TableUID{0x00, 0x00, 0x08, 0x02, 0x00, 0x00, 0x00, 0x00}
 	LockingGlobalRange      = TableUID{0x00, 0x00, 0x08, 0x02, 0x00, 0x00, 0x00, 0x01}
 	Locking_MBRTable        = TableUID{0x00, 0x00, 0x08, 0x04, 0x00, 0x00, 0x00, 0x00}
+	Clock_ClockTimeTable    = TableUID{0x00, 0x00, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00}
+	Log_LogTable            = TableUID{0x00, 0x00, 0x0A, 0x01, 0x00, 0x00, 0x00, 0x00}
+	Log_LogListTable        = TableUID{0x00, 0x00, 0x0A, 0x02, 0x00, 0x00, 0x00, 0x00}
+
+	// Vendor specific Port table of the Admin SP of Seagate drives
+	Seagate_PortTable = TableUID{0x00, 0x01, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00}
 )
 
 func (t *TableUID) Row(uid [4]byte) RowUID {
 	return [8]byte{t[0], t[1], t[2], t[3], uid[0], uid[1], uid[2], uid[3]}
 }
 
+// C_PINRowForAuthority returns the C_PIN row holding the credential of the
+// given authority, which shares the lower half of the UID with the authority
+// for all authorities except SID.
+func C_PINRowForAuthority(auth AuthorityObjectUID) RowUID {
+	if auth == AuthoritySID {
+		return Admin_C_PIN_SIDRow
+	}
+	return Admin_C_PINTable.Row([4]byte{auth[4], auth[5], auth[6], auth[7]})
+}
+
 func Base_TableRowForTable(tid TableUID) RowUID {
 	return Base_TableTable.Row([4]byte{tid[0], tid[1], tid[2], tid[3]})
 }
@@ -31,6 +31,16 @@ var (
 	AuthorityPSID               = AuthorityObjectUID{0x00, 0x00, 0x00, 0x09, 0x00, 0x01, 0xFF, 0x01} // Opal Feature Set: PSID
 )
 
+// LockingAuthorityAdmin returns the AdminN authority of the Locking SP.
+func LockingAuthorityAdmin(n int) AuthorityObjectUID {
+	return AuthorityObjectUID{0x00, 0x00, 0x00, 0x09, 0x00, 0x01, uint8(n >> 8), uint8(n)}
+}
+
+// LockingAuthorityUser returns the UserN authority of the Locking SP.
+func LockingAuthorityUser(n int) AuthorityObjectUID {
+	return AuthorityObjectUID{0x00, 0x00, 0x00, 0x09, 0x00, 0x03, uint8(n >> 8), uint8(n)}
+}
+
 var (
 	GlobalRangeRowUID RowUID = [8]byte{0x00, 0x00, 0x08, 0x02, 0x00, 0x00, 0x00, 0x01}
 	Band1Enterprise   RowUID = [8]byte{0x00, 0x00, 0x08, 0x02, 0x00, 0x00, 0x00, 0x02}
@@ -0,0 +1,51 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package core
+
+import (
+	"sync"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive"
+)
+
+// VendorOps is implemented by packages providing the proprietary SPs,
+// tables and methods of a vendor, e.g. the port locking of Seagate drives.
+// Such packages register themselves with RegisterVendorOps and offer their
+// operations as methods of the type implementing VendorOps, which callers
+// obtain with Core.VendorOps and a type assertion.
+type VendorOps interface {
+	// Name of the vendor, e.g. "Seagate"
+	Vendor() string
+	// Whether the drive is supported, based on its identity and Level 0
+	// Discovery
+	Match(id *drive.Identity, d0 *Level0Discovery) bool
+}
+
+var vendorOps = struct {
+	sync.Mutex
+	l []VendorOps
+}{}
+
+// RegisterVendorOps makes v available to Core.VendorOps. It is meant to be
+// called from init functions.
+func RegisterVendorOps(v VendorOps) {
+	vendorOps.Lock()
+	defer vendorOps.Unlock()
+	vendorOps.l = append(vendorOps.l, v)
+}
+
+// VendorOps returns the registered vendor extensions that support the drive,
+// in the order they were registered.
+func (d *Core) VendorOps() []VendorOps {
+	vendorOps.Lock()
+	defer vendorOps.Unlock()
+	var res []VendorOps
+	for _, v := range vendorOps.l {
+		if v.Match(d.DiskInfo.Identity, d.DiskInfo.Level0Discovery) {
+			res = append(res, v)
+		}
+	}
+	return res
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package drive
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+var ErrNoCertificate = errors.New("drive has no certificate")
+
+// VerifyCertificate checks a certificate chain as returned by Certificate,
+// where the first certificate is the one of the TPer and the others are
+// intermediates. The chain must lead to one of roots, e.g. the TCG and vendor
+// CAs trusted by the caller. If roots is nil only the validity periods of the
+// certificates are checked against now.
+func VerifyCertificate(chain []*x509.Certificate, roots *x509.CertPool, now time.Time) error {
+	if len(chain) == 0 {
+		return ErrNoCertificate
+	}
+	for _, c := range chain {
+		if now.Before(c.NotBefore) {
+			return fmt.Errorf("certificate %q is not valid before %s", c.Subject, c.NotBefore.Format(time.RFC3339))
+		}
+		if now.After(c.NotAfter) {
+			return fmt.Errorf("certificate %q expired on %s", c.Subject, c.NotAfter.Format(time.RFC3339))
+		}
+	}
+	if roots == nil {
+		return nil
+	}
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+	_, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		// TPer certificates do not necessarily carry extended key usages
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return fmt.Errorf("certificate verification failed: %v", err)
+	}
+	return nil
+}
+
+// LoadCertPool reads PEM encoded CA certificates from the given files.
+func LoadCertPool(paths ...string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+	for _, p := range paths {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no certificates found in %s", p)
+		}
+	}
+	return pool, nil
+}
@@ -0,0 +1,74 @@
+package drive
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func newCertificate(t *testing.T, name string, serial int64, ca bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() failed: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		IsCA:                  ca,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate() failed: %v", err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("ParseCertificate() failed: %v", err)
+	}
+	return c, key
+}
+
+func TestVerifyCertificate(t *testing.T) {
+	root, rootKey := newCertificate(t, "Root CA", 1, true, nil, nil)
+	inter, interKey := newCertificate(t, "Vendor CA", 2, true, root, rootKey)
+	tper, _ := newCertificate(t, "TPer", 3, false, inter, interKey)
+	other, _ := newCertificate(t, "Other CA", 4, true, nil, nil)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	untrusted := x509.NewCertPool()
+	untrusted.AddCert(other)
+	valid := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name  string
+		chain []*x509.Certificate
+		roots *x509.CertPool
+		now   time.Time
+		ok    bool
+	}{
+		{"trusted", []*x509.Certificate{tper, inter}, roots, valid, true},
+		{"expiry only", []*x509.Certificate{tper, inter}, nil, valid, true},
+		{"expired", []*x509.Certificate{tper, inter}, nil, time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC), false},
+		{"missing intermediate", []*x509.Certificate{tper}, roots, valid, false},
+		{"untrusted", []*x509.Certificate{tper, inter}, untrusted, valid, false},
+		{"no certificate", nil, roots, valid, false},
+	} {
+		err := VerifyCertificate(tc.chain, tc.roots, tc.now)
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: VerifyCertificate() = %v, want ok %v", tc.name, err, tc.ok)
+		}
+	}
+}
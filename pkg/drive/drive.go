@@ -16,6 +16,10 @@ var (
 	ErrDeviceNotSupported = errors.New("device is not supported")
 )
 
+// DefaultPadding is the size IF-SEND transfers are padded to a multiple of
+// for drives that do not implement Padder, which some drives like.
+const DefaultPadding = 512
+
 type SecurityProtocol int
 
 const (
@@ -56,6 +60,24 @@ type Closer interface {
 	Close() error
 }
 
+// A Padder is a drive that declares the size IF-SEND transfers are padded to
+// a multiple of, or 0 if they should be sent as they are.
+type Padder interface {
+	Padding() uint
+}
+
+// An Opener opens a drive that is not backed by a device node.
+type Opener func(name string) (DriveIntf, error)
+
+var openers = map[string]Opener{}
+
+// RegisterOpener makes Open pass device names of the form "prefix:name" to
+// o, e.g. to use simulated drives with the command line tools. It is meant
+// to be called from init functions.
+func RegisterOpener(prefix string, o Opener) {
+	openers[prefix] = o
+}
+
 // Returns a list of supported security protocols.
 func SecurityProtocols(d DriveIntf) ([]SecurityProtocol, error) {
 	raw := make([]byte, 2048)
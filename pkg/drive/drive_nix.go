@@ -6,9 +6,15 @@ package drive
 
 import (
 	"os"
+	"strings"
 )
 
 func Open(device string) (DriveIntf, error) {
+	if prefix, name, ok := strings.Cut(device, ":"); ok {
+		if o, ok := openers[prefix]; ok {
+			return o(name)
+		}
+	}
 	d, err := os.OpenFile(device, os.O_RDWR, 0)
 	if err != nil {
 		return nil, err
@@ -50,6 +50,12 @@ type nvmeDrive struct {
 	fd FdIntf
 }
 
+// Padding returns 0 as the transfer length of NVMe commands is in bytes, and
+// some drives reject IF-SEND transfers longer than the ComPacket.
+func (d *nvmeDrive) Padding() uint {
+	return 0
+}
+
 func (d *nvmeDrive) IFRecv(proto SecurityProtocol, sps uint16, data *[]byte) error {
 	cmd := nvmeAdminCommand{
 		opcode:   NVME_SECURITY_RECV,
@@ -0,0 +1,52 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package drive
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrBehindRAIDController is returned for logical drives of RAID controllers,
+// which do not pass the security protocols through to the drives behind them.
+var ErrBehindRAIDController = errors.New("device is a logical drive of a RAID controller")
+
+// Inquiry signatures of the logical drives of common RAID controllers, as
+// vendor and product prefix of the model reported by Identify.
+var raidControllers = []struct {
+	vendor  string
+	product string
+	name    string
+}{
+	{"LSI", "MR", "MegaRAID"},
+	{"LSI", "MegaRAID", "MegaRAID"},
+	{"AVAGO", "MR", "MegaRAID"},
+	{"BROADCOM", "MR", "MegaRAID"},
+	{"DELL", "PERC", "PERC"},
+	{"HP", "LOGICAL VOLUME", "Smart Array"},
+	{"HPE", "LOGICAL VOLUME", "Smart Array"},
+	{"COMPAQ", "LOGICAL VOLUME", "Smart Array"},
+	{"IBM", "ServeRAID", "ServeRAID"},
+	{"Lenovo", "RAID", "ThinkSystem RAID"},
+	{"FTS", "PRAID", "PRAID"},
+	{"Adaptec", "", "Adaptec"},
+	{"ASR", "", "Adaptec"},
+	{"Areca", "", "Areca"},
+}
+
+// RAIDController returns the family of the RAID controller if the identity
+// is the one of a logical drive of a known RAID controller.
+func RAIDController(id *Identity) (string, bool) {
+	if id == nil {
+		return "", false
+	}
+	vendor, product, _ := strings.Cut(id.Model, " ")
+	for _, c := range raidControllers {
+		if strings.EqualFold(vendor, c.vendor) && strings.HasPrefix(product, c.product) {
+			return c.name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,24 @@
+package drive
+
+import "testing"
+
+func TestRAIDController(t *testing.T) {
+	for _, tc := range []struct {
+		model string
+		want  string
+	}{
+		{"LSI MR9361-8i", "MegaRAID"},
+		{"AVAGO MR9460-16i", "MegaRAID"},
+		{"DELL PERC H730P Mini", "PERC"},
+		{"HP LOGICAL VOLUME", "Smart Array"},
+		{"Adaptec 8805", "Adaptec"},
+		{"Samsung SSD 970 EVO Plus 1TB", ""},
+		{"SEAGATE ST4000NM0025", ""},
+		{"HP MB4000GVYZK", ""},
+	} {
+		got, ok := RAIDController(&Identity{Model: tc.model})
+		if got != tc.want || ok != (tc.want != "") {
+			t.Errorf("RAIDController(%q) = %q, %v, want %q", tc.model, got, ok, tc.want)
+		}
+	}
+}
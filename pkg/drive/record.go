@@ -0,0 +1,216 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package drive
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var ErrReplayMismatch = errors.New("request does not match the recording")
+
+// Exchange is a single IF-SEND or IF-RECV recorded from a drive.
+type Exchange struct {
+	Op       string           `json:"op"`
+	Protocol SecurityProtocol `json:"protocol"`
+	SPS      uint16           `json:"sps"`
+	// Data sent or received, trailing zero padding of received data is not
+	// recorded
+	Data  []byte `json:"data,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+const (
+	OpIFSend = "IF-SEND"
+	OpIFRecv = "IF-RECV"
+)
+
+// Recording holds all traffic of a drive, in the order it happened.
+type Recording struct {
+	Identity     *Identity  `json:"identity,omitempty"`
+	SerialNumber []byte     `json:"serial_number,omitempty"`
+	Exchanges    []Exchange `json:"exchanges"`
+}
+
+// Anonymize replaces the serial number of the recorded drive with a hash of
+// it, so that recordings of the same drive can still be correlated.
+func (r *Recording) Anonymize() {
+	anon := func(serial string) string {
+		h := sha256.Sum256([]byte(serial))
+		return fmt.Sprintf("anon-%x", h[:8])
+	}
+	if r.Identity != nil {
+		ident := *r.Identity
+		ident.SerialNumber = anon(ident.SerialNumber)
+		r.Identity = &ident
+	}
+	if r.SerialNumber != nil {
+		r.SerialNumber = []byte(anon(string(r.SerialNumber)))
+	}
+}
+
+// Recorder wraps a drive and records all traffic passing through it.
+type Recorder struct {
+	DriveIntf
+	mu  sync.Mutex
+	rec Recording
+}
+
+func NewRecorder(d DriveIntf) *Recorder {
+	return &Recorder{DriveIntf: d}
+}
+
+// Recording returns a copy of everything recorded so far.
+func (r *Recorder) Recording() *Recording {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	rec := r.rec
+	rec.Exchanges = append([]Exchange(nil), r.rec.Exchanges...)
+	return &rec
+}
+
+func (r *Recorder) add(op string, proto SecurityProtocol, sps uint16, data []byte, err error) {
+	e := Exchange{Op: op, Protocol: proto, SPS: sps}
+	if data != nil {
+		e.Data = append([]byte(nil), bytes.TrimRight(data, "\x00")...)
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	r.mu.Lock()
+	r.rec.Exchanges = append(r.rec.Exchanges, e)
+	r.mu.Unlock()
+}
+
+// Padding forwards the padding of the recorded drive, if it declares one.
+func (r *Recorder) Padding() uint {
+	if p, ok := r.DriveIntf.(Padder); ok {
+		return p.Padding()
+	}
+	return DefaultPadding
+}
+
+func (r *Recorder) IFSend(proto SecurityProtocol, sps uint16, data []byte) error {
+	err := r.DriveIntf.IFSend(proto, sps, data)
+	r.add(OpIFSend, proto, sps, data, err)
+	return err
+}
+
+func (r *Recorder) IFRecv(proto SecurityProtocol, sps uint16, data *[]byte) error {
+	err := r.DriveIntf.IFRecv(proto, sps, data)
+	if err != nil {
+		r.add(OpIFRecv, proto, sps, nil, err)
+	} else {
+		r.add(OpIFRecv, proto, sps, *data, nil)
+	}
+	return err
+}
+
+func (r *Recorder) Identify() (*Identity, error) {
+	ident, err := r.DriveIntf.Identify()
+	if err == nil {
+		r.mu.Lock()
+		r.rec.Identity = ident
+		r.mu.Unlock()
+	}
+	return ident, err
+}
+
+func (r *Recorder) SerialNumber() ([]byte, error) {
+	sn, err := r.DriveIntf.SerialNumber()
+	if err == nil {
+		r.mu.Lock()
+		r.rec.SerialNumber = sn
+		r.mu.Unlock()
+	}
+	return sn, err
+}
+
+type replayDrive struct {
+	mu  sync.Mutex
+	rec *Recording
+	pos int
+}
+
+// NewReplayDrive returns a drive that plays back a recording. Requests have
+// to arrive in the recorded order and for the same protocol and ComID, their
+// content is not compared as it contains e.g. session numbers and nonces.
+func NewReplayDrive(rec *Recording) DriveIntf {
+	return &replayDrive{rec: rec}
+}
+
+func (d *replayDrive) next(op string, proto SecurityProtocol, sps uint16) (*Exchange, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.pos >= len(d.rec.Exchanges) {
+		return nil, fmt.Errorf("%w: %s beyond end of recording", ErrReplayMismatch, op)
+	}
+	e := &d.rec.Exchanges[d.pos]
+	if e.Op != op || e.Protocol != proto || e.SPS != sps {
+		return nil, fmt.Errorf("%w: exchange %d is %s protocol 0x%02x ComID 0x%04x, got %s protocol 0x%02x ComID 0x%04x",
+			ErrReplayMismatch, d.pos, e.Op, int(e.Protocol), e.SPS, op, int(proto), sps)
+	}
+	d.pos++
+	return e, nil
+}
+
+func replayError(msg string) error {
+	for _, err := range []error{ErrNotSupported, ErrDeviceNotSupported} {
+		if msg == err.Error() {
+			return err
+		}
+	}
+	return errors.New(msg)
+}
+
+func (d *replayDrive) IFSend(proto SecurityProtocol, sps uint16, data []byte) error {
+	e, err := d.next(OpIFSend, proto, sps)
+	if err != nil {
+		return err
+	}
+	if e.Error != "" {
+		return replayError(e.Error)
+	}
+	return nil
+}
+
+func (d *replayDrive) IFRecv(proto SecurityProtocol, sps uint16, data *[]byte) error {
+	e, err := d.next(OpIFRecv, proto, sps)
+	if err != nil {
+		return err
+	}
+	if e.Error != "" {
+		return replayError(e.Error)
+	}
+	if len(e.Data) > len(*data) {
+		return fmt.Errorf("%w: recorded response of %d bytes does not fit %d byte buffer", ErrReplayMismatch, len(e.Data), len(*data))
+	}
+	n := copy(*data, e.Data)
+	for i := n; i < len(*data); i++ {
+		(*data)[i] = 0
+	}
+	return nil
+}
+
+func (d *replayDrive) Identify() (*Identity, error) {
+	if d.rec.Identity == nil {
+		return nil, ErrNotSupported
+	}
+	return d.rec.Identity, nil
+}
+
+func (d *replayDrive) SerialNumber() ([]byte, error) {
+	if d.rec.SerialNumber == nil {
+		return nil, ErrNotSupported
+	}
+	return d.rec.SerialNumber, nil
+}
+
+func (d *replayDrive) Close() error {
+	return nil
+}
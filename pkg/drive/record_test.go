@@ -0,0 +1,79 @@
+package drive
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+type fakeDrive struct {
+	resp []byte
+}
+
+func (d *fakeDrive) IFSend(proto SecurityProtocol, sps uint16, data []byte) error {
+	return nil
+}
+
+func (d *fakeDrive) IFRecv(proto SecurityProtocol, sps uint16, data *[]byte) error {
+	if proto == SecurityProtocolTCGTPer {
+		return ErrNotSupported
+	}
+	copy(*data, d.resp)
+	return nil
+}
+
+func (d *fakeDrive) Identify() (*Identity, error) {
+	return &Identity{Protocol: "NVMe", SerialNumber: "S123", Model: "Drive", Firmware: "1.0"}, nil
+}
+
+func (d *fakeDrive) SerialNumber() ([]byte, error) {
+	return []byte("S123"), nil
+}
+
+func (d *fakeDrive) Close() error {
+	return nil
+}
+
+func TestRecordReplay(t *testing.T) {
+	r := NewRecorder(&fakeDrive{resp: []byte{1, 2, 3}})
+	if _, err := r.Identify(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.IFSend(SecurityProtocolTCGManagement, 0x1000, []byte{9, 9}); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 512)
+	if err := r.IFRecv(SecurityProtocolTCGManagement, 0x1000, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.IFRecv(SecurityProtocolTCGTPer, 0, &buf); err != ErrNotSupported {
+		t.Fatalf("IFRecv returned %v, want ErrNotSupported", err)
+	}
+
+	rec := r.Recording()
+	rec.Anonymize()
+	if rec.Identity.SerialNumber == "S123" || rec.Identity.Model != "Drive" {
+		t.Errorf("identity not anonymized as expected: %+v", rec.Identity)
+	}
+	if len(rec.Exchanges) != 3 {
+		t.Fatalf("recorded %d exchanges, want 3", len(rec.Exchanges))
+	}
+	if !bytes.Equal(rec.Exchanges[1].Data, []byte{1, 2, 3}) {
+		t.Errorf("padding not trimmed: %v", rec.Exchanges[1].Data)
+	}
+
+	d := NewReplayDrive(rec)
+	if err := d.IFSend(SecurityProtocolTCGManagement, 0x1000, []byte{8}); err != nil {
+		t.Fatal(err)
+	}
+	buf = bytes.Repeat([]byte{0xff}, 16)
+	if err := d.IFRecv(SecurityProtocolTCGManagement, 0x1000, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if want := append([]byte{1, 2, 3}, make([]byte, 13)...); !bytes.Equal(buf, want) {
+		t.Errorf("replayed %v, want %v", buf, want)
+	}
+	if err := d.IFRecv(SecurityProtocolTCGManagement, 0x1000, &buf); !errors.Is(err, ErrReplayMismatch) {
+		t.Errorf("out of order IFRecv returned %v, want ErrReplayMismatch", err)
+	}
+}
@@ -9,30 +9,97 @@ import (
 	"fmt"
 	"runtime"
 	"strings"
+	"sync"
 
 	"github.com/open-source-firmware/go-tcg-storage/pkg/drive/sgio"
 )
 
 type scsiDrive struct {
 	fd FdIntf
+
+	probeOnce sync.Once
+	tcErr     error
+	// ata is set for ATA drives behind a SCSI ATA Translation (SAT) layer
+	ata bool
+	// ataPT16 selects ATA PASS-THROUGH(16) instead of SECURITY PROTOCOL
+	// IN/OUT, needed for SATA drives behind some SAS HBAs and expanders
+	ataPT16 bool
+}
+
+// probe inspects the drive once before the first security command.
+//
+// It fails if the drive is an ATA drive that reports in ATA IDENTIFY that it
+// does not support the Trusted Computing feature set, as such drives may only
+// time out on the security commands. SATA drives attached through SAS are
+// addressed with ATA PASS-THROUGH(16), as the SAT layer of SAS HBAs and
+// expanders does not reliably translate SECURITY PROTOCOL IN/OUT.
+func (d *scsiDrive) probe() error {
+	d.probeOnce.Do(func() {
+		defer runtime.KeepAlive(d.fd)
+		inq, err := sgio.SCSIInquiry(d.fd.Fd())
+		if err != nil || !bytes.Equal(inq.VendorIdent, []byte("ATA     ")) {
+			return
+		}
+		d.ata = true
+		// Protocol identifier 6 is SAS, reported by the SAT layer of the
+		// HBA or expander the SATA drive is attached to
+		d.ataPT16 = inq.Protocol == sgio.SCSIProtocol(6)
+		id, err := sgio.ATAIdentify(d.fd.Fd())
+		if err != nil {
+			// Not all SAT implementations pass ATA commands through,
+			// leave it to the security commands
+			return
+		}
+		if supported, reported := id.TrustedComputing(); reported && !supported {
+			d.tcErr = fmt.Errorf("%w: the ATA drive does not support the Trusted Computing feature set", ErrNotSupported)
+		}
+	})
+	return d.tcErr
 }
 
 func (d *scsiDrive) IFRecv(proto SecurityProtocol, sps uint16, data *[]byte) error {
+	if err := d.probe(); err != nil {
+		return err
+	}
+	defer runtime.KeepAlive(d.fd)
+	if d.ataPT16 {
+		return securityErr(sgio.ATATrustedReceive16(d.fd.Fd(), uint8(proto), sps, data))
+	}
 	// TODO: It seems that some drives are picky on that the data is aligned in some fashion, possibly to 512?
 	// Should work something out to ensure we pad the request accordingly
 	err := sgio.SCSISecurityIn(d.fd.Fd(), uint8(proto), sps, data)
-	runtime.KeepAlive(d.fd)
-	if err == sgio.ErrIllegalRequest {
-		return ErrNotSupported
+	if err == sgio.ErrIllegalRequest && d.ata {
+		// The SAT layer does not translate SECURITY PROTOCOL IN,
+		// retry with and stick to ATA PASS-THROUGH(16) if that works
+		if err := sgio.ATATrustedReceive16(d.fd.Fd(), uint8(proto), sps, data); err == nil {
+			d.ataPT16 = true
+			return nil
+		}
 	}
-	return err
+	return securityErr(err)
 }
 
 func (d *scsiDrive) IFSend(proto SecurityProtocol, sps uint16, data []byte) error {
+	if err := d.probe(); err != nil {
+		return err
+	}
+	defer runtime.KeepAlive(d.fd)
+	if d.ataPT16 {
+		return securityErr(sgio.ATATrustedSend16(d.fd.Fd(), uint8(proto), sps, data))
+	}
 	// TODO: It seems that some drives are picky on that the data is aligned in some fashion, possibly to 512?
 	// Should work something out to ensure we pad the request accordingly
 	err := sgio.SCSISecurityOut(d.fd.Fd(), uint8(proto), sps, data)
-	runtime.KeepAlive(d.fd)
+	if err == sgio.ErrIllegalRequest && d.ata {
+		if err := sgio.ATATrustedSend16(d.fd.Fd(), uint8(proto), sps, data); err == nil {
+			d.ataPT16 = true
+			return nil
+		}
+	}
+	return securityErr(err)
+}
+
+func securityErr(err error) error {
 	if err == sgio.ErrIllegalRequest {
 		return ErrNotSupported
 	}
@@ -94,7 +94,10 @@ type IdentifyDeviceResponse struct {
 	_        [6]byte
 	Firmware [8]byte
 	Model    [40]byte
-	_        [418]byte
+	_        [2]byte
+	// Word 48, Trusted Computing feature set options
+	TrustedComputingOptions [2]byte
+	_                       [414]byte
 }
 
 func ATAString(b []byte) string {
@@ -106,6 +109,18 @@ func ATAString(b []byte) string {
 	return string(out)
 }
 
+// TrustedComputing returns whether the device supports the Trusted Computing
+// feature set, i.e. TRUSTED SEND and TRUSTED RECEIVE. reported is false if
+// word 48 does not hold valid data, in which case support is unknown.
+func (id IdentifyDeviceResponse) TrustedComputing() (supported bool, reported bool) {
+	w := binary.LittleEndian.Uint16(id.TrustedComputingOptions[:])
+	// Bits 15:14 are 01b if the word is valid
+	if w&0xC000 != 0x4000 {
+		return false, false
+	}
+	return w&0x1 != 0, true
+}
+
 func (id IdentifyDeviceResponse) String() string {
 	return fmt.Sprintf("Serial=%s, Firmware=%s, Model=%s",
 		strings.TrimSpace(ATAString(id.Serial[:])),
@@ -274,13 +289,43 @@ func ATATrustedSend(fd uintptr, proto uint8, comID uint16, in []byte) error {
 	cdb[4] = uint8(len(in) / 512)
 	cdb[6] = uint8(comID & 0xff)
 	cdb[7] = uint8((comID & 0xff00) >> 8)
-	cdb[9] = ATA_TRUSTED_RCV
+	cdb[9] = ATA_TRUSTED_SND
 	if err := SendCDB(fd, cdb[:], CDBToDevice, &in); err != nil {
 		return err
 	}
 	return nil
 }
 
+// ATA PASS-THROUGH(16) CDB of TRUSTED RECEIVE or TRUSTED SEND. The extend bit
+// is set and the transfer length spans COUNT and LBA(7:0), as SAT layers of
+// SAS HBAs and expanders may reject the 12 byte variant or truncate its
+// registers.
+func ataTrustedCDB16(command uint8, protocol uint8, flags uint8, proto uint8, comID uint16, length int) CDB16 {
+	blocks := length / 512
+	cdb := CDB16{SCSI_ATA_PASSTHRU_16}
+	cdb[1] = protocol<<1 | 0x1
+	cdb[2] = flags
+	cdb[4] = proto
+	cdb[6] = uint8(blocks)
+	cdb[8] = uint8(blocks >> 8)
+	cdb[10] = uint8(comID & 0xff)
+	cdb[12] = uint8((comID & 0xff00) >> 8)
+	cdb[14] = command
+	return cdb
+}
+
+// ATA TRUSTED RECEIVE using ATA PASS-THROUGH(16)
+func ATATrustedReceive16(fd uintptr, proto uint8, comID uint16, resp *[]byte) error {
+	cdb := ataTrustedCDB16(ATA_TRUSTED_RCV, PIO_DATA_IN, 0x0E, proto, comID, len(*resp))
+	return SendCDB(fd, cdb[:], CDBFromDevice, resp)
+}
+
+// ATA TRUSTED SEND using ATA PASS-THROUGH(16)
+func ATATrustedSend16(fd uintptr, proto uint8, comID uint16, in []byte) error {
+	cdb := ataTrustedCDB16(ATA_TRUSTED_SND, PIO_DATA_OUT, 0x06, proto, comID, len(in))
+	return SendCDB(fd, cdb[:], CDBToDevice, &in)
+}
+
 // SCSI SECURITY IN
 func SCSISecurityIn(fd uintptr, proto uint8, sps uint16, resp *[]byte) error {
 	if len(*resp)&0x1ff > 0 {
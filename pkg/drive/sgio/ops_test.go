@@ -0,0 +1,35 @@
+package sgio
+
+import "testing"
+
+func TestTrustedComputing(t *testing.T) {
+	for _, tc := range []struct {
+		word      [2]byte
+		supported bool
+		reported  bool
+	}{
+		{[2]byte{0x01, 0x40}, true, true},
+		{[2]byte{0x00, 0x40}, false, true},
+		{[2]byte{0x00, 0x00}, false, false},
+		{[2]byte{0xff, 0xff}, false, false},
+	} {
+		id := IdentifyDeviceResponse{TrustedComputingOptions: tc.word}
+		supported, reported := id.TrustedComputing()
+		if supported != tc.supported || reported != tc.reported {
+			t.Errorf("TrustedComputing() of word %x = %v, %v, want %v, %v", tc.word, supported, reported, tc.supported, tc.reported)
+		}
+	}
+}
+
+func TestATATrustedCDB16(t *testing.T) {
+	cdb := ataTrustedCDB16(ATA_TRUSTED_RCV, PIO_DATA_IN, 0x0E, 0x01, 0x07fe, 2048)
+	want := CDB16{0x85, 0x09, 0x0E, 0, 0x01, 0, 0x04, 0, 0, 0, 0xfe, 0, 0x07, 0, 0x5c, 0}
+	if cdb != want {
+		t.Errorf("ataTrustedCDB16() = % x, want % x", cdb, want)
+	}
+	cdb = ataTrustedCDB16(ATA_TRUSTED_SND, PIO_DATA_OUT, 0x06, 0x02, 0x0001, 512*0x101)
+	want = CDB16{0x85, 0x0b, 0x06, 0, 0x02, 0, 0x01, 0, 0x01, 0, 0x01, 0, 0, 0, 0x5e, 0}
+	if cdb != want {
+		t.Errorf("ataTrustedCDB16() = % x, want % x", cdb, want)
+	}
+}
@@ -0,0 +1,516 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Session Manager and methods of the simulated SPs
+
+package sim
+
+import (
+	"bytes"
+	"crypto/rand"
+	"sort"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/stream"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+const (
+	statusNotAuthorized    uint = 0x01
+	statusSPBusy           uint = 0x03
+	statusNoSessions       uint = 0x07
+	statusInvalidParameter uint = 0x0C
+	statusFail             uint = 0x3F
+
+	firstTSN = 0x1000
+
+	maxIndTokenSize = 65480
+	maxMethods      = 16
+	maxSessions     = 1
+)
+
+type session struct {
+	hsn, tsn uint32
+	sp       ref
+	write    bool
+	// Authenticated authorities besides Anybody
+	auths []ref
+}
+
+func (s *session) authenticated(a ref) bool {
+	for _, x := range s.auths {
+		if x == a {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *session) admin(d *Drive) bool {
+	for _, a := range s.auths {
+		if s.sp == lockingSP && d.aceAllows(stream.List{lockingAdmins[:]}, a) {
+			return true
+		}
+	}
+	return false
+}
+
+// A method call as decoded from a ComPacket
+type call struct {
+	iid, mid ref
+	// Required parameters followed by the optional ones, by their number
+	params   stream.List
+	optional map[uint]interface{}
+}
+
+// Split the parameters of a method into the required and the optional ones.
+func parseParams(l stream.List) (stream.List, map[uint]interface{}, bool) {
+	var req stream.List
+	opt := map[uint]interface{}{}
+	for i := 0; i < len(l); i++ {
+		if !stream.EqualToken(l[i], stream.StartName) {
+			if len(opt) > 0 {
+				return nil, nil, false
+			}
+			req = append(req, l[i])
+			continue
+		}
+		if i+3 >= len(l) || !stream.EqualToken(l[i+3], stream.EndName) {
+			return nil, nil, false
+		}
+		n, ok := l[i+1].(uint)
+		if !ok {
+			return nil, nil, false
+		}
+		opt[n] = l[i+2]
+		i += 3
+	}
+	return req, opt, true
+}
+
+func parseCall(l stream.List) (*call, bool) {
+	if len(l) != 6 || !stream.EqualToken(l[0], stream.Call) || !stream.EqualToken(l[4], stream.EndOfData) {
+		return nil, false
+	}
+	iid, ok1 := l[1].([]byte)
+	mid, ok2 := l[2].([]byte)
+	params, ok3 := l[3].(stream.List)
+	if !ok1 || !ok2 || !ok3 || len(iid) != 8 || len(mid) != 8 {
+		return nil, false
+	}
+	c := &call{}
+	copy(c.iid[:], iid)
+	copy(c.mid[:], mid)
+	var ok bool
+	if c.params, c.optional, ok = parseParams(params); !ok {
+		return nil, false
+	}
+	return c, true
+}
+
+// Encode a method response: the results or the Session Manager method call,
+// followed by the status list.
+func response(body []byte, status uint) []byte {
+	b := append([]byte{}, body...)
+	b = append(b, stream.Token(stream.EndOfData)...)
+	b = append(b, stream.Token(stream.StartList)...)
+	b = append(b, stream.UInt(status)...)
+	b = append(b, stream.UInt(0)...)
+	b = append(b, stream.UInt(0)...)
+	return append(b, stream.Token(stream.EndList)...)
+}
+
+func list(items ...[]byte) []byte {
+	b := stream.Token(stream.StartList)
+	for _, i := range items {
+		b = append(b, i...)
+	}
+	return append(b, stream.Token(stream.EndList)...)
+}
+
+func named(name []byte, value []byte) []byte {
+	b := stream.Token(stream.StartName)
+	b = append(b, name...)
+	b = append(b, value...)
+	return append(b, stream.Token(stream.EndName)...)
+}
+
+// Handle a ComPacket payload, returning the payload of the response.
+func (d *Drive) handle(tsn, hsn uint32, payload []byte) []byte {
+	l, err := stream.Decode(payload)
+	if err != nil {
+		return nil
+	}
+	if tsn == 0 && hsn == 0 {
+		c, ok := parseCall(l)
+		if !ok || c.iid != ref(uid.InvokeIDSMU) {
+			return nil
+		}
+		switch c.mid {
+		case ref(uid.MethodIDSMProperties):
+			return d.properties(c)
+		case ref(uid.MethodIDSMStartSession):
+			return d.startSession(c)
+		}
+		return nil
+	}
+	s, ok := d.sessions[tsn]
+	if !ok || s.hsn != hsn {
+		// Not a session of ours, ignore it like a drive would
+		return nil
+	}
+	if len(l) == 1 && stream.EqualToken(l[0], stream.EndOfSession) {
+		delete(d.sessions, tsn)
+		return stream.Token(stream.EndOfSession)
+	}
+	// Up to maxMethods calls of six tokens each, responded to in order
+	if len(l) == 0 || len(l)%6 != 0 || len(l)/6 > maxMethods {
+		return response(list(), statusInvalidParameter)
+	}
+	var b []byte
+	for i := 0; i < len(l); i += 6 {
+		c, ok := parseCall(l[i : i+6])
+		if !ok {
+			return append(b, response(list(), statusInvalidParameter)...)
+		}
+		result, status := d.call(s, c)
+		b = append(b, response(list(result...), status)...)
+		// Stop at the first failed method, hosts have to cope with TPers
+		// that do
+		if status != method.MethodStatusSuccess {
+			break
+		}
+	}
+	return b
+}
+
+func (d *Drive) properties(c *call) []byte {
+	mc := method.NewMethodCall(uid.InvokeIDSMU, uid.MethodIDSMProperties, 0)
+	mc.StartList()
+	for _, p := range []struct {
+		name string
+		val  uint
+	}{
+		{"MaxMethods", maxMethods},
+		{"MaxSubpackets", 1},
+		{"MaxPacketSize", 65516},
+		{"MaxPackets", 1},
+		{"MaxComPacketSize", 65536},
+		{"MaxResponseComPacketSize", 65536},
+		{"MaxSessions", maxSessions},
+		{"MaxReadSessions", maxSessions},
+		{"MaxIndTokenSize", maxIndTokenSize},
+		{"MaxAggTokenSize", maxIndTokenSize},
+		{"MaxAuthentications", 2},
+		{"MaxTransactionLimit", 1},
+		{"DefSessionTimeout", 0},
+	} {
+		mc.NamedUInt(p.name, p.val)
+	}
+	mc.EndList()
+	// The host properties are accepted as requested
+	mc.StartOptionalParameter(0, "HostProperties")
+	if hp, ok := c.optional[0].(stream.List); ok {
+		mc.RawByte(encode(hp))
+	} else {
+		mc.StartList()
+		mc.EndList()
+	}
+	mc.EndOptionalParameter()
+	b, err := mc.MarshalBinary()
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+func (d *Drive) startSession(c *call) []byte {
+	fail := func(status uint) []byte {
+		b := stream.Token(stream.Call)
+		b = append(b, stream.Bytes(uid.InvokeIDSMU[:])...)
+		b = append(b, stream.Bytes(uid.MethodIDSMSyncSession[:])...)
+		return response(append(b, list()...), status)
+	}
+	if len(c.params) != 3 {
+		return fail(statusInvalidParameter)
+	}
+	hsn, ok1 := c.params[0].(uint)
+	spid, ok2 := c.params[1].([]byte)
+	write, ok3 := c.params[2].(uint)
+	if !ok1 || !ok2 || !ok3 || len(spid) != 8 {
+		return fail(statusInvalidParameter)
+	}
+	s := &session{hsn: uint32(hsn), write: write > 0}
+	copy(s.sp[:], spid)
+	if s.sp != adminSP && (s.sp != lockingSP || !d.lockingSPActive()) {
+		return fail(statusInvalidParameter)
+	}
+	if s.write {
+		for _, o := range d.sessions {
+			if o.write {
+				return fail(statusSPBusy)
+			}
+		}
+	}
+	if len(d.sessions) >= maxSessions {
+		return fail(statusNoSessions)
+	}
+	// Authentication while starting the session, as sedutil does it
+	if a, ok := c.optional[3].([]byte); ok {
+		var auth ref
+		copy(auth[:], a)
+		proof, _ := c.optional[0].([]byte)
+		if !d.authenticate(s, auth, proof) {
+			return fail(statusNotAuthorized)
+		}
+	}
+	if d.sessions == nil {
+		d.sessions = map[uint32]*session{}
+		d.nextTSN = firstTSN
+	}
+	s.tsn = d.nextTSN
+	d.nextTSN++
+	d.sessions[s.tsn] = s
+
+	mc := method.NewMethodCall(uid.InvokeIDSMU, uid.MethodIDSMSyncSession, 0)
+	mc.UInt(uint(s.hsn))
+	mc.UInt(uint(s.tsn))
+	b, err := mc.MarshalBinary()
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+// Invoke a method in a session, returning the encoded results and status.
+func (d *Drive) call(s *session, c *call) ([][]byte, uint) {
+	switch c.mid {
+	case ref(uid.OpalGet):
+		return d.get(s, c)
+	case ref(uid.OpalSet):
+		return d.set(s, c)
+	case ref(uid.OpalNext):
+		return d.next(s, c)
+	case ref(uid.OpalAuthenticate):
+		if c.iid != ref(uid.InvokeIDThisSP) || len(c.params) != 1 {
+			return nil, statusInvalidParameter
+		}
+		a, ok := c.params[0].([]byte)
+		if !ok || len(a) != 8 {
+			return nil, statusInvalidParameter
+		}
+		var auth ref
+		copy(auth[:], a)
+		proof, _ := c.optional[0].([]byte)
+		return [][]byte{boolCell(d.authenticate(s, auth, proof))}, method.MethodStatusSuccess
+	case ref(uid.OpalGenKey):
+		if !s.write || !s.admin(d) {
+			return nil, statusNotAuthorized
+		}
+		if _, ok := d.st.SPs[s.sp][c.iid]; !ok || !inTable(c.iid, keyTable) {
+			return nil, statusInvalidParameter
+		}
+		return nil, method.MethodStatusSuccess
+	case ref(uid.OpalRandom):
+		if c.iid != ref(uid.InvokeIDThisSP) || len(c.params) != 1 {
+			return nil, statusInvalidParameter
+		}
+		n, ok := c.params[0].(uint)
+		if !ok || n > maxIndTokenSize-4 {
+			return nil, statusInvalidParameter
+		}
+		b := make([]byte, n)
+		if _, err := rand.Read(b); err != nil {
+			return nil, statusFail
+		}
+		return [][]byte{bytesCell(b)}, method.MethodStatusSuccess
+	case ref(uid.OpalActivate):
+		return d.activate(s, c)
+	case ref(uid.OpalRevert):
+		return d.revert(s, c)
+	case ref(uid.OpalRevertSP):
+		if c.iid != ref(uid.InvokeIDThisSP) || s.sp != lockingSP {
+			return nil, statusInvalidParameter
+		}
+		if !s.write || !s.admin(d) {
+			return nil, statusNotAuthorized
+		}
+		d.revertLockingSP()
+		delete(d.sessions, s.tsn)
+		return nil, method.MethodStatusSuccess
+	}
+	return nil, statusInvalidParameter
+}
+
+func (d *Drive) authenticate(s *session, auth ref, proof []byte) bool {
+	objs := d.st.SPs[s.sp]
+	if _, ok := objs[auth]; !ok || !d.boolCell(s.sp, auth, colAuthorityEnabled) {
+		return false
+	}
+	if auth == anybody {
+		return true
+	}
+	pin, ok := d.cell(s.sp, ref(uid.C_PINRowForAuthority(uid.AuthorityObjectUID(auth))), colPIN).([]byte)
+	if !ok || !bytes.Equal(pin, proof) {
+		return false
+	}
+	if !s.authenticated(auth) {
+		s.auths = append(s.auths, auth)
+	}
+	return true
+}
+
+func (d *Drive) get(s *session, c *call) ([][]byte, uint) {
+	r, ok := d.st.SPs[s.sp][c.iid]
+	if !ok || len(c.params) != 1 || len(c.optional) != 0 {
+		return nil, statusInvalidParameter
+	}
+	cellBlock, ok := c.params[0].(stream.List)
+	if !ok {
+		return nil, statusInvalidParameter
+	}
+	req, cols, ok := parseParams(cellBlock)
+	if !ok || len(req) != 0 {
+		return nil, statusInvalidParameter
+	}
+	first, last := uint(0), ^uint(0)
+	for n, v := range cols {
+		col, ok := v.(uint)
+		if !ok {
+			return nil, statusInvalidParameter
+		}
+		switch n {
+		case 3:
+			first = col
+		case 4:
+			last = col
+		default:
+			// Rows of byte tables are not simulated
+			return nil, statusInvalidParameter
+		}
+	}
+	if !s.mayGet(d, c.iid) {
+		return nil, statusNotAuthorized
+	}
+	var ids []uint
+	for col := range r {
+		// The PINs cannot be read, except for the MSID
+		if col >= first && col <= last && !(inTable(c.iid, cpinTable) && col == colPIN && c.iid != msid) {
+			ids = append(ids, col)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	var values [][]byte
+	for _, col := range ids {
+		values = append(values, named(stream.UInt(col), r[col]))
+	}
+	return [][]byte{list(values...)}, method.MethodStatusSuccess
+}
+
+func (d *Drive) set(s *session, c *call) ([][]byte, uint) {
+	r, ok := d.st.SPs[s.sp][c.iid]
+	if !ok || len(c.params) != 0 {
+		return nil, statusInvalidParameter
+	}
+	if _, ok := c.optional[0]; ok {
+		// Where is only used for byte tables, which are not simulated
+		return nil, statusInvalidParameter
+	}
+	values, ok := c.optional[1].(stream.List)
+	if !ok {
+		return nil, statusInvalidParameter
+	}
+	req, cols, ok := parseParams(values)
+	if !ok || len(req) != 0 {
+		return nil, statusInvalidParameter
+	}
+	var ids []uint
+	for col := range cols {
+		if _, ok := r[col]; !ok || col == colUID {
+			return nil, statusInvalidParameter
+		}
+		ids = append(ids, col)
+	}
+	if !s.write || !s.maySet(d, c.iid, ids) {
+		return nil, statusNotAuthorized
+	}
+	for col, v := range cols {
+		r[col] = encode(v)
+	}
+	d.dirty = true
+	return nil, method.MethodStatusSuccess
+}
+
+func (d *Drive) next(s *session, c *call) ([][]byte, uint) {
+	if len(c.params) != 0 || c.iid[4] != 0 || c.iid[5] != 0 || c.iid[6] != 0 || c.iid[7] != 0 {
+		return nil, statusInvalidParameter
+	}
+	var rows []ref
+	for obj := range d.st.SPs[s.sp] {
+		if inTable(obj, c.iid) {
+			rows = append(rows, obj)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool { return bytes.Compare(rows[i][:], rows[j][:]) < 0 })
+	// Where is the row to continue after, Count limits the number of rows
+	if where, ok := c.optional[0].([]byte); ok {
+		for len(rows) > 0 && bytes.Compare(rows[0][:], where) <= 0 {
+			rows = rows[1:]
+		}
+	}
+	if count, ok := c.optional[1].(uint); ok && count < uint(len(rows)) {
+		rows = rows[:count]
+	}
+	var uids [][]byte
+	for _, r := range rows {
+		uids = append(uids, bytesCell(r[:]))
+	}
+	return [][]byte{list(uids...)}, method.MethodStatusSuccess
+}
+
+func (d *Drive) activate(s *session, c *call) ([][]byte, uint) {
+	if s.sp != adminSP || c.iid != lockingSP || len(c.params) != 0 || len(c.optional) != 0 {
+		return nil, statusInvalidParameter
+	}
+	if !s.write || !s.authenticated(sid) {
+		return nil, statusNotAuthorized
+	}
+	if d.lockingSPActive() {
+		return nil, method.MethodStatusSuccess
+	}
+	sidPIN, _ := d.cell(adminSP, ref(uid.Admin_C_PIN_SIDRow), colPIN).([]byte)
+	d.st.SPs[lockingSP] = lockingSPObjects(sidPIN)
+	d.st.SPs[adminSP][lockingSP][colLifeCycleState] = uintCell(lifeCycleManufactured)
+	d.dirty = true
+	return nil, method.MethodStatusSuccess
+}
+
+func (d *Drive) revert(s *session, c *call) ([][]byte, uint) {
+	if s.sp != adminSP || (c.iid != adminSP && c.iid != lockingSP) {
+		return nil, statusInvalidParameter
+	}
+	if !s.write || !s.authenticated(sid) {
+		return nil, statusNotAuthorized
+	}
+	if c.iid == lockingSP {
+		d.revertLockingSP()
+		return nil, method.MethodStatusSuccess
+	}
+	msidPIN, _ := d.cell(adminSP, msid, colPIN).([]byte)
+	d.st = factoryState(d.st.Serial, msidPIN)
+	d.sessions = nil
+	d.dirty = true
+	return nil, method.MethodStatusSuccess
+}
+
+func (d *Drive) revertLockingSP() {
+	delete(d.st.SPs, lockingSP)
+	d.st.SPs[adminSP][lockingSP][colLifeCycleState] = uintCell(lifeCycleManufacturedInactive)
+	for tsn, o := range d.sessions {
+		if o.sp == lockingSP {
+			delete(d.sessions, tsn)
+		}
+	}
+	d.dirty = true
+}
@@ -0,0 +1,311 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sim implements a software TPer of an Opal 2 drive, to run the
+// tools and libraries end to end without a self-encrypting drive.
+//
+// The simulation covers what the tools need to take ownership of a drive,
+// configure, lock and unlock ranges and revert it: the Session Manager,
+// Get, Set, Next, Authenticate, Activate, Revert, RevertSP and GenKey on the
+// tables of the Admin SP and the Locking SP. Access control is a simplified
+// version of the Opal 2 defaults. Like many Opal drives, the simulated TPer
+// only allows a single open session. There is no user data, MBR or DataStore
+// table and Enterprise SSC drives are not simulated.
+//
+// Importing the package registers the "sim" prefix with drive.Open, so that
+// "sim:/path/to/state.json" opens a simulated drive whose state is kept in
+// the given file.
+package sim
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive"
+)
+
+const (
+	// Serial number of simulated drives
+	Serial = "GOTCGSIM0001"
+	// ComID the simulated drives communicate on
+	BaseComID = 0x07fe
+
+	comIDRequestVerifyComIDValid = 1
+	comIDRequestStackReset       = 2
+)
+
+// ref is the UID of an object, encoded as hex in the state file.
+type ref [8]byte
+
+func (r ref) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(r[:])), nil
+}
+
+func (r *ref) UnmarshalText(b []byte) error {
+	n, err := hex.Decode(r[:], b)
+	if err != nil {
+		return err
+	}
+	if n != len(r) {
+		return fmt.Errorf("malformed UID %q", b)
+	}
+	return nil
+}
+
+// row maps column numbers to their encoded values.
+type row map[uint][]byte
+
+// state is the non-volatile state of the TPer: the objects of every SP.
+type state struct {
+	Serial string              `json:"serial"`
+	SPs    map[ref]map[ref]row `json:"sps"`
+}
+
+// Drive is a simulated Opal 2 drive.
+type Drive struct {
+	mu       sync.Mutex
+	path     string
+	st       *state
+	sessions map[uint32]*session
+	nextTSN  uint32
+	// Response to the last IF-SEND, returned by the next IF-RECV
+	pending    []byte
+	pendingTSN uint32
+	pendingHSN uint32
+	comIDResp  []byte
+	dirty      bool
+}
+
+func init() {
+	drive.RegisterOpener("sim", Open)
+}
+
+// New returns a simulated drive in factory state, kept in memory only.
+func New() *Drive {
+	return &Drive{st: factoryState(Serial, newMSID())}
+}
+
+// Open opens the simulated drive kept in the file at path, creating a drive
+// in factory state if the file does not exist. Every change to the drive is
+// written to the file immediately.
+func Open(path string) (drive.DriveIntf, error) {
+	d := &Drive{path: path}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		d.st = factoryState(Serial, newMSID())
+		return d, d.save()
+	}
+	if err != nil {
+		return nil, err
+	}
+	d.st = &state{}
+	if err := json.Unmarshal(b, d.st); err != nil {
+		return nil, fmt.Errorf("failed to parse simulated drive %s: %v", path, err)
+	}
+	return d, nil
+}
+
+func newMSID() []byte {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return []byte(hex.EncodeToString(b))
+}
+
+func (d *Drive) save() error {
+	d.dirty = false
+	if d.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(d.st, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(d.path), ".sim-*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), d.path)
+}
+
+// Reset simulates a power cycle of the drive: all sessions are aborted and
+// the ranges and the MBRControl are reset according to their LockOnReset
+// and DoneOnReset columns.
+func (d *Drive) Reset() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sessions = nil
+	d.pending = nil
+	d.powerCycle()
+	return d.save()
+}
+
+func (d *Drive) IFSend(proto drive.SecurityProtocol, sps uint16, data []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch proto {
+	case drive.SecurityProtocolTCGManagement:
+		if sps != BaseComID {
+			return fmt.Errorf("invalid ComID 0x%04x", sps)
+		}
+		if len(data) < 56 {
+			return fmt.Errorf("short ComPacket")
+		}
+		tsn := binary.BigEndian.Uint32(data[20:24])
+		hsn := binary.BigEndian.Uint32(data[24:28])
+		n := binary.BigEndian.Uint32(data[52:56])
+		if uint64(n) > uint64(len(data)-56) {
+			return fmt.Errorf("malformed ComPacket")
+		}
+		d.pending = d.handle(tsn, hsn, data[56:56+n])
+		d.pendingTSN, d.pendingHSN = tsn, hsn
+		if d.dirty {
+			if err := d.save(); err != nil {
+				return fmt.Errorf("saving simulated drive failed: %v", err)
+			}
+		}
+		return nil
+	case drive.SecurityProtocolTCGTPer:
+		if sps != BaseComID || len(data) < 8 {
+			return drive.ErrNotSupported
+		}
+		req := binary.BigEndian.Uint32(data[4:8])
+		resp := make([]byte, 16)
+		copy(resp[0:8], data[0:8])
+		binary.BigEndian.PutUint16(resp[10:12], 4)
+		switch req {
+		case comIDRequestVerifyComIDValid:
+			// Issued, or Associated while sessions are open
+			binary.BigEndian.PutUint32(resp[12:16], 2)
+			if len(d.sessions) > 0 {
+				binary.BigEndian.PutUint32(resp[12:16], 3)
+			}
+		case comIDRequestStackReset:
+			d.sessions = nil
+			d.pending = nil
+		default:
+			return fmt.Errorf("unsupported ComID request %d", req)
+		}
+		d.comIDResp = resp
+		return nil
+	}
+	return drive.ErrNotSupported
+}
+
+func (d *Drive) IFRecv(proto drive.SecurityProtocol, sps uint16, data *[]byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	buf := *data
+	for i := range buf {
+		buf[i] = 0
+	}
+	switch {
+	case proto == drive.SecurityProtocolInformation && sps == 0:
+		// Supported security protocols
+		protos := []byte{0x00, 0x01, 0x02}
+		binary.BigEndian.PutUint16(buf[6:8], uint16(len(protos)))
+		copy(buf[8:], protos)
+	case proto == drive.SecurityProtocolTCGManagement && sps == 1:
+		copy(buf, d.discovery0())
+	case proto == drive.SecurityProtocolTCGManagement && sps == BaseComID:
+		binary.BigEndian.PutUint16(buf[4:6], BaseComID)
+		if d.pending == nil {
+			// Empty ComPacket, nothing outstanding
+			return nil
+		}
+		n := uint32(len(d.pending))
+		padded := (n + 3) &^ 3
+		if 56+int(padded) > len(buf) {
+			return fmt.Errorf("response of %d bytes does not fit into the buffer", n)
+		}
+		binary.BigEndian.PutUint32(buf[16:20], 24+12+padded)
+		binary.BigEndian.PutUint32(buf[20:24], d.pendingTSN)
+		binary.BigEndian.PutUint32(buf[24:28], d.pendingHSN)
+		binary.BigEndian.PutUint32(buf[40:44], 12+padded)
+		binary.BigEndian.PutUint32(buf[52:56], n)
+		copy(buf[56:], d.pending)
+		d.pending = nil
+	case proto == drive.SecurityProtocolTCGTPer && sps == 0:
+		// No dynamic ComIDs, the base ComID is to be used
+	case proto == drive.SecurityProtocolTCGTPer && sps == BaseComID:
+		copy(buf, d.comIDResp)
+		d.comIDResp = nil
+	default:
+		return drive.ErrNotSupported
+	}
+	return nil
+}
+
+func (d *Drive) Identify() (*drive.Identity, error) {
+	return &drive.Identity{
+		Protocol:     "Simulated",
+		SerialNumber: d.st.Serial,
+		Model:        "Simulated Opal 2 drive",
+		Firmware:     "sim",
+	}, nil
+}
+
+func (d *Drive) SerialNumber() ([]byte, error) {
+	return []byte(d.st.Serial), nil
+}
+
+func (d *Drive) Close() error {
+	return nil
+}
+
+// Level 0 Discovery with the TPer, Locking and Opal SSC V2 features.
+func (d *Drive) discovery0() []byte {
+	features := bytes.Buffer{}
+	feature := func(code uint16, data []byte) {
+		binary.Write(&features, binary.BigEndian, code)
+		features.Write([]byte{0x10, uint8(len(data))})
+		features.Write(data)
+	}
+	// Sync and streaming supported
+	feature(0x0001, []byte{0x11, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	// Locking and media encryption supported
+	locking := uint8(0x09)
+	if d.lockingSPActive() {
+		locking |= 0x02
+	}
+	if d.locked() {
+		locking |= 0x04
+	}
+	if d.mbrFlag(mbrControlEnable) {
+		locking |= 0x10
+	}
+	if d.mbrFlag(mbrControlDone) {
+		locking |= 0x20
+	}
+	feature(0x0002, []byte{locking, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	opal := make([]byte, 16)
+	binary.BigEndian.PutUint16(opal[0:2], BaseComID)
+	binary.BigEndian.PutUint16(opal[2:4], 1)
+	binary.BigEndian.PutUint16(opal[5:7], numAdmins)
+	binary.BigEndian.PutUint16(opal[7:9], numUsers)
+	feature(0x0203, opal)
+
+	hdr := make([]byte, 48)
+	binary.BigEndian.PutUint32(hdr[0:4], uint32(44+features.Len()))
+	binary.BigEndian.PutUint16(hdr[6:8], 1)
+	return append(hdr, features.Bytes()...)
+}
@@ -0,0 +1,148 @@
+package sim
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive"
+)
+
+var sidPIN = []byte("0123456789abcdef")
+
+func controlSession(t *testing.T, d drive.DriveIntf) (*core.Core, *core.ControlSession) {
+	t.Helper()
+	c, err := core.NewCoreFromDrive(d)
+	if err != nil {
+		t.Fatalf("NewCoreFromDrive() failed: %v", err)
+	}
+	comID, _, err := core.FindComID(c.DriveIntf, c.Level0Discovery)
+	if err != nil {
+		t.Fatalf("FindComID() failed: %v", err)
+	}
+	cs, err := core.NewControlSession(c.DriveIntf, c.Level0Discovery, core.WithComID(comID))
+	if err != nil {
+		t.Fatalf("NewControlSession() failed: %v", err)
+	}
+	return c, cs
+}
+
+// Take ownership of the drive and activate the Locking SP.
+func takeOwnership(t *testing.T, cs *core.ControlSession) {
+	t.Helper()
+	s, err := cs.NewSession(uid.AdminSP)
+	if err != nil {
+		t.Fatalf("NewSession() failed: %v", err)
+	}
+	defer s.Close()
+	msid, err := table.Admin_C_PIN_MSID_GetPIN(s)
+	if err != nil {
+		t.Fatalf("Admin_C_PIN_MSID_GetPIN() failed: %v", err)
+	}
+	if _, err := table.GetCell(s, uid.Admin_C_PIN_SIDRow, table.Admin_C_PIN_ColumnPIN, "PIN"); !errors.Is(err, method.ErrMethodStatusNotAuthorized) {
+		t.Errorf("reading the SID PIN as Anybody returned %v", err)
+	}
+	if err := table.ThisSP_Authenticate(s, uid.AuthoritySID, msid); err != nil {
+		t.Fatalf("authenticating as SID failed: %v", err)
+	}
+	if _, err := table.GetCell(s, uid.Admin_C_PIN_SIDRow, table.Admin_C_PIN_ColumnPIN, "PIN"); !errors.Is(err, table.ErrEmptyResult) {
+		t.Errorf("reading the SID PIN as SID returned %v", err)
+	}
+	if err := table.Admin_C_Pin_SID_SetPIN(s, sidPIN); err != nil {
+		t.Fatalf("Admin_C_Pin_SID_SetPIN() failed: %v", err)
+	}
+	if err := table.LockingSPActivate(s); err != nil {
+		t.Fatalf("LockingSPActivate() failed: %v", err)
+	}
+}
+
+func TestLockOnReset(t *testing.T) {
+	d := New()
+	_, cs := controlSession(t, d)
+	takeOwnership(t, cs)
+
+	s, err := cs.NewSession(uid.LockingSP)
+	if err != nil {
+		t.Fatalf("NewSession() failed: %v", err)
+	}
+	if err := table.ThisSP_Authenticate(s, uid.LockingAuthorityAdmin1, []byte("wrong")); !errors.Is(err, table.ErrAuthenticationFailed) {
+		t.Errorf("authenticating with a wrong PIN returned %v", err)
+	}
+	if err := table.ThisSP_Authenticate(s, uid.LockingAuthorityAdmin1, sidPIN); err != nil {
+		t.Fatalf("authenticating as Admin1 failed: %v", err)
+	}
+	enabled, unlocked := true, false
+	lr := &table.LockingRow{UID: uid.GlobalRangeRowUID, ReadLockEnabled: &enabled, ReadLocked: &unlocked}
+	if err := table.Locking_Set(s, lr); err != nil {
+		t.Fatalf("Locking_Set() failed: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+
+	if err := d.Reset(); err != nil {
+		t.Fatalf("Reset() failed: %v", err)
+	}
+	c, cs := controlSession(t, d)
+	if !c.Level0Discovery.Locking.LockingEnabled || !c.Level0Discovery.Locking.Locked {
+		t.Errorf("unexpected Locking feature after reset: %+v", c.Level0Discovery.Locking)
+	}
+	s, err = cs.NewSession(uid.LockingSP)
+	if err != nil {
+		t.Fatalf("NewSession() failed: %v", err)
+	}
+	defer s.Close()
+	if err := table.ThisSP_Authenticate(s, uid.LockingAuthorityAdmin1, sidPIN); err != nil {
+		t.Fatalf("authenticating as Admin1 failed: %v", err)
+	}
+	r, err := table.Locking_Get(s, uid.GlobalRangeRowUID)
+	if err != nil {
+		t.Fatalf("Locking_Get() failed: %v", err)
+	}
+	if r.ReadLocked == nil || !*r.ReadLocked {
+		t.Errorf("global range is not read locked after reset")
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	path := "sim:" + filepath.Join(t.TempDir(), "drive.json")
+	d, err := drive.Open(path)
+	if err != nil {
+		t.Fatalf("drive.Open() failed: %v", err)
+	}
+	_, cs := controlSession(t, d)
+	takeOwnership(t, cs)
+
+	d, err = drive.Open(path)
+	if err != nil {
+		t.Fatalf("drive.Open() failed: %v", err)
+	}
+	_, cs = controlSession(t, d)
+	s, err := cs.NewSession(uid.AdminSP)
+	if err != nil {
+		t.Fatalf("NewSession() failed: %v", err)
+	}
+	defer s.Close()
+	if err := table.ThisSP_Authenticate(s, uid.AuthoritySID, sidPIN); err != nil {
+		t.Fatalf("authenticating as SID after reopening failed: %v", err)
+	}
+	if lcs, err := table.Admin_SP_GetLifeCycleState(s, uid.LockingSP); err != nil || lcs != table.Manufactured {
+		t.Errorf("Locking SP is %v (%v) after reopening", lcs, err)
+	}
+}
+
+func TestMaxSessions(t *testing.T) {
+	_, cs := controlSession(t, New())
+	s, err := cs.NewSession(uid.AdminSP, core.WithReadOnly())
+	if err != nil {
+		t.Fatalf("NewSession() failed: %v", err)
+	}
+	defer s.Close()
+	if _, err := cs.NewSession(uid.AdminSP, core.WithReadOnly()); !errors.Is(err, method.ErrMethodStatusNoSessionsAvailable) {
+		t.Errorf("second session returned %v", err)
+	}
+}
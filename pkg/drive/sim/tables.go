@@ -0,0 +1,359 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Factory state and access control of the simulated SPs
+
+package sim
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/stream"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+const (
+	numAdmins = 4
+	numUsers  = 8
+	numRanges = 8
+
+	lifeCycleManufacturedInactive = 8
+	lifeCycleManufactured         = 9
+
+	colUID              = 0
+	colName             = 1
+	colCommonName       = 2
+	colPIN              = 3
+	colTryLimit         = 5
+	colTries            = 6
+	colAuthorityIsClass = 3
+	colAuthorityClass   = 4
+	colAuthorityEnabled = 5
+	colACEBooleanExpr   = 3
+	colLifeCycleState   = 6
+	colReadLockEnabled  = 5
+	colWriteLockEnabled = 6
+	colReadLocked       = 7
+	colWriteLocked      = 8
+	colLockOnReset      = 9
+	colActiveKey        = 10
+
+	mbrControlEnable      = 1
+	mbrControlDone        = 2
+	mbrControlDoneOnReset = 3
+
+	resetPowerCycle = 0
+)
+
+var (
+	adminSP   = ref(uid.AdminSP)
+	lockingSP = ref(uid.LockingSP)
+	sid       = ref(uid.AuthoritySID)
+	makers    = ref(uid.AuthorityMakers)
+	anybody   = ref(uid.AuthorityAnybody)
+	msid      = ref(uid.Admin_C_PIN_MSIDRow)
+	// Authority classes of the Locking SP
+	lockingAdmins = ref(uid.AuthorityAdmins)
+	lockingUsers  = ref(uid.LockingAuthorityUser(0))
+
+	lockingTable = ref(uid.Locking_LockingTable)
+	cpinTable    = ref(uid.Admin_C_PINTable)
+	spTable      = ref(uid.Admin_SPTable)
+	lockingInfo  = ref(uid.LockingInfoObj)
+	mbrControl   = ref(uid.MBRControlObj)
+	keyTable     = ref(uid.Locking_K_AES_256Table)
+)
+
+func uintCell(v uint64) []byte {
+	if v <= 0xffffffff {
+		return stream.UInt(uint(v))
+	}
+	b := make([]byte, 9)
+	b[0] = 0x88
+	binary.BigEndian.PutUint64(b[1:], v)
+	return b
+}
+
+func bytesCell(b []byte) []byte {
+	return stream.Bytes(b)
+}
+
+func boolCell(v bool) []byte {
+	if v {
+		return uintCell(1)
+	}
+	return uintCell(0)
+}
+
+// Encode a decoded value again, e.g. to store it in a cell.
+func encode(v interface{}) []byte {
+	switch v := v.(type) {
+	case uint:
+		return uintCell(uint64(v))
+	case []byte:
+		return stream.Bytes(v)
+	case stream.TokenType:
+		return stream.Token(v)
+	case stream.List:
+		b := stream.Token(stream.StartList)
+		for _, x := range v {
+			b = append(b, encode(x)...)
+		}
+		return append(b, stream.Token(stream.EndList)...)
+	}
+	return nil
+}
+
+func decodeCell(b []byte) interface{} {
+	l, err := stream.Decode(b)
+	if err != nil || len(l) != 1 {
+		return nil
+	}
+	return l[0]
+}
+
+func inTable(obj ref, table ref) bool {
+	return bytes.Equal(obj[:4], table[:4])
+}
+
+func newRow(obj ref, name string) row {
+	return row{colUID: bytesCell(obj[:]), colName: bytesCell([]byte(name))}
+}
+
+func factoryState(serial string, msidPIN []byte) *state {
+	admin := map[ref]row{}
+	admin[anybody] = newRow(anybody, "Anybody")
+	admin[anybody][colAuthorityEnabled] = boolCell(true)
+	admin[sid] = newRow(sid, "SID")
+	admin[sid][colAuthorityEnabled] = boolCell(true)
+	admin[makers] = newRow(makers, "Makers")
+	admin[makers][colAuthorityEnabled] = boolCell(true)
+
+	sidPIN := newRow(ref(uid.Admin_C_PIN_SIDRow), "C_PIN_SID")
+	sidPIN[colPIN] = bytesCell(msidPIN)
+	sidPIN[colTryLimit] = uintCell(0)
+	sidPIN[colTries] = uintCell(0)
+	admin[ref(uid.Admin_C_PIN_SIDRow)] = sidPIN
+	msidRow := newRow(msid, "C_PIN_MSID")
+	msidRow[colPIN] = bytesCell(msidPIN)
+	admin[msid] = msidRow
+
+	admin[adminSP] = newRow(adminSP, "Admin")
+	admin[adminSP][colLifeCycleState] = uintCell(lifeCycleManufactured)
+	admin[lockingSP] = newRow(lockingSP, "Locking")
+	admin[lockingSP][colLifeCycleState] = uintCell(lifeCycleManufacturedInactive)
+
+	return &state{
+		Serial: serial,
+		SPs:    map[ref]map[ref]row{adminSP: admin},
+	}
+}
+
+// Objects of the Locking SP as created by Activate, with the PIN of Admin1
+// set to the one of SID.
+func lockingSPObjects(admin1PIN []byte) map[ref]row {
+	objs := map[ref]row{}
+	objs[anybody] = newRow(anybody, "Anybody")
+	objs[anybody][colAuthorityEnabled] = boolCell(true)
+	authorityClass := func(a ref, name string) {
+		objs[a] = newRow(a, name)
+		objs[a][colAuthorityIsClass] = boolCell(true)
+		objs[a][colAuthorityEnabled] = boolCell(true)
+	}
+	authority := func(a ref, name string, class ref, enabled bool, pin []byte) {
+		objs[a] = newRow(a, name)
+		objs[a][colAuthorityClass] = bytesCell(class[:])
+		objs[a][colAuthorityEnabled] = boolCell(enabled)
+		c := ref(uid.C_PINRowForAuthority(uid.AuthorityObjectUID(a)))
+		objs[c] = newRow(c, "C_PIN_"+name)
+		objs[c][colPIN] = bytesCell(pin)
+		objs[c][colTryLimit] = uintCell(0)
+		objs[c][colTries] = uintCell(0)
+	}
+	authorityClass(lockingAdmins, "Admins")
+	authorityClass(lockingUsers, "Users")
+	for i := 1; i <= numAdmins; i++ {
+		name, _ := uid.Lookup(uid.UID(uid.LockingAuthorityAdmin(i)))
+		if i == 1 {
+			authority(ref(uid.LockingAuthorityAdmin(i)), name, lockingAdmins, true, admin1PIN)
+		} else {
+			authority(ref(uid.LockingAuthorityAdmin(i)), name, lockingAdmins, false, nil)
+		}
+	}
+	for i := 1; i <= numUsers; i++ {
+		name, _ := uid.Lookup(uid.UID(uid.LockingAuthorityUser(i)))
+		authority(ref(uid.LockingAuthorityUser(i)), name, lockingUsers, false, nil)
+	}
+
+	li := newRow(lockingInfo, "")
+	li[2] = uintCell(1) // Version
+	li[3] = uintCell(1) // EncryptSupport
+	li[4] = uintCell(numRanges)
+	li[7] = boolCell(true) // AlignmentRequired
+	li[8] = uintCell(512)  // LogicalBlockSize
+	li[9] = uintCell(8)    // AlignmentGranularity
+	li[10] = uintCell(0)   // LowestAlignedLBA
+	objs[lockingInfo] = li
+
+	adminsOnly := encode(stream.List{
+		stream.StartName, uid.HalfUID_AuthorityObjectRef[:], lockingAdmins[:], stream.EndName,
+	})
+	for i := 0; i <= numRanges; i++ {
+		r := ref(uid.LockingRange(i))
+		key := r
+		copy(key[:4], keyTable[:4])
+		lr := newRow(r, "")
+		lr[colCommonName] = bytesCell([]byte("Locking"))
+		lr[3] = uintCell(0) // RangeStart
+		lr[4] = uintCell(0) // RangeLength
+		lr[colReadLockEnabled] = boolCell(false)
+		lr[colWriteLockEnabled] = boolCell(false)
+		lr[colReadLocked] = boolCell(false)
+		lr[colWriteLocked] = boolCell(false)
+		lr[colLockOnReset] = encode(stream.List{uint(resetPowerCycle)})
+		lr[colActiveKey] = bytesCell(key[:])
+		objs[r] = lr
+		objs[key] = newRow(key, "")
+		for _, ace := range []ref{ref(uid.ACE_Locking_Range_Set_RdLocked(i)), ref(uid.ACE_Locking_Range_Set_WrLocked(i))} {
+			objs[ace] = newRow(ace, "")
+			objs[ace][colACEBooleanExpr] = adminsOnly
+		}
+	}
+
+	mbr := newRow(mbrControl, "")
+	mbr[mbrControlEnable] = boolCell(false)
+	mbr[mbrControlDone] = boolCell(false)
+	mbr[mbrControlDoneOnReset] = encode(stream.List{uint(resetPowerCycle)})
+	objs[mbrControl] = mbr
+	return objs
+}
+
+func (d *Drive) cell(sp ref, obj ref, col uint) interface{} {
+	r, ok := d.st.SPs[sp][obj]
+	if !ok {
+		return nil
+	}
+	return decodeCell(r[col])
+}
+
+func (d *Drive) boolCell(sp ref, obj ref, col uint) bool {
+	v, ok := d.cell(sp, obj, col).(uint)
+	return ok && v > 0
+}
+
+func (d *Drive) lockingSPActive() bool {
+	return stream.EqualUInt(d.cell(adminSP, lockingSP, colLifeCycleState), lifeCycleManufactured)
+}
+
+// Whether any range is locked for reading or writing
+func (d *Drive) locked() bool {
+	for obj := range d.st.SPs[lockingSP] {
+		if !inTable(obj, lockingTable) {
+			continue
+		}
+		if (d.boolCell(lockingSP, obj, colReadLockEnabled) && d.boolCell(lockingSP, obj, colReadLocked)) ||
+			(d.boolCell(lockingSP, obj, colWriteLockEnabled) && d.boolCell(lockingSP, obj, colWriteLocked)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Drive) mbrFlag(col uint) bool {
+	return d.boolCell(lockingSP, mbrControl, col)
+}
+
+func containsReset(v interface{}, reset uint) bool {
+	l, _ := v.(stream.List)
+	for _, x := range l {
+		if stream.EqualUInt(x, reset) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Drive) powerCycle() {
+	objs := d.st.SPs[lockingSP]
+	for obj, r := range objs {
+		if inTable(obj, lockingTable) && containsReset(d.cell(lockingSP, obj, colLockOnReset), resetPowerCycle) {
+			r[colReadLocked] = boolCell(true)
+			r[colWriteLocked] = boolCell(true)
+		}
+	}
+	if r, ok := objs[mbrControl]; ok && containsReset(d.cell(lockingSP, mbrControl, mbrControlDoneOnReset), resetPowerCycle) {
+		r[mbrControlDone] = boolCell(false)
+	}
+}
+
+// Whether the authority a is referenced by the Boolean expression of an ACE,
+// either directly or by its class.
+func (d *Drive) aceAllows(expr interface{}, a ref) bool {
+	class, _ := d.cell(lockingSP, a, colAuthorityClass).([]byte)
+	l, _ := expr.(stream.List)
+	for _, x := range l {
+		b, ok := x.([]byte)
+		if !ok || len(b) != 8 {
+			continue
+		}
+		if bytes.Equal(b, a[:]) || bytes.Equal(b, class) {
+			return true
+		}
+	}
+	return false
+}
+
+// The Opal 2 access control, simplified. In the Admin SP SID may do
+// anything while Anybody may only read the MSID and the SP table. In the
+// Locking SP the admins may do anything, users may read the Locking and
+// MBRControl tables, change their PIN and lock and unlock ranges if the
+// ACEs allow it.
+func (s *session) mayGet(d *Drive, obj ref) bool {
+	if s.sp == adminSP {
+		return s.authenticated(sid) || obj == msid || inTable(obj, spTable)
+	}
+	if s.admin(d) || obj == lockingInfo || obj == mbrControl {
+		return true
+	}
+	return len(s.auths) > 0 && inTable(obj, lockingTable)
+}
+
+func (s *session) maySet(d *Drive, obj ref, cols []uint) bool {
+	if s.sp == adminSP {
+		return s.authenticated(sid)
+	}
+	if s.admin(d) {
+		return true
+	}
+	for _, c := range cols {
+		ok := false
+		switch {
+		case inTable(obj, cpinTable) && c == colPIN:
+			for _, a := range s.auths {
+				if ref(uid.C_PINRowForAuthority(uid.AuthorityObjectUID(a))) == obj {
+					ok = true
+				}
+			}
+		case inTable(obj, lockingTable) && (c == colReadLocked || c == colWriteLocked):
+			n := int(binary.BigEndian.Uint16(obj[6:8]))
+			if obj == ref(uid.GlobalRangeRowUID) {
+				n = 0
+			}
+			ace := ref(uid.ACE_Locking_Range_Set_RdLocked(n))
+			if c == colWriteLocked {
+				ace = ref(uid.ACE_Locking_Range_Set_WrLocked(n))
+			}
+			for _, a := range s.auths {
+				if d.aceAllows(d.cell(lockingSP, ace, colACEBooleanExpr), a) {
+					ok = true
+				}
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package locking
+
+import (
+	"fmt"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+// HardenedTryLimit is the TryLimit set on all PINs by the hardening steps.
+var HardenedTryLimit uint = 5
+
+// HardeningStep is one of the steps done by WithHardened or LockingSP.Harden.
+type HardeningStep struct {
+	Description string
+	// Nil if the step succeeded
+	Err error
+}
+
+// HardeningReport documents the steps done to harden a drive following the
+// FIPS 140 guidance for TCG Storage drives.
+type HardeningReport struct {
+	Steps []HardeningStep
+}
+
+func (r *HardeningReport) do(desc string, fn func() error) {
+	r.Steps = append(r.Steps, HardeningStep{Description: desc, Err: fn()})
+}
+
+// Err returns an error describing the first failed step, if any.
+func (r *HardeningReport) Err() error {
+	for _, st := range r.Steps {
+		if st.Err != nil {
+			return fmt.Errorf("hardening step %q failed: %w", st.Description, st.Err)
+		}
+	}
+	return nil
+}
+
+// WithHardened applies the FIPS recommendations for the Admin SP while
+// initializing: it verifies that the SID PIN is not the MSID anymore, sets
+// the TryLimit of all Admin SP PINs to HardenedTryLimit and disables the
+// Makers authority. The report is returned in LockingSPMeta.Hardening.
+//
+// The Locking SP is hardened with LockingSP.Harden once it is opened.
+func WithHardened() InitializeOpt {
+	return func(ic *initializeConfig) {
+		ic.hardened = true
+	}
+}
+
+// verifySIDNotMSID is the first hardening step of the Admin SP. It is done in
+// the session before it is authenticated, as many drives only allow a single
+// session and the failed attempt must not interfere with the authentication
+// of SID.
+func verifySIDNotMSID(r *HardeningReport, s *core.Session) {
+	r.do("verify SID PIN differs from MSID", func() error {
+		msid, err := table.Admin_C_PIN_MSID_GetPIN(s)
+		if err != nil {
+			return fmt.Errorf("reading MSID failed: %v", err)
+		}
+		// A failed attempt counts against the TryLimit of SID, which is
+		// still unlimited at this point on a factory configured drive
+		factory, err := sidIsMSID(s, msid)
+		if err != nil {
+			return err
+		}
+		if factory {
+			return fmt.Errorf("SID can still be authenticated with the MSID")
+		}
+		return nil
+	})
+}
+
+// hardenAdminSP does the remaining hardening steps in the Admin SP session
+// authenticated as SID.
+func hardenAdminSP(r *HardeningReport, s *core.Session) error {
+	setTryLimits(r, s, uid.Admin_C_PIN_MSIDRow)
+	r.do("disable Makers authority", func() error {
+		return table.Authority_SetEnabled(s, uid.AuthorityMakers, false)
+	})
+	return r.Err()
+}
+
+// setTryLimits sets the TryLimit of all C_PIN rows of the SP, except skip.
+func setTryLimits(r *HardeningReport, s *core.Session, skip uid.RowUID) {
+	var rows []uid.RowUID
+	r.do("enumerate C_PIN", func() error {
+		var err error
+		rows, err = table.Enumerate(s, uid.Admin_C_PINTable)
+		return err
+	})
+	for _, row := range rows {
+		if row == skip {
+			continue
+		}
+		row := row
+		r.do(fmt.Sprintf("set TryLimit=%d on %s", HardenedTryLimit, uid.Name(row[:])), func() error {
+			return table.SetColumns(s, row, table.ColumnValue{
+				Column: table.Column{Num: table.Admin_C_PIN_ColumnTryLimit, Name: "TryLimit"},
+				Value:  HardenedTryLimit,
+			})
+		})
+	}
+}
+
+// Harden applies the FIPS recommendations for the Locking SP: it sets the
+// TryLimit of all PINs to HardenedTryLimit, requires authentication data for
+// the secrets listed in SecretProtect and makes all ranges lock on power
+// cycles.
+func (l *LockingSP) Harden() (*HardeningReport, error) {
+	if err := l.checkWritable(); err != nil {
+		return nil, err
+	}
+	r := &HardeningReport{}
+	setTryLimits(r, l.Session, uid.RowUID{})
+	if l.Session.ProtocolLevel != core.ProtocolLevelEnterprise {
+		r.do("require authentication data for secrets", l.RequireAuthenticationData)
+	}
+	for _, rng := range l.Ranges {
+		rng := rng
+		r.do(fmt.Sprintf("set LockOnReset on %s", uid.Name(rng.UID[:])), func() error {
+			return rng.SetLockOnReset([]table.ResetType{table.ResetPowerOff})
+		})
+	}
+	return r, r.Err()
+}
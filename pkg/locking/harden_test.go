@@ -0,0 +1,64 @@
+package locking
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive/sim"
+)
+
+func TestHarden(t *testing.T) {
+	c, cs := simControlSession(t, sim.New())
+	_, _, err := Initialize(c, WithAuth(DefaultAdminAuthority(nil)), WithHardened())
+	if err == nil || !strings.Contains(err.Error(), "verify SID PIN differs from MSID") {
+		t.Errorf("hardening a drive with SID set to MSID returned %v", err)
+	}
+	takeOwnership(t, cs)
+
+	_, lmeta, err := Initialize(c, WithAuth(DefaultAdminAuthority(sidPIN)), WithHardened())
+	if err != nil {
+		t.Fatalf("Initialize() with WithHardened failed: %v", err)
+	}
+	if lmeta.Hardening == nil || len(lmeta.Hardening.Steps) == 0 {
+		t.Fatalf("Initialize() returned no hardening report")
+	}
+
+	s, err := cs.NewSession(uid.AdminSP)
+	if err != nil {
+		t.Fatalf("NewSession() failed: %v", err)
+	}
+	defer s.Close()
+	if err := table.ThisSP_Authenticate(s, uid.AuthoritySID, sidPIN); err != nil {
+		t.Fatalf("authenticating as SID failed: %v", err)
+	}
+	if enabled, err := table.Authority_GetEnabled(s, uid.AuthorityMakers); err != nil || enabled {
+		t.Errorf("Makers enabled = %v (%v) after hardening", enabled, err)
+	}
+	if v, err := table.GetCell(s, uid.Admin_C_PIN_SIDRow, table.Admin_C_PIN_ColumnTryLimit, "TryLimit"); err != nil || v != HardenedTryLimit {
+		t.Errorf("SID TryLimit = %v (%v) after hardening", v, err)
+	}
+	s.Close()
+
+	f := &simFixture{c: c, cs: cs, lmeta: lmeta}
+	l := f.lockingSP(t)
+	r, err := l.Harden()
+	if err != nil {
+		t.Fatalf("Harden() failed: %v", err)
+	}
+	for _, st := range r.Steps {
+		if st.Err != nil {
+			t.Errorf("step %q failed: %v", st.Description, st.Err)
+		}
+	}
+	for _, rng := range l.Ranges {
+		lr, err := table.Locking_Get(l.Session, rng.UID)
+		if err != nil {
+			t.Fatalf("Locking_Get() failed: %v", err)
+		}
+		if len(lr.LockOnReset) != 1 || lr.LockOnReset[0] != table.ResetPowerOff {
+			t.Errorf("range %s LockOnReset = %v after hardening", uid.Name(rng.UID[:]), lr.LockOnReset)
+		}
+	}
+}
@@ -7,7 +7,10 @@
 package locking
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
@@ -16,6 +19,8 @@ import (
 	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
 )
 
+var ErrReadOnlySession = errors.New("operation requires a read-write session")
+
 var (
 	LifeCycleStateManufacturedInactive table.LifeCycleState = 8
 	LifeCycleStateManufactured         table.LifeCycleState = 9
@@ -29,17 +34,81 @@ type LockingSP struct {
 	// The full range of Ranges (heh!) that the current session has access to see and possibly modify
 	GlobalRange *Range
 	Ranges      []*Range // Ranges[0] == GlobalRange
-
+	// Number of ranges besides the global range the drive supports, as
+	// reported by LockingInfo. 0 if it could not be read.
+	MaxRanges uint32
+	// Size in bytes of the logical blocks that range boundaries are given in
+	BlockSize uint32
+
+	// Whether any range was locked when the session was opened
+	Locked bool
 	// These are always false on SSC Enterprise
 	MBREnabled     bool
 	MBRDone        bool
 	MBRDoneOnReset []table.ResetType
+	// Hide the shadow MBR (MBRDone) whenever a range is unlocked and show it
+	// again whenever one is locked, so that the drive boots from the shadow
+	// MBR exactly while data is locked. Has no effect if MBREnabled is false.
+	SetMBRDoneOnUnlock bool
+
+	// Whether the drive has a shadow MBR, as reported by Level 0 Discovery
+	mbrSupported bool
+
+	// Ranges to load, see WithoutRangeEnumeration and WithRanges
+	enumerate   bool
+	rangeFilter func(uid.RowUID) bool
 }
 
 func (l *LockingSP) Close() error {
 	return l.Session.Close()
 }
 
+// Refresh reads the state of the ranges and the shadow MBR again, e.g. after
+// another session changed them. The ranges are read with as few round trips
+// as the TPer allows. Ranges and GlobalRange are replaced by new ones, with
+// the same selection of ranges as when the session was opened. Drives
+// without a shadow MBR only have their ranges read.
+func (l *LockingSP) Refresh() error {
+	if err := fillRanges(l.Session, l); err != nil {
+		return err
+	}
+	l.Locked = false
+	for _, r := range l.Ranges {
+		if (r.ReadLockEnabled && r.ReadLocked) || (r.WriteLockEnabled && r.WriteLocked) {
+			l.Locked = true
+		}
+	}
+	if l.Session.ProtocolLevel == core.ProtocolLevelEnterprise || !l.mbrSupported {
+		return nil
+	}
+	mbr, err := table.MBRControl_Get(l.Session)
+	if err != nil {
+		return fmt.Errorf("reading MBRControl failed: %w", err)
+	}
+	if mbr.Enable != nil {
+		l.MBREnabled = *mbr.Enable
+	}
+	if mbr.Done != nil {
+		l.MBRDone = *mbr.Done
+	}
+	if mbr.MBRDoneOnReset != nil {
+		l.MBRDoneOnReset = *mbr.MBRDoneOnReset
+	}
+	return nil
+}
+
+// ReadOnly returns whether the session was opened with core.WithReadOnly.
+func (l *LockingSP) ReadOnly() bool {
+	return l.Session.ReadOnly
+}
+
+func (l *LockingSP) checkWritable() error {
+	if l.Session.ReadOnly {
+		return ErrReadOnlySession
+	}
+	return nil
+}
+
 type AdminSPAuthenticator interface {
 	AuthenticateAdminSP(s *core.Session) error
 }
@@ -100,39 +169,170 @@ func DefaultAuthority(proof []byte) *authority {
 	return &authority{proof: proof}
 }
 
+type signerAuthority struct {
+	auth uid.AuthorityObjectUID
+	sign table.ChallengeSigner
+}
+
+// SignerAuthority authenticates an authority that uses public key
+// cryptography, e.g. one with a C_RSA_2048 credential, by answering the
+// challenge of the TPer with sign. It works for both the Admin SP and the
+// Locking SP.
+func SignerAuthority(auth uid.AuthorityObjectUID, sign table.ChallengeSigner) *signerAuthority {
+	return &signerAuthority{auth: auth, sign: sign}
+}
+
+func (a *signerAuthority) AuthenticateAdminSP(s *core.Session) error {
+	return table.ThisSP_AuthenticateSigned(s, a.auth, a.sign)
+}
+
+func (a *signerAuthority) AuthenticateLockingSP(s *core.Session, lmeta *LockingSPMeta) error {
+	return table.ThisSP_AuthenticateSigned(s, a.auth, a.sign)
+}
+
 func DefaultAdminAuthority(proof []byte) *authority {
 	return &authority{proof: proof}
 }
 
 func AuthorityFromName(user string, proof []byte) (*authority, bool) {
-	return nil, false
+	auth, ok := AuthorityUIDFromName(user)
+	if !ok {
+		return nil, false
+	}
+	return &authority{auth: auth[:], proof: proof}, true
 }
 
+// AuthorityUIDFromName resolves a Locking SP authority name such as "Admin1",
+// "User2" or "BandMaster0" (case-insensitive) to its UID.
+func AuthorityUIDFromName(name string) (uid.AuthorityObjectUID, bool) {
+	lname := strings.ToLower(name)
+	if lname == "erasemaster" {
+		return uid.EraseMaster, true
+	}
+	for _, p := range []struct {
+		prefix string
+		min    int
+		fn     func(int) uid.AuthorityObjectUID
+	}{
+		{"admin", 1, uid.LockingAuthorityAdmin},
+		{"user", 1, uid.LockingAuthorityUser},
+		{"bandmaster", 0, func(n int) uid.AuthorityObjectUID {
+			a := uid.LockingAuthorityBandMaster0
+			a[7] += uint8(n)
+			return a
+		}},
+	} {
+		if !strings.HasPrefix(lname, p.prefix) {
+			continue
+		}
+		n, err := strconv.Atoi(lname[len(p.prefix):])
+		if err != nil || n < p.min || n > 0xfe {
+			return uid.AuthorityObjectUID{}, false
+		}
+		return p.fn(n), true
+	}
+	return uid.AuthorityObjectUID{}, false
+}
+
+type sessionConfig struct {
+	sessOpts    []core.SessionOpt
+	enumerate   bool
+	rangeFilter func(uid.RowUID) bool
+}
+
+// SessionOpt configures NewSessionWithOptions.
+type SessionOpt func(sc *sessionConfig)
+
+// WithSessionOpts passes options to the session to the Locking SP, e.g.
+// core.WithReadOnly, like the options of NewSession.
+func WithSessionOpts(opts ...core.SessionOpt) SessionOpt {
+	return func(sc *sessionConfig) {
+		sc.sessOpts = append(sc.sessOpts, opts...)
+	}
+}
+
+// WithoutRangeEnumeration does not enumerate the Locking table, only the
+// global range is read. This saves round trips for flows that only need the
+// global range, and works on drives that fail to enumerate the table.
+// Ranges is empty if the authority may not read the global range.
+func WithoutRangeEnumeration() SessionOpt {
+	return func(sc *sessionConfig) {
+		sc.enumerate = false
+	}
+}
+
+// WithRanges only reads the ranges of the Locking table for which filter
+// returns true, e.g. uid.LockingRange(1). GlobalRange is nil if the filter
+// drops the global range.
+func WithRanges(filter func(row uid.RowUID) bool) SessionOpt {
+	return func(sc *sessionConfig) {
+		sc.rangeFilter = filter
+	}
+}
+
+// NewSession opens an authenticated session to the Locking SP. Pass
+// core.WithReadOnly to inspect the ranges without taking the write session
+// slot; the modifying operations then fail with ErrReadOnlySession.
 func NewSession(cs *core.ControlSession, lmeta *LockingSPMeta, auth LockingSPAuthenticator, opts ...core.SessionOpt) (*LockingSP, error) {
+	return NewSessionWithOptions(cs, lmeta, auth, WithSessionOpts(opts...))
+}
+
+// NewSessionWithOptions is NewSession with options that also select the
+// ranges to load, see WithoutRangeEnumeration and WithRanges.
+func NewSessionWithOptions(cs *core.ControlSession, lmeta *LockingSPMeta, auth LockingSPAuthenticator, opts ...SessionOpt) (*LockingSP, error) {
+	sc := sessionConfig{enumerate: true}
+	for _, o := range opts {
+		o(&sc)
+	}
 	if lmeta.D0.Locking == nil {
 		return nil, fmt.Errorf("device does not have the Locking feature")
 	}
-	s, err := cs.NewSession(lmeta.SPID, opts...)
+	s, err := cs.NewSession(lmeta.SPID, sc.sessOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("session creation failed: %w", err)
 	}
 
 	if err := auth.AuthenticateLockingSP(s, lmeta); err != nil {
+		// Do not keep the session open, the caller may retry with other
+		// credentials
+		s.Close()
 		return nil, fmt.Errorf("authentication failed: %w", err)
 	}
+	l, err := newLockingSP(s, lmeta, &sc)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return l, nil
+}
 
-	l := &LockingSP{Session: s}
+func newLockingSP(s *core.Session, lmeta *LockingSPMeta, sc *sessionConfig) (*LockingSP, error) {
+	l := &LockingSP{Session: s, enumerate: sc.enumerate, rangeFilter: sc.rangeFilter}
 
 	// TODO: These can be read from the LockingSP instead, it would be cleaner
 	// to not have to drag D0 in the SPMeta.
+	l.Locked = lmeta.D0.Locking.Locked
 	l.MBRDone = lmeta.D0.Locking.MBRDone
 	l.MBREnabled = lmeta.D0.Locking.MBREnabled
+	l.mbrSupported = lmeta.D0.Locking.MBRShadowingSupported()
 	// TODO: Set MBRDoneOnReset to real value
 	l.MBRDoneOnReset = []table.ResetType{table.ResetPowerOff}
 
 	if err := fillRanges(s, l); err != nil {
 		return nil, err
 	}
+	li, err := table.LockingInfo(s)
+	if err == nil && li.MaxRanges != nil {
+		l.MaxRanges = *li.MaxRanges
+	}
+	switch {
+	case lmeta.D0.Geometry != nil && lmeta.D0.Geometry.LogicalBlockSize > 0:
+		l.BlockSize = lmeta.D0.Geometry.LogicalBlockSize
+	case err == nil && li.LogicalBlockSize != nil && *li.LogicalBlockSize > 0:
+		l.BlockSize = *li.LogicalBlockSize
+	default:
+		l.BlockSize = DefaultBlockSize
+	}
 
 	// TODO: Fill l.Authorities with known users for admin actions
 	return l, nil
@@ -141,7 +341,10 @@ func NewSession(cs *core.ControlSession, lmeta *LockingSPMeta, auth LockingSPAut
 type initializeConfig struct {
 	auths                    []AdminSPAuthenticator
 	activate                 bool
+	readOnly                 bool
+	hardened                 bool
 	MaxComPacketSizeOverride uint
+	padding                  *uint
 	ReceiveRetries           int
 	ReceiveInterval          time.Duration
 }
@@ -154,12 +357,30 @@ func WithAuth(auth AdminSPAuthenticator) InitializeOpt {
 	}
 }
 
+// Use a read-only session to the Admin SP. Monitoring tools should use this
+// together with core.WithReadOnly in NewSession, so that they do not take
+// the write session slot from other tools. It cannot be combined with
+// activating the Locking SP.
+func WithReadOnly() InitializeOpt {
+	return func(ic *initializeConfig) {
+		ic.readOnly = true
+	}
+}
+
 func WithMaxComPacketSize(size uint) InitializeOpt {
 	return func(s *initializeConfig) {
 		s.MaxComPacketSizeOverride = size
 	}
 }
 
+// WithPadding overrides the size the ComPackets sent to the drive are padded
+// to a multiple of, see core.WithPadding.
+func WithPadding(size uint) InitializeOpt {
+	return func(ic *initializeConfig) {
+		ic.padding = &size
+	}
+}
+
 func WithReceiveTimeout(retries int, interval time.Duration) InitializeOpt {
 	return func(ic *initializeConfig) {
 		ic.ReceiveRetries = retries
@@ -167,14 +388,7 @@ func WithReceiveTimeout(retries int, interval time.Duration) InitializeOpt {
 	}
 }
 
-type LockingSPMeta struct {
-	SPID uid.SPID
-	MSID []byte
-	D0   *core.Level0Discovery
-}
-
-// Initialize WHAT?
-func Initialize(coreObj *core.Core, opts ...InitializeOpt) (*core.ControlSession, *LockingSPMeta, error) {
+func newInitializeConfig(opts []InitializeOpt) initializeConfig {
 	ic := initializeConfig{
 		MaxComPacketSizeOverride: core.DefaultMaxComPacketSize,
 		ReceiveRetries:           core.DefaultReceiveRetries,
@@ -183,34 +397,63 @@ func Initialize(coreObj *core.Core, opts ...InitializeOpt) (*core.ControlSession
 	for _, o := range opts {
 		o(&ic)
 	}
+	return ic
+}
+
+type LockingSPMeta struct {
+	SPID uid.SPID
+	MSID []byte
+	D0   *core.Level0Discovery
+	// Steps done for WithHardened, nil otherwise
+	Hardening *HardeningReport
+}
+
+// Initialize WHAT?
+func Initialize(coreObj *core.Core, opts ...InitializeOpt) (*core.ControlSession, *LockingSPMeta, error) {
+	ic := newInitializeConfig(opts)
 
 	lmeta := &LockingSPMeta{}
 	lmeta.D0 = coreObj.DiskInfo.Level0Discovery
 
-	comID, proto, err := core.FindComID(coreObj.DriveIntf, coreObj.DiskInfo.Level0Discovery)
-	if err != nil {
-		return nil, nil, err
+	if ic.readOnly && ic.activate {
+		return nil, nil, fmt.Errorf("activating the Locking SP requires a read-write session")
 	}
-	controlSessionOpts := []core.ControlSessionOpt{
-		core.WithComID(comID),
-		core.WithMaxComPacketSize(ic.MaxComPacketSizeOverride),
-		core.WithReceiveTimeout(ic.ReceiveRetries, ic.ReceiveInterval),
+	if ic.readOnly && ic.hardened {
+		return nil, nil, fmt.Errorf("hardening requires a read-write session")
 	}
 
-	cs, err := core.NewControlSession(coreObj.DriveIntf, coreObj.DiskInfo.Level0Discovery, controlSessionOpts...)
+	cs, proto, err := newControlSession(coreObj, &ic)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create control session (comID 0x%04x): %v", comID, err)
+		return nil, nil, err
 	}
-
-	as, err := cs.NewSession(uid.AdminSP)
+	var asOpts []core.SessionOpt
+	if ic.readOnly {
+		asOpts = append(asOpts, core.WithReadOnly())
+	}
+	as, err := cs.NewSession(uid.AdminSP, asOpts...)
 	if err != nil {
 		return nil, nil, fmt.Errorf("admin session creation failed: %w", err)
 	}
 	defer as.Close()
 
+	var hr *HardeningReport
+	if ic.hardened {
+		hr = &HardeningReport{}
+		verifySIDNotMSID(hr, as)
+		if err := hr.Err(); err != nil {
+			// Hardening a drive that is not taken ownership of is pointless
+			return nil, nil, err
+		}
+	}
+
 	err = nil
 	for _, x := range ic.auths {
-		if err = x.AuthenticateAdminSP(as); err == table.ErrAuthenticationFailed {
+		err = x.AuthenticateAdminSP(as)
+		if errors.Is(err, table.ErrAuthorityLockedOut) {
+			// Trying further credentials would only burn attempts
+			return nil, nil, fmt.Errorf("authentication failed: %w", err)
+		}
+		if errors.Is(err, table.ErrAuthenticationFailed) {
 			continue
 		}
 		if err != nil {
@@ -222,6 +465,13 @@ func Initialize(coreObj *core.Core, opts ...InitializeOpt) (*core.ControlSession
 		return nil, nil, fmt.Errorf("all authentications failed, last with: %w", err)
 	}
 
+	if ic.hardened {
+		lmeta.Hardening = hr
+		if err := hardenAdminSP(hr, as); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	if proto == core.ProtocolLevelEnterprise {
 		copy(lmeta.SPID[:], uid.EnterpriseLockingSP[:])
 		if err := initializeEnterprise(as, coreObj.DiskInfo.Level0Discovery, &ic, lmeta); err != nil {
@@ -236,6 +486,27 @@ func Initialize(coreObj *core.Core, opts ...InitializeOpt) (*core.ControlSession
 	return cs, lmeta, nil
 }
 
+func newControlSession(coreObj *core.Core, ic *initializeConfig) (*core.ControlSession, core.ProtocolLevel, error) {
+	comID, proto, err := core.FindComID(coreObj.DriveIntf, coreObj.DiskInfo.Level0Discovery)
+	if err != nil {
+		return nil, proto, err
+	}
+	controlSessionOpts := []core.ControlSessionOpt{
+		core.WithComID(comID),
+		core.WithMaxComPacketSize(ic.MaxComPacketSizeOverride),
+		core.WithReceiveTimeout(ic.ReceiveRetries, ic.ReceiveInterval),
+	}
+	if ic.padding != nil {
+		controlSessionOpts = append(controlSessionOpts, core.WithPadding(*ic.padding))
+	}
+
+	cs, err := core.NewControlSession(coreObj.DriveIntf, coreObj.DiskInfo.Level0Discovery, controlSessionOpts...)
+	if err != nil {
+		return nil, proto, fmt.Errorf("failed to create control session (comID 0x%04x): %v", comID, err)
+	}
+	return cs, proto, nil
+}
+
 func initializeEnterprise(s *core.Session, d0 *core.Level0Discovery, ic *initializeConfig, lmeta *LockingSPMeta) error {
 	msidPin, err := table.Admin_C_PIN_MSID_GetPIN(s)
 	if err == nil {
@@ -243,8 +514,6 @@ func initializeEnterprise(s *core.Session, d0 *core.Level0Discovery, ic *initial
 	}
 	// TODO: Implement take ownership for enterprise if activated in initializeConfig.
 	// The spec should explain what is needed.
-	// TODO: If initializeConfig wants WithHardended, implement relevant
-	// FIPS recommendations.
 	return nil
 }
 
@@ -275,13 +544,51 @@ func initializeOpalFamily(s *core.Session, d0 *core.Level0Discovery, ic *initial
 	} else {
 		return fmt.Errorf("unsupported life cycle state on locking SP: %v", lcs)
 	}
-
-	// TODO: If initializeConfig wants WithHardended, implement relevant
-	// FIPS recommendations.
 	return nil
 }
 
 func (l *LockingSP) SetMBRDone(v bool) error {
+	if err := l.checkWritable(); err != nil {
+		return err
+	}
 	mbr := &table.MBRControl{Done: &v}
-	return table.MBRControl_Set(l.Session, mbr)
+	if err := table.MBRControl_Set(l.Session, mbr); err != nil {
+		return err
+	}
+	l.MBRDone = v
+	return nil
+}
+
+// RequireAuthenticationData sets the ProtectMechanisms of all SecretProtect
+// rows of the Locking SP that guard a media encryption key or a PIN to
+// AuthenticationDataRequired. This is one of the hardening steps recommended
+// for FIPS configurations.
+func (l *LockingSP) RequireAuthenticationData() error {
+	if err := l.checkWritable(); err != nil {
+		return err
+	}
+	s := l.Session
+	rows, err := table.Enumerate(s, uid.Base_SecretProtectTable)
+	if err != nil {
+		return fmt.Errorf("enumerating SecretProtect failed: %v", err)
+	}
+	for _, r := range rows {
+		sp, err := table.SecretProtect_Get(s, r)
+		if err != nil {
+			return fmt.Errorf("reading SecretProtect row %s failed: %v", uid.Name(r[:]), err)
+		}
+		if sp.Table == nil {
+			continue
+		}
+		switch *sp.Table {
+		case uid.Locking_K_AES_128Table, uid.Locking_K_AES_256Table, uid.Admin_C_PINTable:
+		default:
+			continue
+		}
+		mechs := []table.ProtectMechanism{table.ProtectAuthenticationDataRequired}
+		if err := table.SecretProtect_SetProtectMechanisms(s, r, mechs); err != nil {
+			return fmt.Errorf("setting SecretProtect row %s failed: %v", uid.Name(r[:]), err)
+		}
+	}
+	return nil
 }
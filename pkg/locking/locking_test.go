@@ -0,0 +1,235 @@
+package locking
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive/sim"
+)
+
+// The SID and Admin1 PIN of the simulated drives once ownership is taken
+var sidPIN = []byte("0123456789abcdef")
+
+// The number of ranges of the simulated drives besides the global range
+const simRanges = 8
+
+// simControlSession opens a control session to the simulated drive d.
+func simControlSession(t *testing.T, d drive.DriveIntf) (*core.Core, *core.ControlSession) {
+	t.Helper()
+	c, err := core.NewCoreFromDrive(d)
+	if err != nil {
+		t.Fatalf("NewCoreFromDrive() failed: %v", err)
+	}
+	comID, _, err := core.FindComID(c.DriveIntf, c.Level0Discovery)
+	if err != nil {
+		t.Fatalf("FindComID() failed: %v", err)
+	}
+	cs, err := core.NewControlSession(c.DriveIntf, c.Level0Discovery, core.WithComID(comID))
+	if err != nil {
+		t.Fatalf("NewControlSession() failed: %v", err)
+	}
+	return c, cs
+}
+
+// takeOwnership sets the SID PIN to sidPIN and activates the Locking SP.
+func takeOwnership(t *testing.T, cs *core.ControlSession) {
+	t.Helper()
+	s, err := cs.NewSession(uid.AdminSP)
+	if err != nil {
+		t.Fatalf("NewSession() failed: %v", err)
+	}
+	defer s.Close()
+	msid, err := table.Admin_C_PIN_MSID_GetPIN(s)
+	if err != nil {
+		t.Fatalf("Admin_C_PIN_MSID_GetPIN() failed: %v", err)
+	}
+	if err := table.ThisSP_Authenticate(s, uid.AuthoritySID, msid); err != nil {
+		t.Fatalf("authenticating as SID failed: %v", err)
+	}
+	if err := table.Admin_C_Pin_SID_SetPIN(s, sidPIN); err != nil {
+		t.Fatalf("Admin_C_Pin_SID_SetPIN() failed: %v", err)
+	}
+	if err := table.LockingSPActivate(s); err != nil {
+		t.Fatalf("LockingSPActivate() failed: %v", err)
+	}
+}
+
+// simFixture is a simulated drive that has been taken ownership of.
+type simFixture struct {
+	c     *core.Core
+	cs    *core.ControlSession
+	lmeta *LockingSPMeta
+}
+
+func newSimFixture(t *testing.T, d drive.DriveIntf) *simFixture {
+	t.Helper()
+	f := &simFixture{}
+	f.c, f.cs = simControlSession(t, d)
+	takeOwnership(t, f.cs)
+	var err error
+	if _, f.lmeta, err = Initialize(f.c, WithAuth(DefaultAdminAuthority(sidPIN))); err != nil {
+		t.Fatalf("Initialize() failed: %v", err)
+	}
+	return f
+}
+
+// lockingSP opens the Locking SP as Admin1, the session is closed at the end
+// of the test.
+func (f *simFixture) lockingSP(t *testing.T, opts ...SessionOpt) *LockingSP {
+	t.Helper()
+	l, err := NewSessionWithOptions(f.cs, f.lmeta, DefaultAuthority(sidPIN), opts...)
+	if err != nil {
+		t.Fatalf("locking.NewSession() failed: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+// countingDrive counts the ComPackets sent to the drive.
+type countingDrive struct {
+	drive.DriveIntf
+	sends int
+}
+
+func (d *countingDrive) IFSend(proto drive.SecurityProtocol, sps uint16, data []byte) error {
+	d.sends++
+	return d.DriveIntf.IFSend(proto, sps, data)
+}
+
+func TestInitializeReadOnlyConflicts(t *testing.T) {
+	activate := func(ic *initializeConfig) { ic.activate = true }
+	for _, tc := range []struct {
+		name string
+		opts []InitializeOpt
+	}{
+		{"activate", []InitializeOpt{WithReadOnly(), activate}},
+		{"hardened", []InitializeOpt{WithReadOnly(), WithHardened()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := &countingDrive{DriveIntf: sim.New()}
+			c, err := core.NewCoreFromDrive(d)
+			if err != nil {
+				t.Fatalf("NewCoreFromDrive() failed: %v", err)
+			}
+			if _, _, err := Initialize(c, tc.opts...); err == nil {
+				t.Errorf("Initialize() succeeded")
+			}
+			// The conflict is detected before talking to the drive
+			if d.sends != 0 {
+				t.Errorf("Initialize() sent %d ComPackets", d.sends)
+			}
+		})
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	d := &countingDrive{DriveIntf: sim.New()}
+	l := newSimFixture(t, d).lockingSP(t)
+
+	// Change the global range and the MBR behind the back of the LockingSP
+	enabled, locked := true, true
+	lr := &table.LockingRow{UID: l.GlobalRange.UID, ReadLockEnabled: &enabled, WriteLockEnabled: &enabled, ReadLocked: &locked, WriteLocked: &locked}
+	if err := table.Locking_Set(l.Session, lr); err != nil {
+		t.Fatalf("Locking_Set() failed: %v", err)
+	}
+	if err := table.MBRControl_Set(l.Session, &table.MBRControl{Enable: &enabled}); err != nil {
+		t.Fatalf("MBRControl_Set() failed: %v", err)
+	}
+
+	sends := d.sends
+	if err := l.Refresh(); err != nil {
+		t.Fatalf("Refresh() failed: %v", err)
+	}
+	// Enumerate, the batched Gets of the ranges and MBRControl
+	if n := d.sends - sends; n != 3 {
+		t.Errorf("Refresh() took %d round trips, want 3", n)
+	}
+	if g := l.GlobalRange; !g.ReadLocked || !g.WriteLocked || !l.Locked {
+		t.Errorf("after Refresh(): ReadLocked=%v WriteLocked=%v Locked=%v", g.ReadLocked, g.WriteLocked, l.Locked)
+	}
+	if !l.MBREnabled {
+		t.Errorf("after Refresh(): MBREnabled=false")
+	}
+}
+
+func TestRangeSelection(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		opts   []SessionOpt
+		ranges []uid.RowUID
+	}{
+		{"all", nil, nil},
+		{"without enumeration", []SessionOpt{WithoutRangeEnumeration()}, []uid.RowUID{uid.GlobalRangeRowUID}},
+		{"filter", []SessionOpt{WithRanges(func(row uid.RowUID) bool {
+			return row == uid.LockingRange(2)
+		})}, []uid.RowUID{uid.LockingRange(2)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l := newSimFixture(t, sim.New()).lockingSP(t, tc.opts...)
+			for i := 0; i < 2; i++ {
+				var got []uid.RowUID
+				for _, r := range l.Ranges {
+					got = append(got, r.UID)
+				}
+				if tc.ranges == nil {
+					if len(got) != simRanges+1 {
+						t.Errorf("got %d ranges, want %d", len(got), simRanges+1)
+					}
+				} else if !reflect.DeepEqual(got, tc.ranges) {
+					t.Errorf("got ranges %x, want %x", got, tc.ranges)
+				}
+				if (l.GlobalRange != nil) != (len(got) > 0 && got[0] == uid.GlobalRangeRowUID) {
+					t.Errorf("GlobalRange = %v with ranges %x", l.GlobalRange, got)
+				}
+				// The selection is kept on Refresh
+				if err := l.Refresh(); err != nil {
+					t.Fatalf("Refresh() failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestSetMBRDoneOnUnlock(t *testing.T) {
+	l := newSimFixture(t, sim.New()).lockingSP(t)
+	enabled := true
+	if err := table.MBRControl_Set(l.Session, &table.MBRControl{Enable: &enabled}); err != nil {
+		t.Fatalf("MBRControl_Set() failed: %v", err)
+	}
+	if err := l.Refresh(); err != nil {
+		t.Fatalf("Refresh() failed: %v", err)
+	}
+
+	g := l.GlobalRange
+	for _, tc := range []struct {
+		name   string
+		policy bool
+		unlock bool
+		want   bool
+	}{
+		{"unlock without policy", false, true, false},
+		{"unlock", true, true, true},
+		{"lock without policy", false, false, true},
+		{"lock", true, false, false},
+	} {
+		l.SetMBRDoneOnUnlock = tc.policy
+		op := g.LockWrite
+		if tc.unlock {
+			op = func() error { return g.UnlockRead() }
+		}
+		if err := op(); err != nil {
+			t.Fatalf("%s: failed: %v", tc.name, err)
+		}
+		mbr, err := table.MBRControl_Get(l.Session)
+		if err != nil {
+			t.Fatalf("MBRControl_Get() failed: %v", err)
+		}
+		if *mbr.Done != tc.want || l.MBRDone != tc.want {
+			t.Errorf("%s: MBRDone = %v on the drive and %v in the session, want %v", tc.name, *mbr.Done, l.MBRDone, tc.want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package locking
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+var ErrSIDBlocked = errors.New("SID authentication is blocked until the next power cycle")
+
+// Ownership describes who owns the Admin SP of a drive.
+type Ownership struct {
+	// Whether FactoryDefault could be determined without risking to lock
+	// out SID
+	Known bool
+	// The SID PIN is still the MSID, i.e. nobody has taken ownership
+	FactoryDefault bool
+	// The PIN passed to VerifyOwnership authenticates as SID
+	PINValid bool
+}
+
+// VerifyOwnership checks whether pin is the SID PIN of the drive and whether
+// the SID PIN is still the factory default MSID.
+//
+// The latter is read from the SID Value State of the Block SID feature if the
+// drive supports it. Otherwise a single authentication with the MSID is
+// attempted, but only after pin has been verified and the TryLimit of SID
+// leaves room for a failed attempt. A nil pin only checks the Block SID
+// feature.
+func VerifyOwnership(coreObj *core.Core, pin []byte) (*Ownership, error) {
+	ic := newInitializeConfig(nil)
+	cs, _, err := newControlSession(coreObj, &ic)
+	if err != nil {
+		return nil, err
+	}
+	s, err := cs.NewSession(uid.AdminSP, core.WithReadOnly())
+	if err != nil {
+		return nil, fmt.Errorf("admin session creation failed: %w", err)
+	}
+	defer s.Close()
+
+	o := &Ownership{}
+	bs := coreObj.DiskInfo.Level0Discovery.BlockSID
+	if bs != nil {
+		o.Known = true
+		o.FactoryDefault = !bs.SIDValueState
+		if bs.SIDAuthenticationBlockedState {
+			if len(pin) > 0 {
+				return o, ErrSIDBlocked
+			}
+			return o, nil
+		}
+	}
+	if len(pin) == 0 {
+		return o, nil
+	}
+
+	msid, err := table.Admin_C_PIN_MSID_GetPIN(s)
+	if err != nil {
+		return nil, fmt.Errorf("reading MSID failed: %v", err)
+	}
+	err = table.ThisSP_Authenticate(s, uid.AuthoritySID, pin)
+	if errors.Is(err, table.ErrAuthenticationFailed) {
+		return o, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	o.PINValid = true
+	if bytes.Equal(pin, msid) {
+		o.Known = true
+		o.FactoryDefault = true
+	}
+	if o.Known {
+		return o, nil
+	}
+
+	// The successful authentication has reset Tries
+	limit, err := table.GetCell(s, uid.Admin_C_PIN_SIDRow, table.Admin_C_PIN_ColumnTryLimit, "TryLimit")
+	if err != nil {
+		return nil, fmt.Errorf("reading SID TryLimit failed: %v", err)
+	}
+	if l, ok := limit.(uint); !ok || (l != 0 && l < 2) {
+		return o, nil
+	}
+	// The MSID is tried in a fresh session, as s is authenticated as SID
+	// already. Many drives only allow a single session at a time.
+	if err := s.Close(); err != nil {
+		return nil, err
+	}
+	ms, err := cs.NewSession(uid.AdminSP, core.WithReadOnly())
+	if err != nil {
+		return nil, fmt.Errorf("admin session creation failed: %w", err)
+	}
+	defer ms.Close()
+	factory, err := sidIsMSID(ms, msid)
+	if err != nil {
+		return nil, err
+	}
+	o.Known = true
+	o.FactoryDefault = factory
+	return o, nil
+}
+
+// sidIsMSID tries to authenticate as SID with the MSID in the given Admin SP
+// session, which must not be authenticated as SID yet. A failed attempt counts
+// against the TryLimit of SID.
+func sidIsMSID(s *core.Session, msid []byte) (bool, error) {
+	err := table.ThisSP_Authenticate(s, uid.AuthoritySID, msid)
+	if errors.Is(err, table.ErrAuthenticationFailed) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,39 @@
+package locking
+
+import (
+	"testing"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive/sim"
+)
+
+func TestVerifyOwnership(t *testing.T) {
+	c, cs := simControlSession(t, sim.New())
+	s, err := cs.NewSession(uid.AdminSP, core.WithReadOnly())
+	if err != nil {
+		t.Fatalf("NewSession() failed: %v", err)
+	}
+	msid, err := table.Admin_C_PIN_MSID_GetPIN(s)
+	if err != nil {
+		t.Fatalf("Admin_C_PIN_MSID_GetPIN() failed: %v", err)
+	}
+	s.Close()
+
+	check := func(pin []byte, want Ownership) {
+		t.Helper()
+		got, err := VerifyOwnership(c, pin)
+		if err != nil {
+			t.Fatalf("VerifyOwnership() failed: %v", err)
+		}
+		if *got != want {
+			t.Errorf("VerifyOwnership(%q) = %+v, want %+v", pin, *got, want)
+		}
+	}
+	check(nil, Ownership{})
+	check(msid, Ownership{Known: true, FactoryDefault: true, PINValid: true})
+	takeOwnership(t, cs)
+	check([]byte("wrong"), Ownership{})
+	check(sidPIN, Ownership{Known: true, PINValid: true})
+}
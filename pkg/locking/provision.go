@@ -0,0 +1,447 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Declarative provisioning of Opal family drives
+
+package locking
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+// ProvisionProfile describes the desired state of a drive, see Provision.
+// PINs are written as given, passwords should be hashed before they are put
+// into a profile.
+type ProvisionProfile struct {
+	// PIN of the SID authority of the Admin SP
+	SIDPIN []byte
+	// PIN of the Admin1 authority of the Locking SP, defaults to SIDPIN
+	Admin1PIN []byte
+
+	// Authorities of the Locking SP, the ones not listed are left untouched
+	Users []UserProfile
+	// Locking ranges, the ones not listed are left untouched
+	Ranges []RangeProfile
+
+	// Whether the shadow MBR is enabled, nil leaves it unchanged
+	MBREnabled *bool
+	// Single User Mode to select when activating the Locking SP, nil for none
+	SingleUserMode *SUMProfile
+}
+
+type UserProfile struct {
+	// Name of the authority, e.g. "User1"
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	// PIN of the authority, nil leaves it unchanged
+	PIN []byte `json:"-"`
+}
+
+type RangeProfile struct {
+	// Number of the range, 0 being the global range which has no start and
+	// length
+	Index  int       `json:"index"`
+	Start  LockRange `json:"start"`
+	Length LockRange `json:"length"`
+
+	ReadLockEnabled  bool `json:"read_lock_enabled"`
+	WriteLockEnabled bool `json:"write_lock_enabled"`
+	// Resets that lock the range again, nil leaves them unchanged
+	LockOnReset []table.ResetType `json:"lock_on_reset,omitempty"`
+	// Name of the range, nil leaves it unchanged
+	Name *string `json:"name,omitempty"`
+}
+
+type SUMProfile struct {
+	// Numbers of the ranges in Single User Mode, empty for all of them
+	Ranges []int
+	// Only allow Admins to change start and length of the ranges
+	AdminPolicy bool
+}
+
+type provisioner struct {
+	cs      *core.ControlSession
+	d0      *core.Level0Discovery
+	p       *ProvisionProfile
+	dryRun  bool
+	changes []string
+}
+
+// Provision brings an Opal family drive into the state described by the
+// profile. Only the differences to the current state are applied, so running
+// it again with the same profile changes nothing. The returned list describes
+// the changes that were made, also if an error stopped it half way.
+//
+// Ownership is taken using MSID if the drive does not accept the SID PIN of
+// the profile, and the Locking SP is activated if it is not yet. PINs cannot
+// be read back, so they are compared by authenticating with them: every PIN
+// that needs to be changed costs one failed attempt of its authority.
+//
+// Single User Mode can only be selected on activation, Provision fails if an
+// active Locking SP does not match the profile. Ranges in Single User Mode are
+// owned by their user and cannot be configured by Provision.
+//
+// With WithReadOnly nothing is changed and the returned list describes the
+// drift from the profile instead. The Locking SP is then only inspected if it
+// is already active. Of the other options only the ones configuring the
+// transport are used.
+func Provision(coreObj *core.Core, p *ProvisionProfile, opts ...InitializeOpt) ([]string, error) {
+	d0 := coreObj.DiskInfo.Level0Discovery
+	if err := validateProfile(d0, p); err != nil {
+		return nil, err
+	}
+	ic := newInitializeConfig(opts)
+	cs, proto, err := newControlSession(coreObj, &ic)
+	if err != nil {
+		return nil, err
+	}
+	defer cs.Close()
+	if proto == core.ProtocolLevelEnterprise {
+		return nil, fmt.Errorf("provisioning is not supported on Enterprise drives")
+	}
+
+	pr := &provisioner{cs: cs, d0: d0, p: p, dryRun: ic.readOnly}
+	active, err := pr.adminSP()
+	if err != nil {
+		return pr.changes, err
+	}
+	if !active {
+		// Only possible in a dry run, as the Locking SP is activated otherwise
+		return pr.changes, nil
+	}
+	pinOK, err := pr.checkUserPINs()
+	if err != nil {
+		return pr.changes, err
+	}
+	if err := pr.lockingSP(pinOK); err != nil {
+		return pr.changes, err
+	}
+	return pr.changes, nil
+}
+
+func validateProfile(d0 *core.Level0Discovery, p *ProvisionProfile) error {
+	if d0.Locking == nil {
+		return fmt.Errorf("device does not have the Locking feature")
+	}
+	if len(p.SIDPIN) == 0 {
+		return fmt.Errorf("profile has no SID PIN")
+	}
+	for _, u := range p.Users {
+		if _, ok := AuthorityUIDFromName(u.Name); !ok {
+			return fmt.Errorf("unknown authority %q", u.Name)
+		}
+	}
+	for _, rp := range p.Ranges {
+		if rp.Index < 0 {
+			return fmt.Errorf("invalid locking range %d", rp.Index)
+		}
+		if rp.Index == 0 && (rp.Start != 0 || rp.Length != 0) {
+			return fmt.Errorf("cannot modify start and length of the global range")
+		}
+	}
+	if p.SingleUserMode != nil && d0.SingleUser == nil {
+		return fmt.Errorf("device does not support Single User Mode")
+	}
+	return nil
+}
+
+// apply runs fn unless this is a dry run, and records the change.
+func (pr *provisioner) apply(fn func() error, format string, args ...interface{}) error {
+	if !pr.dryRun {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	pr.changes = append(pr.changes, fmt.Sprintf(format, args...))
+	return nil
+}
+
+func (pr *provisioner) newSession(spid uid.SPID) (*core.Session, error) {
+	var opts []core.SessionOpt
+	if pr.dryRun {
+		opts = append(opts, core.WithReadOnly())
+	}
+	return pr.cs.NewSession(spid, opts...)
+}
+
+// Take ownership and activate the Locking SP, if needed. Returns whether the
+// Locking SP is active.
+func (pr *provisioner) adminSP() (bool, error) {
+	s, err := pr.newSession(uid.AdminSP)
+	if err != nil {
+		return false, fmt.Errorf("admin session creation failed: %w", err)
+	}
+	defer s.Close()
+
+	err = table.ThisSP_Authenticate(s, uid.AuthoritySID, pr.p.SIDPIN)
+	if errors.Is(err, table.ErrAuthenticationFailed) && !errors.Is(err, table.ErrAuthorityLockedOut) {
+		msid, merr := table.Admin_C_PIN_MSID_GetPIN(s)
+		if merr != nil {
+			return false, fmt.Errorf("reading MSID failed: %v", merr)
+		}
+		if err = table.ThisSP_Authenticate(s, uid.AuthoritySID, msid); err == nil {
+			err = pr.apply(func() error {
+				if err := table.Admin_C_Pin_SID_SetPIN(s, pr.p.SIDPIN); err != nil {
+					return fmt.Errorf("setting SID PIN failed: %v", err)
+				}
+				return nil
+			}, "Admin SP: set SID PIN")
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+	if err != nil {
+		return false, fmt.Errorf("authenticating as SID failed: %w", err)
+	}
+
+	lcs, err := table.Admin_SP_GetLifeCycleState(s, uid.LockingSP)
+	if err != nil {
+		return false, fmt.Errorf("reading Locking SP life cycle state failed: %v", err)
+	}
+	switch lcs {
+	case table.Manufactured:
+		return true, pr.checkSUM()
+	case table.ManufacturedInactive:
+		if sum := pr.p.SingleUserMode; sum != nil {
+			var rows []uid.RowUID
+			for _, n := range sum.Ranges {
+				rows = append(rows, uid.LockingRange(n))
+			}
+			err = pr.apply(func() error {
+				if err := table.LockingSPActivateSUM(s, rows, sum.AdminPolicy); err != nil {
+					return fmt.Errorf("activating Locking SP failed: %v", err)
+				}
+				return nil
+			}, "Admin SP: activate Locking SP with Single User Mode ranges %v", sum.Ranges)
+		} else {
+			err = pr.apply(func() error {
+				if err := table.LockingSPActivate(s); err != nil {
+					return fmt.Errorf("activating Locking SP failed: %v", err)
+				}
+				return nil
+			}, "Admin SP: activate Locking SP")
+		}
+		return !pr.dryRun && err == nil, err
+	default:
+		return false, fmt.Errorf("unsupported life cycle state on locking SP: %v", lcs)
+	}
+}
+
+// Single User Mode can only be changed by Reactivate, which would throw
+// away the configuration of the Locking SP.
+func (pr *provisioner) checkSUM() error {
+	sum := pr.d0.SingleUser
+	want := pr.p.SingleUserMode
+	switch {
+	case want == nil && sum != nil && sum.Any:
+		return fmt.Errorf("Locking SP has ranges in Single User Mode, but the profile has none")
+	case want != nil && len(want.Ranges) == 0 && !sum.All:
+		return fmt.Errorf("Locking SP is not entirely in Single User Mode as the profile requires")
+	case want != nil && !sum.Any:
+		return fmt.Errorf("Locking SP has no ranges in Single User Mode as the profile requires")
+	}
+	return nil
+}
+
+// Check the user PINs of the profile by authenticating with them, each in
+// its own session so that they do not count against the authentications of
+// the Admin1 session. Returns the users whose PIN is already set.
+func (pr *provisioner) checkUserPINs() (map[string]bool, error) {
+	ok := map[string]bool{}
+	for _, u := range pr.p.Users {
+		if u.PIN == nil {
+			continue
+		}
+		auth, _ := AuthorityUIDFromName(u.Name)
+		s, err := pr.cs.NewSession(uid.LockingSP, core.WithReadOnly())
+		if err != nil {
+			return nil, fmt.Errorf("session creation failed: %w", err)
+		}
+		err = table.ThisSP_Authenticate(s, auth, u.PIN)
+		s.Close()
+		switch {
+		case err == nil:
+			ok[u.Name] = true
+		case errors.Is(err, table.ErrAuthenticationFailed), errors.Is(err, method.ErrMethodStatusNotAuthorized):
+			// Wrong PIN or disabled authority, the PIN is set below
+		default:
+			return nil, fmt.Errorf("authenticating as %s failed: %w", u.Name, err)
+		}
+	}
+	return ok, nil
+}
+
+func (pr *provisioner) lockingSP(pinOK map[string]bool) error {
+	admin1PIN := pr.p.Admin1PIN
+	if admin1PIN == nil {
+		admin1PIN = pr.p.SIDPIN
+	}
+	s, err := pr.newSession(uid.LockingSP)
+	if err != nil {
+		return fmt.Errorf("session creation failed: %w", err)
+	}
+	defer s.Close()
+
+	admin1 := uid.LockingAuthorityAdmin1
+	err = table.ThisSP_Authenticate(s, admin1, admin1PIN)
+	if errors.Is(err, table.ErrAuthenticationFailed) && !errors.Is(err, table.ErrAuthorityLockedOut) &&
+		!bytes.Equal(admin1PIN, pr.p.SIDPIN) {
+		// Activate copies the SID PIN to Admin1
+		if err = table.ThisSP_Authenticate(s, admin1, pr.p.SIDPIN); err == nil {
+			err = pr.apply(func() error {
+				if err := table.C_PIN_SetPIN(s, uid.C_PINRowForAuthority(admin1), admin1PIN); err != nil {
+					return fmt.Errorf("setting Admin1 PIN failed: %v", err)
+				}
+				return nil
+			}, "Locking SP: set Admin1 PIN")
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("authenticating as Admin1 failed: %w", err)
+	}
+
+	lmeta := &LockingSPMeta{D0: pr.d0}
+	copy(lmeta.SPID[:], uid.LockingSP[:])
+	l, err := newLockingSP(s, lmeta, &sessionConfig{enumerate: true})
+	if err != nil {
+		return err
+	}
+
+	for _, u := range pr.p.Users {
+		auth, _ := AuthorityUIDFromName(u.Name)
+		enabled, err := table.Authority_GetEnabled(s, auth)
+		if err != nil {
+			return fmt.Errorf("reading state of %s failed: %v", u.Name, err)
+		}
+		if enabled != u.Enabled {
+			err := pr.apply(func() error {
+				if err := l.SetUserEnabled(u.Name, u.Enabled); err != nil {
+					return fmt.Errorf("changing state of %s failed: %v", u.Name, err)
+				}
+				return nil
+			}, "Locking SP: set %s Enabled=%v", u.Name, u.Enabled)
+			if err != nil {
+				return err
+			}
+		}
+		if u.PIN != nil && !pinOK[u.Name] {
+			err := pr.apply(func() error {
+				if err := l.SetPIN(u.Name, u.PIN); err != nil {
+					return fmt.Errorf("setting %s PIN failed: %v", u.Name, err)
+				}
+				return nil
+			}, "Locking SP: set %s PIN", u.Name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, rp := range pr.p.Ranges {
+		var r *Range
+		for _, lr := range l.Ranges {
+			if lr.index() == rp.Index {
+				r = lr
+			}
+		}
+		if r == nil {
+			return fmt.Errorf("locking range %d not found", rp.Index)
+		}
+		row, desc := rangeChanges(r, rp)
+		if row == nil {
+			continue
+		}
+		err := pr.apply(func() error {
+			if err := table.Locking_Set(s, row); err != nil {
+				return fmt.Errorf("configuring locking range %d failed: %v", rp.Index, err)
+			}
+			return nil
+		}, "Locking SP: set locking range %d %s", rp.Index, strings.Join(desc, " "))
+		if err != nil {
+			return err
+		}
+	}
+
+	if want := pr.p.MBREnabled; want != nil {
+		mbr, err := table.MBRControl_Get(s)
+		if err != nil {
+			return fmt.Errorf("reading MBRControl failed: %v", err)
+		}
+		if mbr.Enable == nil || *mbr.Enable != *want {
+			return pr.apply(func() error {
+				if err := table.MBRControl_Set(s, &table.MBRControl{Enable: want}); err != nil {
+					return fmt.Errorf("changing MBR state failed: %v", err)
+				}
+				return nil
+			}, "Locking SP: set MBR Enable=%v", *want)
+		}
+	}
+	return nil
+}
+
+// rangeChanges returns the row setting the columns of r that differ from the
+// profile together with a description of them, or nil if there are none.
+func rangeChanges(r *Range, rp RangeProfile) (*table.LockingRow, []string) {
+	row := &table.LockingRow{UID: r.UID}
+	var desc []string
+	if !r.isGlobal && (r.Start != rp.Start || r.End-r.Start != rp.Length) {
+		start, length := uint64(rp.Start), uint64(rp.Length)
+		row.RangeStart = &start
+		row.RangeLength = &length
+		desc = append(desc, fmt.Sprintf("RangeStart=%d RangeLength=%d", start, length))
+	}
+	if r.ReadLockEnabled != rp.ReadLockEnabled {
+		v := rp.ReadLockEnabled
+		row.ReadLockEnabled = &v
+		desc = append(desc, fmt.Sprintf("ReadLockEnabled=%v", v))
+	}
+	if r.WriteLockEnabled != rp.WriteLockEnabled {
+		v := rp.WriteLockEnabled
+		row.WriteLockEnabled = &v
+		desc = append(desc, fmt.Sprintf("WriteLockEnabled=%v", v))
+	}
+	if rp.LockOnReset != nil && !sameResetTypes(r.LockOnReset, rp.LockOnReset) {
+		row.LockOnReset = append([]table.ResetType{}, rp.LockOnReset...)
+		desc = append(desc, fmt.Sprintf("LockOnReset=%v", rp.LockOnReset))
+	}
+	if rp.Name != nil && (r.Name == nil || *r.Name != *rp.Name) {
+		v := *rp.Name
+		row.Name = &v
+		desc = append(desc, fmt.Sprintf("Name=%q", v))
+	}
+	if len(desc) == 0 {
+		return nil, nil
+	}
+	return row, desc
+}
+
+// Compare two lists of reset types ignoring their order.
+func sameResetTypes(a, b []table.ResetType) bool {
+	set := map[table.ResetType]bool{}
+	for _, t := range a {
+		set[t] = true
+	}
+	for _, t := range b {
+		if !set[t] {
+			return false
+		}
+	}
+	other := map[table.ResetType]bool{}
+	for _, t := range b {
+		other[t] = true
+	}
+	return len(set) == len(other)
+}
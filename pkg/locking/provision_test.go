@@ -0,0 +1,63 @@
+package locking
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+)
+
+func TestRangeChanges(t *testing.T) {
+	configured := &Range{
+		Start:            2048,
+		End:              4096,
+		ReadLockEnabled:  true,
+		WriteLockEnabled: true,
+		LockOnReset:      []table.ResetType{table.ResetPowerOff},
+	}
+	for _, tc := range []struct {
+		name string
+		r    *Range
+		rp   RangeProfile
+		desc []string
+	}{
+		{
+			name: "unchanged",
+			r:    configured,
+			rp:   RangeProfile{Index: 1, Start: 2048, Length: 2048, ReadLockEnabled: true, WriteLockEnabled: true},
+		},
+		{
+			name: "lock on reset in other order",
+			r:    &Range{LockOnReset: []table.ResetType{table.ResetPowerOff, table.ResetHardware}},
+			rp:   RangeProfile{Index: 1, LockOnReset: []table.ResetType{table.ResetHardware, table.ResetPowerOff}},
+		},
+		{
+			name: "resize",
+			r:    configured,
+			rp:   RangeProfile{Index: 1, Start: 2048, Length: 1024, ReadLockEnabled: true, WriteLockEnabled: true},
+			desc: []string{"RangeStart=2048 RangeLength=1024"},
+		},
+		{
+			name: "global range has no extent",
+			r:    &Range{isGlobal: true},
+			rp:   RangeProfile{ReadLockEnabled: true, LockOnReset: []table.ResetType{}},
+			desc: []string{"ReadLockEnabled=true"},
+		},
+		{
+			name: "clear lock on reset",
+			r:    configured,
+			rp:   RangeProfile{Index: 1, Start: 2048, Length: 2048, WriteLockEnabled: true, LockOnReset: []table.ResetType{}},
+			desc: []string{"ReadLockEnabled=false", "LockOnReset=[]"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			row, desc := rangeChanges(tc.r, tc.rp)
+			if (row == nil) != (tc.desc == nil) {
+				t.Fatalf("rangeChanges() row = %+v, want changes %v", row, tc.desc)
+			}
+			if !reflect.DeepEqual(desc, tc.desc) {
+				t.Errorf("rangeChanges() = %q, want %q", desc, tc.desc)
+			}
+		})
+	}
+}
@@ -8,7 +8,10 @@ package locking
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"sort"
 
 	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
@@ -42,22 +45,41 @@ type Range struct {
 	ReadLocked  bool
 	WriteLocked bool
 
-	//LockOnReset SomeType TODO: Create this type from spec
+	// Resets that lock the range again, if locking is enabled
+	LockOnReset []table.ResetType
 }
 
 func fillRanges(s *core.Session, l *LockingSP) error {
-	lockList, err := table.Locking_Enumerate(s)
-	if err != nil {
-		return fmt.Errorf("enumerate ranges failed: %v", err)
+	lockList := []uid.RowUID{uid.GlobalRangeRowUID}
+	if l.enumerate {
+		var err error
+		lockList, err = table.Locking_Enumerate(s)
+		if err != nil {
+			return fmt.Errorf("enumerate ranges failed: %v", err)
+		}
+	}
+	if l.rangeFilter != nil {
+		var filtered []uid.RowUID
+		for _, row := range lockList {
+			if l.rangeFilter(row) {
+				filtered = append(filtered, row)
+			}
+		}
+		lockList = filtered
 	}
 
 	sort.Slice(lockList, func(i, j int) bool {
 		return bytes.Compare(lockList[i][:], lockList[j][:]) < 0
 	})
 
-	for _, luid := range lockList {
-		lr, err := table.Locking_Get(s, luid)
-		if err != nil {
+	lrs, err := table.Locking_GetRows(s, lockList)
+	if err != nil {
+		return fmt.Errorf("reading ranges failed: %v", err)
+	}
+	l.GlobalRange = nil
+	l.Ranges = nil
+	for _, lr := range lrs {
+		if lr == nil {
 			continue
 		}
 		r := &Range{
@@ -83,62 +105,151 @@ func fillRanges(s *core.Session, l *LockingSP) error {
 			r.ReadLocked = *lr.ReadLocked
 			r.WriteLocked = *lr.WriteLocked
 		}
+		r.LockOnReset = lr.LockOnReset
 		// TODO: Enumerate users with permissions on this range
-		// TODO: Fill the LockOnReset property
 		l.Ranges = append(l.Ranges, r)
 	}
 	return nil
 }
 
-func (r *Range) UnlockRead() error {
-	lr := &table.LockingRow{}
-	copy(lr.UID[:], r.UID[:])
-	v := false
-	lr.ReadLocked = &v
-	if err := table.Locking_Set(r.l.Session, lr); err != nil {
-		return err
+// ErrUnlockNotEffective is returned when the drive accepted an unlock but the
+// range is still locked, see WithVerify.
+var ErrUnlockNotEffective = errors.New("range is still locked after unlocking")
+
+type unlockConfig struct {
+	verify bool
+	dev    io.ReaderAt
+}
+
+type UnlockOpt func(uc *unlockConfig)
+
+// WithVerify reads the Locking row again after UnlockRead or UnlockWrite to
+// confirm that the range is unlocked. Some drives silently keep the range
+// locked when a reset in LockOnReset races with the command.
+func WithVerify() UnlockOpt {
+	return func(uc *unlockConfig) {
+		uc.verify = true
+	}
+}
+
+// WithVerifyRead implies WithVerify and reads the first block of the range
+// from dev, the block device of the drive, after UnlockRead. Reads of a read
+// locked range fail. Blocks in the page cache are not read from the drive, so
+// this is only conclusive before anything of the range was read, e.g. at boot.
+func WithVerifyRead(dev io.ReaderAt) UnlockOpt {
+	return func(uc *unlockConfig) {
+		uc.verify = true
+		uc.dev = dev
+	}
+}
+
+func (r *Range) verifyUnlocked(read bool, write bool, opts []UnlockOpt) error {
+	uc := unlockConfig{}
+	for _, o := range opts {
+		o(&uc)
+	}
+	if !uc.verify {
+		return nil
+	}
+	lr, err := table.Locking_Get(r.l.Session, r.UID)
+	if err != nil {
+		return fmt.Errorf("re-reading the range failed: %v", err)
+	}
+	if lr.ReadLocked != nil && lr.WriteLocked != nil {
+		r.ReadLocked = *lr.ReadLocked
+		r.WriteLocked = *lr.WriteLocked
+	}
+	if (read && r.ReadLocked) || (write && r.WriteLocked) {
+		return ErrUnlockNotEffective
+	}
+	// The global range starts at 0 and has no length
+	if !read || uc.dev == nil || (!r.isGlobal && r.End <= r.Start) {
+		return nil
+	}
+	start, _ := r.Bytes()
+	buf := make([]byte, r.l.blockSize())
+	if _, err := uc.dev.ReadAt(buf, int64(start)); err != nil {
+		return fmt.Errorf("%w: reading from the device failed: %v", ErrUnlockNotEffective, err)
 	}
-	r.ReadLocked = v
 	return nil
 }
 
+func (r *Range) UnlockRead(opts ...UnlockOpt) error {
+	return r.Unlock(true, false, opts...)
+}
+
 func (r *Range) LockRead() error {
-	lr := &table.LockingRow{}
-	copy(lr.UID[:], r.UID[:])
-	v := true
-	lr.ReadLocked = &v
-	if err := table.Locking_Set(r.l.Session, lr); err != nil {
+	return r.Lock(true, false)
+}
+
+func (r *Range) UnlockWrite(opts ...UnlockOpt) error {
+	return r.Unlock(false, true, opts...)
+}
+
+func (r *Range) LockWrite() error {
+	return r.Lock(false, true)
+}
+
+// Unlock unlocks reading and/or writing of the range with a single Set, so
+// that a failure does not leave the range half unlocked.
+func (r *Range) Unlock(read bool, write bool, opts ...UnlockOpt) error {
+	if err := r.setLocked(read, write, false); err != nil {
 		return err
 	}
-	r.ReadLocked = v
-	return nil
+	if err := r.verifyUnlocked(read, write, opts); err != nil {
+		return err
+	}
+	return r.l.applyMBRPolicy(true)
 }
 
-func (r *Range) UnlockWrite() error {
-	lr := &table.LockingRow{}
-	copy(lr.UID[:], r.UID[:])
-	v := false
-	lr.WriteLocked = &v
-	if err := table.Locking_Set(r.l.Session, lr); err != nil {
+// Lock locks reading and/or writing of the range with a single Set.
+func (r *Range) Lock(read bool, write bool) error {
+	if err := r.setLocked(read, write, true); err != nil {
 		return err
 	}
-	r.WriteLocked = v
-	return nil
+	return r.l.applyMBRPolicy(false)
 }
 
-func (r *Range) LockWrite() error {
+func (r *Range) setLocked(read bool, write bool, v bool) error {
+	if err := r.l.checkWritable(); err != nil {
+		return err
+	}
 	lr := &table.LockingRow{}
 	copy(lr.UID[:], r.UID[:])
-	v := true
-	lr.WriteLocked = &v
+	if read {
+		lr.ReadLocked = &v
+	}
+	if write {
+		lr.WriteLocked = &v
+	}
 	if err := table.Locking_Set(r.l.Session, lr); err != nil {
 		return err
 	}
-	r.WriteLocked = v
+	if read {
+		r.ReadLocked = v
+	}
+	if write {
+		r.WriteLocked = v
+	}
+	return nil
+}
+
+// applyMBRPolicy hides the shadow MBR after a range was unlocked and shows it
+// again after one was locked, if SetMBRDoneOnUnlock is set.
+func (l *LockingSP) applyMBRPolicy(unlocked bool) error {
+	if !l.SetMBRDoneOnUnlock || !l.MBREnabled || l.MBRDone == unlocked {
+		return nil
+	}
+	if err := l.SetMBRDone(unlocked); err != nil {
+		return fmt.Errorf("SetMBRDone(%v) failed: %v", unlocked, err)
+	}
 	return nil
 }
 
 func (r *Range) SetReadLockEnabled(v bool) error {
+	if err := r.l.checkWritable(); err != nil {
+		return err
+	}
 	lr := &table.LockingRow{}
 	copy(lr.UID[:], r.UID[:])
 	lr.ReadLockEnabled = &v
@@ -151,6 +262,9 @@ func (r *Range) SetReadLockEnabled(v bool) error {
 }
 
 func (r *Range) SetWriteLockEnabled(v bool) error {
+	if err := r.l.checkWritable(); err != nil {
+		return err
+	}
 	lr := &table.LockingRow{}
 	copy(lr.UID[:], r.UID[:])
 	lr.WriteLockEnabled = &v
@@ -162,7 +276,52 @@ func (r *Range) SetWriteLockEnabled(v bool) error {
 
 }
 
+// Enable sets whether reading and writing of the range can be locked, in a
+// single Set together with the Locked bits, see checkEnable for the accepted
+// combinations. Read locking without write locking is allowed.
+func (r *Range) Enable(read bool, write bool) error {
+	if err := r.l.checkWritable(); err != nil {
+		return err
+	}
+	if err := checkEnable(read, write, r.ReadLocked, r.WriteLocked); err != nil {
+		return err
+	}
+	readLocked := r.ReadLocked && read
+	writeLocked := r.WriteLocked && write
+	lr := &table.LockingRow{}
+	copy(lr.UID[:], r.UID[:])
+	lr.ReadLockEnabled = &read
+	lr.WriteLockEnabled = &write
+	lr.ReadLocked = &readLocked
+	lr.WriteLocked = &writeLocked
+	if err := table.Locking_Set(r.l.Session, lr); err != nil {
+		return err
+	}
+	r.ReadLockEnabled = read
+	r.WriteLockEnabled = write
+	r.ReadLocked = readLocked
+	r.WriteLocked = writeLocked
+	return nil
+}
+
+// checkEnable rejects lock enables the SSC gives no meaning to. Per the
+// Locking table of the Core Spec, ReadLocked and WriteLocked have no effect
+// while ReadLockEnabled or WriteLockEnabled is False, so disabling a locked
+// direction would unlock it without saying so. It has to be unlocked first.
+func checkEnable(read, write, readLocked, writeLocked bool) error {
+	if !read && readLocked {
+		return fmt.Errorf("cannot disable read locking of a read locked range, unlock it first")
+	}
+	if !write && writeLocked {
+		return fmt.Errorf("cannot disable write locking of a write locked range, unlock it first")
+	}
+	return nil
+}
+
 func (r *Range) SetRange(from LockRange, to LockRange) error {
+	if err := r.l.checkWritable(); err != nil {
+		return err
+	}
 	if r.isGlobal {
 		return fmt.Errorf("cannot modify the global range")
 	}
@@ -180,6 +339,228 @@ func (r *Range) SetRange(from LockRange, to LockRange) error {
 	return nil
 }
 
+// SetName sets the name of the range, so that it can be found again with
+// RangeByName regardless of its index on the drive.
+func (r *Range) SetName(name string) error {
+	if err := r.l.checkWritable(); err != nil {
+		return err
+	}
+	lr := &table.LockingRow{}
+	copy(lr.UID[:], r.UID[:])
+	lr.Name = &name
+	if err := table.Locking_Set(r.l.Session, lr); err != nil {
+		return err
+	}
+	r.Name = &name
+	return nil
+}
+
+// RangeByName returns the range with the given name, if any.
+func (l *LockingSP) RangeByName(name string) (*Range, bool) {
+	for _, r := range l.Ranges {
+		if r.Name != nil && *r.Name == name {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// SetLockOnReset selects the resets that lock the range again. An empty
+// list keeps the range unlocked until it is locked explicitly.
+func (r *Range) SetLockOnReset(types []table.ResetType) error {
+	if err := r.l.checkWritable(); err != nil {
+		return err
+	}
+	lr := &table.LockingRow{}
+	copy(lr.UID[:], r.UID[:])
+	lr.LockOnReset = append([]table.ResetType{}, types...)
+	if err := table.Locking_Set(r.l.Session, lr); err != nil {
+		return err
+	}
+	r.LockOnReset = lr.LockOnReset
+	return nil
+}
+
+// index returns the range number as used in e.g. ACE UIDs, where the global
+// range is 0.
+func (r *Range) index() int {
+	if r.isGlobal {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(r.UID[6:8]))
+}
+
+// DefaultBlockSize is the logical block size assumed when neither the
+// Geometry feature nor LockingInfo report one.
+const DefaultBlockSize = 512
+
+// BytesToLBA converts a byte offset or length to logical blocks of the
+// drive. It fails if b is not a multiple of the block size.
+func (l *LockingSP) BytesToLBA(b uint64) (LockRange, error) {
+	bs := uint64(l.blockSize())
+	if b%bs != 0 {
+		return 0, fmt.Errorf("%d bytes is not a multiple of the %d byte block size", b, bs)
+	}
+	return LockRange(b / bs), nil
+}
+
+// LBAToBytes converts a number of logical blocks of the drive to bytes.
+func (l *LockingSP) LBAToBytes(lba LockRange) uint64 {
+	return uint64(lba) * uint64(l.blockSize())
+}
+
+func (l *LockingSP) blockSize() uint32 {
+	if l.BlockSize == 0 {
+		return DefaultBlockSize
+	}
+	return l.BlockSize
+}
+
+// Bytes returns the area covered by the range in bytes.
+func (r *Range) Bytes() (start uint64, end uint64) {
+	return r.l.LBAToBytes(r.Start), r.l.LBAToBytes(r.End)
+}
+
+// CreateRange configures the first unused locking range to cover length
+// blocks starting at LBA start. Locking is not enabled on the new range.
+// It fails if the drive already has MaxRanges ranges configured.
+func (l *LockingSP) CreateRange(start LockRange, length LockRange) (*Range, error) {
+	if err := l.checkWritable(); err != nil {
+		return nil, err
+	}
+	if n := l.configuredRanges(); l.MaxRanges > 0 && uint32(n) >= l.MaxRanges {
+		return nil, fmt.Errorf("drive supports %d ranges, %d configured", l.MaxRanges, n)
+	}
+	for _, r := range l.Ranges {
+		if r.isGlobal || r.ReadLockEnabled || r.WriteLockEnabled || r.End > 0 {
+			continue
+		}
+		lr := &table.LockingRow{}
+		copy(lr.UID[:], r.UID[:])
+		start64 := uint64(start)
+		lr.RangeStart = &start64
+		length64 := uint64(length)
+		lr.RangeLength = &length64
+		if err := table.Locking_Set(l.Session, lr); err != nil {
+			return nil, err
+		}
+		r.Start = start
+		r.End = start + length
+		return r, nil
+	}
+	return nil, fmt.Errorf("no unused locking range available")
+}
+
+// configuredRanges returns the number of ranges besides the global range
+// that cover an area or have locking enabled.
+func (l *LockingSP) configuredRanges() int {
+	n := 0
+	for _, r := range l.Ranges {
+		if r.isGlobal {
+			continue
+		}
+		if r.ReadLockEnabled || r.WriteLockEnabled || r.End > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// Reset restores the range to its unconfigured default: zero length and
+// unlocked with locking disabled.
+func (r *Range) Reset() error {
+	if err := r.l.checkWritable(); err != nil {
+		return err
+	}
+	if r.isGlobal {
+		return fmt.Errorf("cannot modify the global range")
+	}
+	lr := &table.LockingRow{}
+	copy(lr.UID[:], r.UID[:])
+	zero := uint64(0)
+	f := false
+	lr.RangeStart = &zero
+	lr.RangeLength = &zero
+	lr.ReadLockEnabled = &f
+	lr.WriteLockEnabled = &f
+	lr.ReadLocked = &f
+	lr.WriteLocked = &f
+	if err := table.Locking_Set(r.l.Session, lr); err != nil {
+		return err
+	}
+	r.Start = 0
+	r.End = 0
+	r.ReadLockEnabled = false
+	r.WriteLockEnabled = false
+	r.ReadLocked = false
+	r.WriteLocked = false
+	return nil
+}
+
+// AddUser grants the named authority (e.g. "User1") the right to lock and
+// unlock the range. The authorities already in the ACEs of the range, e.g.
+// granted in earlier sessions, keep their rights.
+func (r *Range) AddUser(name string) error {
+	if err := r.l.checkWritable(); err != nil {
+		return err
+	}
+	if r.l.Session.ProtocolLevel == core.ProtocolLevelEnterprise {
+		return fmt.Errorf("ranges are bound to their BandMaster on Enterprise")
+	}
+	auth, ok := AuthorityUIDFromName(name)
+	if !ok {
+		return fmt.Errorf("unknown authority %q", name)
+	}
+	for _, ace := range []uid.RowUID{uid.ACE_Locking_Range_Set_RdLocked(r.index()), uid.ACE_Locking_Range_Set_WrLocked(r.index())} {
+		auths, err := table.ACE_GetBooleanExpression(r.l.Session, ace)
+		if err != nil {
+			return fmt.Errorf("reading ACE %x failed: %w", ace[:], err)
+		}
+		granted := false
+		for _, a := range auths {
+			granted = granted || a == auth
+		}
+		if granted {
+			continue
+		}
+		if err := table.ACE_SetBooleanExpression(r.l.Session, ace, append(auths, auth)); err != nil {
+			return err
+		}
+	}
+	if r.Users == nil {
+		r.Users = map[string]uid.AuthorityObjectUID{}
+	}
+	r.Users[name] = auth
+	return nil
+}
+
+// Erase cryptographically erases the range.
+//
+// On Enterprise the band is erased using the Erase method, which requires the
+// session to be authenticated as EraseMaster. On the other SSCs a new media
+// encryption key is generated for the range using GenKey.
 func (r *Range) Erase() error {
-	return fmt.Errorf("not implemented")
+	if err := r.l.checkWritable(); err != nil {
+		return err
+	}
+	s := r.l.Session
+	if s.ProtocolLevel == core.ProtocolLevelEnterprise {
+		if err := table.EraseBand(s, uid.InvokingID(r.UID)); err != nil {
+			return err
+		}
+		// Erase resets the band to its unlocked and disabled defaults
+		r.ReadLockEnabled = false
+		r.WriteLockEnabled = false
+		r.ReadLocked = false
+		r.WriteLocked = false
+		return nil
+	}
+	lr, err := table.Locking_Get(s, r.UID)
+	if err != nil {
+		return fmt.Errorf("reading active key failed: %v", err)
+	}
+	if lr.ActiveKey == nil {
+		return fmt.Errorf("range has no active key, media encryption not supported?")
+	}
+	return table.GenKey(s, *lr.ActiveKey)
 }
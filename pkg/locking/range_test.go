@@ -0,0 +1,177 @@
+package locking
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive/sim"
+)
+
+func TestBytesToLBA(t *testing.T) {
+	for _, tc := range []struct {
+		blockSize uint32
+		bytes     uint64
+		lba       LockRange
+		ok        bool
+	}{
+		{0, 1 << 30, 2097152, true},
+		{512, 1 << 30, 2097152, true},
+		{4096, 1 << 30, 262144, true},
+		{4096, 512, 0, false},
+		{512, 0, 0, true},
+	} {
+		l := &LockingSP{BlockSize: tc.blockSize}
+		lba, err := l.BytesToLBA(tc.bytes)
+		if (err == nil) != tc.ok || lba != tc.lba {
+			t.Errorf("BytesToLBA(%d) with %d byte blocks = %d, %v", tc.bytes, tc.blockSize, lba, err)
+			continue
+		}
+		if tc.ok && l.LBAToBytes(lba) != tc.bytes {
+			t.Errorf("LBAToBytes(%d) with %d byte blocks = %d, want %d", lba, tc.blockSize, l.LBAToBytes(lba), tc.bytes)
+		}
+	}
+}
+
+func TestCheckEnable(t *testing.T) {
+	for _, tc := range []struct {
+		read, write             bool
+		readLocked, writeLocked bool
+		ok                      bool
+	}{
+		{true, true, false, false, true},
+		{true, true, true, true, true},
+		// Only locking reads, or only writes
+		{true, false, false, false, true},
+		{true, false, true, false, true},
+		{false, true, false, true, true},
+		{false, false, false, false, true},
+		// Disabling a locked direction
+		{false, true, true, false, false},
+		{true, false, false, true, false},
+		{false, false, true, true, false},
+		{false, false, false, true, false},
+	} {
+		err := checkEnable(tc.read, tc.write, tc.readLocked, tc.writeLocked)
+		if (err == nil) != tc.ok {
+			t.Errorf("checkEnable(%v, %v) with ReadLocked=%v WriteLocked=%v returned %v, want ok=%v",
+				tc.read, tc.write, tc.readLocked, tc.writeLocked, err, tc.ok)
+		}
+	}
+}
+
+func TestRangeByName(t *testing.T) {
+	l := newSimFixture(t, sim.New()).lockingSP(t)
+	if len(l.Ranges) < 2 {
+		t.Fatalf("got %d ranges, want at least 2", len(l.Ranges))
+	}
+	want := l.Ranges[1]
+	if err := want.SetName("data"); err != nil {
+		t.Fatalf("SetName() failed: %v", err)
+	}
+	lr, err := table.Locking_Get(l.Session, want.UID)
+	if err != nil {
+		t.Fatalf("Locking_Get() failed: %v", err)
+	}
+	if lr.Name == nil || *lr.Name != "data" {
+		t.Errorf("Name = %v after SetName", lr.Name)
+	}
+	if r, ok := l.RangeByName("data"); !ok || r != want {
+		t.Errorf("RangeByName(\"data\") = %v, %v", r, ok)
+	}
+	if _, ok := l.RangeByName("boot"); ok {
+		t.Errorf("RangeByName(\"boot\") found a range")
+	}
+}
+
+func TestMaxRanges(t *testing.T) {
+	l := newSimFixture(t, sim.New()).lockingSP(t)
+	if l.MaxRanges != simRanges {
+		t.Fatalf("MaxRanges = %d, want %d", l.MaxRanges, simRanges)
+	}
+	for i := 0; i < simRanges; i++ {
+		if _, err := l.CreateRange(LockRange(i*1024), 1024); err != nil {
+			t.Fatalf("CreateRange() #%d failed: %v", i, err)
+		}
+	}
+	_, err := l.CreateRange(simRanges*1024, 1024)
+	if want := "drive supports 8 ranges, 8 configured"; err == nil || err.Error() != want {
+		t.Errorf("CreateRange() beyond MaxRanges returned %v, want %q", err, want)
+	}
+}
+
+func TestRangeEnable(t *testing.T) {
+	l := newSimFixture(t, sim.New()).lockingSP(t)
+	r := l.Ranges[1]
+	// Allowed by the spec, even if drives differ in whether the range can
+	// be written while it is read locked
+	if err := r.Enable(true, false); err != nil {
+		t.Fatalf("Enable(true, false) failed: %v", err)
+	}
+	if !r.ReadLockEnabled || r.WriteLockEnabled {
+		t.Errorf("range after Enable(true, false): ReadLockEnabled=%v WriteLockEnabled=%v", r.ReadLockEnabled, r.WriteLockEnabled)
+	}
+	if err := r.Enable(true, true); err != nil {
+		t.Fatalf("Enable(true, true) failed: %v", err)
+	}
+	if err := r.LockRead(); err != nil {
+		t.Fatalf("LockRead() failed: %v", err)
+	}
+	if err := r.LockWrite(); err != nil {
+		t.Fatalf("LockWrite() failed: %v", err)
+	}
+	if err := r.Enable(false, true); err == nil {
+		t.Errorf("Enable(false, true) of a read locked range succeeded")
+	}
+	if err := r.UnlockRead(); err != nil {
+		t.Fatalf("UnlockRead() failed: %v", err)
+	}
+	if err := r.Enable(false, true); err != nil {
+		t.Fatalf("Enable(false, true) failed: %v", err)
+	}
+	lr, err := table.Locking_Get(l.Session, r.UID)
+	if err != nil {
+		t.Fatalf("Locking_Get() failed: %v", err)
+	}
+	if *lr.ReadLockEnabled || *lr.ReadLocked || !*lr.WriteLockEnabled || !*lr.WriteLocked {
+		t.Errorf("range after Enable(false, true): ReadLockEnabled=%v ReadLocked=%v WriteLockEnabled=%v WriteLocked=%v",
+			*lr.ReadLockEnabled, *lr.ReadLocked, *lr.WriteLockEnabled, *lr.WriteLocked)
+	}
+}
+
+// failingReader fails all reads like a read locked range.
+type failingReader struct{}
+
+func (failingReader) ReadAt(p []byte, off int64) (int, error) {
+	return 0, errors.New("input/output error")
+}
+
+func TestUnlockVerify(t *testing.T) {
+	l := newSimFixture(t, sim.New()).lockingSP(t)
+	g := l.GlobalRange
+	if err := g.Enable(true, true); err != nil {
+		t.Fatalf("Enable() failed: %v", err)
+	}
+	for _, tc := range []struct {
+		name string
+		opts []UnlockOpt
+		want error
+	}{
+		{"verify", []UnlockOpt{WithVerify()}, nil},
+		{"verify read", []UnlockOpt{WithVerifyRead(bytes.NewReader(make([]byte, 4096)))}, nil},
+		{"device still locked", []UnlockOpt{WithVerifyRead(failingReader{})}, ErrUnlockNotEffective},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := g.LockRead(); err != nil {
+				t.Fatalf("LockRead() failed: %v", err)
+			}
+			if err := g.UnlockRead(tc.opts...); !errors.Is(err, tc.want) {
+				t.Errorf("UnlockRead() = %v, want %v", err, tc.want)
+			}
+			if g.ReadLocked {
+				t.Errorf("ReadLocked = true after UnlockRead()")
+			}
+		})
+	}
+}
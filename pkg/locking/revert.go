@@ -0,0 +1,57 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package locking
+
+import (
+	"fmt"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+// Revert reverts the Locking SP to its factory state with RevertSP, which
+// requires the session to be authenticated as an admin. With
+// keepGlobalRangeKey the media encryption key of the global range, and with
+// it the data, is kept. Otherwise all data on the drive is lost. The TPer
+// ends the session on success, l cannot be used afterwards.
+func (l *LockingSP) Revert(keepGlobalRangeKey bool) error {
+	if err := l.checkWritable(); err != nil {
+		return err
+	}
+	if l.Session.ProtocolLevel == core.ProtocolLevelEnterprise {
+		return fmt.Errorf("RevertSP is not supported on Enterprise drives")
+	}
+	if err := table.RevertLockingSP(l.Session, keepGlobalRangeKey, nil); err != nil {
+		return err
+	}
+	l.Session.Ended()
+	return nil
+}
+
+// RevertTPer reverts the whole TPer to its factory state, authenticating to
+// the Admin SP with auth, usually as SID. This DESTROYS ALL DATA on the
+// drive, or starts its removal on drives that do not encrypt data.
+func RevertTPer(coreObj *core.Core, auth AdminSPAuthenticator, opts ...InitializeOpt) error {
+	ic := newInitializeConfig(opts)
+	cs, _, err := newControlSession(coreObj, &ic)
+	if err != nil {
+		return err
+	}
+	s, err := cs.NewSession(uid.AdminSP)
+	if err != nil {
+		return fmt.Errorf("admin session creation failed: %w", err)
+	}
+	if err := auth.AuthenticateAdminSP(s); err != nil {
+		s.Close()
+		return fmt.Errorf("authentication failed: %w", err)
+	}
+	if err := table.RevertTPer(s); err != nil {
+		s.Close()
+		return fmt.Errorf("RevertTPer() failed: %v", err)
+	}
+	s.Ended()
+	return nil
+}
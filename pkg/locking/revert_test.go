@@ -0,0 +1,45 @@
+package locking
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive/sim"
+)
+
+func TestRevert(t *testing.T) {
+	f := newSimFixture(t, sim.New())
+	l := f.lockingSP(t)
+	if err := l.Revert(true); err != nil {
+		t.Fatalf("Revert() failed: %v", err)
+	}
+	if err := l.Close(); !errors.Is(err, core.ErrSessionAlreadyClosed) {
+		t.Errorf("Close() after Revert() returned %v", err)
+	}
+
+	s, err := f.cs.NewSession(uid.AdminSP)
+	if err != nil {
+		t.Fatalf("NewSession() failed: %v", err)
+	}
+	lcs, err := table.Admin_SP_GetLifeCycleState(s, uid.LockingSP)
+	if err != nil {
+		t.Fatalf("Admin_SP_GetLifeCycleState() failed: %v", err)
+	}
+	if lcs != table.ManufacturedInactive {
+		t.Errorf("Locking SP is %v after Revert()", lcs)
+	}
+	s.Close()
+
+	if err := RevertTPer(f.c, DefaultAdminAuthority([]byte("wrong"))); !errors.Is(err, table.ErrAuthenticationFailed) {
+		t.Errorf("RevertTPer() with a wrong PIN returned %v", err)
+	}
+	if err := RevertTPer(f.c, DefaultAdminAuthority(sidPIN)); err != nil {
+		t.Fatalf("RevertTPer() failed: %v", err)
+	}
+	if err := RevertTPer(f.c, DefaultAuthorityWithMSID); err != nil {
+		t.Errorf("RevertTPer() with the MSID after a revert failed: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package locking
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/method"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+)
+
+// Snapshot is the configuration of the Locking SP that RevertSP discards,
+// e.g. before a firmware update that requires a revert. It is taken with
+// LockingSP.Snapshot, can be stored as JSON and is applied again with
+// Restore.
+//
+// PINs cannot be read from the drive and are not part of the snapshot,
+// neither are the users granted access to the ranges.
+type Snapshot struct {
+	Users      []UserProfile  `json:"users"`
+	Ranges     []RangeProfile `json:"ranges"`
+	MBREnabled bool           `json:"mbr_enabled"`
+}
+
+// Snapshot records the configuration of the users and ranges. This requires
+// the session to be authenticated as an Admin.
+func (l *LockingSP) Snapshot() (*Snapshot, error) {
+	sn := &Snapshot{MBREnabled: l.MBREnabled}
+	for i := 1; ; i++ {
+		name := fmt.Sprintf("User%d", i)
+		auth, ok := AuthorityUIDFromName(name)
+		if !ok {
+			break
+		}
+		enabled, err := table.Authority_GetEnabled(l.Session, auth)
+		if errors.Is(err, method.ErrMethodStatusInvalidParameter) {
+			// No such authority, all users have been seen
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading state of %s failed: %v", name, err)
+		}
+		sn.Users = append(sn.Users, UserProfile{Name: name, Enabled: enabled})
+	}
+	for _, r := range l.Ranges {
+		rp := RangeProfile{
+			Index:            r.index(),
+			ReadLockEnabled:  r.ReadLockEnabled,
+			WriteLockEnabled: r.WriteLockEnabled,
+			LockOnReset:      append([]table.ResetType{}, r.LockOnReset...),
+			Name:             r.Name,
+		}
+		if !r.isGlobal {
+			rp.Start = r.Start
+			rp.Length = r.End - r.Start
+		}
+		sn.Ranges = append(sn.Ranges, rp)
+	}
+	return sn, nil
+}
+
+// Restore applies a snapshot with Provision, activating the Locking SP if
+// it is not active, e.g. after it has been reverted. The PINs are those the
+// Provision profile would take, the user PINs are left unchanged.
+func Restore(coreObj *core.Core, sn *Snapshot, sidPIN []byte, admin1PIN []byte, opts ...InitializeOpt) ([]string, error) {
+	mbrEnabled := sn.MBREnabled
+	return Provision(coreObj, &ProvisionProfile{
+		SIDPIN:     sidPIN,
+		Admin1PIN:  admin1PIN,
+		Users:      sn.Users,
+		Ranges:     sn.Ranges,
+		MBREnabled: &mbrEnabled,
+	}, opts...)
+}
@@ -0,0 +1,58 @@
+package locking
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive/sim"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	f := newSimFixture(t, sim.New())
+	l := f.lockingSP(t)
+	r, err := l.CreateRange(2048, 4096)
+	if err != nil {
+		t.Fatalf("CreateRange() failed: %v", err)
+	}
+	if err := r.Enable(true, true); err != nil {
+		t.Fatalf("Enable() failed: %v", err)
+	}
+	if err := r.SetName("data"); err != nil {
+		t.Fatalf("SetName() failed: %v", err)
+	}
+	if err := l.SetUserEnabled("User1", true); err != nil {
+		t.Fatalf("SetUserEnabled() failed: %v", err)
+	}
+	sn, err := l.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot() failed: %v", err)
+	}
+	b, err := json.Marshal(sn)
+	if err != nil {
+		t.Fatalf("json.Marshal() failed: %v", err)
+	}
+	if err := l.Revert(false); err != nil {
+		t.Fatalf("Revert() failed: %v", err)
+	}
+
+	restored := &Snapshot{}
+	if err := json.Unmarshal(b, restored); err != nil {
+		t.Fatalf("json.Unmarshal() failed: %v", err)
+	}
+	if _, err := Restore(f.c, restored, sidPIN, nil); err != nil {
+		t.Fatalf("Restore() failed: %v", err)
+	}
+	if _, f.lmeta, err = Initialize(f.c, WithAuth(DefaultAdminAuthority(sidPIN))); err != nil {
+		t.Fatalf("Initialize() failed: %v", err)
+	}
+	l = f.lockingSP(t)
+	r, ok := l.RangeByName("data")
+	if !ok || r.Start != 2048 || r.End != 6144 || !r.ReadLockEnabled || !r.WriteLockEnabled {
+		t.Errorf("restored range = %+v, %v", r, ok)
+	}
+	if enabled, err := table.Authority_GetEnabled(l.Session, uid.LockingAuthorityUser(1)); err != nil || !enabled {
+		t.Errorf("User1 enabled = %v (%v) after Restore()", enabled, err)
+	}
+}
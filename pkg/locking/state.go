@@ -0,0 +1,56 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package locking
+
+import (
+	"fmt"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+)
+
+// State is the locking state of a drive as reported by the Locking feature
+// of Level 0 Discovery.
+type State struct {
+	// The drive implements the Locking feature set
+	Supported bool
+	// The Locking SP is active and at least one range is lock enabled
+	Enabled bool
+	// At least one range is currently read or write locked
+	Locked     bool
+	MBREnabled bool
+	MBRDone    bool
+}
+
+// Shadowing returns whether the shadow MBR is currently presented to the
+// host instead of the user data.
+func (s State) Shadowing() bool {
+	return s.MBREnabled && !s.MBRDone
+}
+
+// StateFromDiscovery returns the locking state reported by d0. Drives without
+// the Locking feature report the zero State.
+func StateFromDiscovery(d0 *core.Level0Discovery) State {
+	if d0 == nil || d0.Locking == nil {
+		return State{}
+	}
+	l := d0.Locking
+	return State{
+		Supported:  l.LockingSupported,
+		Enabled:    l.LockingEnabled,
+		Locked:     l.Locked,
+		MBREnabled: l.MBREnabled,
+		MBRDone:    l.MBRDone,
+	}
+}
+
+// QueryState repeats Level 0 Discovery and returns the current locking state
+// of the drive. No session is opened and no authentication is needed, which
+// makes it suitable to check at boot whether a drive needs to be unlocked.
+func QueryState(coreObj *core.Core) (State, error) {
+	if err := coreObj.Discovery0(); err != nil {
+		return State{}, fmt.Errorf("Discovery0() failed: %v", err)
+	}
+	return StateFromDiscovery(coreObj.DiskInfo.Level0Discovery), nil
+}
@@ -0,0 +1,39 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Functions for managing the authorities of the Locking SP
+
+package locking
+
+import (
+	"fmt"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+)
+
+// SetUserEnabled enables or disables the named authority (e.g. "User1").
+// This requires the session to be authenticated as an Admin.
+func (l *LockingSP) SetUserEnabled(name string, enabled bool) error {
+	if err := l.checkWritable(); err != nil {
+		return err
+	}
+	auth, ok := AuthorityUIDFromName(name)
+	if !ok {
+		return fmt.Errorf("unknown authority %q", name)
+	}
+	return table.Authority_SetEnabled(l.Session, auth, enabled)
+}
+
+// SetPIN changes the credential of the named authority (e.g. "User1").
+func (l *LockingSP) SetPIN(name string, pin []byte) error {
+	if err := l.checkWritable(); err != nil {
+		return err
+	}
+	auth, ok := AuthorityUIDFromName(name)
+	if !ok {
+		return fmt.Errorf("unknown authority %q", name)
+	}
+	return table.C_PIN_SetPIN(l.Session, uid.C_PINRowForAuthority(auth), pin)
+}
@@ -0,0 +1,58 @@
+package locking
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive/sim"
+)
+
+func TestAddUser(t *testing.T) {
+	f := newSimFixture(t, sim.New())
+	users := []string{"User1", "User2"}
+	// Grant each user in its own session, as separate add-user calls do
+	for _, u := range users {
+		l := f.lockingSP(t)
+		if err := l.SetUserEnabled(u, true); err != nil {
+			t.Fatalf("SetUserEnabled(%s) failed: %v", u, err)
+		}
+		if err := l.SetPIN(u, []byte(u)); err != nil {
+			t.Fatalf("SetPIN(%s) failed: %v", u, err)
+		}
+		if err := l.GlobalRange.AddUser(u); err != nil {
+			t.Fatalf("AddUser(%s) failed: %v", u, err)
+		}
+		// Granting again does not change the ACE
+		if err := l.GlobalRange.AddUser(u); err != nil {
+			t.Fatalf("AddUser(%s) again failed: %v", u, err)
+		}
+		l.Close()
+	}
+
+	for _, u := range users {
+		a, _ := AuthorityFromName(u, []byte(u))
+		l, err := NewSession(f.cs, f.lmeta, a)
+		if err != nil {
+			t.Fatalf("NewSession() as %s failed: %v", u, err)
+		}
+		if err := l.GlobalRange.LockWrite(); err != nil {
+			t.Errorf("LockWrite() as %s failed: %v", u, err)
+		}
+		if err := l.GlobalRange.UnlockWrite(); err != nil {
+			t.Errorf("UnlockWrite() as %s failed: %v", u, err)
+		}
+		l.Close()
+	}
+
+	l := f.lockingSP(t)
+	auths, err := table.ACE_GetBooleanExpression(l.Session, uid.ACE_Locking_Range_Set_WrLocked(0))
+	if err != nil {
+		t.Fatalf("ACE_GetBooleanExpression() failed: %v", err)
+	}
+	want := []uid.AuthorityObjectUID{uid.AuthorityAdmins, uid.LockingAuthorityUser(1), uid.LockingAuthorityUser(2)}
+	if !reflect.DeepEqual(auths, want) {
+		t.Errorf("ACE_GetBooleanExpression() = %x, want %x", auths, want)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package metrics exports the locking state of TCG Storage devices as
+// Prometheus metrics, like tcgdiskstat does. The protocol-level events of a
+// device are exported by the coremetrics package instead.
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/locking"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	mDriveInfo = prometheus.NewDesc(
+		"tcg_storage_drive_info",
+		"Info metric regarding the detected drives",
+		[]string{"device", "model", "serial", "firmware", "protocol"}, nil,
+	)
+	mTCGSupported = prometheus.NewDesc(
+		"tcg_storage_supported",
+		"Boolean describing whether a drive supports any TCG storage standards",
+		[]string{"device"}, nil,
+	)
+	mSSCSupported = prometheus.NewDesc(
+		"tcg_storage_ssc_supported",
+		"Boolean describing whether a particular SSC is supported by the drive or not",
+		[]string{"device", "ssc"}, nil,
+	)
+	mLockingEnabled = prometheus.NewDesc(
+		"tcg_storage_locking_enabled",
+		"Boolean describing whether the drive is reporting range locking has been enabled",
+		[]string{"device"}, nil,
+	)
+	mLocked = prometheus.NewDesc(
+		"tcg_storage_locked",
+		"Boolean describing whether the drive is reporting that at least one range is locked",
+		[]string{"device"}, nil,
+	)
+	mMBRShadowing = prometheus.NewDesc(
+		"tcg_storage_mbr_shadowing",
+		"Boolean describing whether the drive is presenting the shadow MBR instead of the user data",
+		[]string{"device"}, nil,
+	)
+	mMBREnabled = prometheus.NewDesc(
+		"tcg_storage_mbr_enabled",
+		"Boolean describing whether the drive is reporting that the shadow MBR is enabled",
+		[]string{"device"}, nil,
+	)
+	mMBRDone = prometheus.NewDesc(
+		"tcg_storage_mbr_done",
+		"Boolean describing whether the drive is reporting that the shadow MBR is done, i.e. hidden",
+		[]string{"device"}, nil,
+	)
+	mSIDAuthBlocked = prometheus.NewDesc(
+		"tcg_storage_sid_authentication_blocked",
+		"Boolean describing if the Block SID feature has made authentication to the drive currently impossible",
+		[]string{"device"}, nil,
+	)
+	mDefaultSIDPIN = prometheus.NewDesc(
+		"tcg_storage_default_sid_pin_detected",
+		"Boolean describing if the Block SID feature reports the default SID PIN is in use",
+		[]string{"device"}, nil,
+	)
+	mProbeFailed = prometheus.NewDesc(
+		"tcg_storage_probe_failed",
+		"Boolean describing whether probing the device failed or timed out",
+		[]string{"device"}, nil,
+	)
+	mScrapeDuration = prometheus.NewDesc(
+		"tcg_storage_scrape_duration_seconds",
+		"Time it took to scan all devices",
+		nil, nil,
+	)
+	mScrapeErrors = prometheus.NewDesc(
+		"tcg_storage_scrape_errors",
+		"Number of devices that could not be probed during the scan",
+		nil, nil,
+	)
+)
+
+// Device is the state of a device as exported by the Collector.
+type Device struct {
+	Device   string
+	Identity *drive.Identity
+	// Level 0 Discovery, nil if the device does not support TCG Storage
+	Level0 *core.Level0Discovery
+	// Why probing the device failed, empty on success
+	Error string
+}
+
+type Devices []Device
+
+// Collector exports the state of devices, scanning them every time it is
+// collected.
+type Collector struct {
+	scan       func() (Devices, error)
+	timestamps bool
+	// Serializes concurrent scrapes, there is no point in probing the same
+	// drives in parallel.
+	mu sync.Mutex
+}
+
+type CollectorOpt func(c *Collector)
+
+// WithTimestamps adds the time of the scan as explicit timestamp to the
+// metrics of the devices.
+func WithTimestamps() CollectorOpt {
+	return func(c *Collector) {
+		c.timestamps = true
+	}
+}
+
+// NewCollector returns a collector exporting the devices returned by scan.
+// An error of scan is counted as a scrape error, the devices returned along
+// with it are exported nonetheless. Register it with prometheus.MustRegister.
+func NewCollector(scan func() (Devices, error), opts ...CollectorOpt) *Collector {
+	c := &Collector{scan: scan}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Describe sends no descriptors, the metrics depend on the devices found.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	start := time.Now()
+	devs, err := c.scan()
+	end := time.Now()
+	failed := 0
+	if err != nil {
+		failed++
+	}
+	for _, d := range devs {
+		if d.Error != "" {
+			failed++
+		}
+	}
+	for _, m := range DeviceMetrics(devs) {
+		if c.timestamps {
+			m = prometheus.NewMetricWithTimestamp(end, m)
+		}
+		ch <- m
+	}
+	ch <- prometheus.MustNewConstMetric(mScrapeDuration, prometheus.GaugeValue, end.Sub(start).Seconds())
+	ch <- prometheus.MustNewConstMetric(mScrapeErrors, prometheus.GaugeValue, float64(failed))
+}
+
+// DeviceMetrics returns the metrics describing the state of the devices.
+func DeviceMetrics(devs Devices) []prometheus.Metric {
+	var m []prometheus.Metric
+	for _, s := range devs {
+		failed := float64(0)
+		if s.Error != "" {
+			failed = 1
+		}
+		m = append(m, prometheus.MustNewConstMetric(mProbeFailed, prometheus.GaugeValue, failed, s.Device))
+		if s.Error != "" {
+			continue
+		}
+		if id := s.Identity; id != nil {
+			m = append(m,
+				prometheus.MustNewConstMetric(mDriveInfo, prometheus.GaugeValue, 1,
+					s.Device, id.Model, id.SerialNumber, id.Firmware, id.Protocol))
+		}
+		sup := float64(0)
+		if s.Level0 != nil {
+			sup = 1
+		}
+		m = append(m, prometheus.MustNewConstMetric(mTCGSupported, prometheus.GaugeValue, sup, s.Device))
+
+		// This is how far we can make it without a successful Level0 discovery
+		if s.Level0 == nil {
+			continue
+		}
+
+		for _, ssc := range core.GetCapabilities(s.Level0).SSCs {
+			m = append(m,
+				prometheus.MustNewConstMetric(mSSCSupported, prometheus.GaugeValue, 1,
+					s.Device, ssc))
+		}
+
+		ls := locking.StateFromDiscovery(s.Level0)
+		m = append(m, prometheus.MustNewConstMetric(mLockingEnabled, prometheus.GaugeValue, gauge(ls.Enabled), s.Device))
+		m = append(m, prometheus.MustNewConstMetric(mLocked, prometheus.GaugeValue, gauge(ls.Locked), s.Device))
+		m = append(m, prometheus.MustNewConstMetric(mMBRShadowing, prometheus.GaugeValue, gauge(ls.Shadowing()), s.Device))
+		m = append(m, prometheus.MustNewConstMetric(mMBREnabled, prometheus.GaugeValue, gauge(ls.MBREnabled), s.Device))
+		m = append(m, prometheus.MustNewConstMetric(mMBRDone, prometheus.GaugeValue, gauge(ls.MBRDone), s.Device))
+
+		if b := s.Level0.BlockSID; b != nil {
+			// Metrics only visible if Block SID feature is supported
+			m = append(m, prometheus.MustNewConstMetric(mSIDAuthBlocked, prometheus.GaugeValue, gauge(b.SIDAuthenticationBlockedState), s.Device))
+			m = append(m, prometheus.MustNewConstMetric(mDefaultSIDPIN, prometheus.GaugeValue, gauge(!b.SIDValueState), s.Device))
+		}
+	}
+	return m
+}
+
+func gauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/feature"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestCollector(t *testing.T) {
+	devs := Devices{
+		{
+			Device:   "/dev/sda",
+			Identity: &drive.Identity{},
+			Level0: &core.Level0Discovery{
+				Locking: &feature.Locking{LockingSupported: true, LockingEnabled: true, Locked: true, MBREnabled: true},
+			},
+		},
+		{Device: "/dev/sdb", Error: "timed out"},
+	}
+	want := map[*prometheus.Desc]float64{
+		mLocked:       1,
+		mMBREnabled:   1,
+		mMBRDone:      0,
+		mMBRShadowing: 1,
+		mScrapeErrors: 2,
+	}
+	for _, timestamps := range []bool{false, true} {
+		var opts []CollectorOpt
+		if timestamps {
+			opts = append(opts, WithTimestamps())
+		}
+		c := NewCollector(func() (Devices, error) { return devs, errors.New("listing devices failed") }, opts...)
+		ch := make(chan prometheus.Metric, 100)
+		c.Collect(ch)
+		close(ch)
+
+		found := map[*prometheus.Desc]bool{}
+		for m := range ch {
+			var pb dto.Metric
+			if err := m.Write(&pb); err != nil {
+				t.Fatalf("Write() failed: %v", err)
+			}
+			scrape := m.Desc() == mScrapeDuration || m.Desc() == mScrapeErrors
+			if (pb.TimestampMs != nil) != (timestamps && !scrape) {
+				t.Errorf("%s has timestamp %v with timestamps %v", m.Desc(), pb.TimestampMs, timestamps)
+			}
+			if v, ok := want[m.Desc()]; ok {
+				found[m.Desc()] = true
+				if got := pb.GetGauge().GetValue(); got != v {
+					t.Errorf("%s = %v, want %v", m.Desc(), got, v)
+				}
+			}
+		}
+		for d := range want {
+			if !found[d] {
+				t.Errorf("%s is missing", d)
+			}
+		}
+	}
+}
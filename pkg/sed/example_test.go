@@ -0,0 +1,46 @@
+package sed_test
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/sed"
+)
+
+func ExampleGetStatus() {
+	st, err := sed.GetStatus("/dev/nvme0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s: locking enabled: %v, locked: %v\n", st.Model, st.LockingEnabled, st.Locked)
+}
+
+func ExampleUnlock() {
+	pin, err := sed.HashPassword("/dev/nvme0", "secret")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := sed.Unlock("/dev/nvme0", pin); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func ExampleTakeOwnership() {
+	pin, err := sed.HashPassword("/dev/nvme0", "secret")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := sed.TakeOwnership("/dev/nvme0", pin); err != nil {
+		log.Fatal(err)
+	}
+	// Lock the drive now, it locks itself on every power cycle from now on
+	if err := sed.Lock("/dev/nvme0", pin); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func ExampleHashSedutilDTA() {
+	pin := sed.HashSedutilDTA("debug", "S3Z9NB0K123456")
+	fmt.Printf("%d byte PIN\n", len(pin))
+	// Output: 32 byte PIN
+}
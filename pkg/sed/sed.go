@@ -0,0 +1,177 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package sed provides task oriented functions to manage self encrypting
+// drives, for applications that do not want to deal with ComIDs, security
+// providers and sessions. Use the core and locking packages for anything
+// beyond that.
+//
+// PINs are passed to the drive as they are. Derive them with HashPassword to
+// interoperate with sedutil-cli and gosedctl.
+package sed
+
+import (
+	"crypto/sha1"
+	"fmt"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/locking"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Status is the state of a drive as reported by Level 0 Discovery.
+type Status struct {
+	Model        string
+	SerialNumber string
+	Firmware     string
+	// The drive implements the Locking feature set
+	LockingSupported bool
+	// The Locking SP is active and at least one range is lock enabled
+	LockingEnabled bool
+	// At least one range is locked
+	Locked     bool
+	MBREnabled bool
+	MBRDone    bool
+	// Whether ownership has been taken, nil if the drive does not report it
+	Owned *bool
+}
+
+// HashSedutilDTA derives a PIN from a password like sedutil-cli does, salted
+// with the serial number of the drive.
+func HashSedutilDTA(password string, serial string) []byte {
+	// This needs to match https://github.com/Drive-Trust-Alliance/sedutil/
+	salt := fmt.Sprintf("%-20s", serial)
+	return pbkdf2.Key([]byte(password), []byte(salt[:20]), 75000, 32, sha1.New)
+}
+
+// HashPassword derives the PIN for a password on the given device, see
+// HashSedutilDTA.
+func HashPassword(device string, password string) ([]byte, error) {
+	coreObj, err := core.NewCore(device)
+	if err != nil {
+		return nil, err
+	}
+	defer coreObj.Close()
+	serial, err := coreObj.SerialNumber()
+	if err != nil {
+		return nil, fmt.Errorf("coreObj.SerialNumber() failed: %v", err)
+	}
+	return HashSedutilDTA(password, string(serial)), nil
+}
+
+// GetStatus reads the status of a drive, no authentication is needed.
+func GetStatus(device string) (*Status, error) {
+	coreObj, err := core.NewCore(device)
+	if err != nil {
+		return nil, err
+	}
+	defer coreObj.Close()
+
+	d0 := coreObj.DiskInfo.Level0Discovery
+	st := &Status{
+		Model:        coreObj.DiskInfo.Identity.Model,
+		SerialNumber: coreObj.DiskInfo.Identity.SerialNumber,
+		Firmware:     coreObj.DiskInfo.Identity.Firmware,
+	}
+	ls := locking.StateFromDiscovery(d0)
+	st.LockingSupported = ls.Supported
+	st.LockingEnabled = ls.Enabled
+	st.Locked = ls.Locked
+	st.MBREnabled = ls.MBREnabled
+	st.MBRDone = ls.MBRDone
+	if b := d0.BlockSID; b != nil {
+		owned := b.SIDValueState
+		st.Owned = &owned
+	}
+	return st, nil
+}
+
+// Open a session to the Locking SP as its default administrator (Admin1 or
+// BandMaster0).
+func openLockingSP(device string, pin []byte) (*locking.LockingSP, func(), error) {
+	coreObj, err := core.NewCore(device)
+	if err != nil {
+		return nil, nil, err
+	}
+	cs, lmeta, err := locking.Initialize(coreObj)
+	if err != nil {
+		coreObj.Close()
+		return nil, nil, fmt.Errorf("locking.Initialize() failed: %w", err)
+	}
+	l, err := locking.NewSession(cs, lmeta, locking.DefaultAuthority(pin))
+	if err != nil {
+		cs.Close()
+		coreObj.Close()
+		return nil, nil, fmt.Errorf("locking.NewSession() failed: %w", err)
+	}
+	return l, func() {
+		l.Close()
+		cs.Close()
+		coreObj.Close()
+	}, nil
+}
+
+// Unlock unlocks reading and writing of all ranges and hides the shadow MBR,
+// so that the data of the drive becomes accessible until its next power
+// cycle.
+func Unlock(device string, pin []byte) error {
+	l, closer, err := openLockingSP(device, pin)
+	if err != nil {
+		return err
+	}
+	defer closer()
+	l.SetMBRDoneOnUnlock = true
+	for i, r := range l.Ranges {
+		if err := r.Unlock(true, true); err != nil {
+			return fmt.Errorf("unlock range %d failed: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// Lock locks reading and writing of all ranges.
+func Lock(device string, pin []byte) error {
+	l, closer, err := openLockingSP(device, pin)
+	if err != nil {
+		return err
+	}
+	defer closer()
+	for i, r := range l.Ranges {
+		if err := r.LockRead(); err != nil {
+			return fmt.Errorf("read lock range %d failed: %v", i, err)
+		}
+		if err := r.LockWrite(); err != nil {
+			return fmt.Errorf("write lock range %d failed: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// TakeOwnership sets the SID PIN of a drive in factory state and activates
+// its Locking SP with the same PIN for Admin1. Ranges are left unlocked, use
+// Lock, or the locking package to configure them. Calling it again on a
+// drive owned with the same PIN does nothing. Enterprise drives are not
+// supported.
+func TakeOwnership(device string, pin []byte) error {
+	coreObj, err := core.NewCore(device)
+	if err != nil {
+		return err
+	}
+	defer coreObj.Close()
+	if _, err := locking.Provision(coreObj, &locking.ProvisionProfile{SIDPIN: pin}); err != nil {
+		return fmt.Errorf("locking.Provision() failed: %w", err)
+	}
+	return nil
+}
+
+// Revert resets the drive to factory state, authenticating as SID. This
+// DESTROYS ALL DATA on the drive.
+func Revert(device string, pin []byte) error {
+	coreObj, err := core.NewCore(device)
+	if err != nil {
+		return err
+	}
+	defer coreObj.Close()
+	return locking.RevertTPer(coreObj, locking.DefaultAdminAuthority(pin))
+}
@@ -0,0 +1,98 @@
+// Copyright (c) 2022 by library authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package seagate implements the vendor specific operations of Seagate
+// drives. Importing it registers Ops with core.RegisterVendorOps:
+//
+//	for _, v := range coreObj.VendorOps() {
+//		if ops, ok := v.(seagate.Ops); ok {
+//			ports := ops.Ports(coreObj.DiskInfo.Level0Discovery)
+//		}
+//	}
+package seagate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/table"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive"
+)
+
+func init() {
+	core.RegisterVendorOps(Ops{})
+}
+
+// Ops are the operations of Seagate drives.
+type Ops struct{}
+
+func (Ops) Vendor() string {
+	return "Seagate"
+}
+
+func (Ops) Match(id *drive.Identity, d0 *core.Level0Discovery) bool {
+	if d0 != nil && d0.SeagatePorts != nil {
+		return true
+	}
+	if id == nil {
+		return false
+	}
+	// SCSI drives report "SEAGATE ST...", ATA drives only the model number
+	return strings.HasPrefix(id.Model, "SEAGATE ") || strings.HasPrefix(id.Model, "ST")
+}
+
+// Port is a port of the drive that can be locked, as reported by Level 0
+// Discovery.
+type Port struct {
+	// "fw-download", "uds", or the identifier in hex for unknown ports
+	Name       string
+	Identifier int32
+	Locked     bool
+	// Row of the Port table, not set for unknown ports
+	Row *uid.RowUID
+}
+
+var portNames = map[uid.RowUID]string{
+	uid.Seagate_Port_FWDownload: "fw-download",
+	uid.Seagate_Port_UDS:        "uds",
+}
+
+// Ports returns the ports reported by the drive.
+func (Ops) Ports(d0 *core.Level0Discovery) []Port {
+	if d0.SeagatePorts == nil {
+		return nil
+	}
+	var res []Port
+	for _, p := range d0.SeagatePorts.Ports {
+		port := Port{
+			Name:       fmt.Sprintf("0x%08x", uint32(p.PortIdentifier)),
+			Identifier: p.PortIdentifier,
+			Locked:     p.PortLocked != 0,
+		}
+		if row, ok := table.SeagatePortFromIdentifier(p.PortIdentifier); ok {
+			port.Name = portNames[row]
+			port.Row = &row
+		}
+		res = append(res, port)
+	}
+	return res
+}
+
+// PortByName returns the row of the Port table of the named port.
+func (Ops) PortByName(name string) (uid.RowUID, bool) {
+	for row, n := range portNames {
+		if n == name {
+			return row, true
+		}
+	}
+	return uid.RowUID{}, false
+}
+
+// SetPortLocked locks or unlocks a port. This requires s to be a session to
+// the Admin SP authenticated as SID.
+func (Ops) SetPortLocked(s *core.Session, row uid.RowUID, locked bool) error {
+	return table.Seagate_Port_SetLocked(s, row, locked)
+}
@@ -0,0 +1,51 @@
+package seagate
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/feature"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/core/uid"
+	"github.com/open-source-firmware/go-tcg-storage/pkg/drive"
+)
+
+func TestVendorOps(t *testing.T) {
+	ports := &feature.SeagatePorts{Ports: []feature.SeagatePort{
+		{PortIdentifier: 0x01000002, PortLocked: 1},
+		{PortIdentifier: 0x0100000E},
+		{PortIdentifier: 0x01000042},
+	}}
+	for _, tc := range []struct {
+		name  string
+		model string
+		d0    *core.Level0Discovery
+		match bool
+	}{
+		{"SAS", "SEAGATE ST4000NM0025", &core.Level0Discovery{}, true},
+		{"SATA", "ST4000NM0035-1V4107", &core.Level0Discovery{}, true},
+		{"ports feature", "Other", &core.Level0Discovery{SeagatePorts: ports}, true},
+		{"other vendor", "Samsung SSD 970 EVO Plus 1TB", &core.Level0Discovery{}, false},
+	} {
+		c := &core.Core{DiskInfo: core.DiskInfo{Identity: &drive.Identity{Model: tc.model}, Level0Discovery: tc.d0}}
+		found := false
+		for _, v := range c.VendorOps() {
+			if _, ok := v.(Ops); ok {
+				found = true
+			}
+		}
+		if found != tc.match {
+			t.Errorf("%s: Seagate ops found = %v, want %v", tc.name, found, tc.match)
+		}
+	}
+
+	fw, uds := uid.Seagate_Port_FWDownload, uid.Seagate_Port_UDS
+	want := []Port{
+		{Name: "fw-download", Identifier: 0x01000002, Locked: true, Row: &fw},
+		{Name: "uds", Identifier: 0x0100000E, Row: &uds},
+		{Name: "0x01000042", Identifier: 0x01000042},
+	}
+	if got := (Ops{}).Ports(&core.Level0Discovery{SeagatePorts: ports}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Ports() = %+v, want %+v", got, want)
+	}
+}